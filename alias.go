@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/settings"
+	"github.com/urfave/cli/v3"
+)
+
+// expandAlias replaces the command of args with the invocation of the alias of that name, the arguments after it
+// are appended, eg. `ios-debug --verbose`. Only one level is expanded and a command always wins over an alias, so
+// an alias can't loop or hide a command added in a later version.
+func expandAlias(app *cli.Command, args []string, aliases map[string]string) ([]string, error) {
+	// The global flags come before the command
+	position := slices.IndexFunc(args[1:], func(arg string) bool { return !strings.HasPrefix(arg, "-") }) + 1
+	if position == 0 {
+		return args, nil
+	}
+	name := args[position]
+	invocation, ok := aliases[name]
+	if !ok || app.Command(name) != nil {
+		return args, nil
+	}
+
+	words, err := splitWords(invocation)
+	if err != nil {
+		return nil, fmt.Errorf("alias %s: %w", name, err)
+	}
+	return slices.Concat(args[:position], words, args[position+1:]), nil
+}
+
+// splitWords splits the invocation the way a POSIX shell would, without the expansions: quotes group the words
+// and a backslash escapes the next character outside single quotes.
+func splitWords(invocation string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, escaped := false, false
+	var quote rune
+	for _, r := range invocation {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote in %s", invocation)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func aliasAdd(ctx context.Context, cliCmd *cli.Command) error {
+	args := cliCmd.Args().Slice()
+	if len(args) < 2 {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("alias name and invocation are required"))
+	}
+	// Unquoted invocations arrive as separate arguments
+	name, invocation := args[0], strings.Join(args[1:], " ")
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t\n") {
+		return failure.New(failure.Config, fmt.Errorf("invalid alias name: %q", name))
+	}
+	if cliCmd.Root().Command(name) != nil {
+		return failure.New(failure.Config, fmt.Errorf("%s is a command, choose another name", name))
+	}
+	words, err := splitWords(invocation)
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+	if len(words) == 0 {
+		return failure.New(failure.Config, fmt.Errorf("invocation is required"))
+	}
+
+	userSettings, err := settings.Load()
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+	if userSettings.Aliases == nil {
+		userSettings.Aliases = map[string]string{}
+	}
+	previous, replaced := userSettings.Aliases[name]
+	userSettings.Aliases[name] = invocation
+	if err := settings.Save(userSettings); err != nil {
+		return err
+	}
+
+	if replaced {
+		logger.Successf("Replaced the alias %s, it was: %s", name, previous)
+	} else {
+		logger.Successf("Added the alias %s, run it with `%s %s`", name, cliName, name)
+	}
+	return nil
+}
+
+func aliasList(ctx context.Context, cliCmd *cli.Command) error {
+	userSettings, err := settings.Load()
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+	if len(userSettings.Aliases) == 0 {
+		logger.Infof("No aliases, add one with `%s %s %s <NAME> <INVOCATION>`", cliName, aliasCommand, addCommand)
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(userSettings.Aliases)) {
+		line := fmt.Sprintf("%s = %s", name, userSettings.Aliases[name])
+		if cliCmd.Root().Command(name) != nil {
+			line += " (shadowed by the command of the same name)"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func aliasRemove(ctx context.Context, cliCmd *cli.Command) error {
+	name := cliCmd.Args().First()
+	if name == "" {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("alias name is required"))
+	}
+
+	userSettings, err := settings.Load()
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+	if _, ok := userSettings.Aliases[name]; !ok {
+		return failure.New(failure.Config, fmt.Errorf("no alias named %s, see `%s %s`", name, aliasCommand, listCommand))
+	}
+	delete(userSettings.Aliases, name)
+	if err := settings.Save(userSettings); err != nil {
+		return err
+	}
+	logger.Successf("Removed the alias %s", name)
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		name       string
+		invocation string
+		want       []string
+		wantErr    bool
+	}{
+		{name: "words", invocation: "debug  --verbose\tios", want: []string{"debug", "--verbose", "ios"}},
+		{name: "double quotes", invocation: `run "make test"`, want: []string{"run", "make test"}},
+		{name: "single quotes keep backslashes", invocation: `run 'a\b'`, want: []string{"run", `a\b`}},
+		{name: "escaped space", invocation: `open my\ project`, want: []string{"open", "my project"}},
+		{name: "empty quotes", invocation: `run ""`, want: []string{"run", ""}},
+		{name: "quotes inside a word", invocation: `--password=se"c r"et`, want: []string{"--password=sec ret"}},
+		{name: "empty", invocation: " ", want: nil},
+		{name: "unterminated quote", invocation: `run "make`, wantErr: true},
+		{name: "trailing backslash", invocation: `run \`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			words, err := splitWords(tt.invocation)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("splitWords(%q) succeeded, want an error", tt.invocation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(words, tt.want) {
+				t.Errorf("splitWords(%q) = %q, want %q", tt.invocation, words, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandAlias(t *testing.T) {
+	app := &cli.Command{Commands: []*cli.Command{{Name: "pull"}}}
+	aliases := map[string]string{
+		"ios":  `open vscode --folder "~/my app"`,
+		"pull": "push",
+		"bad":  `open "vscode`,
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "alias with arguments after it",
+			args: []string{"cli", "ios", "--verbose"},
+			want: []string{"cli", "open", "vscode", "--folder", "~/my app", "--verbose"},
+		},
+		{
+			name: "global flags before the alias",
+			args: []string{"cli", "--quiet", "ios"},
+			want: []string{"cli", "--quiet", "open", "vscode", "--folder", "~/my app"},
+		},
+		{
+			name: "command wins over the alias",
+			args: []string{"cli", "pull", "a.txt"},
+			want: []string{"cli", "pull", "a.txt"},
+		},
+		{
+			name: "unknown name",
+			args: []string{"cli", "shell"},
+			want: []string{"cli", "shell"},
+		},
+		{
+			name: "no command",
+			args: []string{"cli", "--version"},
+			want: []string{"cli", "--version"},
+		},
+		{
+			name:    "invalid invocation",
+			args:    []string{"cli", "bad"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := expandAlias(app, tt.args, aliases)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expandAlias(%q) succeeded, want an error", tt.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(args, tt.want) {
+				t.Errorf("expandAlias(%q) = %q, want %q", tt.args, args, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/urfave/cli/v3"
+)
+
+func command(name, usage string, aliases []string) *cli.Command {
+	return &cli.Command{
+		Name:            name,
+		Usage:           usage,
+		UsageText:       usageTextForCommand(name),
+		Action:          entry,
+		Aliases:         aliases,
+		Description:     "You need to add SSH arguments to connect to the remote server",
+		Flags:           flags,
+		SkipFlagParsing: true,
+	}
+}
+
+func usageTextForCommand(command string) string {
+	if command == openCommand {
+		command += " <IDE>[,<IDE>...]"
+	}
+	return fmt.Sprintf("%s %s --%s <HOSTNAME> --%s <PORT> --%s <USER> --%s <PASSWORD>\n%s %s <USER>@<HOSTNAME>:<PORT> --%s <PASSWORD>", cliName, command, sshHostFlag, sshPortFlag, sshUserFlag, sshPasswordFlag, cliName, command, sshPasswordFlag)
+}
+
+// built in flag parsing cannot ignore unknown flags AND set the required ones
+// at the same time, so we need to parse the args manually.
+// Values can be given as --flag value or --flag=value, the value of a string flag is taken as it is even if it
+// starts with a dash (eg. a password). Bool flags accept --flag=false. A repeated flag keeps its last value and
+// everything after -- is ignored. An unknown flag is ignored with its value, the arguments that are not flags are
+// returned in order.
+func parseArgs(args []string, flags []cli.Flag) (map[string]string, []string, error) {
+	parsed := make(map[string]string)
+	validFlags := make(map[string]bool)
+	boolFlags := make(map[string]bool)
+	flagAliases := make(map[string]string)
+
+	for _, flag := range flags {
+		switch f := flag.(type) {
+		case *cli.StringFlag:
+			validFlags[f.Name] = true
+			for _, alias := range f.Aliases {
+				validFlags[alias] = true
+				flagAliases[alias] = f.Name
+			}
+		case *cli.BoolFlag:
+			validFlags[f.Name] = true
+			boolFlags[f.Name] = true
+			for _, alias := range f.Aliases {
+				validFlags[alias] = true
+				flagAliases[alias] = f.Name
+			}
+		}
+	}
+
+	ignoredFlags := []string{}
+	var positional []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if alias, exists := flagAliases[key]; exists {
+			key = alias
+		}
+
+		switch {
+		case boolFlags[key]:
+			enabled := true
+			if hasValue {
+				var err error
+				if enabled, err = strconv.ParseBool(unquote(value)); err != nil {
+					return nil, nil, fmt.Errorf("invalid value for --%s: %q", key, value)
+				}
+			}
+			if enabled {
+				parsed[key] = "true"
+			} else {
+				delete(parsed, key)
+			}
+		case validFlags[key]:
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, nil, fmt.Errorf("--%s needs a value", key)
+				}
+				i++ // next will be value
+				value = args[i]
+			}
+			parsed[key] = unquote(value)
+		default:
+			// The value of an unknown flag is skipped too, so it isn't taken as the target, eg. --forward 8080:localhost:8080
+			if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+			}
+			ignoredFlags = append(ignoredFlags, key)
+		}
+	}
+
+	if len(ignoredFlags) > 0 {
+		logger.Warnf("Ignored unknown flags: %v", ignoredFlags)
+	}
+
+	return parsed, positional, nil
+}
+
+// applyEnvVars sets the flags that are not passed from their environment variables.
+func applyEnvVars(parsed map[string]string, flags []cli.Flag) {
+	for _, flag := range flags {
+		if f, ok := flag.(*cli.StringFlag); ok {
+			if _, set := parsed[f.Name]; !set {
+				if value, found := f.Sources.Lookup(); found {
+					parsed[f.Name] = value
+				}
+			}
+		}
+	}
+}
+
+// applyTarget sets the connection flags that are not passed from a [user@]host[:port] argument, like the
+// destination of ssh. IPv6 addresses with a port are written in brackets, eg. [::1]:2222, other targets with more
+// than one colon or with spaces are rejected.
+func applyTarget(parsed map[string]string, target string) error {
+	user, hostPort, hasUser := strings.Cut(target, "@")
+	if !hasUser {
+		hostPort = user
+		user = ""
+	}
+
+	invalid := fmt.Errorf("invalid target %q, expected [user@]host[:port]", target)
+	if strings.ContainsFunc(target, unicode.IsSpace) {
+		return invalid
+	}
+	host, port := hostPort, ""
+	switch {
+	case strings.HasPrefix(hostPort, "["):
+		var err error
+		if host, port, err = net.SplitHostPort(hostPort); err != nil {
+			if !strings.HasSuffix(hostPort, "]") {
+				return invalid
+			}
+			host, port = strings.TrimSuffix(strings.TrimPrefix(hostPort, "["), "]"), ""
+		}
+		if net.ParseIP(host) == nil {
+			return invalid
+		}
+	case strings.Count(hostPort, ":") == 1:
+		var err error
+		if host, port, err = net.SplitHostPort(hostPort); err != nil {
+			return invalid
+		}
+	case strings.Contains(hostPort, ":") && net.ParseIP(hostPort) == nil:
+		// Only an IPv6 address has more colons, eg. a port forward spec is not a target
+		return invalid
+	}
+	if host == "" || (hasUser && user == "") {
+		return invalid
+	}
+	if port != "" {
+		if _, err := strconv.Atoi(port); err != nil {
+			return fmt.Errorf("invalid port in target %q", target)
+		}
+	}
+
+	for flag, value := range map[string]string{sshHostFlag: host, sshPortFlag: port, sshUserFlag: user} {
+		if _, set := parsed[flag]; !set && value != "" {
+			parsed[flag] = value
+		}
+	}
+	return nil
+}
+
+// shellJoin quotes the arguments that a POSIX shell would split or expand.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`*?[]{}()<>|&;~#!") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// unquote removes the quotes around a value that were not removed by a shell, eg. when the command is copied
+// into a launcher that passes the arguments as they are.
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
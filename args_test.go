@@ -0,0 +1,233 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+func TestParseArgs(t *testing.T) {
+	flags := []cli.Flag{
+		&cli.StringFlag{Name: "host"},
+		&cli.StringFlag{Name: "port", Aliases: []string{"p"}},
+		&cli.StringFlag{Name: "password"},
+		&cli.BoolFlag{Name: "verbose", Aliases: []string{"v"}},
+	}
+
+	tests := []struct {
+		name           string
+		args           []string
+		wantParsed     map[string]string
+		wantPositional []string
+		wantErr        bool
+	}{
+		{
+			name:       "value after the flag",
+			args:       []string{"--host", "10.0.0.1", "--port", "22"},
+			wantParsed: map[string]string{"host": "10.0.0.1", "port": "22"},
+		},
+		{
+			name:       "value joined with =",
+			args:       []string{"--host=10.0.0.1", "-p=22"},
+			wantParsed: map[string]string{"host": "10.0.0.1", "port": "22"},
+		},
+		{
+			name:       "= in a joined value",
+			args:       []string{"--password=a=b="},
+			wantParsed: map[string]string{"password": "a=b="},
+		},
+		{
+			name:       "value starting with a dash",
+			args:       []string{"--password", "-secret", "--port", "-1"},
+			wantParsed: map[string]string{"password": "-secret", "port": "-1"},
+		},
+		{
+			name:       "repeated flag keeps the last value",
+			args:       []string{"--host", "10.0.0.1", "--host=10.0.0.2"},
+			wantParsed: map[string]string{"host": "10.0.0.2"},
+		},
+		{
+			name:       "bool flag",
+			args:       []string{"-v"},
+			wantParsed: map[string]string{"verbose": "true"},
+		},
+		{
+			name:       "bool flag turned off again",
+			args:       []string{"--verbose", "--verbose=false"},
+			wantParsed: map[string]string{},
+		},
+		{
+			name:           "everything after -- is ignored",
+			args:           []string{"vscode", "--", "--host", "10.0.0.1", "shell"},
+			wantParsed:     map[string]string{},
+			wantPositional: []string{"vscode"},
+		},
+		{
+			name:       "double quoted value",
+			args:       []string{"--password", `"se cret"`},
+			wantParsed: map[string]string{"password": "se cret"},
+		},
+		{
+			name:       "single quoted joined value",
+			args:       []string{"--password='se cret'"},
+			wantParsed: map[string]string{"password": "se cret"},
+		},
+		{
+			name:       "unbalanced quotes are kept",
+			args:       []string{`--password="secret`},
+			wantParsed: map[string]string{"password": `"secret`},
+		},
+		{
+			name:           "positional arguments in order",
+			args:           []string{"vagrant@10.0.0.1", "--host", "10.0.0.2", "-", "vscode"},
+			wantParsed:     map[string]string{"host": "10.0.0.2"},
+			wantPositional: []string{"vagrant@10.0.0.1", "-", "vscode"},
+		},
+		{
+			name:       "unknown flags are ignored",
+			args:       []string{"--unknown", "--host", "10.0.0.1"},
+			wantParsed: map[string]string{"host": "10.0.0.1"},
+		},
+		{
+			name:       "value of an unknown flag is ignored",
+			args:       []string{"--forward", "8080:localhost:8080", "--host", "10.0.0.1"},
+			wantParsed: map[string]string{"host": "10.0.0.1"},
+		},
+		{
+			name:           "joined value of an unknown flag is ignored",
+			args:           []string{"--forward=8080:localhost:8080", "vagrant@10.0.0.1"},
+			wantParsed:     map[string]string{},
+			wantPositional: []string{"vagrant@10.0.0.1"},
+		},
+		{
+			name:    "missing value",
+			args:    []string{"--host"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid bool value",
+			args:    []string{"--verbose=maybe"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, positional, err := parseArgs(tt.args, flags)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseArgs(%q) succeeded, want an error", tt.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(parsed, tt.wantParsed) {
+				t.Errorf("parseArgs(%q) flags = %v, want %v", tt.args, parsed, tt.wantParsed)
+			}
+			if !slices.Equal(positional, tt.wantPositional) {
+				t.Errorf("parseArgs(%q) positional = %q, want %q", tt.args, positional, tt.wantPositional)
+			}
+		})
+	}
+}
+
+func TestApplyTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		parsed  map[string]string
+		target  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "user, host and port",
+			target: "vagrant@10.0.0.1:2222",
+			want:   map[string]string{"user": "vagrant", "host": "10.0.0.1", "port": "2222"},
+		},
+		{
+			name:   "host only",
+			target: "mac.local",
+			want:   map[string]string{"host": "mac.local"},
+		},
+		{
+			name:   "IPv6 address with a port",
+			target: "vagrant@[::1]:2222",
+			want:   map[string]string{"user": "vagrant", "host": "::1", "port": "2222"},
+		},
+		{
+			name:   "IPv6 address in brackets",
+			target: "[fe80::1]",
+			want:   map[string]string{"host": "fe80::1"},
+		},
+		{
+			name:   "IPv6 address",
+			target: "fe80::1",
+			want:   map[string]string{"host": "fe80::1"},
+		},
+		{
+			name:   "flags win over the target",
+			parsed: map[string]string{"host": "10.0.0.2", "port": "22"},
+			target: "vagrant@10.0.0.1:2222",
+			want:   map[string]string{"user": "vagrant", "host": "10.0.0.2", "port": "22"},
+		},
+		{
+			name:    "port forward spec",
+			target:  "8080:localhost:8080",
+			wantErr: true,
+		},
+		{
+			name:    "space in the target",
+			target:  "vagrant@10.0.0.1 2222",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed bracket",
+			target:  "[::1",
+			wantErr: true,
+		},
+		{
+			name:    "host name in brackets",
+			target:  "[mac.local]:22",
+			wantErr: true,
+		},
+		{
+			name:    "invalid port",
+			target:  "10.0.0.1:ssh",
+			wantErr: true,
+		},
+		{
+			name:    "empty user",
+			target:  "@10.0.0.1",
+			wantErr: true,
+		},
+		{
+			name:    "empty host",
+			target:  "vagrant@:22",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := maps.Clone(tt.parsed)
+			if parsed == nil {
+				parsed = map[string]string{}
+			}
+			err := applyTarget(parsed, tt.target)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("applyTarget(%q) succeeded, want an error", tt.target)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(parsed, tt.want) {
+				t.Errorf("applyTarget(%q) = %v, want %v", tt.target, parsed, tt.want)
+			}
+		})
+	}
+}
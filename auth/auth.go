@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/bitrise"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+)
+
+const profilesFileName = "auth.json"
+
+// Profile is a named API token, the token itself is kept in the keychain.
+type Profile struct {
+	Name string `json:"name"`
+	// Workspace is the slug of the Bitrise workspace the token is used with, informational only
+	Workspace string `json:"workspace,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+type profiles struct {
+	Current  string    `json:"current"`
+	Profiles []Profile `json:"profiles"`
+}
+
+// Login stores the token under the name and makes it the current one.
+func Login(profile Profile, token string) error {
+	if err := storeToken(profile.Name, token); err != nil {
+		return fmt.Errorf("store token: %w", err)
+	}
+
+	state, err := read()
+	if err != nil {
+		return err
+	}
+
+	state.Profiles = slices.DeleteFunc(state.Profiles, func(p Profile) bool { return p.Name == profile.Name })
+	state.Profiles = append(state.Profiles, profile)
+	state.Current = profile.Name
+	return write(state)
+}
+
+// List returns the stored profiles and the name of the current one.
+func List() ([]Profile, string, error) {
+	state, err := read()
+	if err != nil {
+		return nil, "", err
+	}
+	return state.Profiles, state.Current, nil
+}
+
+// Switch makes the named profile the current one.
+func Switch(name string) error {
+	state, err := read()
+	if err != nil {
+		return err
+	}
+
+	if !slices.ContainsFunc(state.Profiles, func(p Profile) bool { return p.Name == name }) {
+		return fmt.Errorf("no profile named %s, see `auth list`", name)
+	}
+	state.Current = name
+	return write(state)
+}
+
+// Token returns the API token to use: $BITRISE_API_TOKEN takes precedence over the current profile.
+// It is empty if neither is set.
+func Token() (string, error) {
+	if token := bitrise.TokenFromEnv(); token != "" {
+		return token, nil
+	}
+
+	state, err := read()
+	if err != nil || state.Current == "" {
+		return "", err
+	}
+
+	token, err := loadToken(state.Current)
+	if err != nil {
+		return "", fmt.Errorf("load token of profile %s: %w", state.Current, err)
+	}
+	return token, nil
+}
+
+func profilesPath() string {
+	return filepath.Join(paths.ConfigDir(), profilesFileName)
+}
+
+func read() (profiles, error) {
+	var state profiles
+
+	content, err := os.ReadFile(profilesPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("read profiles: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &state); err != nil {
+		return state, fmt.Errorf("decode profiles: %w", err)
+	}
+	return state, nil
+}
+
+func write(state profiles) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode profiles: %w", err)
+	}
+
+	path := profilesPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("write profiles: %w", err)
+	}
+	return nil
+}
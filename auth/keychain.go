@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+)
+
+const (
+	keychainService = "bitrise-remote-access"
+	// tokensFileName is only used where no keychain is available, eg. Windows or headless Linux
+	tokensFileName = "tokens.json"
+)
+
+// storeToken saves the token in the macOS Keychain or the Secret Service on Linux,
+// falling back to a file readable only by the user.
+func storeToken(name, token string) error {
+	switch {
+	case runtime.GOOS == "darwin":
+		// -U updates the existing item of a repeated login
+		return exec.Command("security", "add-generic-password", "-U", "-s", keychainService, "-a", name, "-w", token).Run()
+	case hasSecretTool():
+		cmd := exec.Command("secret-tool", "store", "--label", fmt.Sprintf("Bitrise remote access (%s)", name), "service", keychainService, "account", name)
+		cmd.Stdin = strings.NewReader(token)
+		return cmd.Run()
+	default:
+		tokens, err := readTokensFile()
+		if err != nil {
+			return err
+		}
+		tokens[name] = token
+		return writeTokensFile(tokens)
+	}
+}
+
+func loadToken(name string) (string, error) {
+	var out []byte
+	var err error
+
+	switch {
+	case runtime.GOOS == "darwin":
+		out, err = exec.Command("security", "find-generic-password", "-s", keychainService, "-a", name, "-w").Output()
+	case hasSecretTool():
+		out, err = exec.Command("secret-tool", "lookup", "service", keychainService, "account", name).Output()
+	default:
+		tokens, err := readTokensFile()
+		if err != nil {
+			return "", err
+		}
+		token, ok := tokens[name]
+		if !ok {
+			return "", fmt.Errorf("no token stored")
+		}
+		return token, nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func deleteToken(name string) error {
+	switch {
+	case runtime.GOOS == "darwin":
+		return exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", name).Run()
+	case hasSecretTool():
+		return exec.Command("secret-tool", "clear", "service", keychainService, "account", name).Run()
+	default:
+		tokens, err := readTokensFile()
+		if err != nil {
+			return err
+		}
+		delete(tokens, name)
+		return writeTokensFile(tokens)
+	}
+}
+
+// UsesKeychain reports whether tokens are kept in the system keychain instead of a plain file.
+func UsesKeychain() bool {
+	return runtime.GOOS == "darwin" || hasSecretTool()
+}
+
+func hasSecretTool() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	_, err := exec.LookPath("secret-tool")
+	return err == nil
+}
+
+func tokensPath() string {
+	return filepath.Join(paths.StateDir(), tokensFileName)
+}
+
+func readTokensFile() (map[string]string, error) {
+	tokens := map[string]string{}
+
+	content, err := os.ReadFile(tokensPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &tokens); err != nil {
+		return nil, fmt.Errorf("decode tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func writeTokensFile(tokens map[string]string) error {
+	content, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	path := tokensPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0600)
+}
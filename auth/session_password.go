@@ -0,0 +1,34 @@
+package auth
+
+import "fmt"
+
+// sessionPasswordAccount is the keychain account of the SSH password, only the password of the last session is kept.
+const sessionPasswordAccount = "ssh-session-password"
+
+// StoreSessionPassword keeps the SSH password of the current session, so later commands don't have to ask for it.
+func StoreSessionPassword(password string) error {
+	if err := storeToken(sessionPasswordAccount, password); err != nil {
+		return fmt.Errorf("store session password: %w", err)
+	}
+	return nil
+}
+
+// SessionPassword returns the stored SSH password of the current session, if any.
+func SessionPassword() (string, bool) {
+	password, err := loadToken(sessionPasswordAccount)
+	if err != nil || password == "" {
+		return "", false
+	}
+	return password, true
+}
+
+// ForgetSessionPassword removes the stored SSH password, a missing one is not an error.
+func ForgetSessionPassword() error {
+	if _, ok := SessionPassword(); !ok {
+		return nil
+	}
+	if err := deleteToken(sessionPasswordAccount); err != nil {
+		return fmt.Errorf("remove session password: %w", err)
+	}
+	return nil
+}
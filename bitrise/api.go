@@ -0,0 +1,92 @@
+package bitrise
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	apiBaseURL = "https://api.bitrise.io/v0.1"
+	// TokenEnvVar holds the personal access token used for the API-driven features
+	TokenEnvVar = "BITRISE_API_TOKEN"
+
+	requestTimeout = 30 * time.Second
+)
+
+// Client is a minimal client of the Bitrise API.
+type Client struct {
+	token      string
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewClient(token string) *Client {
+	return &Client{
+		token:      token,
+		baseURL:    apiBaseURL,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// TokenFromEnv returns the API token from the environment, empty if not set.
+func TokenFromEnv() string {
+	return os.Getenv(TokenEnvVar)
+}
+
+func jsonBody(payload any) (io.Reader, error) {
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	return bytes.NewReader(content), nil
+}
+
+func (c *Client) get(path string, query url.Values, result any) error {
+	return c.do(http.MethodGet, path, query, nil, result)
+}
+
+func (c *Client) do(method, path string, query url.Values, body io.Reader, result any) error {
+	requestURL := c.baseURL + path
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, requestURL, body)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, content)
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(content, result); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package bitrise
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	BuildStatusRunning = 0
+	BuildStatusSuccess = 1
+	BuildStatusFailed  = 2
+	BuildStatusAborted = 3
+
+	// RemoteAccessGracePeriod is how long the VM stays available after the build finished
+	RemoteAccessGracePeriod = 10 * time.Minute
+)
+
+type Build struct {
+	Slug              string     `json:"slug"`
+	BuildNumber       int        `json:"build_number"`
+	Status            int        `json:"status"`
+	StatusText        string     `json:"status_text"`
+	TriggeredWorkflow string     `json:"triggered_workflow"`
+	Branch            string     `json:"branch"`
+	TriggeredAt       *time.Time `json:"triggered_at"`
+	StartedAt         *time.Time `json:"started_on_worker_at"`
+	FinishedAt        *time.Time `json:"finished_at"`
+	// App is only set in the lists of every app's builds
+	App *BuildApp `json:"repository,omitempty"`
+}
+
+// BuildApp is the app a build belongs to.
+type BuildApp struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+type buildResponse struct {
+	Data Build `json:"data"`
+}
+
+type buildsResponse struct {
+	Data []Build `json:"data"`
+}
+
+// Build returns the build of the app.
+func (c *Client) Build(appSlug, buildSlug string) (*Build, error) {
+	var response buildResponse
+	if err := c.get(fmt.Sprintf("/apps/%s/builds/%s", appSlug, buildSlug), nil, &response); err != nil {
+		return nil, fmt.Errorf("get build %s: %w", buildSlug, err)
+	}
+	return &response.Data, nil
+}
+
+// RunningBuilds returns the running builds of every app the user has access to.
+func (c *Client) RunningBuilds() ([]Build, error) {
+	var response buildsResponse
+	query := url.Values{"status": {strconv.Itoa(BuildStatusRunning)}}
+	if err := c.get("/builds", query, &response); err != nil {
+		return nil, fmt.Errorf("list running builds: %w", err)
+	}
+	return response.Data, nil
+}
+
+// RemoteAccessExpiry returns when the build's VM goes away, false while the build is running as its end is unknown.
+func (b *Build) RemoteAccessExpiry() (time.Time, bool) {
+	if b.Status == BuildStatusRunning || b.FinishedAt == nil {
+		return time.Time{}, false
+	}
+	return b.FinishedAt.Add(RemoteAccessGracePeriod), true
+}
+
+// RemoteAccessProblem explains why the build's VM can't be reached, nil if it should be reachable.
+func (b *Build) RemoteAccessProblem(now time.Time) error {
+	if b.Status == BuildStatusRunning {
+		if b.StartedAt == nil {
+			return fmt.Errorf("build #%d is still waiting for a VM, try again when it has started", b.BuildNumber)
+		}
+		return nil
+	}
+
+	if b.FinishedAt == nil {
+		return fmt.Errorf("build #%d is %s", b.BuildNumber, b.StatusText)
+	}
+
+	since := now.Sub(*b.FinishedAt)
+	if since > RemoteAccessGracePeriod {
+		return fmt.Errorf("build #%d finished %s ago, remote access is only available for %s after the build", b.BuildNumber, since.Round(time.Minute), RemoteAccessGracePeriod)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package bitrise
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RemoteAccess holds the SSH connection parameters of a build's VM.
+type RemoteAccess struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type remoteAccessResponse struct {
+	Data RemoteAccess `json:"data"`
+}
+
+// AccessToken is a short-lived credential of a build's VM, accepted by its sshd in place of the password.
+type AccessToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type accessTokenResponse struct {
+	Data AccessToken `json:"data"`
+}
+
+type rebuildRequest struct {
+	WithRemoteAccess bool `json:"with_remote_access"`
+}
+
+// RebuildWithRemoteAccess re-triggers the build's workflow on the same commit with remote access enabled.
+func (c *Client) RebuildWithRemoteAccess(appSlug, buildSlug string) (*Build, error) {
+	body, err := jsonBody(rebuildRequest{WithRemoteAccess: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var response buildResponse
+	if err := c.do("POST", fmt.Sprintf("/apps/%s/builds/%s/rebuild", appSlug, buildSlug), nil, body, &response); err != nil {
+		return nil, fmt.Errorf("rebuild %s: %w", buildSlug, err)
+	}
+	return &response.Data, nil
+}
+
+// RemoteAccess returns the connection parameters of the build, available once its VM accepts SSH connections.
+func (c *Client) RemoteAccess(appSlug, buildSlug string) (*RemoteAccess, error) {
+	var response remoteAccessResponse
+	if err := c.get(fmt.Sprintf("/apps/%s/builds/%s/remote-access", appSlug, buildSlug), nil, &response); err != nil {
+		return nil, fmt.Errorf("get remote access of build %s: %w", buildSlug, err)
+	}
+	if response.Data.Host == "" {
+		return nil, fmt.Errorf("remote access of build %s is not ready yet", buildSlug)
+	}
+	return &response.Data, nil
+}
+
+// RemoteAccessToken issues a new access token for the VM of the build, so no static password has to be kept.
+func (c *Client) RemoteAccessToken(appSlug, buildSlug string) (*AccessToken, error) {
+	var response accessTokenResponse
+	if err := c.do("POST", fmt.Sprintf("/apps/%s/builds/%s/remote-access/token", appSlug, buildSlug), nil, nil, &response); err != nil {
+		return nil, fmt.Errorf("get remote access token of build %s: %w", buildSlug, err)
+	}
+	if response.Data.Token == "" {
+		return nil, fmt.Errorf("no remote access token issued for build %s", buildSlug)
+	}
+	return &response.Data, nil
+}
+
+// WaitForRemoteAccess polls the build until its connection parameters are available.
+// onPoll is called before every attempt with the time spent waiting so far.
+func (c *Client) WaitForRemoteAccess(appSlug, buildSlug string, interval, timeout time.Duration, onPoll func(elapsed time.Duration)) (*RemoteAccess, error) {
+	start := time.Now()
+	for {
+		onPoll(time.Since(start))
+
+		access, err := c.RemoteAccess(appSlug, buildSlug)
+		if err == nil {
+			return access, nil
+		}
+
+		build, buildErr := c.Build(appSlug, buildSlug)
+		if buildErr == nil && build.Status != BuildStatusRunning {
+			return nil, fmt.Errorf("build #%d is %s, its VM is not available", build.BuildNumber, strings.ToLower(build.StatusText))
+		}
+
+		if time.Since(start) > timeout {
+			return nil, fmt.Errorf("build %s was not ready for remote access in %s: %w", buildSlug, timeout, err)
+		}
+		time.Sleep(interval)
+	}
+}
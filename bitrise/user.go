@@ -0,0 +1,21 @@
+package bitrise
+
+import "fmt"
+
+type User struct {
+	Slug     string `json:"slug"`
+	Username string `json:"username"`
+}
+
+type userResponse struct {
+	Data User `json:"data"`
+}
+
+// CurrentUser returns the owner of the token, it is used to validate tokens.
+func (c *Client) CurrentUser() (*User, error) {
+	var response userResponse
+	if err := c.get("/me", nil, &response); err != nil {
+		return nil, fmt.Errorf("get current user: %w", err)
+	}
+	return &response.Data, nil
+}
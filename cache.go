@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/urfave/cli/v3"
+)
+
+func cacheList(ctx context.Context, cliCmd *cli.Command) error {
+	entries, err := ssh.ListCache(passwordFlag(cliCmd))
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		logger.Info("No build cache found on the VM")
+		return nil
+	}
+
+	for i, entry := range entries {
+		kind := "path"
+		if entry.Archive {
+			kind = "archive"
+		}
+		size := "missing"
+		if entry.SizeKB >= 0 {
+			size = fmt.Sprintf("%d KB", entry.SizeKB)
+		}
+		fmt.Printf("%3d  %-7s  %10s  %s\n", i+1, kind, size, entry.Path)
+	}
+	return nil
+}
+
+func cacheDownload(ctx context.Context, cliCmd *cli.Command) error {
+	args := cliCmd.Args().Slice()
+	if len(args) != 2 {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("expected a cache entry and a local path"))
+	}
+
+	password := passwordFlag(cliCmd)
+	cachePaths, err := resolveCacheEntries(args[:1], password)
+	if err != nil {
+		return err
+	}
+
+	if err := ssh.Pull(cachePaths[0], args[1], password, ssh.TransferOptions{}); err != nil {
+		return failure.New(failure.Network, err)
+	}
+	logger.Successf("%s downloaded to %s", cachePaths[0], args[1])
+	return nil
+}
+
+func cachePurge(ctx context.Context, cliCmd *cli.Command) error {
+	password := passwordFlag(cliCmd)
+	cachePaths, err := resolveCacheEntries(cliCmd.Args().Slice(), password)
+	if err != nil {
+		return err
+	}
+	if len(cachePaths) == 0 {
+		logger.Info("No build cache found on the VM")
+		return nil
+	}
+
+	if !cliCmd.Bool(yesFlag) {
+		confirmed, err := logger.Confirm(fmt.Sprintf("Delete from the VM?\n%s", strings.Join(cachePaths, "\n")), "", "Nothing was deleted")
+		if err != nil || !confirmed {
+			return err
+		}
+	}
+
+	if err := ssh.PurgeCache(cachePaths, password); err != nil {
+		return failure.New(failure.RemoteSetup, err)
+	}
+	logger.Successf("%d cache entries deleted", len(cachePaths))
+	return nil
+}
+
+// resolveCacheEntries turns the numbers of cache list into paths, other arguments are taken as paths.
+// Without arguments every entry is returned.
+func resolveCacheEntries(args []string, password *string) ([]string, error) {
+	needsList := len(args) == 0
+	for _, arg := range args {
+		if _, err := strconv.Atoi(arg); err == nil {
+			needsList = true
+		}
+	}
+	if !needsList {
+		return args, nil
+	}
+
+	entries, err := ssh.ListCache(password)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		var all []string
+		for _, entry := range entries {
+			if entry.SizeKB >= 0 {
+				all = append(all, entry.Path)
+			}
+		}
+		return all, nil
+	}
+
+	resolved := make([]string, len(args))
+	for i, arg := range args {
+		number, err := strconv.Atoi(arg)
+		if err != nil {
+			resolved[i] = arg
+			continue
+		}
+		if number < 1 || number > len(entries) {
+			return nil, failure.New(failure.Config, fmt.Errorf("no cache entry %d, see `%s %s %s`", number, cliName, cacheCommand, listCommand))
+		}
+		resolved[i] = entries[number-1].Path
+	}
+	return resolved, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/urfave/cli/v3"
+)
+
+func invite(ctx context.Context, cliCmd *cli.Command) error {
+	source := cliCmd.String(pubkeyFlag)
+	keys, err := ssh.ResolvePublicKeys(source)
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+
+	invitation, err := ssh.Invite(filepath.Base(source), keys, passwordFlag(cliCmd))
+	if err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+
+	logger.Successf("%d public key(s) of %s authorized on the VM", invitation.Keys, source)
+	logger.PrintFormattedOutput("Send this to your teammate", fmt.Sprintf("ssh -p %s %s@%s\n\nThey connect with their own key, no password or Bitrise access is needed.",
+		invitation.Port, invitation.User, invitation.HostName))
+	return nil
+}
+
+func share(ctx context.Context, cliCmd *cli.Command) error {
+	password := passwordFlag(cliCmd)
+
+	if cliCmd.Bool(stopFlag) {
+		if err := ssh.StopSharing(password); err != nil {
+			return failure.New(failure.RemoteSetup, err)
+		}
+		logger.Success("Shared terminal ended")
+		return nil
+	}
+
+	logger.Info("Starting a shared terminal, installing tmate on the VM if needed...")
+	terminal, err := ssh.Share(password)
+	if err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+
+	logger.PrintFormattedOutput("Shared terminal", fmt.Sprintf("Read-write:\n%s\n%s\n\nRead-only:\n%s\n%s\n\nEnd it with `%s %s --%s`",
+		terminal.SSH, terminal.Web, terminal.SSHReadOnly, terminal.WebReadOnly, cliName, shareCommand, stopFlag))
+	return nil
+}
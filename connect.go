@@ -0,0 +1,717 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/bitrise"
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ide"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/metrics"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+	"github.com/bitrise-io/bitrise-remote-access-cli/settings"
+	"github.com/bitrise-io/bitrise-remote-access-cli/shell"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/bitrise-io/bitrise-remote-access-cli/support"
+	"github.com/bitrise-io/bitrise-remote-access-cli/team"
+	"github.com/bitrise-io/bitrise-remote-access-cli/vscode"
+	"github.com/bitrise-io/bitrise-remote-access-cli/workspace"
+	"github.com/urfave/cli/v3"
+)
+
+// rebuild re-triggers a build with remote access enabled and connects to it once its VM is ready.
+func rebuild(ctx context.Context, cliCmd *cli.Command) error {
+	args := cliCmd.Args().Slice()
+	if len(args) == 0 {
+		return cli.ShowSubcommandHelp(cliCmd)
+	}
+	buildSlug, args := args[0], args[1:]
+
+	parsedArgs, _, err := parseArgs(args, flags)
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+	appSlug := parsedArgs[appSlugFlag]
+	if appSlug == "" {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("--%s is required", appSlugFlag))
+	}
+	token := apiToken()
+	if token == "" {
+		return failure.New(failure.Config, fmt.Errorf("$%s or `%s %s` is required to use the Bitrise API", bitrise.TokenEnvVar, authCommand, loginCommand))
+	}
+
+	client := bitrise.NewClient(token)
+
+	logger.Info("Starting rebuild with remote access...")
+	build, err := client.RebuildWithRemoteAccess(appSlug, buildSlug)
+	if err != nil {
+		return failure.New(failure.RemoteSetup, err)
+	}
+	logger.Successf("Build #%d started", build.BuildNumber)
+
+	access, err := client.WaitForRemoteAccess(appSlug, build.Slug, rebuildPollInterval, rebuildTimeout, func(elapsed time.Duration) {
+		logger.Infof("Waiting for the VM of build #%d... (%s)", build.BuildNumber, elapsed.Round(time.Second))
+	})
+	if err != nil {
+		return failure.New(failure.RemoteSetup, err)
+	}
+
+	connectArgs := append([]string{
+		"--" + sshHostFlag, access.Host,
+		"--" + sshPortFlag, access.Port,
+		"--" + sshUserFlag, access.User,
+		"--" + sshPasswordFlag, access.Password,
+		"--" + buildSlugFlag, build.Slug,
+	}, args...)
+	return connect(cliCmd, autoCommand, connectArgs)
+}
+
+// connect sets up the connection with the SSH arguments and opens the IDEs selected by the command.
+func connect(cliCmd *cli.Command, command string, args []string) error {
+	parsedArgs, positional, err := parseArgs(args, flags)
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+	var openTargets string
+	if command == openCommand && len(positional) > 0 {
+		// The first argument of open is the list of IDEs
+		openTargets = positional[0]
+		positional = positional[1:]
+	}
+	if command == openCommand && openTargets == "" {
+		return failure.New(failure.Config, fmt.Errorf("the IDEs to open are required, eg. %s %s vscode,shell", cliName, openCommand))
+	}
+	if len(positional) > 0 {
+		if err := applyTarget(parsedArgs, positional[0]); err != nil {
+			return failure.New(failure.Config, err)
+		}
+	}
+	applyEnvVars(parsedArgs, flags)
+
+	if configDir, ok := parsedArgs[configDirFlag]; ok {
+		paths.SetConfigDir(configDir)
+	}
+	_, jsonOutput = parsedArgs[jsonFlag]
+	if _, ok := parsedArgs[accessibleFlag]; ok {
+		logger.SetAccessible(true)
+	}
+	if _, ok := parsedArgs[quietFlag]; ok {
+		logger.SetQuiet(true)
+	}
+	_, printSSH := parsedArgs[printSSHFlag]
+	if printSSH {
+		logger.SetOutput(os.Stderr)
+	}
+
+	if !printSSH && needsOnboarding() {
+		if err := runOnboarding(); err != nil {
+			logger.Warnf("onboarding: %s", err)
+		}
+	}
+	userSettings, err := settings.Load()
+	if err != nil {
+		logger.Warn(err)
+	}
+	i18n.SetLocale(userSettings.Locale)
+
+	var wizardIDE string
+	if needsWizard(parsedArgs) {
+		if wizardIDE, err = runWizard(parsedArgs, command); err != nil {
+			return failure.New(failure.Config, err)
+		}
+	}
+
+	_, notify := parsedArgs[notifyFlag]
+	closeProgress, err := configureProgress(parsedArgs[logFileFlag], notify)
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+	defer closeProgress()
+
+	teamConfig, err := team.Load()
+	if err != nil {
+		logger.Warnf("load team config: %s", err)
+	} else if teamConfig != nil {
+		logger.Infof("Using the team config at %s", teamConfig.Path)
+		ssh.SetAdaptiveThresholds(ssh.AdaptiveThresholds{
+			Slow:     teamConfig.Adaptive.SlowRTT,
+			VerySlow: teamConfig.Adaptive.VerySlowRTT,
+			Disabled: teamConfig.Adaptive.Disabled,
+		})
+		vscode.AddIncompatibleSSHExtensionVersions(teamConfig.IncompatibleRemoteSSH...)
+	}
+
+	host, port := parsedArgs[sshHostFlag], parsedArgs[sshPortFlag]
+	previous, reconnecting := workspace.Load(host, port)
+
+	var ides []ide.IDE
+	if printSSH {
+		// No IDE is opened, the key is used like the shell would
+		ides = append(ides, shell.IdeData)
+	}
+
+	switch command {
+	case autoCommand:
+		if len(ides) == 0 && wizardIDE != "" {
+			if ide, found := findIDE(wizardIDE); found {
+				ides = append(ides, ide)
+			}
+		}
+		if len(ides) == 0 && reconnecting {
+			// Reopen the IDEs of the previous connection to the same build
+			for _, identifier := range previous.IDEs {
+				if ide, found := findIDE(identifier); found {
+					ides = append(ides, ide)
+				}
+			}
+		}
+		if len(ides) == 0 && teamConfig != nil && teamConfig.IDE != "" {
+			if ide, found := findIDE(teamConfig.IDE); found {
+				ides = append(ides, ide)
+			} else {
+				logger.Warnf("unknown IDE in the team config: %s", teamConfig.IDE)
+			}
+		}
+		if len(ides) == 0 && userSettings.DefaultIDE != "" {
+			if ide, found := findIDE(userSettings.DefaultIDE); found {
+				ides = append(ides, ide)
+			} else {
+				logger.Warnf("unknown default IDE in %s: %s", settings.Path(), userSettings.DefaultIDE)
+			}
+		}
+		if len(ides) == 0 {
+			autoIDE, err := autoChooseIDE()
+			if err != nil {
+				return err
+			}
+			ides = append(ides, autoIDE)
+		}
+	case openCommand:
+		for _, target := range strings.Split(openTargets, ",") {
+			ide, found := findIDE(target)
+			if !found {
+				return failure.New(failure.Config, fmt.Errorf("unknown IDE: %s", target))
+			}
+			ides = append(ides, ide)
+		}
+	default:
+		if ide, found := findIDE(command); found {
+			ides = append(ides, ide)
+		}
+	}
+	if len(ides) == 0 {
+		return failure.New(failure.Config, fmt.Errorf("unknown command: %s", command))
+	}
+
+	allowKeyAuth := true
+	for _, ide := range ides {
+		if !ide.SupportsCurrentPlatform() {
+			return failure.New(failure.IDE, fmt.Errorf("%s is not supported on %s", ide.Name, runtime.GOOS))
+		}
+		// The SSH config entry is shared, so the key is only used if every IDE can use it
+		allowKeyAuth = allowKeyAuth && ide.Capabilities.KeyAuth
+		if ide.Identifier == vscode.IdeData.Identifier {
+			ssh.SetIDEServers(vscode.Server)
+		}
+	}
+
+	_, reuseWindow := parsedArgs[reuseWindowFlag]
+	_, newWindow := parsedArgs[newWindowFlag]
+	if reuseWindow && newWindow {
+		return failure.New(failure.Config, fmt.Errorf("--%s and --%s cannot be used together", reuseWindowFlag, newWindowFlag))
+	}
+	openOptions := ide.OpenOptions{
+		// Reconnecting to the same build should not leave the window of the previous connection behind
+		ReuseWindow: reuseWindow || (reconnecting && !newWindow),
+		NewWindow:   newWindow,
+	}
+	if extensions := parsedArgs[extensionsFlag]; extensions != "" {
+		openOptions.RemoteExtensions = strings.Split(extensions, ",")
+	}
+	var localForwards []string
+	if teamConfig != nil {
+		openOptions.RemoteExtensions = append(openOptions.RemoteExtensions, teamConfig.Extensions...)
+		localForwards = append(localForwards, teamConfig.Forwards...)
+	}
+	if err := ssh.SetLocalForwards(localForwards); err != nil {
+		return failure.New(failure.Config, fmt.Errorf("team config: %w", err))
+	}
+	if names := parsedArgs[presetFlag]; names != "" {
+		if err := applyPresets(strings.Split(names, ","), localForwards); err != nil {
+			return failure.New(failure.Config, err)
+		}
+	}
+	if _, mosh := parsedArgs[moshFlag]; mosh {
+		openOptions.Mosh = true
+	}
+	_, openOptions.SkipVerify = parsedArgs[skipIDECheckFlag]
+	_, openOptions.DisableWorkspaceTrust = parsedArgs[noTrustPromptFlag]
+	_, openOptions.DisableTelemetry = parsedArgs[noTelemetryFlag]
+	if location := parsedArgs[gotoFlag]; location != "" {
+		goTo, err := ide.ParseLocation(location)
+		if err != nil {
+			return failure.New(failure.Config, fmt.Errorf("--%s: %w", gotoFlag, err))
+		}
+		openOptions.Goto = goTo
+		for _, chosen := range ides {
+			if !chosen.Capabilities.Goto {
+				logger.Warnf("%s can't open a file at a line, only the folder is opened in it", chosen.Name)
+			}
+		}
+	}
+	openOptions.RecordPath = parsedArgs[recordFlag]
+	if _, offline := parsedArgs[offlineFlag]; offline {
+		openOptions.Offline = true
+		logger.Warn("Offline mode: extension installs and other steps needing internet access are skipped")
+	}
+
+	_, skipDNSCheck := parsedArgs[skipDNSCheckFlag]
+	ssh.SetSkipDNSCheck(skipDNSCheck)
+	ssh.SetWebSocketURL(parsedArgs[webSocketURLFlag])
+	if err := ssh.SetNetwork(parsedArgs[networkFlag], parsedArgs[interfaceFlag]); err != nil {
+		return failure.New(failure.Config, err)
+	}
+	if err := ssh.SetCertificate(parsedArgs[certificateFlag]); err != nil {
+		return failure.New(failure.Config, fmt.Errorf("--%s: %w", certificateFlag, err))
+	}
+	_, securityKey := parsedArgs[securityKeyFlag]
+	ssh.SetSecurityKey(securityKey, parsedArgs[skProviderFlag])
+
+	_, compression := parsedArgs[compressionFlag]
+	tuning := ssh.Tuning{Compression: compression}
+	if ciphers := parsedArgs[ciphersFlag]; ciphers != "" {
+		tuning.Ciphers = strings.Split(ciphers, ",")
+	}
+	if macs := parsedArgs[macsFlag]; macs != "" {
+		tuning.MACs = strings.Split(macs, ",")
+	}
+
+	usesAccessTokens := useAccessTokens(parsedArgs[appSlugFlag], parsedArgs[buildSlugFlag])
+
+	var password *string
+	parsedPw, parsedPwExists := parsedArgs[sshPasswordFlag]
+	if parsedPwExists {
+		password = &parsedPw
+	} else if host != "" && !jsonOutput && parsedArgs[certificateFlag] == "" && !usesAccessTokens {
+		// The certificate and the access tokens log in without the password
+		password = promptPassword()
+	}
+
+	// Hooks get the connection details, eg. to call the VM with ssh $BITRISE_REMOTE_HOST_PATTERN
+	hookEnv := []string{
+		hostEnvVar + "=" + host,
+		portEnvVar + "=" + port,
+		"BITRISE_REMOTE_HOST_PATTERN=" + ssh.BitriseHostPattern,
+	}
+
+	var openedFolder string
+	onLaunchIDE := func(useIdentityKey bool, folderPath string, info ssh.LaunchInfo) error {
+		if printSSH {
+			if !useIdentityKey {
+				logger.Info("The SSH key can't be used with this VM, ssh will ask for the password")
+			}
+			fmt.Println(shellJoin(ssh.SSHCommand()))
+			return nil
+		}
+		if folderPath != "" && teamConfig != nil && teamConfig.OpenPath != "" {
+			folderPath = path.Join(folderPath, teamConfig.OpenPath)
+		}
+		if folderPath == "" && reconnecting && previous.Folder != "" {
+			logger.Infof("Reopening the workspace of the previous connection: %s", previous.Folder)
+			folderPath = previous.Folder
+		}
+
+		openOptions.ContextFiles = info.ContextFiles
+		if openOptions.Goto != nil {
+			resolved := openOptions.Goto.Resolve(folderPath)
+			openOptions.Goto = &resolved
+		}
+		if info.SlowLink && len(openOptions.RemoteExtensions) > 0 {
+			logger.Warnf("Slow link: not installing extensions on remote: %s", strings.Join(openOptions.RemoteExtensions, ", "))
+			openOptions.RemoteExtensions = nil
+		}
+		ideLaunchDone := metrics.Start(metrics.IDELaunch)
+		err := openWithIDEs(ides, folderPath, password, useIdentityKey, openOptions)
+		ideLaunchDone(err)
+		if err != nil {
+			return err
+		}
+		openedFolder = folderPath
+
+		if teamConfig != nil {
+			if err := teamConfig.RunHooks(teamConfig.Hooks.AfterOpen, hookEnv); err != nil {
+				logger.Warn(err)
+			}
+		}
+
+		identifiers := make([]string, len(ides))
+		for i, ide := range ides {
+			identifiers[i] = ide.Identifier
+		}
+		if err := workspace.Save(workspace.Entry{Host: host, Port: port, Folder: folderPath, IDEs: identifiers}); err != nil {
+			logger.Warnf("save workspace state: %s", err)
+		}
+		return nil
+	}
+
+	if _, dryRun := parsedArgs[dryRunFlag]; dryRun {
+		return printPlan(host, port, parsedArgs[sshUserFlag], password, tuning, allowKeyAuth, ides, teamConfig)
+	}
+
+	if _, wait := parsedArgs[waitFlag]; wait {
+		if err := waitForVM(host, port, parsedArgs); err != nil {
+			return err
+		}
+	}
+
+	if teamConfig != nil {
+		if err := teamConfig.RunHooks(teamConfig.Hooks.BeforeConnect, hookEnv); err != nil {
+			return failure.New(failure.Config, err)
+		}
+	}
+
+	progress.Start(setupStage, "Setting up the connection...")
+	totalDone := metrics.Start(metrics.Total)
+	settingUp.Store(true)
+	err = ssh.SetupSSH(host, port, parsedArgs[sshUserFlag], password, tuning, allowKeyAuth, afterProvisioning(onLaunchIDE))
+	settingUp.Store(false)
+	totalDone(err)
+	exportMetrics(parsedArgs, teamConfig, ides, userSettings.Telemetry)
+	if err != nil {
+		progress.Fail(setupStage, "Setup failed", err)
+	} else {
+		progress.Succeed(setupStage, "Setup finished, happy debugging!")
+		names := make([]string, len(ides))
+		for i, ide := range ides {
+			names[i] = ide.Name
+		}
+		if logger.IsQuiet() || jsonOutput || printSSH {
+			logger.Resultf("Connected to %s@%s:%s with %s", parsedArgs[sshUserFlag], host, port, strings.Join(names, ", "))
+		} else {
+			printSessionSummary(openedFolder, names, parsedArgs[appSlugFlag], parsedArgs[buildSlugFlag])
+		}
+	}
+
+	var configErr ssh.ConfigErr
+	if errors.As(err, &configErr) {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return err
+	}
+
+	return explainWithBuildState(err, parsedArgs[appSlugFlag], parsedArgs[buildSlugFlag])
+}
+
+// exportMetrics writes the timings of the setup phases where the flags or the team config ask for them. They are
+// only sent to a collector if the user opted in to the metrics, the local file is always written. Failures are only
+// reported, the session works without the metrics.
+func exportMetrics(parsedArgs map[string]string, teamConfig *team.Config, ides []ide.IDE, telemetry bool) {
+	file, endpoint := parsedArgs[metricsFileFlag], parsedArgs[otlpEndpointFlag]
+	if teamConfig != nil && file == "" {
+		file = teamConfig.Metrics.File
+	}
+	if teamConfig != nil && endpoint == "" {
+		endpoint = teamConfig.Metrics.OTLPEndpoint
+	}
+	if endpoint != "" && !telemetry {
+		logger.Infof("Metrics are not sent to %s, opt in to them with `%s %s`", endpoint, cliName, setupCommand)
+		endpoint = ""
+	}
+	if file == "" && endpoint == "" {
+		return
+	}
+
+	identifiers := make([]string, len(ides))
+	for i, ide := range ides {
+		identifiers[i] = ide.Identifier
+	}
+	labels := map[string]string{"ide": strings.Join(identifiers, ","), "os": runtime.GOOS}
+
+	if file != "" {
+		if err := metrics.WriteFile(file, labels); err != nil {
+			logger.Warnf("write metrics to %s: %s", file, err)
+		}
+	}
+	if endpoint != "" {
+		// The headers are in the format of the OpenTelemetry SDKs, eg. api-key=secret,tenant=mobile
+		headers := map[string]string{}
+		for _, header := range strings.Split(os.Getenv(otlpHeadersEnvVar), ",") {
+			if key, value, found := strings.Cut(header, "="); found {
+				headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+		if err := metrics.ExportOTLP(endpoint, headers, labels); err != nil {
+			logger.Warnf("export metrics to %s: %s", endpoint, err)
+		}
+	}
+}
+
+// applyPresets adds the forwards and remote environment of the presets to the ones of the team config.
+func applyPresets(names []string, localForwards []string) error {
+	var remoteForwards []string
+	env := map[string]string{}
+	for _, name := range names {
+		preset, err := ssh.FindPreset(name)
+		if err != nil {
+			return err
+		}
+		localForwards = append(localForwards, preset.LocalForwards...)
+		remoteForwards = append(remoteForwards, preset.RemoteForwards...)
+		maps.Copy(env, preset.Env)
+		logger.Infof("%s preset: %s", preset.Name, preset.Description)
+	}
+
+	if err := ssh.SetLocalForwards(localForwards); err != nil {
+		return err
+	}
+	if err := ssh.SetRemoteForwards(remoteForwards); err != nil {
+		return err
+	}
+	ssh.SetRemoteEnv(env)
+	return nil
+}
+
+// configureProgress selects the sinks of the progress events, the returned function closes the log file.
+func configureProgress(logFile string, notify bool) (func(), error) {
+	if jsonOutput {
+		progress.SetSinks(progress.NewJSONSink(os.Stdout))
+	}
+	if notify {
+		progress.AddSink(progress.NotificationSink{Stages: []string{setupStage}})
+	}
+
+	// The transcript of the last connect goes into the support bundle
+	closeTranscript := func() {}
+	transcriptPath := filepath.Join(paths.StateDir(), support.TranscriptFileName)
+	_ = os.Remove(transcriptPath)
+	if err := os.MkdirAll(paths.StateDir(), 0755); err == nil {
+		if transcript, err := progress.NewFileSink(transcriptPath); err == nil {
+			progress.AddSink(transcript)
+			closeTranscript = func() { _ = transcript.Close() }
+		}
+	}
+	if logFile == "" {
+		return closeTranscript, nil
+	}
+
+	fileSink, err := progress.NewFileSink(logFile)
+	if err != nil {
+		closeTranscript()
+		return nil, err
+	}
+	progress.AddSink(fileSink)
+	return func() {
+		closeTranscript()
+		_ = fileSink.Close()
+	}, nil
+}
+
+// printPlan prints what the setup would change without changing anything.
+func printPlan(host, port, user string, password *string, tuning ssh.Tuning, allowKeyAuth bool, ides []ide.IDE, teamConfig *team.Config) error {
+	plan, err := ssh.PlanSetup(host, port, user, password, tuning, allowKeyAuth)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(ides))
+	for i, ide := range ides {
+		names[i] = ide.Name
+	}
+	body := plan.String() + fmt.Sprintf("\nThen: open the source directory with %s\n", strings.Join(names, ", "))
+	if teamConfig != nil {
+		for _, hook := range append(slices.Clone(teamConfig.Hooks.BeforeConnect), teamConfig.Hooks.AfterOpen...) {
+			body += fmt.Sprintf("Run hook: %s\n", hook)
+		}
+	}
+
+	logger.PrintFormattedOutput("Dry run, nothing was changed", body)
+	return nil
+}
+
+// waitForVM blocks until the VM accepts SSH connections. With the API token and slugs set,
+// the build state is checked too, so waiting stops as soon as the build finishes.
+func waitForVM(host, port string, parsedArgs map[string]string) error {
+	timeout := defaultWaitTimeout
+	if value, ok := parsedArgs[waitTimeoutFlag]; ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return failure.New(failure.Config, fmt.Errorf("invalid --%s: %w", waitTimeoutFlag, err))
+		}
+		timeout = parsed
+	}
+
+	var client *bitrise.Client
+	appSlug, buildSlug := parsedArgs[appSlugFlag], parsedArgs[buildSlugFlag]
+	if token := apiToken(); token != "" && appSlug != "" && buildSlug != "" {
+		client = bitrise.NewClient(token)
+	}
+
+	err := ssh.WaitForSSH(host, port, timeout, func(elapsed time.Duration) error {
+		logger.Infof("Waiting for the VM to accept SSH connections... (%s)", elapsed.Round(time.Second))
+		if client == nil {
+			return nil
+		}
+		build, err := client.Build(appSlug, buildSlug)
+		if err != nil {
+			logger.Warnf("check build state: %s", err)
+			return nil
+		}
+		if build.Status != bitrise.BuildStatusRunning {
+			return build.RemoteAccessProblem(time.Now())
+		}
+		return nil
+	})
+	if err != nil {
+		return failure.New(failure.Network, err)
+	}
+
+	logger.Success("VM accepts SSH connections")
+	return nil
+}
+
+// printSessionSummary tells what can be done with the session once the editor is open.
+func printSessionSummary(folder string, ideNames []string, appSlug, buildSlug string) {
+	available := fmt.Sprintf("while the build runs and %s after it finishes", bitrise.RemoteAccessGracePeriod)
+	if token := apiToken(); token != "" && appSlug != "" && buildSlug != "" {
+		if build, err := bitrise.NewClient(token).Build(appSlug, buildSlug); err == nil {
+			if expiry, ok := build.RemoteAccessExpiry(); ok {
+				available = "until " + expiry.Local().Format(time.Kitchen)
+			}
+		}
+	}
+	if folder == "" {
+		folder = "unknown, the home directory is opened"
+	}
+
+	lines := []string{
+		fmt.Sprintf("Opened in:     %s", strings.Join(ideNames, ", ")),
+		fmt.Sprintf("Host alias:    %s", ssh.BitriseHostPattern),
+		fmt.Sprintf("Source dir:    %s", folder),
+		fmt.Sprintf("Available:     %s", available),
+		"",
+		"Reconnect:     run the same command again, the workspace is reopened",
+		fmt.Sprintf("Open a shell:  %s", shellJoin(ssh.SSHCommand())),
+		fmt.Sprintf("Copy files:    %s %s <LOCAL_PATH> <REMOTE_PATH>, %s <REMOTE_PATH> <LOCAL_PATH>", cliName, pushCommand, pullCommand),
+		fmt.Sprintf("Clean up:      %s %s", cliName, disconnectCommand),
+	}
+	logger.PrintFormattedOutput("Next steps", strings.Join(lines, "\n"))
+}
+
+// explainWithBuildState replaces connection failures with the reason found in the build's state,
+// eg. the build has finished long ago. The original error is kept if the API can't tell more.
+func explainWithBuildState(err error, appSlug, buildSlug string) error {
+	category := failure.CategoryOf(err)
+	if category != failure.Network && category != failure.Auth {
+		return err
+	}
+
+	token := apiToken()
+	if token == "" || appSlug == "" || buildSlug == "" {
+		return err
+	}
+
+	build, apiErr := bitrise.NewClient(token).Build(appSlug, buildSlug)
+	if apiErr != nil {
+		logger.Warnf("check build state: %s", apiErr)
+		return err
+	}
+
+	if problem := build.RemoteAccessProblem(time.Now()); problem != nil {
+		return failure.New(category, problem)
+	}
+	return err
+}
+
+func autoChooseIDE() (ide.IDE, error) {
+	termProgram := os.Getenv("TERM_PROGRAM")
+
+	if termProgram != "" {
+		for _, ide := range supportedIDEs {
+			if termProgram == ide.Identifier && ide.SupportsCurrentPlatform() {
+				logger.Successf("%s IDE detected automatically", ide.Name)
+				return ide, nil
+			}
+		}
+	}
+
+	for _, ide := range supportedIDEs {
+		if !ide.SupportsCurrentPlatform() {
+			continue
+		}
+		_, installed := ide.OnTestPath()
+		if installed {
+			logger.Successf("%s IDE found in PATH", ide.Name)
+			return ide, nil
+		}
+	}
+
+	return ide.IDE{}, failure.New(failure.IDE, fmt.Errorf("IDE could not be detected automatically, please specify the IDE explicitly instead of using the '%s' subcommand", autoCommand))
+}
+
+func findIDE(name string) (ide.IDE, bool) {
+	for _, supportedIDE := range supportedIDEs {
+		if name == supportedIDE.Identifier || slices.Contains(supportedIDE.Aliases, name) {
+			return supportedIDE, true
+		}
+	}
+	return ide.IDE{}, false
+}
+
+// openWithIDEs launches the IDEs concurrently, they share the SSH config entry set up for the session.
+func openWithIDEs(ides []ide.IDE, folder string, password *string, usingKey bool, options ide.OpenOptions) error {
+	needsFolder := false
+	for _, ide := range ides {
+		needsFolder = needsFolder || ide.Capabilities.FolderURI
+	}
+
+	if folder == "" && needsFolder {
+		confirm, err := logger.Confirm(
+			"Source code location is unknown.\nWould you like to use the root directory and proceed?",
+			"Using root directory",
+			"Not using root directory, ending session...")
+
+		if !confirm || err != nil {
+			return fmt.Errorf("source code location could not be determined")
+		}
+	}
+
+	if len(ides) == 1 {
+		return openWithIDE(&ides[0], folder, password, usingKey, options)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(ides))
+	for i := range ides {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = openWithIDE(&ides[i], folder, password, usingKey, options)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func openWithIDE(ide *ide.IDE, folder string, password *string, usingKey bool, options ide.OpenOptions) error {
+	var additionalInfo string
+	if !usingKey && password != nil && ide.Capabilities.PasswordPaste {
+		additionalInfo = fmt.Sprintf("Your password for SSH connection:\n\n%s\n\ncopy this into the password field of the opening window", *password)
+	}
+	options.Password = password
+
+	return ide.OnOpen(ssh.BitriseHostPattern, folder, additionalInfo, options)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/auth"
+	"github.com/bitrise-io/bitrise-remote-access-cli/bitrise"
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/settings"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/urfave/cli/v3"
+)
+
+// passwordFlag returns the SSH password of the flag, or the one stored for the session when the flag is omitted.
+func passwordFlag(cliCmd *cli.Command) *string {
+	if cliCmd.IsSet(sshPasswordFlag) {
+		password := cliCmd.String(sshPasswordFlag)
+		return &password
+	}
+	if password, ok := auth.SessionPassword(); ok {
+		return &password
+	}
+	return nil
+}
+
+// promptPassword asks for the SSH password that wasn't passed as a flag, and offers to keep it for the later
+// commands of the session. Nil is returned if nothing was entered or there is no terminal to ask on.
+func promptPassword() *string {
+	password, err := logger.Password(i18n.T("SSH password of the VM"))
+	if err != nil || password == "" {
+		return nil
+	}
+	if !auth.UsesKeychain() {
+		return &password
+	}
+
+	userSettings, err := settings.Load()
+	if err != nil {
+		logger.Warn(err)
+	}
+	switch userSettings.Password {
+	case settings.PasswordForget:
+		return &password
+	case settings.PasswordStore:
+		if err := auth.StoreSessionPassword(password); err != nil {
+			logger.Warn(err)
+		}
+		return &password
+	}
+
+	store, err := logger.Confirm(
+		i18n.T("Store the password in the keychain until you disconnect?\nrepair, push and pull won't ask for it then."),
+		i18n.T("Password stored for the session"),
+		"")
+	if err == nil && store {
+		if err := auth.StoreSessionPassword(password); err != nil {
+			logger.Warn(err)
+		}
+	}
+	return &password
+}
+
+// useAccessTokens authenticates the connections with the expiring access tokens of the build's VM, if they are
+// turned on and the API can be asked for them.
+func useAccessTokens(appSlug, buildSlug string) bool {
+	if enabled, _ := strconv.ParseBool(os.Getenv(accessTokensEnvVar)); !enabled {
+		return false
+	}
+	token := apiToken()
+	if token == "" || appSlug == "" || buildSlug == "" {
+		logger.Warnf("$%s needs --%s, --%s and an API token, the password is used instead", accessTokensEnvVar, appSlugFlag, buildSlugFlag)
+		return false
+	}
+
+	client := bitrise.NewClient(token)
+	ssh.SetAccessTokenSource(func() (string, time.Time, error) {
+		accessToken, err := client.RemoteAccessToken(appSlug, buildSlug)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		return accessToken.Token, accessToken.ExpiresAt, nil
+	})
+	return true
+}
+
+// apiToken returns the token of the API-driven features, empty if none is configured.
+func apiToken() string {
+	token, err := auth.Token()
+	if err != nil {
+		logger.Warn(err)
+	}
+	return token
+}
+
+func authLogin(ctx context.Context, cliCmd *cli.Command) error {
+	name := cliCmd.Args().First()
+	if name == "" {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("profile name is required"))
+	}
+
+	token := cliCmd.String(tokenFlag)
+	if token == "" {
+		fmt.Print("Paste the personal access token: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return failure.New(failure.Config, fmt.Errorf("read token: %w", err))
+		}
+		token = strings.TrimSpace(line)
+	}
+	if token == "" {
+		return failure.New(failure.Config, fmt.Errorf("token is required"))
+	}
+
+	user, err := bitrise.NewClient(token).CurrentUser()
+	if err != nil {
+		return failure.New(failure.Auth, fmt.Errorf("validate token: %w", err))
+	}
+
+	profile := auth.Profile{Name: name, Workspace: cliCmd.String(workspaceFlag), Username: user.Username}
+	if err := auth.Login(profile, token); err != nil {
+		return err
+	}
+
+	if !auth.UsesKeychain() {
+		logger.Warn("No keychain found, the token is stored in a file only readable by you")
+	}
+	logger.Successf("Logged in as %s, %s is the current profile", user.Username, name)
+	return nil
+}
+
+func authList(ctx context.Context, cliCmd *cli.Command) error {
+	profiles, current, err := auth.List()
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		logger.Infof("No tokens stored, add one with `%s %s %s <NAME>`", cliName, authCommand, loginCommand)
+		return nil
+	}
+
+	for _, profile := range profiles {
+		marker := " "
+		if profile.Name == current {
+			marker = "*"
+		}
+		line := fmt.Sprintf("%s %s (%s)", marker, profile.Name, profile.Username)
+		if profile.Workspace != "" {
+			line += " workspace: " + profile.Workspace
+		}
+		fmt.Println(line)
+	}
+
+	if bitrise.TokenFromEnv() != "" {
+		logger.Warnf("$%s is set, it takes precedence over the current profile", bitrise.TokenEnvVar)
+	}
+	return nil
+}
+
+func authSwitch(ctx context.Context, cliCmd *cli.Command) error {
+	name := cliCmd.Args().First()
+	if name == "" {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("profile name is required"))
+	}
+
+	if err := auth.Switch(name); err != nil {
+		return failure.New(failure.Config, err)
+	}
+	logger.Successf("Switched to %s", name)
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/urfave/cli/v3"
+)
+
+// proxy is run by the SSH clients of the IDEs, so nothing but the tunneled connection may be written to stdout.
+func proxy(ctx context.Context, cliCmd *cli.Command) error {
+	// The SSH client stops the proxy with a signal when the connection ends, that must not end the session
+	signal.Reset(os.Interrupt, syscall.SIGTERM)
+	logger.SetOutput(os.Stderr)
+	if cliCmd.Args().Len() != 2 {
+		return failure.New(failure.Config, fmt.Errorf("expected the host and port of the VM"))
+	}
+	err := ssh.Proxy(cliCmd.String(webSocketURLFlag), cliCmd.Args().Get(0), cliCmd.Args().Get(1), os.Stdin, os.Stdout)
+	if err != nil {
+		return failure.New(failure.Network, err)
+	}
+	return nil
+}
+
+// daemonStart runs `daemon run` in a detached process and waits until it's connected. The password is passed
+// in the environment, not to show up in the process list.
+func daemonStart(ctx context.Context, cliCmd *cli.Command) error {
+	if status, err := ssh.QueryDaemon(); err == nil {
+		logger.Infof("The daemon is already running, pid %d", status.PID)
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("find executable: %w", err)
+	}
+	args := []string{daemonCommand, runCommand}
+	if configDir := cliCmd.String(configDirFlag); configDir != "" {
+		args = append(args, "--"+configDirFlag, configDir)
+	}
+	if err := os.MkdirAll(paths.StateDir(), 0700); err != nil {
+		return fmt.Errorf("create state directory: %w", err)
+	}
+	logPath := filepath.Join(paths.StateDir(), daemonLogFileName)
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open daemon log: %w", err)
+	}
+	defer logFile.Close()
+
+	daemonCmd := exec.Command(executable, args...)
+	daemonCmd.Stdout, daemonCmd.Stderr = logFile, logFile
+	daemonCmd.Env = os.Environ()
+	if password := passwordFlag(cliCmd); password != nil {
+		daemonCmd.Env = append(daemonCmd.Env, passwordEnvVar+"="+*password)
+	}
+	if err := daemonCmd.Start(); err != nil {
+		return fmt.Errorf("start daemon: %w", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = daemonCmd.Wait()
+		close(exited)
+	}()
+
+	logger.Info("Starting the daemon...")
+	deadline := time.After(daemonStartWait)
+	for {
+		select {
+		case <-exited:
+			return failure.New(failure.RemoteSetup, fmt.Errorf("the daemon exited, see %s", logPath))
+		case <-deadline:
+			return failure.New(failure.Network, fmt.Errorf("the daemon didn't connect in %s, see %s", daemonStartWait, logPath))
+		case <-time.After(500 * time.Millisecond):
+		}
+		if status, err := ssh.QueryDaemon(); err == nil {
+			logger.Successf("Daemon connected to %s, pid %d", status.Host, status.PID)
+			return nil
+		}
+	}
+}
+
+func daemonStop(ctx context.Context, cliCmd *cli.Command) error {
+	if err := ssh.StopDaemon(); err != nil {
+		if errors.Is(err, ssh.ErrDaemonNotRunning) {
+			logger.Info("The daemon is not running")
+			return nil
+		}
+		return err
+	}
+	logger.Success("Daemon stopped")
+	return nil
+}
+
+func daemonStatus(ctx context.Context, cliCmd *cli.Command) error {
+	status, err := ssh.QueryDaemon()
+	if err != nil && !errors.Is(err, ssh.ErrDaemonNotRunning) {
+		return err
+	}
+	if cliCmd.Bool(jsonFlag) {
+		if status == nil {
+			status = &ssh.DaemonStatus{}
+		}
+		return json.NewEncoder(os.Stdout).Encode(status)
+	}
+	if status == nil {
+		logger.Info("The daemon is not running")
+		return nil
+	}
+
+	state := "connected"
+	if !status.Connected {
+		state = "reconnecting"
+	}
+	lines := []string{
+		fmt.Sprintf("Host: %s (%s)", status.Host, state),
+		fmt.Sprintf("PID: %d, running since %s", status.PID, status.StartedAt.Format(time.DateTime)),
+		fmt.Sprintf("Reconnects: %d", status.Reconnects),
+	}
+	for _, forward := range status.Forwards {
+		lines = append(lines, "Forward: "+forward)
+	}
+	if status.LastError != "" {
+		lines = append(lines, "Last error: "+status.LastError)
+	}
+	logger.PrintFormattedOutput("Daemon", strings.Join(lines, "\n"))
+	return nil
+}
+
+func daemonRun(ctx context.Context, cliCmd *cli.Command) error {
+	// The daemon outlives the terminal it was started from, the signals are only used to stop it
+	signal.Reset(os.Interrupt, syscall.SIGTERM)
+	signal.Ignore(syscall.SIGHUP)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	if err := ssh.RunDaemon(passwordFlag(cliCmd), stop); err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+	return nil
+}
+
+// waitForEnterOr returns when Enter is pressed or done is closed, with the error sent on done.
+func waitForEnterOr(done <-chan error) error {
+	entered := make(chan struct{})
+	go func() {
+		_, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+		close(entered)
+	}()
+
+	select {
+	case <-entered:
+		return nil
+	case err := <-done:
+		if err != nil {
+			return failure.New(failure.RemoteSetup, fmt.Errorf("debugging server exited: %w", err))
+		}
+		logger.Info("Debugging server exited")
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/auth"
+	"github.com/bitrise-io/bitrise-remote-access-cli/bitrise"
+	"github.com/bitrise-io/bitrise-remote-access-cli/dashboard"
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/bitrise-io/bitrise-remote-access-cli/workspace"
+	"github.com/urfave/cli/v3"
+)
+
+// stepLogTailLines is how much of the failed step's log is shown before following it
+const stepLogTailLines = 200
+
+// root shows the dashboard when the CLI is run without a command in a terminal, the help otherwise.
+func root(ctx context.Context, cliCmd *cli.Command) error {
+	if cliCmd.Args().Len() > 0 {
+		_ = cli.ShowAppHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("unknown command: %s", cliCmd.Args().First()))
+	}
+	// The dashboard needs a terminal to draw on, not only to read from
+	if info, err := os.Stdout.Stat(); !logger.IsInteractive() || err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return cli.ShowAppHelp(cliCmd)
+	}
+
+	action, err := dashboard.Run(apiToken(), paletteEntries(cliCmd))
+	if err != nil {
+		return err
+	}
+
+	switch action.Kind {
+	case dashboard.Connect:
+		return runSelf(dashboardConnectArgs(action))
+	case dashboard.Shell:
+		return runSSH()
+	case dashboard.Logs:
+		stepLog, err := ssh.FailedStepLog(nil)
+		if err != nil {
+			return failure.New(failure.RemoteSetup, err)
+		}
+		return runSSH(fmt.Sprintf("tail -n %d -f %s", stepLogTailLines, shellJoin([]string{stepLog})))
+	case dashboard.Cleanup:
+		return runSelf([]string{disconnectCommand}, nil)
+	case dashboard.Launch:
+		return runSelf(action.Args, nil)
+	}
+	return nil
+}
+
+// paletteEntries lists what the palette can launch: the commands, switching to a saved profile and connecting to a
+// recent host. The commands that need arguments ask for them or print their usage.
+func paletteEntries(cliCmd *cli.Command) []dashboard.PaletteEntry {
+	entries := commandEntries(cliCmd.Root().Commands, nil)
+
+	// Broken state files only leave their entries out, the commands still report them
+	if profiles, current, err := auth.List(); err == nil {
+		for _, profile := range profiles {
+			if profile.Name == current {
+				continue
+			}
+			detail := "Switch to the saved token"
+			if profile.Workspace != "" {
+				detail += " of " + profile.Workspace
+			}
+			entries = append(entries, dashboard.PaletteEntry{
+				Title:  fmt.Sprintf("%s %s %s", authCommand, switchCommand, profile.Name),
+				Detail: detail,
+				Args:   []string{authCommand, switchCommand, profile.Name},
+			})
+		}
+	}
+	if sessions, err := workspace.Recent(); err == nil {
+		for _, session := range sessions {
+			host := net.JoinHostPort(session.Host, session.Port)
+			entries = append(entries, dashboard.PaletteEntry{
+				Title:  fmt.Sprintf("%s %s", autoCommand, host),
+				Detail: "Connect to " + session.Folder,
+				Args:   []string{autoCommand, host},
+			})
+		}
+	}
+	return entries
+}
+
+func commandEntries(commands []*cli.Command, parents []string) []dashboard.PaletteEntry {
+	var entries []dashboard.PaletteEntry
+	for _, command := range commands {
+		if command.Hidden || command.Name == "help" {
+			continue
+		}
+		path := append(slices.Clone(parents), command.Name)
+		if len(command.Commands) > 0 {
+			entries = append(entries, commandEntries(command.Commands, path)...)
+			continue
+		}
+		entries = append(entries, dashboard.PaletteEntry{Title: strings.Join(path, " "), Detail: command.Usage, Args: path})
+	}
+	return entries
+}
+
+// dashboardConnectArgs returns the auto command of the chosen build or session, the password goes in the
+// environment so other users can't see it in the process list.
+func dashboardConnectArgs(action dashboard.Action) ([]string, []string) {
+	args := []string{autoCommand}
+	switch {
+	case action.Build != nil && action.Build.App != nil:
+		access, err := bitrise.NewClient(apiToken()).RemoteAccess(action.Build.App.Slug, action.Build.Slug)
+		if err != nil {
+			logger.Warnf("get the connection parameters of build #%d, enter them manually: %s", action.Build.BuildNumber, err)
+			return args, nil
+		}
+		args = append(args, fmt.Sprintf("%s@%s", access.User, net.JoinHostPort(access.Host, access.Port)),
+			"--"+appSlugFlag, action.Build.App.Slug, "--"+buildSlugFlag, action.Build.Slug)
+		return args, []string{passwordEnvVar + "=" + access.Password}
+	case action.Session != nil:
+		// The wizard asks for the rest
+		args = append(args, net.JoinHostPort(action.Session.Host, action.Session.Port))
+	}
+	return args, nil
+}
+
+// runSelf runs the CLI again with the command chosen on the dashboard, as if it was typed.
+func runSelf(args, env []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("find executable: %w", err)
+	}
+	cmd := interrupt.Command(executable, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	return exitWith(cmd.Run())
+}
+
+// runSSH runs ssh with the host entry of the last session, a shell without a remote command.
+func runSSH(remoteCommand ...string) error {
+	sshCommand := ssh.SSHCommand()
+	args := sshCommand[1:]
+	if len(remoteCommand) > 0 {
+		// Without a terminal Ctrl+C would stop ssh but leave the command running
+		args = append([]string{"-t"}, append(args, remoteCommand...)...)
+	}
+
+	cmd := interrupt.Command(sshCommand[0], args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return exitWith(cmd.Run())
+}
+
+// exitWith exits with the exit code of the program, which has already reported its own error.
+func exitWith(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	return err
+}
@@ -0,0 +1,327 @@
+// Package dashboard is the overview shown when the CLI is run without a command: the state of the connection, the
+// running builds, the recent sessions and the actions to take on them. Its palette fuzzy finds the commands,
+// the saved profiles and the recent hosts.
+package dashboard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/bitrise"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/bitrise-io/bitrise-remote-access-cli/workspace"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ActionKind is what the user chose to do on the dashboard.
+type ActionKind int
+
+const (
+	// Quit leaves the dashboard without doing anything
+	Quit ActionKind = iota
+	// Connect connects to the selected build or session, or asks for the parameters if none is selected
+	Connect
+	// Shell opens a shell on the VM of the last session
+	Shell
+	// Logs follows the log of the failed step on the VM of the last session
+	Logs
+	// Cleanup removes the local and remote changes of the last session
+	Cleanup
+	// Launch runs the CLI with the Args of the entry chosen in the palette
+	Launch
+)
+
+// Action is the choice of the user, Build or Session is set when Connect was chosen on one of them.
+type Action struct {
+	Kind    ActionKind
+	Build   *bitrise.Build
+	Session *workspace.Entry
+	Args    []string
+}
+
+const refreshInterval = 15 * time.Second
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#c289e6"))
+	headerStyle   = lipgloss.NewStyle().Bold(true).MarginTop(1)
+	selectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#c289e6"))
+	faintStyle    = lipgloss.NewStyle().Faint(true)
+)
+
+// item is a row that can be selected, a running build or a recent session.
+type item struct {
+	build   *bitrise.Build
+	session *workspace.Entry
+}
+
+type statusMsg string
+
+type buildsMsg struct {
+	builds []bitrise.Build
+	err    error
+}
+
+type sessionsMsg []workspace.Entry
+
+type tickMsg struct{}
+
+type model struct {
+	// token is empty if the user has no API token, the builds are not listed then
+	token    string
+	status   string
+	builds   []bitrise.Build
+	buildErr error
+	loading  bool
+	sessions []workspace.Entry
+	cursor   int
+	action   Action
+
+	palette []PaletteEntry
+	// searching is set while the palette is open
+	searching     bool
+	query         string
+	paletteCursor int
+}
+
+// Run shows the dashboard until the user chooses an action or quits, the palette launches the entries.
+func Run(token string, palette []PaletteEntry) (Action, error) {
+	final, err := tea.NewProgram(model{token: token, loading: token != "", palette: palette}, tea.WithAltScreen()).Run()
+	if err != nil {
+		return Action{}, fmt.Errorf("run dashboard: %w", err)
+	}
+	return final.(model).action, nil
+}
+
+func (m model) Init() tea.Cmd {
+	return tea.Batch(loadStatus, loadSessions, m.loadBuilds(), tick())
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(refreshInterval, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+// loadStatus describes the connection: the daemon's if it runs, otherwise the last session's host.
+func loadStatus() tea.Msg {
+	status, err := ssh.QueryDaemon()
+	if err == nil {
+		state := "connected"
+		if !status.Connected {
+			state = "reconnecting"
+		}
+		return statusMsg(fmt.Sprintf("Daemon %s to %s, %d forwards", state, status.Host, len(status.Forwards)))
+	}
+	if !errors.Is(err, ssh.ErrDaemonNotRunning) {
+		return statusMsg(fmt.Sprintf("Daemon: %s", err))
+	}
+
+	address, err := ssh.LastSession()
+	if err != nil {
+		return statusMsg("No session, connect to a build first")
+	}
+	return statusMsg("Last session: " + address)
+}
+
+func loadSessions() tea.Msg {
+	sessions, _ := workspace.Recent()
+	return sessionsMsg(sessions)
+}
+
+func (m model) loadBuilds() tea.Cmd {
+	if m.token == "" {
+		return nil
+	}
+	token := m.token
+	return func() tea.Msg {
+		builds, err := bitrise.NewClient(token).RunningBuilds()
+		return buildsMsg{builds: builds, err: err}
+	}
+}
+
+func (m model) items() []item {
+	var items []item
+	for i := range m.builds {
+		items = append(items, item{build: &m.builds[i]})
+	}
+	for i := range m.sessions {
+		items = append(items, item{session: &m.sessions[i]})
+	}
+	return items
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case statusMsg:
+		m.status = string(msg)
+	case buildsMsg:
+		m.builds, m.buildErr, m.loading = msg.builds, msg.err, false
+	case sessionsMsg:
+		m.sessions = msg
+	case tickMsg:
+		return m, tea.Batch(loadStatus, m.loadBuilds(), tick())
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+
+	if items := m.items(); m.cursor >= len(items) {
+		m.cursor = max(len(items)-1, 0)
+	}
+	return m, nil
+}
+
+func (m model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.searching {
+		return m.handlePaletteKey(msg)
+	}
+
+	items := m.items()
+	switch msg.String() {
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(items)-1 {
+			m.cursor++
+		}
+	case "enter":
+		m.action = Action{Kind: Connect}
+		if m.cursor < len(items) {
+			m.action.Build, m.action.Session = items[m.cursor].build, items[m.cursor].session
+		}
+		return m, tea.Quit
+	case "c":
+		m.action = Action{Kind: Connect}
+		return m, tea.Quit
+	case "s":
+		m.action = Action{Kind: Shell}
+		return m, tea.Quit
+	case "l":
+		m.action = Action{Kind: Logs}
+		return m, tea.Quit
+	case "x":
+		m.action = Action{Kind: Cleanup}
+		return m, tea.Quit
+	case "r":
+		m.loading = m.token != ""
+		return m, tea.Batch(loadStatus, loadSessions, m.loadBuilds())
+	case "/", "ctrl+k":
+		m.searching, m.query, m.paletteCursor = true, "", 0
+	case "q", "esc", "ctrl+c":
+		m.action = Action{Kind: Quit}
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// handlePaletteKey edits the query and moves between the matches, the letters don't trigger the actions meanwhile.
+func (m model) handlePaletteKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	matches := matchPalette(m.palette, m.query)
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.searching = false
+	case tea.KeyCtrlC:
+		m.action = Action{Kind: Quit}
+		return m, tea.Quit
+	case tea.KeyUp, tea.KeyCtrlP:
+		if m.paletteCursor > 0 {
+			m.paletteCursor--
+		}
+	case tea.KeyDown, tea.KeyCtrlN:
+		if m.paletteCursor < min(len(matches), maxPaletteRows)-1 {
+			m.paletteCursor++
+		}
+	case tea.KeyEnter:
+		if m.paletteCursor < len(matches) {
+			m.action = Action{Kind: Launch, Args: matches[m.paletteCursor].Args}
+			return m, tea.Quit
+		}
+	case tea.KeyBackspace:
+		if runes := []rune(m.query); len(runes) > 0 {
+			m.query = string(runes[:len(runes)-1])
+			m.paletteCursor = 0
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.query += string(msg.Runes)
+		m.paletteCursor = 0
+	}
+	return m, nil
+}
+
+func (m model) paletteView() string {
+	var view strings.Builder
+	view.WriteString(titleStyle.Render("Bitrise Remote Access") + "\n")
+	view.WriteString("> " + m.query + "\n\n")
+
+	matches := matchPalette(m.palette, m.query)
+	if len(matches) == 0 {
+		view.WriteString(faintStyle.Render("  Nothing matches") + "\n")
+	}
+	for i, match := range matches[:min(len(matches), maxPaletteRows)] {
+		title := "  " + match.Title
+		if i == m.paletteCursor {
+			title = selectedStyle.Render("> " + match.Title)
+		}
+		view.WriteString(title + " " + faintStyle.Render(match.Detail) + "\n")
+	}
+
+	view.WriteString("\n" + faintStyle.Render("type to search · ↑/↓ select · enter run · esc back") + "\n")
+	return view.String()
+}
+
+func (m model) View() string {
+	if m.searching {
+		return m.paletteView()
+	}
+
+	var view strings.Builder
+	view.WriteString(titleStyle.Render("Bitrise Remote Access") + "\n")
+	status := m.status
+	if status == "" {
+		status = "Checking the connection..."
+	}
+	view.WriteString(status + "\n")
+
+	row := 0
+	line := func(text string) {
+		if row == m.cursor {
+			view.WriteString(selectedStyle.Render("> "+text) + "\n")
+		} else {
+			view.WriteString("  " + text + "\n")
+		}
+		row++
+	}
+
+	view.WriteString(headerStyle.Render("Running builds") + "\n")
+	switch {
+	case m.token == "":
+		view.WriteString(faintStyle.Render("  Log in with `auth login` to list the running builds") + "\n")
+	case m.loading && len(m.builds) == 0:
+		view.WriteString(faintStyle.Render("  Loading...") + "\n")
+	case m.buildErr != nil:
+		view.WriteString(faintStyle.Render("  "+m.buildErr.Error()) + "\n")
+	case len(m.builds) == 0:
+		view.WriteString(faintStyle.Render("  No running builds") + "\n")
+	}
+	for _, build := range m.builds {
+		app := ""
+		if build.App != nil {
+			app = build.App.Title + " "
+		}
+		line(fmt.Sprintf("%s#%d %s (%s)", app, build.BuildNumber, build.TriggeredWorkflow, build.Branch))
+	}
+
+	view.WriteString(headerStyle.Render("Recent sessions") + "\n")
+	if len(m.sessions) == 0 {
+		view.WriteString(faintStyle.Render("  No sessions in the last day") + "\n")
+	}
+	for _, session := range m.sessions {
+		line(fmt.Sprintf("%s:%s %s, %s ago", session.Host, session.Port, strings.Join(session.IDEs, ","),
+			time.Since(session.OpenedAt).Round(time.Minute)))
+	}
+
+	view.WriteString("\n" + faintStyle.Render("enter connect to selected · c connect · s shell · l logs · x cleanup · r refresh · / search commands · q quit") + "\n")
+	return view.String()
+}
@@ -0,0 +1,76 @@
+package dashboard
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// maxPaletteRows is how many matches are shown, the query narrows the rest down
+const maxPaletteRows = 12
+
+// PaletteEntry is something the palette can launch: a command, a saved profile or a recent host.
+type PaletteEntry struct {
+	Title  string
+	Detail string
+	// Args are the arguments the CLI is run again with
+	Args []string
+}
+
+type paletteMatch struct {
+	entry PaletteEntry
+	score int
+}
+
+// matchPalette returns the entries the query fuzzy matches, the best matches first.
+func matchPalette(entries []PaletteEntry, query string) []PaletteEntry {
+	var matches []paletteMatch
+	for _, entry := range entries {
+		if score, ok := fuzzyScore(query, entry.Title+" "+entry.Detail); ok {
+			matches = append(matches, paletteMatch{entry: entry, score: score})
+		}
+	}
+	// Equal scores keep the order of the entries, commands before profiles before hosts
+	slices.SortStableFunc(matches, func(a, b paletteMatch) int { return b.score - a.score })
+
+	result := make([]PaletteEntry, len(matches))
+	for i, match := range matches {
+		result[i] = match.entry
+	}
+	return result
+}
+
+// fuzzyScore reports whether the letters of the query appear in the text in order, and how well: runs of
+// consecutive letters and letters at the start of words score higher, so "ss" ranks "sim shutdown" over "status".
+func fuzzyScore(query, text string) (int, bool) {
+	query = strings.ToLower(strings.ReplaceAll(query, " ", ""))
+	if query == "" {
+		return 0, true
+	}
+
+	runes := []rune(strings.ToLower(text))
+	score, position, previous := 0, 0, -2
+	for _, want := range query {
+		found := -1
+		for i := position; i < len(runes); i++ {
+			if runes[i] == want {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return 0, false
+		}
+
+		score++
+		if found == previous+1 {
+			score += 3
+		}
+		if found == 0 || !unicode.IsLetter(runes[found-1]) && !unicode.IsDigit(runes[found-1]) {
+			score += 2
+		}
+		previous, position = found, found+1
+	}
+	// Shorter texts are closer matches of the same letters
+	return score*100 - len(runes), true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/urfave/cli/v3"
+)
+
+func debugserver(ctx context.Context, cliCmd *cli.Command) error {
+	process := cliCmd.Args().First()
+	if process == "" {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("process to attach to is required"))
+	}
+
+	session, err := ssh.StartDebugserver(process, int(cliCmd.Int(debugPortFlag)), passwordFlag(cliCmd))
+	if err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+	defer session.Stop()
+
+	logger.PrintFormattedOutput(fmt.Sprintf("debugserver attached to process %d", session.PID), fmt.Sprintf(
+		"Connect from lldb with:\n\n(lldb) process connect connect://localhost:%d\n\nPress Enter to stop debugging", session.LocalPort))
+	return waitForEnterOr(session.Done)
+}
+
+func jdwp(ctx context.Context, cliCmd *cli.Command) error {
+	port := int(cliCmd.Int(debugPortFlag))
+	var session *ssh.DebugSession
+	var err error
+	if process := cliCmd.String(attachFlag); process != "" {
+		session, err = ssh.AttachJDWP(process, port, passwordFlag(cliCmd))
+	} else if cliCmd.Args().Len() > 0 {
+		session, err = ssh.LaunchJDWP(shellJoin(cliCmd.Args().Slice()), port, os.Stdout, passwordFlag(cliCmd))
+	} else {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("command to run or --%s is required", attachFlag))
+	}
+	if err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+	defer session.Stop()
+
+	header := "JVM waiting for a debugger"
+	if session.PID != 0 {
+		header = fmt.Sprintf("JVM process %d ready for a debugger", session.PID)
+	}
+	logger.PrintFormattedOutput(header, fmt.Sprintf(
+		"IntelliJ IDEA: add a Remote JVM Debug configuration with host localhost and port %d\n\n"+
+			"VS Code: add to .vscode/launch.json\n\n"+
+			`{ "type": "java", "name": "Attach to Bitrise VM", "request": "attach", "hostName": "localhost", "port": %d }`+
+			"\n\nPress Enter to stop debugging", session.LocalPort, session.LocalPort))
+	return waitForEnterOr(session.Done)
+}
+
+func rerunStep(ctx context.Context, cliCmd *cli.Command) error {
+	step := cliCmd.Args().First()
+	if step == "" {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("step to run is required"))
+	}
+
+	logger.Infof("Running %s on the VM...", step)
+	if err := ssh.RerunStep(step, os.Stdout, passwordFlag(cliCmd)); err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+	logger.Successf("%s finished", step)
+	return nil
+}
+
+func checkout(ctx context.Context, cliCmd *cli.Command) error {
+	ref := cliCmd.Args().First()
+	if ref == "" {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("branch or pull request to check out is required"))
+	}
+
+	logger.Infof("Checking out %s on the VM...", ref)
+	result, err := ssh.Checkout(ref, os.Stdout, passwordFlag(cliCmd))
+	if err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+
+	if result.Branch != "" {
+		logger.Successf("%s checked out, the editor picks the change up on its own", result.Branch)
+	} else {
+		logger.Successf("%s checked out in detached HEAD state", ref)
+	}
+	back := fmt.Sprintf("git checkout %s", shellJoin([]string{result.Previous}))
+	if result.Stashed {
+		back += " && git stash pop"
+	}
+	logger.Infof("To return to the state of the build, run in the source directory: %s", back)
+	return nil
+}
@@ -0,0 +1,22 @@
+// Package desktop hands files and URLs over to the apps of the user's desktop.
+package desktop
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// Open opens the file or URL with its default app, eg. an image with the image viewer or a URL with the browser.
+// On Windows the shell's file handler is used instead of start, which cmd would parse the path for.
+func Open(target string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/bitrise-io/bitrise-remote-access-cli/support"
+	"github.com/urfave/cli/v3"
+)
+
+func supportBundle(ctx context.Context, cliCmd *cli.Command) error {
+	zipPath := cliCmd.Args().First()
+	if zipPath == "" {
+		zipPath = fmt.Sprintf("bitrise-remote-access-support-%s.zip", time.Now().Format("20060102-150405"))
+	}
+
+	logs := []string{
+		filepath.Join(paths.StateDir(), support.TranscriptFileName),
+		filepath.Join(paths.StateDir(), daemonLogFileName),
+	}
+	names, err := support.Create(zipPath, logs)
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+	logger.PrintFormattedOutput(fmt.Sprintf("Support bundle saved to %s", zipPath), strings.Join(names, "\n"))
+	logger.Info("The address of the VM, the user and the password are redacted, check the files before sharing them")
+	return nil
+}
+
+// diffEnv saves a snapshot of the VM or compares it with a saved one, two snapshots are compared with each other
+// without connecting.
+func diffEnv(ctx context.Context, cliCmd *cli.Command) error {
+	args := cliCmd.Args().Slice()
+	savePath := cliCmd.String(saveFlag)
+	if (savePath == "" && len(args) == 0) || len(args) > 2 || (savePath != "" && len(args) > 0) {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("expected --%s <FILE> or the snapshots to compare", saveFlag))
+	}
+
+	var snapshots []*ssh.EnvSnapshot
+	for _, path := range args {
+		snapshot, err := ssh.LoadEnvSnapshot(path)
+		if err != nil {
+			return failure.New(failure.Config, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	if len(snapshots) < 2 {
+		logger.Info("Capturing the environment of the VM...")
+		current, err := ssh.CaptureEnv(passwordFlag(cliCmd))
+		if err != nil {
+			return failure.Default(failure.RemoteSetup, err)
+		}
+		if savePath != "" {
+			if err := ssh.SaveEnvSnapshot(current, savePath); err != nil {
+				return err
+			}
+			logger.Successf("Snapshot saved to %s, compare another build with `%s %s %s`", savePath, cliName, diffEnvCommand, savePath)
+			return nil
+		}
+		snapshots = append(snapshots, current)
+	}
+
+	changes := ssh.DiffEnv(snapshots[0], snapshots[1])
+	if len(changes) == 0 {
+		logger.Success("No differences found")
+		return nil
+	}
+	for _, change := range changes {
+		switch {
+		case change.Old == "":
+			fmt.Printf("+ %-5s %s: %s\n", change.Section, change.Name, change.New)
+		case change.New == "":
+			fmt.Printf("- %-5s %s: %s\n", change.Section, change.Name, change.Old)
+		default:
+			fmt.Printf("~ %-5s %s: %s -> %s\n", change.Section, change.Name, change.Old, change.New)
+		}
+	}
+	return nil
+}
+
+// info reports the stack and the architecture of the VM and warns about the differences from this machine.
+func info(ctx context.Context, cliCmd *cli.Command) error {
+	remote, err := ssh.DetectArch(passwordFlag(cliCmd))
+	if err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+	stack, err := ssh.DetectStack(passwordFlag(cliCmd))
+	if err != nil {
+		return failure.New(failure.RemoteSetup, err)
+	}
+	local := ssh.LocalArch()
+	warnings := append(stack.Advice(), ssh.ArchWarnings(remote, local)...)
+
+	if cliCmd.Bool(jsonFlag) {
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			Stack    *ssh.StackInfo `json:"stack"`
+			VM       *ssh.Arch      `json:"vm"`
+			Local    ssh.Arch       `json:"local"`
+			Warnings []string       `json:"warnings,omitempty"`
+		}{stack, remote, local, warnings})
+	}
+
+	var stackLines []string
+	for _, field := range []struct{ name, value string }{
+		{"Revision:     ", stack.Revision},
+		{"bitrise.yml:  ", stack.Declared},
+		{"Xcode:        ", stack.RemoteXcode},
+		{"Local Xcode:  ", stack.LocalXcode},
+	} {
+		if field.value != "" {
+			stackLines = append(stackLines, field.name+field.value)
+		}
+	}
+	if len(stackLines) > 0 {
+		logger.PrintFormattedOutput("Stack", strings.Join(stackLines, "\n"))
+	}
+
+	lines := []string{fmt.Sprintf("VM:           %s", remote)}
+	if len(remote.Toolchain) > 0 {
+		lines = append(lines, fmt.Sprintf("Toolchain:    %s", strings.Join(remote.Toolchain, ", ")))
+	}
+	lines = append(lines, fmt.Sprintf("This machine: %s", local))
+	logger.PrintFormattedOutput("Architecture", strings.Join(lines, "\n"))
+	for _, warning := range warnings {
+		logger.Warn(warning)
+	}
+	return nil
+}
+
+func check(ctx context.Context, cliCmd *cli.Command) error {
+	jsonOutput = cliCmd.Bool(jsonFlag)
+
+	ssh.SetSkipDNSCheck(cliCmd.Bool(skipDNSCheckFlag))
+	ssh.SetWebSocketURL(cliCmd.String(webSocketURLFlag))
+	if err := ssh.SetNetwork(cliCmd.String(networkFlag), cliCmd.String(interfaceFlag)); err != nil {
+		return failure.New(failure.Config, err)
+	}
+	if err := ssh.SetCertificate(cliCmd.String(certificateFlag)); err != nil {
+		return failure.New(failure.Config, fmt.Errorf("--%s: %w", certificateFlag, err))
+	}
+
+	password := passwordFlag(cliCmd)
+
+	err := ssh.CheckConnection(cliCmd.String(sshHostFlag), cliCmd.String(sshPortFlag), cliCmd.String(sshUserFlag), password)
+
+	var configErr ssh.ConfigErr
+	if errors.As(err, &configErr) {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return err
+	}
+	return explainWithBuildState(err, cliCmd.String(appSlugFlag), cliCmd.String(buildSlugFlag))
+}
@@ -0,0 +1,96 @@
+package failure
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Category tells wrappers what kind of problem ended the session.
+type Category string
+
+const (
+	Unknown     Category = "unknown"
+	Config      Category = "config"
+	Network     Category = "network"
+	Auth        Category = "auth"
+	RemoteSetup Category = "remote_setup"
+	IDE         Category = "ide"
+)
+
+var exitCodes = map[Category]int{
+	Unknown:     1,
+	Config:      2,
+	Network:     3,
+	Auth:        4,
+	RemoteSetup: 5,
+	IDE:         6,
+}
+
+// Categorized is implemented by errors that know their category.
+type Categorized interface {
+	Category() Category
+}
+
+// Error attaches a category to an error.
+type Error struct {
+	category Category
+	err      error
+}
+
+// New wraps err with the category, returns nil for a nil err.
+func New(category Category, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{category: category, err: err}
+}
+
+func (e *Error) Error() string {
+	return e.err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+func (e *Error) Category() Category {
+	return e.category
+}
+
+// Default wraps err with the category unless it already has one, returns nil for a nil err.
+func Default(category Category, err error) error {
+	if CategoryOf(err) != Unknown {
+		return err
+	}
+	return New(category, err)
+}
+
+// CategoryOf returns the category of the outermost categorized error in the chain.
+func CategoryOf(err error) Category {
+	var categorized Categorized
+	if errors.As(err, &categorized) {
+		return categorized.Category()
+	}
+	return Unknown
+}
+
+// ExitCode returns the process exit code for the error.
+func ExitCode(err error) int {
+	return exitCodes[CategoryOf(err)]
+}
+
+type summary struct {
+	Error    string   `json:"error"`
+	Category Category `json:"category"`
+	ExitCode int      `json:"exit_code"`
+}
+
+// JSONSummary returns the machine-readable description of the error.
+func JSONSummary(err error) string {
+	content, _ := json.Marshal(summary{
+		Error:    err.Error(),
+		Category: CategoryOf(err),
+		ExitCode: ExitCode(err),
+	})
+	return string(content)
+}
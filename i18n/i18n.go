@@ -0,0 +1,61 @@
+package i18n
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LocaleEnvVar selects the language of the messages, eg. ja. It takes precedence over the settings and the
+// locale of the system.
+const LocaleEnvVar = "BITRISE_REMOTE_LANG"
+
+const (
+	English  = "en"
+	Japanese = "ja"
+)
+
+// catalogs holds the translations keyed by the English message, English needs none
+var catalogs = map[string]map[string]string{
+	Japanese: japanese,
+}
+
+var localeOverride string
+
+// SetLocale sets the locale chosen in the settings, LocaleEnvVar still takes precedence.
+func SetLocale(locale string) {
+	localeOverride = locale
+}
+
+// Locale returns the language of the messages: $BITRISE_REMOTE_LANG, the settings, then $LC_ALL, $LC_MESSAGES
+// and $LANG. Unsupported languages fall back to English.
+func Locale() string {
+	candidates := []string{os.Getenv(LocaleEnvVar), localeOverride, os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")}
+	for _, candidate := range candidates {
+		// eg. ja_JP.UTF-8
+		parts := strings.FieldsFunc(candidate, func(r rune) bool { return r == '_' || r == '-' || r == '.' })
+		if len(parts) == 0 {
+			continue
+		}
+		language := strings.ToLower(parts[0])
+		if language == English {
+			return English
+		}
+		if _, ok := catalogs[language]; ok {
+			return language
+		}
+	}
+	return English
+}
+
+// T returns the message in the language of Locale, formatted with the args like fmt.Sprintf. Messages
+// without a translation are returned in English.
+func T(message string, args ...any) string {
+	if translated, ok := catalogs[Locale()][message]; ok {
+		message = translated
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
@@ -0,0 +1,105 @@
+package i18n
+
+var japanese = map[string]string{
+	// Connection setup
+	"Setting up SSH config of remote host...":       "リモートホストの SSH 設定を行っています...",
+	"Removing old host key...":                      "古いホスト鍵を削除しています...",
+	"No old host keys remaining":                    "古いホスト鍵は残っていません",
+	"Connecting to remote host...":                  "リモートホストに接続しています...",
+	"Detecting remote environment...":               "リモート環境を検出しています...",
+	"Remote environment detected":                   "リモート環境を検出しました",
+	"Ensuring SSH key is available...":              "SSH 鍵を準備しています...",
+	"SSH key already ensured":                       "SSH 鍵は準備済みです",
+	"SSH key ensured":                               "SSH 鍵を準備しました",
+	"Verifying the SSH key is accepted...":          "SSH 鍵が受け入れられるか確認しています...",
+	"SSH key accepted":                              "SSH 鍵が受け入れられました",
+	"Adding message of the day to shell configs...": "シェル設定に MOTD を追加しています...",
+	"MOTD added to shell configs":                   "シェル設定に MOTD を追加しました",
+	"Unrecognized OS type: %s":                      "認識できない OS タイプです: %s",
+	"README copy skipped on the slow link":          "回線が遅いため README のコピーをスキップしました",
+	"Copying README file to remote...":              "README ファイルをリモートにコピーしています...",
+	"README file already copied":                    "README ファイルはコピー済みです",
+	"README file copied":                            "README ファイルをコピーしました",
+	"Looking for the log of the failed step...":     "失敗したステップのログを探しています...",
+	"No failed step log found":                      "失敗したステップのログは見つかりませんでした",
+	"Measuring round-trip time...":                  "往復遅延時間を測定しています...",
+	"The link is very slow, compression is turned on and optional steps are skipped. Remote - SSH may be sluggish.": "回線が非常に遅いため、圧縮を有効にし、任意の手順をスキップします。Remote - SSH の動作が重くなる可能性があります。",
+	"The link is slow, compression is turned on. Remote - SSH may be sluggish.":                                     "回線が遅いため、圧縮を有効にします。Remote - SSH の動作が重くなる可能性があります。",
+
+	// Disconnect
+	"No session to disconnect from":   "切断するセッションはありません",
+	"Daemon stopped":                  "デーモンを停止しました",
+	"Removing SSH key from remote...": "リモートから SSH 鍵を削除しています...",
+	"SSH key removed from remote":     "リモートから SSH 鍵を削除しました",
+	"Shell configs restored":          "シェル設定を元に戻しました",
+	"Removing host key...":            "ホスト鍵を削除しています...",
+	"No host keys remaining":          "ホスト鍵は残っていません",
+	"Removing SSH config entry...":    "SSH 設定エントリを削除しています...",
+	"SSH config entry removed":        "SSH 設定エントリを削除しました",
+
+	// Refresh
+	"New SSH password of the VM":             "VM の新しい SSH パスワード",
+	"Connecting with the new credentials...": "新しい認証情報で接続しています...",
+	"Connected with the new credentials":     "新しい認証情報で接続しました",
+	"Authorizing the session key again...":   "セッション鍵を再登録しています...",
+	"Session key authorized":                 "セッション鍵を登録しました",
+	"Verifying the session key...":           "セッション鍵を確認しています...",
+	"Session key accepted":                   "セッション鍵が受け入れられました",
+
+	// Stack
+	"Comparing the stack with bitrise.yml and the local Xcode...": "スタックを bitrise.yml とローカルの Xcode と比較しています...",
+	"The stack matches": "スタックは一致しています",
+	"The stack differs": "スタックが異なります",
+
+	// Read-only SSH config
+	"%s, so it isn't changed. How should the editors find the Bitrise host?":     "%s のため変更しません。エディターが Bitrise のホストを見つける方法を選んでください",
+	"Only VS Code, through its remote.SSH.configFile setting":                    "VS Code のみ（remote.SSH.configFile 設定を使用）",
+	"Show me the lines to add to the source of my SSH config":                    "SSH 設定の元ファイルに追加する行を表示する",
+	"Add this to your VS Code settings":                                          "VS Code の設定に次を追加してください",
+	"Other editors can't find %s, `ssh -F %s %s` still works from the terminal.": "他のエディターからは %s を利用できません。ターミナルからは `ssh -F %s %s` で接続できます。",
+	"%s, included the Bitrise SSH config from %s instead":                        "%s のため、代わりに %s から Bitrise の SSH 設定を読み込むようにしました",
+
+	// Lock
+	"Another session (pid %d) is configuring the SSH config, waiting for it...": "別のセッション (pid %d) が SSH 設定を構成中です。完了を待っています...",
+
+	// Reuse
+	"Reusing the %s already running on the VM":                 "VM で実行中の %s を再利用します",
+	"SSH key already accepted by the running server's session": "SSH キーは実行中のサーバーのセッションで受け入れ済みです",
+
+	// Prompts
+	"Some connection parameters are missing, you can find them on the build's page under Remote Access": "接続パラメーターが不足しています。ビルドページの Remote Access で確認できます",
+	"Host":                   "ホスト",
+	"Port":                   "ポート",
+	"User":                   "ユーザー",
+	"Password":               "パスワード",
+	"Editor":                 "エディター",
+	"SSH password of the VM": "VM の SSH パスワード",
+	"Store the password in the keychain until you disconnect?\nrepair, push and pull won't ask for it then.": "切断するまでパスワードをキーチェーンに保存しますか？\nrepair、push、pull でパスワードを聞かれなくなります。",
+	"Password stored for the session": "このセッションのパスワードを保存しました",
+
+	// Onboarding
+	"Welcome! A few questions to set up the defaults, run `setup` to change them later": "ようこそ！初期設定のためにいくつか質問します。後から `setup` で変更できます",
+	"Prerequisites": "前提条件",
+	"No editor found in $PATH, the shell can still be used": "$PATH にエディターが見つかりません。シェルは利用できます",
+	"Editors: %s":        "エディター: %s",
+	"OpenSSH client: %s": "OpenSSH クライアント: %s",
+	"Keychain available": "キーチェーンを利用できます",
+	"No keychain found, tokens are stored in a file only readable by you": "キーチェーンが見つかりません。トークンはあなただけが読めるファイルに保存されます",
+	"Detect it every time":                                        "毎回自動検出する",
+	"Default editor of the auto command":                          "auto コマンドのデフォルトエディター",
+	"Keep the SSH password in the keychain until you disconnect?": "切断するまで SSH パスワードをキーチェーンに保存しますか？",
+	"Ask every time":                                              "毎回確認する",
+	"Always, the commands of the session won't ask for it":        "常に保存する（セッション中のコマンドで聞かれなくなります）",
+	"Never": "保存しない",
+	"Send anonymous usage metrics?\nOnly the commands, their duration and outcome, never hosts, paths or passwords.": "匿名の利用状況を送信しますか？\nコマンド、所要時間、結果のみを送信し、ホスト、パス、パスワードは送信しません。",
+	"Thanks, metrics enabled": "ありがとうございます。送信を有効にしました",
+	"Metrics disabled":        "送信を無効にしました",
+	"Set up a Bitrise personal access token?\nIt's needed by rebuild and for explaining failed connections.": "Bitrise のパーソナルアクセストークンを設定しますか？\nrebuild や接続失敗の原因表示に必要です。",
+	"Skipped, run `%s %s <NAME>` later":   "スキップしました。後から `%s %s <NAME>` を実行してください",
+	"Personal access token":               "パーソナルアクセストークン",
+	"Logged in as %s":                     "%s としてログインしました",
+	"Settings saved to %s":                "設定を %s に保存しました",
+	"System default":                      "システムの設定に従う",
+	"Log of the failed step: <file://%s>": "失敗したステップのログ: <file://%s>",
+	"Language of the messages":            "メッセージの言語",
+}
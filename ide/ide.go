@@ -1,9 +1,69 @@
 package ide
 
+import "runtime"
+
 type IDE struct {
-	Identifier string
-	Name       string
-	Aliases    []string
-	OnOpen     func(hostPattern, folderPath, additionalInfo string) error
-	OnTestPath func() (string, bool)
+	Identifier   string
+	Name         string
+	Aliases      []string
+	Capabilities Capabilities
+	OnOpen       func(hostPattern, folderPath, additionalInfo string, options OpenOptions) error
+	OnTestPath   func() (string, bool)
+}
+
+// OpenOptions are the launch preferences of the user, IDEs ignore the ones they don't support.
+type OpenOptions struct {
+	// ReuseWindow opens the project in the last active window
+	ReuseWindow bool
+	// NewWindow forces a new window even if the project is already open
+	NewWindow bool
+	// RemoteExtensions are installed on the remote side so language support is ready when the window opens
+	RemoteExtensions []string
+	// Offline skips the optional steps that need internet access on the local machine, eg. extension installs
+	Offline bool
+	// Mosh uses mosh instead of plain SSH for terminal sessions, it copes better with high-latency links
+	Mosh bool
+	// RecordPath is where terminal sessions are recorded in asciicast format, empty if not recorded
+	RecordPath string
+	// ContextFiles are remote files opened as editor tabs next to the folder, eg. the build's bitrise.yml
+	ContextFiles []string
+	// SkipVerify reports success once the IDE is launched, without waiting for it to connect to the VM
+	SkipVerify bool
+	// Password authenticates the check of the IDE's connection if the key is not used
+	Password *string
+	// DisableWorkspaceTrust opens the folder without asking whether its authors are trusted
+	DisableWorkspaceTrust bool
+	// DisableTelemetry turns off the IDE's usage data collection for the session
+	DisableTelemetry bool
+	// Goto is the remote file position the IDE jumps to after opening the folder, nil to only open the folder
+	Goto *Location
+}
+
+// Capabilities tell the CLI how to prepare the connection for the IDE.
+type Capabilities struct {
+	// KeyAuth is set if the IDE's SSH client can use the generated key instead of the password
+	KeyAuth bool
+	// PasswordPaste is set if the user has to paste the password into the IDE when the key is not used
+	PasswordPaste bool
+	// FolderURI is set if the IDE opens the remote source directory directly
+	FolderURI bool
+	// ExtensionInstall is set if the IDE needs an extension to connect over SSH
+	ExtensionInstall bool
+	// Goto is set if the IDE can open a remote file at a line
+	Goto bool
+	// Platforms lists the supported GOOS values, empty means every platform
+	Platforms []string
+}
+
+// SupportsCurrentPlatform reports whether the IDE can be used on this OS.
+func (i IDE) SupportsCurrentPlatform() bool {
+	if len(i.Capabilities.Platforms) == 0 {
+		return true
+	}
+	for _, platform := range i.Capabilities.Platforms {
+		if platform == runtime.GOOS {
+			return true
+		}
+	}
+	return false
 }
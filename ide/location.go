@@ -0,0 +1,76 @@
+package ide
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Location is a position in a remote file, eg. where a test failed.
+type Location struct {
+	Path string
+	// Line and Column are 1-based, 0 if not given
+	Line   int
+	Column int
+}
+
+// ParseLocation parses a path:line:col location, the line and the column can be left out.
+func ParseLocation(value string) (*Location, error) {
+	location := &Location{Path: value}
+
+	// The numbers are taken from the end, a path may contain colons itself
+	var numbers []int
+	for len(numbers) < 2 {
+		rest, last, found := cutLast(location.Path, ":")
+		if !found {
+			break
+		}
+		number, err := strconv.Atoi(last)
+		if err != nil {
+			break
+		}
+		if number <= 0 {
+			return nil, fmt.Errorf("invalid location %s: lines and columns start at 1", value)
+		}
+		numbers = append([]int{number}, numbers...)
+		location.Path = rest
+	}
+	if location.Path == "" {
+		return nil, fmt.Errorf("invalid location %s: the path is missing", value)
+	}
+
+	if len(numbers) > 0 {
+		location.Line = numbers[0]
+	}
+	if len(numbers) > 1 {
+		location.Column = numbers[1]
+	}
+	return location, nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// Resolve returns the location with a relative path joined to the folder opened on the VM.
+func (l Location) Resolve(folderPath string) Location {
+	if !path.IsAbs(l.Path) && folderPath != "" {
+		l.Path = path.Join(folderPath, l.Path)
+	}
+	return l
+}
+
+// String formats the location as path:line:col, the format of VS Code's --goto.
+func (l Location) String() string {
+	switch {
+	case l.Column > 0:
+		return fmt.Sprintf("%s:%d:%d", l.Path, l.Line, l.Column)
+	case l.Line > 0:
+		return fmt.Sprintf("%s:%d", l.Path, l.Line)
+	}
+	return l.Path
+}
@@ -0,0 +1,147 @@
+package ide
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+)
+
+const (
+	// DefinitionsFileName is the name of the user config file with external IDE definitions.
+	DefinitionsFileName = "ides.json"
+
+	hostPlaceholder   = "{host}"
+	folderPlaceholder = "{folder}"
+	filePlaceholder   = "{file}"
+	linePlaceholder   = "{line}"
+	columnPlaceholder = "{column}"
+)
+
+var registry []IDE
+
+// Definition describes an IDE that is not built into the CLI, eg.
+//
+//	{"identifier": "zed", "name": "Zed", "detect_command": "zed", "open_command": ["zed", "ssh://{host}{folder}"]}
+type Definition struct {
+	Identifier    string   `json:"identifier"`
+	Name          string   `json:"name"`
+	Aliases       []string `json:"aliases"`
+	DetectCommand string   `json:"detect_command"`
+	OpenCommand   []string `json:"open_command"`
+	// GotoCommand opens a remote file at a line after the folder, eg. ["zed", "ssh://{host}{file}:{line}:{column}"]
+	GotoCommand   []string `json:"goto_command"`
+	KeyAuth       bool     `json:"key_auth"`
+	PasswordPaste bool     `json:"password_paste"`
+	FolderURI     bool     `json:"folder_uri"`
+	Platforms     []string `json:"platforms"`
+}
+
+// Register adds IDEs to the registry, replacing the ones with the same identifier.
+func Register(ides ...IDE) {
+	for _, ide := range ides {
+		replaced := false
+		for i, registered := range registry {
+			if registered.Identifier == ide.Identifier {
+				registry[i] = ide
+				replaced = true
+			}
+		}
+		if !replaced {
+			registry = append(registry, ide)
+		}
+	}
+}
+
+// All returns the registered IDEs in registration order.
+func All() []IDE {
+	return registry
+}
+
+// LoadDefinitions registers the IDEs defined in the JSON file at path. A missing file is not an error.
+func LoadDefinitions(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read IDE definitions: %w", err)
+	}
+
+	var definitions []Definition
+	if err := json.Unmarshal(content, &definitions); err != nil {
+		return fmt.Errorf("parse IDE definitions %s: %w", path, err)
+	}
+
+	for _, definition := range definitions {
+		if definition.Identifier == "" || len(definition.OpenCommand) == 0 {
+			return fmt.Errorf("IDE definition in %s needs an identifier and an open_command", path)
+		}
+		Register(definition.toIDE())
+	}
+
+	return nil
+}
+
+func (d Definition) toIDE() IDE {
+	name := d.Name
+	if name == "" {
+		name = d.Identifier
+	}
+	detectCommand := d.DetectCommand
+	if detectCommand == "" {
+		detectCommand = d.OpenCommand[0]
+	}
+
+	return IDE{
+		Identifier: d.Identifier,
+		Name:       name,
+		Aliases:    d.Aliases,
+		Capabilities: Capabilities{
+			KeyAuth:       d.KeyAuth,
+			PasswordPaste: d.PasswordPaste,
+			FolderURI:     d.FolderURI,
+			Goto:          len(d.GotoCommand) > 0,
+			Platforms:     d.Platforms,
+		},
+		OnOpen: func(hostPattern, folderPath, additionalInfo string, options OpenOptions) error {
+			if additionalInfo != "" {
+				logger.PrintFormattedOutput(fmt.Sprintf("Opening %s", name), fmt.Sprintf("Source code location:\n\n%s\n\n%s", folderPath, additionalInfo))
+			} else {
+				logger.Infof("Opening %s...", folderPath)
+			}
+
+			replacer := strings.NewReplacer(hostPlaceholder, hostPattern, folderPlaceholder, folderPath)
+			if err := runTemplate(d.OpenCommand, replacer); err != nil {
+				return fmt.Errorf("open %s window: %w", name, err)
+			}
+
+			if options.Goto != nil && len(d.GotoCommand) > 0 {
+				replacer := strings.NewReplacer(hostPlaceholder, hostPattern, filePlaceholder, options.Goto.Path,
+					linePlaceholder, strconv.Itoa(max(options.Goto.Line, 1)), columnPlaceholder, strconv.Itoa(max(options.Goto.Column, 1)))
+				if err := runTemplate(d.GotoCommand, replacer); err != nil {
+					logger.Warnf("open %s in %s: %s", options.Goto, name, err)
+				}
+			}
+			return nil
+		},
+		OnTestPath: func() (string, bool) {
+			path, err := exec.LookPath(detectCommand)
+			return path, err == nil
+		},
+	}
+}
+
+// runTemplate runs the command with its placeholders replaced.
+func runTemplate(command []string, replacer *strings.Replacer) error {
+	args := make([]string, len(command))
+	for i, arg := range command {
+		args[i] = replacer.Replace(arg)
+	}
+	return interrupt.Command(args[0], args[1:]...).Run()
+}
@@ -0,0 +1,196 @@
+package interrupt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ExitCode is the exit code of the CLI when it's interrupted, the same as a shell's.
+const ExitCode = 130
+
+const (
+	// terminateWait is how long the spawned programs get to exit after the interrupt, before they are killed
+	terminateWait = 3 * time.Second
+	// writeWait is how long the config files being written get to be finished
+	writeWait    = 2 * time.Second
+	pollInterval = 50 * time.Millisecond
+)
+
+type snapshot struct {
+	content []byte
+	mode    os.FileMode
+	existed bool
+}
+
+var (
+	ctx, cancel = context.WithCancel(context.Background())
+
+	mu        sync.Mutex
+	snapshots = map[string]snapshot{}
+	order     []string
+	// writing is the number of tracked files being written, commands the number of programs running,
+	// the handler waits for them to finish
+	writing     int
+	commands    int
+	interrupted bool
+)
+
+// Context is canceled when the CLI is interrupted, the operations in flight should stop on it.
+func Context() context.Context {
+	return ctx
+}
+
+// Cmd is a program that's terminated when the CLI is interrupted, eg. code installing an extension, instead of being
+// left running. The handler waits for it to exit.
+type Cmd struct {
+	*exec.Cmd
+}
+
+// Command returns the command of a program that's terminated when the CLI is interrupted.
+func Command(name string, args ...string) *Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			// Windows has no interrupt signal for other processes
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = terminateWait
+	return &Cmd{Cmd: cmd}
+}
+
+// Run starts the program and waits for it, like exec.Cmd.Run.
+func (c *Cmd) Run() error {
+	defer running()()
+	return c.Cmd.Run()
+}
+
+// Output runs the program and returns its standard output, like exec.Cmd.Output.
+func (c *Cmd) Output() ([]byte, error) {
+	defer running()()
+	return c.Cmd.Output()
+}
+
+// CombinedOutput runs the program and returns its standard output and error, like exec.Cmd.CombinedOutput.
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	defer running()()
+	return c.Cmd.CombinedOutput()
+}
+
+func running() func() {
+	mu.Lock()
+	defer mu.Unlock()
+	commands++
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		commands--
+	}
+}
+
+// Track records the content of a config file before it's written for the first time in this run, so it's restored
+// if the CLI is interrupted. The returned function has to be called once the file is written.
+func Track(path string) func() {
+	mu.Lock()
+	defer mu.Unlock()
+	writing++
+	// The cleanup's own changes are kept
+	if _, ok := snapshots[path]; !ok && !interrupted {
+		snapshots[path] = take(path)
+		order = append(order, path)
+	}
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		writing--
+	}
+}
+
+// Keep forgets the recorded contents, so the files written so far are kept if the CLI is interrupted later, eg.
+// once the setup they belong to is finished.
+func Keep() {
+	mu.Lock()
+	defer mu.Unlock()
+	snapshots = map[string]snapshot{}
+	order = nil
+}
+
+func take(path string) snapshot {
+	info, err := os.Stat(path)
+	if err != nil {
+		return snapshot{}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot{}
+	}
+	return snapshot{content: content, mode: info.Mode().Perm(), existed: true}
+}
+
+// Handle runs cleanup and exits when the CLI is interrupted, after canceling the operations in flight, terminating
+// the spawned programs and restoring the tracked config files.
+func Handle(cleanup func(), restoreErr func(path string, err error)) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		cancel()
+		wait()
+
+		cleanup()
+
+		for path, err := range restore() {
+			restoreErr(path, err)
+		}
+		os.Exit(ExitCode)
+	}()
+}
+
+// wait waits for the spawned programs to exit and the files being written, so none of them is restored halfway.
+func wait() {
+	deadline := time.Now().Add(terminateWait + writeWait)
+	for {
+		mu.Lock()
+		if (writing == 0 && commands == 0) || time.Now().After(deadline) {
+			interrupted = true
+			mu.Unlock()
+			return
+		}
+		mu.Unlock()
+		time.Sleep(pollInterval)
+	}
+}
+
+// restore puts back the tracked files in the reverse order they were written.
+func restore() map[string]error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	failed := map[string]error{}
+	for i := len(order) - 1; i >= 0; i-- {
+		path := order[i]
+		original := snapshots[path]
+
+		var err error
+		if original.existed {
+			err = os.WriteFile(path, original.content, original.mode)
+		} else if err = os.Remove(path); errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		if err != nil {
+			failed[path] = err
+		}
+	}
+	return failed
+}
@@ -0,0 +1,34 @@
+package interrupt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeep(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "config")
+	restored := filepath.Join(dir, "known_hosts")
+	t.Cleanup(Keep)
+
+	Track(kept)()
+	if err := os.WriteFile(kept, []byte("Host bitrise\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	Keep()
+	Track(restored)()
+	if err := os.WriteFile(restored, []byte("bitrise ssh-ed25519 AAAA\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, err := range restore() {
+		t.Fatalf("restore %s: %s", path, err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Errorf("the file written before Keep was restored: %s", err)
+	}
+	if _, err := os.Stat(restored); !os.IsNotExist(err) {
+		t.Errorf("the file written after Keep was not restored: %v", err)
+	}
+}
@@ -2,12 +2,46 @@ package logger
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"time"
 
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
 )
 
+// output is where the messages are written, stdout unless it is reserved for machine-readable output
+var output io.Writer = os.Stdout
+
+// SetOutput redirects the messages, eg. to stderr when stdout is read by a script.
+func SetOutput(w io.Writer) {
+	output = w
+}
+
+// AccessibleEnvVar turns on the accessible mode, ACCESSIBLE is accepted too as huh's examples use it.
+const AccessibleEnvVar = "BITRISE_REMOTE_ACCESSIBLE"
+
+// accessible prints plain text for screen readers: no colors, no frames, and prompts read lines from stdin
+var accessible = os.Getenv(AccessibleEnvVar) != "" || os.Getenv("ACCESSIBLE") != ""
+
+// SetAccessible turns the accessible mode on or off.
+func SetAccessible(enabled bool) {
+	accessible = enabled
+}
+
+// quiet drops the info and success messages, warnings, errors and results are still printed
+var quiet bool
+
+// SetQuiet turns the quiet mode on or off.
+func SetQuiet(enabled bool) {
+	quiet = enabled
+}
+
+// IsQuiet reports whether the quiet mode is on.
+func IsQuiet() bool {
+	return quiet
+}
+
 const (
 	neutral90 = "#dfdae1"
 	neutral60 = "#94879b"
@@ -34,17 +68,30 @@ func Warn(a ...any) {
 }
 
 func Successf(format string, a ...any) {
+	if quiet {
+		return
+	}
 	message := fmt.Sprintf(format, a...)
 
 	write("INFO", message, blue70, green70, green70, true)
 }
 
 func Infof(format string, a ...any) {
+	if quiet {
+		return
+	}
 	message := fmt.Sprintf(format, a...)
 
 	write("INFO", message, blue70, neutral60, neutral90, false)
 }
 
+// Resultf prints the outcome of a command, it is shown in quiet mode too.
+func Resultf(format string, a ...any) {
+	message := fmt.Sprintf(format, a...)
+
+	write("DONE", message, blue70, green70, green70, true)
+}
+
 func Warnf(format string, a ...any) {
 	message := fmt.Sprintf(format, a...)
 
@@ -57,6 +104,11 @@ func Error(a ...any) {
 }
 
 func PrintFormattedOutput(headerText, bodyText string) {
+	if accessible {
+		fmt.Fprintf(output, "%s:\n%s\n\n", headerText, bodyText)
+		return
+	}
+
 	headerStyle := lipgloss.NewStyle().
 		Bold(true).
 		Foreground(lipgloss.Color(purple70)).
@@ -74,7 +126,7 @@ func PrintFormattedOutput(headerText, bodyText string) {
 	content := fmt.Sprintf("%s\n%s", header, body)
 	framedContent := frameStyle.Render(content)
 
-	fmt.Println(framedContent)
+	fmt.Fprintln(output, framedContent)
 }
 
 func Confirm(title, onYes, onNo string) (bool, error) {
@@ -88,6 +140,7 @@ func Confirm(title, onYes, onNo string) (bool, error) {
 		WithTheme(
 			confirmTheme(),
 		).
+		WithAccessible(accessible).
 		Run()
 
 	if err == nil {
@@ -101,6 +154,71 @@ func Confirm(title, onYes, onNo string) (bool, error) {
 	return confirm, err
 }
 
+// IsInteractive reports whether the standard input is a terminal that prompts can be shown on.
+func IsInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Input asks for a line of text, validate is called with the value before accepting it.
+func Input(title, placeholder string, validate func(string) error) (string, error) {
+	var value string
+
+	input := huh.NewInput().
+		Title(title).
+		Placeholder(placeholder).
+		Value(&value)
+	if validate != nil {
+		input = input.Validate(validate)
+	}
+
+	return value, input.
+		WithTheme(
+			confirmTheme(),
+		).
+		WithAccessible(accessible).
+		Run()
+}
+
+// Choose asks to pick one of the options and returns its index.
+func Choose(title string, options []string) (int, error) {
+	var choice int
+
+	huhOptions := make([]huh.Option[int], len(options))
+	for i, option := range options {
+		huhOptions[i] = huh.NewOption(option, i)
+	}
+
+	err := huh.NewSelect[int]().
+		Title(title).
+		Options(huhOptions...).
+		Value(&choice).
+		WithTheme(
+			confirmTheme(),
+		).
+		WithAccessible(accessible).
+		Run()
+
+	return choice, err
+}
+
+// Password asks for a secret without echoing it.
+func Password(title string) (string, error) {
+	var password string
+
+	err := huh.NewInput().
+		Title(title).
+		EchoMode(huh.EchoModePassword).
+		Value(&password).
+		WithTheme(
+			confirmTheme(),
+		).
+		WithAccessible(accessible).
+		Run()
+
+	return password, err
+}
+
 func confirmTheme() *huh.Theme {
 	t := huh.ThemeBase()
 
@@ -123,6 +241,12 @@ func confirmTheme() *huh.Theme {
 
 func write(tag, message string, tagColor, messageColorDark, messageColorLight string, boldText bool) {
 	timestamp := time.Now().Format("15:04:05")
+	if accessible {
+		// The tag is kept as a word, it's what tells a warning from an info without colors
+		fmt.Fprintf(output, "%s [%s] %s\n", tag, timestamp, message)
+		return
+	}
+
 	tagStr := lipgloss.NewStyle().
 		Foreground(lipgloss.Color(tagColor)).
 		Width(7).
@@ -144,7 +268,7 @@ func write(tag, message string, tagColor, messageColorDark, messageColorLight st
 
 	formattedMessage := tagStr + timeStr + messageStr
 
-	fmt.Println(formattedMessage)
+	fmt.Fprintln(output, formattedMessage)
 }
 
 func getFormattedMessage(a ...any) string {
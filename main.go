@@ -2,223 +2,951 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"os"
-	"strings"
-
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/bitrise"
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
 	"github.com/bitrise-io/bitrise-remote-access-cli/ide"
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
 	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/migrate"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	"github.com/bitrise-io/bitrise-remote-access-cli/scripts"
+	"github.com/bitrise-io/bitrise-remote-access-cli/settings"
+	"github.com/bitrise-io/bitrise-remote-access-cli/shell"
 	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/bitrise-io/bitrise-remote-access-cli/troubleshoot"
 	"github.com/bitrise-io/bitrise-remote-access-cli/vscode"
 	"github.com/urfave/cli/v3"
 )
 
 const (
-	cliName         = ":remote"
-	autoCommand     = "auto"
-	sshHostFlag     = "host"
-	sshPortFlag     = "port"
-	sshUserFlag     = "user"
-	sshPasswordFlag = "password"
+	autoCommand       = "auto"
+	openCommand       = "open"
+	disconnectCommand = "disconnect"
+	checkCommand      = "check"
+	rebuildCommand    = "rebuild"
+	repairCommand     = "repair"
+	refreshCommand    = "refresh"
+	pushCommand       = "push"
+	pullCommand       = "pull"
+	syncCommand       = "sync"
+	authCommand       = "auth"
+	loginCommand      = "login"
+	listCommand       = "list"
+	switchCommand     = "switch"
+	sshHostFlag       = "host"
+	sshPortFlag       = "port"
+	sshUserFlag       = "user"
+	sshPasswordFlag   = "password"
+	configDirFlag     = "config-dir"
+	reuseWindowFlag   = "reuse-window"
+	newWindowFlag     = "new-window"
+	extensionsFlag    = "extensions"
+	offlineFlag       = "offline"
+	skipIDECheckFlag  = "skip-ide-check"
+	noTrustPromptFlag = "disable-workspace-trust"
+	noTelemetryFlag   = "disable-telemetry"
+	gotoFlag          = "goto"
+	moshFlag          = "mosh"
+	compressionFlag   = "compression"
+	ciphersFlag       = "ciphers"
+	macsFlag          = "macs"
+	skipDNSCheckFlag  = "skip-dns-check"
+	webSocketURLFlag  = "websocket-url"
+	networkFlag       = "network"
+	interfaceFlag     = "interface"
+	certificateFlag   = "certificate"
+	securityKeyFlag   = "security-key"
+	skProviderFlag    = "security-key-provider"
+	proxyCommand      = "proxy"
+	jsonFlag          = "json"
+	appSlugFlag       = "app-slug"
+	buildSlugFlag     = "build-slug"
+	waitFlag          = "wait"
+	waitTimeoutFlag   = "wait-timeout"
+	workspaceFlag     = "workspace"
+	tokenFlag         = "token"
+	dryRunFlag        = "dry-run"
+	logFileFlag       = "log-file"
+	metricsFileFlag   = "metrics-file"
+	otlpEndpointFlag  = "otlp-endpoint"
+	notifyFlag        = "notify"
+	resumeFlag        = "resume"
+	verifyFlag        = "verify"
+	concurrencyFlag   = "concurrency"
+	retriesFlag       = "retries"
+	printSSHFlag      = "print-ssh-command"
+	exportCommand     = "export"
+	importCommand     = "import"
+	includeKeyFlag    = "include-key"
+	outputFlag        = "output"
+	expiresFlag       = "expires"
+	inviteCommand     = "invite"
+	pubkeyFlag        = "pubkey"
+	shareCommand      = "share"
+	stopFlag          = "stop"
+	recordFlag        = "record"
+	cacheCommand      = "cache"
+	downloadCommand   = "download"
+	purgeCommand      = "purge"
+	yesFlag           = "yes"
+	grabCommand       = "grab"
+	openFlag          = "open"
+	presetFlag        = "preset"
+	debugserverCmd    = "debugserver"
+	debugPortFlag     = "debug-port"
+	jdwpCmd           = "jdwp"
+	attachFlag        = "attach"
+	diffEnvCommand    = "diff-env"
+	infoCommand       = "info"
+	simCommand        = "sim"
+	emulatorCommand   = "emulator"
+	bootCommand       = "boot"
+	shutdownCommand   = "shutdown"
+	screenshotCommand = "screenshot"
+	saveFlag          = "save"
+	rerunStepCommand  = "rerun-step"
+	checkoutCommand   = "checkout"
+	supportCommand    = "support-bundle"
+	daemonCommand     = "daemon"
+	setupCommand      = "setup"
+	aliasCommand      = "alias"
+	addCommand        = "add"
+	removeCommand     = "remove"
+	pluginCheckCmd    = "plugin-check"
+	standaloneCmd     = "standalone-install"
+	dirFlag           = "dir"
+	fileFlag          = "file"
+	accessibleFlag    = "accessible"
+	quietFlag         = "quiet"
+	startCommand      = "start"
+	stopCommand       = "stop"
+	statusCommand     = "status"
+	runCommand        = "run"
+	daemonLogFileName = "daemon.log"
+	daemonStartWait   = time.Minute
+)
+
+const (
+	rebuildPollInterval = 10 * time.Second
+	rebuildTimeout      = 15 * time.Minute
+	defaultWaitTimeout  = 10 * time.Minute
+	// defaultBundleExpiry is about the longest a remote access session is kept alive
+	defaultBundleExpiry = 2 * time.Hour
 )
 
-var supportedIDEs = []ide.IDE{
-	vscode.IdeData}
+// Environment variables of the connection parameters, the flags take precedence over them
+const (
+	hostEnvVar     = "BITRISE_REMOTE_HOST"
+	portEnvVar     = "BITRISE_REMOTE_PORT"
+	userEnvVar     = "BITRISE_REMOTE_USER"
+	passwordEnvVar = "BITRISE_REMOTE_PASSWORD"
+	// otlpEndpointEnvVar and otlpHeadersEnvVar are the standard variables of the OpenTelemetry exporters
+	otlpEndpointEnvVar = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otlpHeadersEnvVar  = "OTEL_EXPORTER_OTLP_HEADERS"
+	// webSocketURLEnvVar can be set once for networks that always need the tunnel
+	webSocketURLEnvVar = "BITRISE_REMOTE_WEBSOCKET_URL"
+	// certificateEnvVar points to the SSH certificate of orgs that sign keys with their CA
+	certificateEnvVar = "BITRISE_REMOTE_SSH_CERTIFICATE"
+	// skProviderEnvVar is read by ssh-keygen too
+	skProviderEnvVar = "SSH_SK_PROVIDER"
+	// accessTokensEnvVar turns on the expiring access tokens while the Bitrise API rolls them out
+	accessTokensEnvVar = "BITRISE_REMOTE_ACCESS_TOKENS"
+)
+
+// setupStage is the progress stage of the whole connection setup
+const setupStage = "setup"
+
+var builtInIDEs = []ide.IDE{
+	vscode.IdeData,
+	shell.IdeData}
 
-var flags = []cli.Flag{
+// supportedIDEs holds the built-in IDEs and the ones defined in the user's IDE definitions file
+var supportedIDEs []ide.IDE
+
+var connectionFlags = []cli.Flag{
 	&cli.StringFlag{
 		Name:    sshHostFlag,
 		Usage:   "SSH Hostname",
 		Aliases: []string{"H"},
+		Sources: cli.EnvVars(hostEnvVar),
 	},
 	&cli.StringFlag{
 		Name:    sshPortFlag,
 		Usage:   "SSH Port number",
 		Aliases: []string{"P"},
+		Sources: cli.EnvVars(portEnvVar),
 	},
 	&cli.StringFlag{
 		Name:    sshUserFlag,
 		Usage:   "Username for SSH connection",
 		Aliases: []string{"U"},
+		Sources: cli.EnvVars(userEnvVar),
 	},
 	&cli.StringFlag{
 		Name:    sshPasswordFlag,
 		Usage:   "Password for SSH connection",
 		Aliases: []string{"p"},
+		Sources: cli.EnvVars(passwordEnvVar),
+	},
+	&cli.StringFlag{
+		Name:  appSlugFlag,
+		Usage: "Slug of the Bitrise app, used with the API token to explain connection failures",
+	},
+	&cli.StringFlag{
+		Name:  buildSlugFlag,
+		Usage: "Slug of the Bitrise build, used with the API token to explain connection failures",
+	},
+	&cli.BoolFlag{
+		Name:  waitFlag,
+		Usage: "Wait until the VM accepts SSH connections, eg. when the build is still starting",
+	},
+	&cli.StringFlag{
+		Name:  waitTimeoutFlag,
+		Usage: fmt.Sprintf("How long --%s waits for the VM (default: %s)", waitFlag, defaultWaitTimeout),
+	},
+	&cli.BoolFlag{
+		Name:  skipDNSCheckFlag,
+		Usage: "Don't wait for the hostname to resolve before connecting",
+	},
+	&cli.StringFlag{
+		Name:    webSocketURLFlag,
+		Usage:   "Tunnel SSH through this wss:// endpoint, for networks that block outbound SSH ports",
+		Sources: cli.EnvVars(webSocketURLEnvVar),
+	},
+	&cli.StringFlag{
+		Name:  networkFlag,
+		Usage: fmt.Sprintf("%s for a VM only reachable over a VPN like Tailscale, its MagicDNS names are resolved and unresolved names are tried anyway", ssh.NetworkVPN),
+		Value: ssh.NetworkDirect,
+	},
+	&cli.StringFlag{
+		Name:  interfaceFlag,
+		Usage: "Network interface or local address to connect from, eg. utun4 for the VPN",
+	},
+	&cli.StringFlag{
+		Name:    certificateFlag,
+		Usage:   "SSH certificate to authenticate with, eg. ~/.ssh/id_ed25519-cert.pub, its private key is read from next to it or from ssh-agent",
+		Sources: cli.EnvVars(certificateEnvVar),
 	},
 }
 
-func main() {
-	commands := []*cli.Command{
-		command(autoCommand, "Automatically detect the IDE and open the project", nil)}
+var flags = append(slices.Clone(connectionFlags),
+	&cli.BoolFlag{
+		Name:    reuseWindowFlag,
+		Usage:   "Open the project in the last active IDE window",
+		Aliases: []string{"r"},
+	},
+	&cli.BoolFlag{
+		Name:    newWindowFlag,
+		Usage:   "Open the project in a new IDE window",
+		Aliases: []string{"n"},
+	},
+	&cli.StringFlag{
+		Name:  extensionsFlag,
+		Usage: "Comma separated IDE extensions to install on the remote, eg. golang.go,ms-python.python",
+	},
+	&cli.BoolFlag{
+		Name:  offlineFlag,
+		Usage: "Skip the optional steps that need internet access, eg. extension installs",
+	},
+	&cli.BoolFlag{
+		Name:  skipIDECheckFlag,
+		Usage: "Don't wait for the IDE to connect to the VM after launching it",
+	},
+	&cli.BoolFlag{
+		Name:  noTrustPromptFlag,
+		Usage: "Open the folder in VS Code without the workspace trust prompt, it's the build's own code",
+	},
+	&cli.BoolFlag{
+		Name:  noTelemetryFlag,
+		Usage: "Turn off the telemetry of the VS Code window",
+	},
+	&cli.StringFlag{
+		Name:  gotoFlag,
+		Usage: "Open the remote file at the line after the folder, eg. Tests/LoginTests.swift:42:5, relative to the source dir",
+	},
+	&cli.BoolFlag{
+		Name:  moshFlag,
+		Usage: "Use mosh for the terminal shell, it copes better with high-latency networks",
+	},
+	&cli.StringFlag{
+		Name:  presetFlag,
+		Usage: "Comma separated presets of port forwards and remote environment for dev servers: flutter, metro",
+	},
+	&cli.StringFlag{
+		Name:  recordFlag,
+		Usage: "Record the terminal shell to the file in asciicast format, replay it with `asciinema play`",
+	},
+	&cli.BoolFlag{
+		Name:  compressionFlag,
+		Usage: "Compress the SSH traffic, helps on low-bandwidth networks",
+	},
+	&cli.StringFlag{
+		Name:  ciphersFlag,
+		Usage: "Comma separated SSH ciphers in order of preference, eg. aes128-gcm@openssh.com",
+	},
+	&cli.StringFlag{
+		Name:  macsFlag,
+		Usage: "Comma separated SSH MACs in order of preference",
+	},
+	&cli.BoolFlag{
+		Name:  securityKeyFlag,
+		Usage: "Create the session key on a FIDO2 security key, eg. a YubiKey, the editors' connections need a touch",
+	},
+	&cli.StringFlag{
+		Name:    skProviderFlag,
+		Usage:   fmt.Sprintf("FIDO middleware library for --%s, for an ssh without built-in support", securityKeyFlag),
+		Sources: cli.EnvVars(skProviderEnvVar),
+	},
+	&cli.BoolFlag{
+		Name:  dryRunFlag,
+		Usage: "Print the changes the setup would make locally and on the remote without making them",
+	},
+	&cli.StringFlag{
+		Name:  logFileFlag,
+		Usage: "Append the progress of the setup to the file",
+	},
+	&cli.StringFlag{
+		Name:  metricsFileFlag,
+		Usage: "Append the timings of the setup phases to the file as JSON, or write them in the Prometheus text format to a .prom file",
+	},
+	&cli.StringFlag{
+		Name:    otlpEndpointFlag,
+		Usage:   "Send the timings of the setup phases to the OTLP/HTTP endpoint of an OpenTelemetry collector, eg. http://localhost:4318",
+		Sources: cli.EnvVars(otlpEndpointEnvVar),
+	},
+	&cli.BoolFlag{
+		Name:  notifyFlag,
+		Usage: "Show a desktop notification when the setup finishes",
+	},
+	&cli.BoolFlag{
+		Name:  printSSHFlag,
+		Usage: "Set up the connection and print the ssh command to connect with instead of opening an IDE, other messages go to stderr",
+	},
+	accessibleCLIFlag,
+	quietCLIFlag,
+	configDirCLIFlag,
+	jsonCLIFlag,
+)
 
-	for _, ide := range supportedIDEs {
-		commands = append(commands, command(ide.Identifier, fmt.Sprintf("Debug the build with %s", ide.Name), ide.Aliases))
-	}
+// configDirCLIFlag is applied by its action, before the action of the command reads any file
+var configDirCLIFlag = &cli.StringFlag{
+	Name:  configDirFlag,
+	Usage: fmt.Sprintf("Directory of the files managed by the CLI (default: $%s, $XDG_STATE_HOME or ~/.bitrise/remote-access)", paths.HomeEnvVar),
+	Action: func(ctx context.Context, cliCmd *cli.Command, configDir string) error {
+		paths.SetConfigDir(configDir)
+		return nil
+	},
+}
 
-	app := &cli.Command{
-		Name:     cliName,
-		Usage:    "Instantly connect to a running Bitrise CI build and debug it with an IDE",
-		Commands: commands,
-	}
+// sessionPasswordCLIFlag is the password of the commands working with the VM of the last session
+var sessionPasswordCLIFlag = &cli.StringFlag{
+	Name:    sshPasswordFlag,
+	Usage:   "Password for SSH connection, only needed if the session has no SSH key",
+	Sources: cli.EnvVars(passwordEnvVar),
+	Aliases: []string{"p"},
+}
 
-	if err := app.Run(context.Background(), os.Args); err != nil {
-		logger.Error(err)
-		os.Exit(1)
-	}
+// accessibleCLIFlag is set on the root command, so every subcommand accepts it
+var accessibleCLIFlag = &cli.BoolFlag{
+	Name:    accessibleFlag,
+	Usage:   "Print plain text without colors and frames for screen readers, prompts read a line from the standard input",
+	Sources: cli.EnvVars(logger.AccessibleEnvVar),
+	Action: func(ctx context.Context, cliCmd *cli.Command, enabled bool) error {
+		logger.SetAccessible(enabled)
+		return nil
+	},
 }
 
-func entry(ctx context.Context, cliCmd *cli.Command) error {
-	command := cliCmd.Name
-	args := cliCmd.Args().Slice()
-	if len(args) == 0 {
-		return cli.ShowSubcommandHelp(cliCmd)
-	}
+// quietCLIFlag is set on the root command like accessibleCLIFlag
+var quietCLIFlag = &cli.BoolFlag{
+	Name:    quietFlag,
+	Usage:   "Only print warnings, errors and the outcome, eg. in scripts",
+	Aliases: []string{"q"},
+	Action: func(ctx context.Context, cliCmd *cli.Command, enabled bool) error {
+		logger.SetQuiet(enabled)
+		return nil
+	},
+}
+
+var jsonCLIFlag = &cli.BoolFlag{
+	Name:  jsonFlag,
+	Usage: "Print progress events and errors as JSON lines, errors with their category and exit code",
+}
 
-	var ide ide.IDE
+// jsonOutput is set by the --json flag of the subcommands
+var jsonOutput bool
 
-	if command == autoCommand {
-		autoIDE, err := autoChooseIDE()
-		if err != nil {
-			return err
-		}
-		ide = autoIDE
-	} else {
-		for _, supportedIDE := range supportedIDEs {
-			if command == supportedIDE.Identifier {
-				ide = supportedIDE
-			}
-		}
+func main() {
+	// Before anything reads the files, they may still be where an earlier version left them
+	changes, err := migrate.Run()
+	for _, change := range changes {
+		logger.Info(change)
 	}
-	if ide.Identifier == "" {
-		return fmt.Errorf("unknown command: %s", command)
+	if err != nil {
+		logger.Warnf("Migrate the files of an earlier version: %s", err)
 	}
 
-	parsedArgs := parseArgs(args, flags)
-
-	var password *string
-	parsedPw, parsedPwExists := parsedArgs[sshPasswordFlag]
-	if parsedPwExists {
-		password = &parsedPw
+	ide.Register(builtInIDEs...)
+	if err := ide.LoadDefinitions(filepath.Join(paths.ConfigDir(), ide.DefinitionsFileName)); err != nil {
+		logger.Warn(err)
 	}
-
-	onLaunchIDE := func(useIdentityKey bool, folderPath string) error {
-		return openWithIDE(&ide, folderPath, password, useIdentityKey)
+	supportedIDEs = ide.All()
+	teamScripts, err := scripts.List()
+	if err != nil {
+		logger.Warn(err)
+	}
+	// The config dir of the command isn't known yet, connect reloads the settings with it
+	userSettings, err := settings.Load()
+	if err == nil {
+		i18n.SetLocale(userSettings.Locale)
 	}
 
-	err := ssh.SetupSSH(parsedArgs[sshHostFlag], parsedArgs[sshPortFlag], parsedArgs[sshUserFlag], password, onLaunchIDE)
+	commands := []*cli.Command{
+		command(autoCommand, "Automatically detect the IDE and open the project", nil),
+		command(openCommand, "Open the project with multiple IDEs at once, eg. vscode,shell", nil),
+		{
+			Name:   setupCommand,
+			Usage:  "Check the prerequisites and choose the defaults, eg. the editor of auto, asked on the first run",
+			Action: setup,
+			Flags:  []cli.Flag{configDirCLIFlag},
+		},
+		{
+			Name:   pluginCheckCmd,
+			Usage:  "Check why installing the Bitrise CLI plugin fails on this machine",
+			Action: pluginCheck,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  fileFlag,
+					Usage: "bitrise-plugin.yml to check instead of the one this binary was released with",
+				},
+			},
+		},
+		{
+			Name:        standaloneCmd,
+			Usage:       fmt.Sprintf("Link this binary as %s on $PATH, to use it without the Bitrise CLI", standaloneName),
+			Description: "The binary works the same way standalone, eg. when the plugin can't be installed",
+			Action:      standaloneInstall,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  dirFlag,
+					Usage: "Directory to create the link in (default: ~/.local/bin)",
+				},
+			},
+		},
+		{
+			Name:   disconnectCommand,
+			Usage:  "Remove the SSH key, config entry and known host of the last session",
+			Action: disconnect,
+			Flags:  []cli.Flag{configDirCLIFlag, jsonCLIFlag},
+		},
+		{
+			Name:            rebuildCommand,
+			Usage:           "Rebuild a build with remote access and connect to it once its VM is ready",
+			UsageText:       fmt.Sprintf("%s %s <BUILD_SLUG> --%s <APP_SLUG>", cliName, rebuildCommand, appSlugFlag),
+			Description:     fmt.Sprintf("Needs a Bitrise personal access token in $%s or stored with `%s %s`", bitrise.TokenEnvVar, authCommand, loginCommand),
+			Action:          rebuild,
+			Flags:           flags,
+			SkipFlagParsing: true,
+		},
+		{
+			Name:   repairCommand,
+			Usage:  "Find and reapply the missing pieces of an interrupted setup of the last session",
+			Action: repair,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    sshPasswordFlag,
+					Usage:   "Password for SSH connection, only needed if the session key is gone",
+					Sources: cli.EnvVars(passwordEnvVar),
+					Aliases: []string{"p"},
+				},
+				&cli.BoolFlag{
+					Name:  dryRunFlag,
+					Usage: "Only report the missing pieces",
+				},
+				configDirCLIFlag,
+				jsonCLIFlag,
+			},
+		},
+		{
+			Name:        refreshCommand,
+			Usage:       "Switch the last session to the new password after the build restarted the remote access step",
+			Description: fmt.Sprintf("With --%s, --%s and an API token the new credentials are fetched, otherwise they are asked for", appSlugFlag, buildSlugFlag),
+			Action:      refresh,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    sshPasswordFlag,
+					Usage:   "New password for SSH connection",
+					Sources: cli.EnvVars(passwordEnvVar),
+					Aliases: []string{"p"},
+				},
+				&cli.StringFlag{
+					Name:  sshHostFlag,
+					Usage: "New hostname or IP address, if it changed",
+				},
+				&cli.StringFlag{
+					Name:  sshPortFlag,
+					Usage: "New port, if it changed",
+				},
+				&cli.StringFlag{
+					Name:  sshUserFlag,
+					Usage: "New user, if it changed",
+				},
+				&cli.StringFlag{
+					Name:  appSlugFlag,
+					Usage: "Slug of the Bitrise app, to fetch the new credentials with the API token",
+				},
+				&cli.StringFlag{
+					Name:  buildSlugFlag,
+					Usage: "Slug of the Bitrise build, to fetch the new credentials with the API token",
+				},
+				configDirCLIFlag,
+			},
+		},
+		transferCommand(pushCommand, "Copy a local file or directory to the VM of the last session", "<LOCAL_PATH> <REMOTE_PATH>"),
+		transferCommand(pullCommand, "Copy a file or directory from the VM of the last session", "<REMOTE_PATH> <LOCAL_PATH>"),
+		transferCommand(syncCommand, "Copy the changed files of a local directory to the VM of the last session", "<LOCAL_PATH> <REMOTE_PATH>"),
+		{
+			Name:      exportCommand,
+			Usage:     "Write the connection of the last session to a file a teammate can import to join the same VM",
+			UsageText: fmt.Sprintf("%s %s [--%s] [--%s <FILE>] [--%s <DURATION>]", cliName, exportCommand, includeKeyFlag, outputFlag, expiresFlag),
+			Action:    exportSession,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  includeKeyFlag,
+					Usage: "Include the private SSH key of the session, anyone with the file can connect to the VM until it's gone",
+				},
+				&cli.StringFlag{
+					Name:  outputFlag,
+					Usage: "File to write the bundle to, the standard output if not set",
+				},
+				&cli.StringFlag{
+					Name:  expiresFlag,
+					Usage: fmt.Sprintf("How long the bundle can be imported (default: %s)", defaultBundleExpiry),
+				},
+				configDirCLIFlag,
+			},
+		},
+		{
+			Name:      importCommand,
+			Usage:     "Set up the connection of a bundle exported by a teammate",
+			UsageText: fmt.Sprintf("%s %s <FILE>", cliName, importCommand),
+			Action:    importSession,
+			Flags:     []cli.Flag{configDirCLIFlag},
+		},
+		{
+			Name:      inviteCommand,
+			Usage:     "Authorize a teammate's public key on the VM of the last session to debug the build together",
+			UsageText: fmt.Sprintf("%s %s --%s <FILE_OR_GITHUB_USER>", cliName, inviteCommand, pubkeyFlag),
+			Action:    invite,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     pubkeyFlag,
+					Usage:    "File with the public keys in authorized_keys format, or a GitHub username to use their keys",
+					Required: true,
+				},
+				sessionPasswordCLIFlag,
+				configDirCLIFlag,
+			},
+		},
+		{
+			Name:        shareCommand,
+			Usage:       "Start a tmate terminal on the VM of the last session and print the links to join it",
+			Description: "Anyone with a link can join the terminal without Bitrise access, share the read-only links when watching is enough",
+			Action:      share,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  stopFlag,
+					Usage: "End the shared terminal, disconnecting everyone",
+				},
+				sessionPasswordCLIFlag,
+				configDirCLIFlag,
+			},
+		},
+		{
+			Name:  cacheCommand,
+			Usage: "Inspect the build cache on the VM of the last session, eg. to rule out a corrupted cache",
+			Commands: []*cli.Command{
+				{
+					Name:   listCommand,
+					Usage:  "List the cached paths and cache archives with their sizes",
+					Action: cacheList,
+					Flags:  []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag},
+				},
+				{
+					Name:      downloadCommand,
+					Usage:     "Copy a cached path or archive to the local machine",
+					UsageText: fmt.Sprintf("%s %s %s <NUMBER_OR_PATH> <LOCAL_PATH>", cliName, cacheCommand, downloadCommand),
+					Action:    cacheDownload,
+					Flags:     []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag},
+				},
+				{
+					Name:      purgeCommand,
+					Usage:     "Delete cached paths and archives from the VM, all of them if none is given",
+					UsageText: fmt.Sprintf("%s %s %s [<NUMBER_OR_PATH>...] [--%s]", cliName, cacheCommand, purgeCommand, yesFlag),
+					Action:    cachePurge,
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:  yesFlag,
+							Usage: "Don't ask for confirmation",
+						},
+						sessionPasswordCLIFlag,
+						configDirCLIFlag,
+					},
+				},
+			},
+		},
+		{
+			Name:  simCommand,
+			Usage: "Manage the simulators on the VM of the last session, eg. to boot the right one before running the tests again",
+			Commands: []*cli.Command{
+				{
+					Name:   listCommand,
+					Usage:  "List the available simulators with their state",
+					Action: simList,
+					Flags:  []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag, jsonCLIFlag},
+				},
+				{
+					Name:      bootCommand,
+					Usage:     "Boot a simulator and wait until it's ready",
+					UsageText: fmt.Sprintf("%s %s %s <UDID_OR_NAME>", cliName, simCommand, bootCommand),
+					Action:    simBoot,
+					Flags:     []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag},
+				},
+				{
+					Name:      shutdownCommand,
+					Usage:     "Shut down a simulator, every booted one if none is given",
+					UsageText: fmt.Sprintf("%s %s %s [<UDID_OR_NAME>]", cliName, simCommand, shutdownCommand),
+					Action:    simShutdown,
+					Flags:     []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag},
+				},
+			},
+		},
+		{
+			Name:  emulatorCommand,
+			Usage: "Manage the Android emulators on the VM of the last session",
+			Commands: []*cli.Command{
+				{
+					Name:   listCommand,
+					Usage:  "List the Android virtual devices and whether they are running",
+					Action: emulatorList,
+					Flags:  []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag, jsonCLIFlag},
+				},
+				{
+					Name:      startCommand,
+					Usage:     "Start an Android virtual device without a window and wait until it booted",
+					UsageText: fmt.Sprintf("%s %s %s <AVD_NAME>", cliName, emulatorCommand, startCommand),
+					Action:    emulatorStart,
+					Flags:     []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag},
+				},
+			},
+		},
+		{
+			Name:      screenshotCommand,
+			Usage:     "Capture the desktop of the last session's macOS VM, eg. to see a system dialog blocking the UI tests",
+			UsageText: fmt.Sprintf("%s %s [<LOCAL_PATH>] [--%s=false]", cliName, screenshotCommand, openFlag),
+			Action:    screenshot,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  openFlag,
+					Usage: "Open the screenshot once it's downloaded",
+					Value: true,
+				},
+				sessionPasswordCLIFlag,
+				configDirCLIFlag,
+			},
+		},
+		{
+			Name:  grabCommand,
+			Usage: "Download the newest Xcode test results or DerivedData from the VM of the last session",
+			Commands: []*cli.Command{
+				grabCommandFor(ssh.GrabXCResult, "Download the newest .xcresult bundle"),
+				grabCommandFor(ssh.GrabDerivedData, "Download the newest project folder of DerivedData"),
+			},
+		},
+		{
+			Name:      debugserverCmd,
+			Usage:     "Attach debugserver to a process on the macOS VM of the last session and forward it for lldb",
+			UsageText: fmt.Sprintf("%s %s <PID_OR_PROCESS_NAME> [--%s <PORT>]", cliName, debugserverCmd, debugPortFlag),
+			Action:    debugserver,
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  debugPortFlag,
+					Usage: "Port of debugserver on the VM and of the forward on this machine",
+					Value: ssh.DefaultDebugserverPort,
+				},
+				sessionPasswordCLIFlag,
+				configDirCLIFlag,
+			},
+		},
+		{
+			Name:  jdwpCmd,
+			Usage: "Run a Gradle or JVM command on the Linux VM of the last session waiting for a Java debugger, and forward its port",
+			UsageText: fmt.Sprintf("%s %s [--%s <PORT>] -- <COMMAND>\n%s %s --%s <PID_OR_PROCESS_NAME> [--%s <PORT>]",
+				cliName, jdwpCmd, debugPortFlag, cliName, jdwpCmd, attachFlag, debugPortFlag),
+			Action: jdwp,
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:  debugPortFlag,
+					Usage: "Port of the JVM debug agent on the VM and of the forward on this machine",
+					Value: ssh.DefaultJDWPPort,
+				},
+				&cli.StringFlag{
+					Name:  attachFlag,
+					Usage: "Attach to a JVM already running with the -agentlib:jdwp option instead of running a command",
+				},
+				sessionPasswordCLIFlag,
+				configDirCLIFlag,
+			},
+		},
+		{
+			Name:  diffEnvCommand,
+			Usage: "Compare the environment, tool versions and SDKs of the last session's VM with a snapshot of another build",
+			UsageText: fmt.Sprintf("%s %s --%s <FILE>\n%s %s <SNAPSHOT> [<OTHER_SNAPSHOT>]",
+				cliName, diffEnvCommand, saveFlag, cliName, diffEnvCommand),
+			Action: diffEnv,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  saveFlag,
+					Usage: "Save a snapshot of the VM to the file instead of comparing, eg. while connected to a passing build",
+				},
+				sessionPasswordCLIFlag,
+				configDirCLIFlag,
+			},
+		},
+		{
+			Name:   infoCommand,
+			Usage:  "Show the stack, Xcode version and CPU architecture of the last session's VM, compared with bitrise.yml and this machine",
+			Action: info,
+			Flags:  []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag, jsonCLIFlag},
+		},
+		{
+			Name:      rerunStepCommand,
+			Usage:     "Run a step of the build's workflow again on the VM of the last session, with the build's inputs and environment",
+			UsageText: fmt.Sprintf("%s %s <STEP_ID_OR_TITLE>", cliName, rerunStepCommand),
+			Action:    rerunStep,
+			Flags:     []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag},
+		},
+		{
+			Name:      checkoutCommand,
+			Usage:     "Fetch and check out a branch or pull request in the source directory of the last session's VM, the build's changes are stashed",
+			UsageText: fmt.Sprintf("%s %s <BRANCH | #PR_NUMBER | PR_URL>", cliName, checkoutCommand),
+			Action:    checkout,
+			Flags:     []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag},
+		},
+		{
+			Name:      supportCommand,
+			Usage:     "Collect the logs, the redacted SSH config and the tool versions into a zip to attach to a bug report",
+			UsageText: fmt.Sprintf("%s %s [FILE]", cliName, supportCommand),
+			Action:    supportBundle,
+			Flags:     []cli.Flag{configDirCLIFlag},
+		},
+		{
+			Name:      runCommand,
+			Usage:     fmt.Sprintf("Run a debug script of the repo's %s or the config dir's %s directory on the last session's VM", scripts.RepoDirName, scripts.DirName),
+			UsageText: fmt.Sprintf("%s %s [--%s <PASSWORD>] <SCRIPT> [ARGS...]", cliName, runCommand, sshPasswordFlag),
+			Action:    listScripts,
+			Flags:     []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag, jsonCLIFlag},
+			Commands:  scriptCommands(teamScripts),
+		},
+		{
+			Name:  daemonCommand,
+			Usage: "Keep the connection to the VM of the last session and its forwards alive in the background",
+			Commands: []*cli.Command{
+				{
+					Name:        startCommand,
+					Usage:       "Start the daemon, the forwards stay open while the editors restart and reconnect",
+					Description: fmt.Sprintf("The daemon writes its log to %s in the state directory", daemonLogFileName),
+					Action:      daemonStart,
+					Flags:       []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag},
+				},
+				{
+					Name:   stopCommand,
+					Usage:  "Stop the daemon, closing its connection and forwards",
+					Action: daemonStop,
+					Flags:  []cli.Flag{configDirCLIFlag},
+				},
+				{
+					Name:   statusCommand,
+					Usage:  "Show whether the daemon is connected and the forwards it keeps open",
+					Action: daemonStatus,
+					Flags:  []cli.Flag{configDirCLIFlag, jsonCLIFlag},
+				},
+				{
+					Name:   runCommand,
+					Usage:  "Run the daemon in the foreground",
+					Hidden: true,
+					Action: daemonRun,
+					Flags:  []cli.Flag{sessionPasswordCLIFlag, configDirCLIFlag},
+				},
+			},
+		},
+		{
+			Name:      proxyCommand,
+			Usage:     "Tunnel the standard input and output to the VM through a WebSocket endpoint, the ProxyCommand of the SSH config",
+			UsageText: fmt.Sprintf("%s %s --%s <URL> <HOST> <PORT>", cliName, proxyCommand, webSocketURLFlag),
+			Hidden:    true,
+			Action:    proxy,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     webSocketURLFlag,
+					Usage:    "WebSocket endpoint to tunnel through",
+					Required: true,
+				},
+			},
+		},
+		{
+			Name:   checkCommand,
+			Usage:  "Measure whether the connection to the build's VM is good enough for remote debugging",
+			Action: check,
+			Flags:  append(slices.Clone(connectionFlags), configDirCLIFlag, jsonCLIFlag),
+		},
+		{
+			Name:  authCommand,
+			Usage: "Manage the Bitrise API tokens of your workspaces",
+			Commands: []*cli.Command{
+				{
+					Name:      loginCommand,
+					Usage:     "Store a personal access token in the keychain and make it the current one",
+					UsageText: fmt.Sprintf("%s %s %s <NAME> [--%s <WORKSPACE_SLUG>]", cliName, authCommand, loginCommand, workspaceFlag),
+					Action:    authLogin,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  workspaceFlag,
+							Usage: "Slug of the workspace the token is used with",
+						},
+						&cli.StringFlag{
+							Name:  tokenFlag,
+							Usage: "The personal access token, read from the standard input if not set",
+						},
+						configDirCLIFlag,
+					},
+				},
+				{
+					Name:   listCommand,
+					Usage:  "List the stored tokens",
+					Action: authList,
+					Flags:  []cli.Flag{configDirCLIFlag},
+				},
+				{
+					Name:      switchCommand,
+					Usage:     "Change the token used for the API-driven features",
+					UsageText: fmt.Sprintf("%s %s %s <NAME>", cliName, authCommand, switchCommand),
+					Action:    authSwitch,
+					Flags:     []cli.Flag{configDirCLIFlag},
+				},
+			},
+		},
+		{
+			Name:  aliasCommand,
+			Usage: "Manage the shorthands of frequently used invocations",
+			Commands: []*cli.Command{
+				{
+					Name:        addCommand,
+					Usage:       "Add an alias, or replace the one of the same name",
+					UsageText:   fmt.Sprintf("%s %s %s <NAME> \"<INVOCATION>\"", cliName, aliasCommand, addCommand),
+					Description: fmt.Sprintf("Eg. `%s %s ios-debug \"vscode --%s --%s\"`, then `%s ios-debug <HOST>` runs the invocation with the arguments after it appended", aliasCommand, addCommand, reuseWindowFlag, skipIDECheckFlag, cliName),
+					Action:      aliasAdd,
+					Flags:       []cli.Flag{configDirCLIFlag},
+				},
+				{
+					Name:   listCommand,
+					Usage:  "List the aliases",
+					Action: aliasList,
+					Flags:  []cli.Flag{configDirCLIFlag},
+				},
+				{
+					Name:      removeCommand,
+					Usage:     "Remove an alias",
+					UsageText: fmt.Sprintf("%s %s %s <NAME>", cliName, aliasCommand, removeCommand),
+					Action:    aliasRemove,
+					Flags:     []cli.Flag{configDirCLIFlag},
+				},
+			},
+		}}
 
-	var configErr ssh.ConfigErr
-	if errors.As(err, &configErr) {
-		_ = cli.ShowSubcommandHelp(cliCmd)
-		return err
+	for _, ide := range supportedIDEs {
+		commands = append(commands, command(ide.Identifier, fmt.Sprintf("Debug the build with %s", ide.Name), ide.Aliases))
 	}
 
-	return err
-}
-
-func command(name, usage string, aliases []string) *cli.Command {
-	return &cli.Command{
-		Name:            name,
-		Usage:           usage,
-		UsageText:       usageTextForCommand(name),
-		Action:          entry,
-		Aliases:         aliases,
-		Description:     "You need to add SSH arguments to connect to the remote server",
-		Flags:           flags,
-		SkipFlagParsing: true,
+	app := &cli.Command{
+		Name:     cliName,
+		Usage:    "Instantly connect to a running Bitrise CI build and debug it with an IDE",
+		Commands: commands,
+		Flags:    []cli.Flag{accessibleCLIFlag, quietCLIFlag},
+		Action:   root,
 	}
-}
 
-func usageTextForCommand(command string) string {
-	return fmt.Sprintf("%s %s --%s <HOSTNAME> --%s <PORT> --%s <USER> --%s <PASSWORD>", cliName, command, sshHostFlag, sshPortFlag, sshUserFlag, sshPasswordFlag)
-}
+	handleInterrupt()
 
-// built in flag parsing cannot ignore unknown flags AND set the required ones
-// at the same time, so we need to parse the args manually
-func parseArgs(args []string, flags []cli.Flag) map[string]string {
-	parsed := make(map[string]string)
-	validFlags := make(map[string]bool)
-	flagAliases := make(map[string]string)
-
-	for _, flag := range flags {
-		switch f := flag.(type) {
-		case *cli.StringFlag:
-			validFlags[f.Name] = true
-			for _, alias := range f.Aliases {
-				validFlags[alias] = true
-				flagAliases[alias] = f.Name
-			}
-		}
+	// The aliases of the default config dir are expanded, the --config-dir of the command comes after them
+	args, err := expandAlias(app, os.Args, userSettings.Aliases)
+	if err != nil {
+		logger.Error(err)
+		os.Exit(failure.ExitCode(failure.New(failure.Config, err)))
 	}
 
-	ignoredFlags := []string{}
-
-	for i := 0; i < len(args); i++ {
-		arg := args[i]
-		if strings.HasPrefix(arg, "--") || strings.HasPrefix(arg, "-") {
-			key := strings.TrimLeft(arg, "-")
-			if alias, exists := flagAliases[key]; exists {
-				key = alias
-			}
-			if validFlags[key] {
-				if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") && !strings.HasPrefix(args[i+1], "-") {
-					parsed[key] = args[i+1]
-					i++ // next will be value
-				}
-			} else {
-				ignoredFlags = append(ignoredFlags, key)
-			}
+	if err := app.Run(interrupt.Context(), args); err != nil {
+		if jsonOutput {
+			fmt.Println(failure.JSONSummary(err))
+		} else {
+			logger.Error(err)
+			troubleshoot.Run(err)
 		}
+		os.Exit(failure.ExitCode(err))
 	}
+}
 
-	if len(ignoredFlags) > 0 {
-		logger.Warnf("Ignored unknown flags: %v", ignoredFlags)
+func entry(ctx context.Context, cliCmd *cli.Command) error {
+	args := cliCmd.Args().Slice()
+	// Without arguments the connection parameters are asked for, the IDEs of open can't be
+	if len(args) == 0 && (cliCmd.Name == openCommand || !logger.IsInteractive()) {
+		return cli.ShowSubcommandHelp(cliCmd)
 	}
 
-	return parsed
+	return connect(cliCmd, cliCmd.Name, args)
 }
 
-func autoChooseIDE() (ide.IDE, error) {
-	termProgram := os.Getenv("TERM_PROGRAM")
+// settingUp is set while connect provisions the session, until the IDE is launched. Only a half-finished session
+// is torn down on interrupt.
+var settingUp atomic.Bool
+
+// disconnectInterrupted tears down the session of an interrupted setup, the tests replace it.
+var disconnectInterrupted = ssh.Disconnect
+
+// handleInterrupt cleans up when the user aborts a command, so no spawned program, eg. code installing an extension,
+// keeps running and no config file is left half-written. An aborted setup is disconnected too, so no key is left
+// behind on the remote and no config points to the dead host. Other commands, eg. an aborted pull, leave the live
+// session alone.
+func handleInterrupt() {
+	interrupt.Handle(cleanupInterruptedSetup, func(path string, err error) {
+		logger.Warnf("restore %s: %s", path, err)
+	})
+}
 
-	if termProgram != "" {
-		for _, ide := range supportedIDEs {
-			if termProgram == ide.Identifier {
-				logger.Successf("%s IDE detected automatically", ide.Name)
-				return ide, nil
-			}
-		}
+func cleanupInterruptedSetup() {
+	if !settingUp.Load() {
+		return
 	}
-
-	for _, ide := range supportedIDEs {
-		_, installed := ide.OnTestPath()
-		if installed {
-			logger.Successf("%s IDE found in PATH", ide.Name)
-			return ide, nil
-		}
+	logger.Warn("Interrupted, cleaning up...")
+	if err := disconnectInterrupted(); err != nil {
+		logger.Error(err)
 	}
-
-	return ide.IDE{}, fmt.Errorf("IDE could not be detected automatically, please specify the IDE explicitly instead of using the '%s' subcommand", autoCommand)
 }
 
-func openWithIDE(ide *ide.IDE, folder string, password *string, usingKey bool) error {
-	if folder == "" {
-		confirm, err := logger.Confirm(
-			"Source code location is unknown.\nWould you like to use the root directory and proceed?",
-			"Using root directory",
-			"Not using root directory, ending session...")
-
-		if !confirm || err != nil {
-			return fmt.Errorf("source code location could not be determined")
-		}
+// afterProvisioning ends the setup before the IDE is launched: the session works by then, so an interrupt while
+// waiting for the IDE or in the shell neither disconnects it nor restores the config it wrote.
+func afterProvisioning(launch func(bool, string, ssh.LaunchInfo) error) func(bool, string, ssh.LaunchInfo) error {
+	return func(useIdentityKey bool, folderPath string, info ssh.LaunchInfo) error {
+		settingUp.Store(false)
+		interrupt.Keep()
+		return launch(useIdentityKey, folderPath, info)
 	}
-
-	var additionalInfo string
-	if !usingKey && password != nil {
-		additionalInfo = fmt.Sprintf("Your password for SSH connection:\n\n%s\n\ncopy this into the password field of the opening window", *password)
-	}
-
-	return ide.OnOpen(ssh.BitriseHostPattern, folder, additionalInfo)
 }
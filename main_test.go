@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+)
+
+func TestInterruptAfterProvisioning(t *testing.T) {
+	disconnects := 0
+	disconnectInterrupted = func() error {
+		disconnects++
+		return nil
+	}
+	t.Cleanup(func() {
+		disconnectInterrupted = ssh.Disconnect
+		settingUp.Store(false)
+	})
+
+	settingUp.Store(true)
+	cleanupInterruptedSetup()
+	if disconnects != 1 {
+		t.Fatalf("interrupt during the setup disconnected %d times, want 1", disconnects)
+	}
+
+	launch := afterProvisioning(func(bool, string, ssh.LaunchInfo) error {
+		cleanupInterruptedSetup()
+		return nil
+	})
+	if err := launch(true, "/tmp", ssh.LaunchInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if disconnects != 1 {
+		t.Errorf("interrupt after the provisioning disconnected the session")
+	}
+}
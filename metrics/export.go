@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	serviceName = "bitrise-remote-access"
+	// metricName follows the Prometheus naming conventions, OTLP collectors keep it as it is
+	metricName = "bitrise_remote_access_phase_duration_seconds"
+	metricHelp = "How long the phases of the connection setup took"
+
+	otlpMetricsPath = "/v1/metrics"
+	otlpTimeout     = 5 * time.Second
+)
+
+// WriteFile writes the timings to path. A .prom file gets the Prometheus text format for the textfile collector
+// of node_exporter and is replaced every time, other files get a JSON line per connect appended.
+func WriteFile(path string, labels map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	if filepath.Ext(path) == ".prom" {
+		// The collector may read the file any time, so it's replaced at once
+		tmpPath := path + ".tmp"
+		if err := os.WriteFile(tmpPath, []byte(prometheusText(labels)), 0644); err != nil {
+			return fmt.Errorf("write metrics: %w", err)
+		}
+		return os.Rename(tmpPath, path)
+	}
+
+	line, err := json.Marshal(struct {
+		Labels  map[string]string `json:"labels,omitempty"`
+		Timings []Timing          `json:"timings"`
+	}{labels, Timings()})
+	if err != nil {
+		return fmt.Errorf("encode metrics: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("open metrics file: %w", err)
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func prometheusText(labels map[string]string) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "# HELP %s %s\n# TYPE %s gauge\n", metricName, metricHelp, metricName)
+	for _, timing := range Timings() {
+		pairs := []string{fmt.Sprintf("phase=%q", timing.Phase), fmt.Sprintf("failed=%q", strconv.FormatBool(timing.Failed))}
+		for _, key := range slices.Sorted(maps.Keys(labels)) {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", key, labels[key]))
+		}
+		fmt.Fprintf(&text, "%s{%s} %g\n", metricName, strings.Join(pairs, ","), timing.Duration)
+	}
+	return text.String()
+}
+
+// ExportOTLP sends the timings to the OTLP/HTTP endpoint of an OpenTelemetry collector, eg.
+// http://localhost:4318. headers are added to the request, eg. the collector's API key.
+func ExportOTLP(endpoint string, headers, labels map[string]string) error {
+	body, err := json.Marshal(otlpRequest(labels))
+	if err != nil {
+		return fmt.Errorf("encode metrics: %w", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(endpoint, "/")+otlpMetricsPath, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := (&http.Client{Timeout: otlpTimeout}).Do(request)
+	if err != nil {
+		return fmt.Errorf("send metrics: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("send metrics: %s", response.Status)
+	}
+	return nil
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+func attribute(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+// otlpRequest builds an ExportMetricsServiceRequest in the JSON encoding of OTLP, the phases are data points
+// of a gauge, so the SDK isn't needed for the few values of a connect.
+func otlpRequest(labels map[string]string) map[string]any {
+	var dataPoints []map[string]any
+	for _, timing := range Timings() {
+		attributes := []otlpAttribute{attribute("phase", timing.Phase), attribute("failed", strconv.FormatBool(timing.Failed))}
+		for _, key := range slices.Sorted(maps.Keys(labels)) {
+			attributes = append(attributes, attribute(key, labels[key]))
+		}
+		end := timing.Start.Add(time.Duration(timing.Duration * float64(time.Second)))
+		dataPoints = append(dataPoints, map[string]any{
+			// 64-bit integers are strings in the JSON encoding of protobuf
+			"startTimeUnixNano": strconv.FormatInt(timing.Start.UnixNano(), 10),
+			"timeUnixNano":      strconv.FormatInt(end.UnixNano(), 10),
+			"asDouble":          timing.Duration,
+			"attributes":        attributes,
+		})
+	}
+
+	metric := map[string]any{
+		"name":        metricName,
+		"description": metricHelp,
+		"unit":        "s",
+		"gauge":       map[string]any{"dataPoints": dataPoints},
+	}
+	return map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": []otlpAttribute{attribute("service.name", serviceName)}},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]any{"name": serviceName},
+				"metrics": []any{metric},
+			}},
+		}},
+	}
+}
@@ -0,0 +1,59 @@
+// Package metrics times the phases of the connection setup, so platform teams can track how long engineers wait
+// to get into a broken build. The timings are exported to a local file or an OpenTelemetry collector, only
+// the phase names, durations and outcomes are sent, never hosts, paths or passwords.
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// Phases of the connection setup
+const (
+	Dial       = "dial"
+	Auth       = "auth"
+	Detect     = "detect"
+	KeyInstall = "key_install"
+	IDELaunch  = "ide_launch"
+	// Total is the whole setup, from the first connection to the IDE connecting to the VM
+	Total = "total"
+)
+
+// Timing is how long a phase took.
+type Timing struct {
+	Phase    string    `json:"phase"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration_seconds"`
+	Failed   bool      `json:"failed,omitempty"`
+}
+
+var (
+	mu      sync.Mutex
+	timings []Timing
+	started = map[string]bool{}
+)
+
+// Start starts timing the phase, the returned function records it as failed if it gets an error. Only the first
+// run of a phase is timed, the later ones, eg. the connection of the IDE check, belong to the phase they run in.
+func Start(phase string) func(error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if started[phase] {
+		return func(error) {}
+	}
+	started[phase] = true
+
+	start := time.Now()
+	return func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		timings = append(timings, Timing{Phase: phase, Start: start, Duration: time.Since(start).Seconds(), Failed: err != nil})
+	}
+}
+
+// Timings returns the recorded timings in the order the phases finished.
+func Timings() []Timing {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]Timing(nil), timings...)
+}
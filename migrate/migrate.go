@@ -0,0 +1,267 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+)
+
+const stateFileName = "state.json"
+
+// SchemaVersion is the layout of the files this version writes, recorded in the state file.
+const SchemaVersion = 2
+
+// Earlier versions kept every file in the legacy dir, these are the ones that moved.
+var (
+	legacyStateFiles  = []string{"ssh_config", "known_hosts", "workspaces.json", "tokens.json"}
+	legacyConfigFiles = []string{"auth.json", "ides.json", "settings.json"}
+)
+
+// The first releases shared one key between every session, instead of a key per build.
+const legacySharedKeyName = "id_bitrise_remote_access"
+
+type state struct {
+	SchemaVersion int `json:"schema_version"`
+}
+
+type migration struct {
+	version     int
+	description string
+	apply       func() ([]string, error)
+}
+
+// Migrations are applied in order, each one brings the files from the previous version to its own.
+var migrations = []migration{
+	{version: 1, description: "move files out of the legacy dir", apply: moveLegacyFiles},
+	{version: 2, description: "remove the shared key of the first releases", apply: removeSharedKey},
+}
+
+// Run applies the migrations newer than the recorded schema version and records the current one.
+// It returns what was changed, nothing on an up to date or a fresh install.
+func Run() ([]string, error) {
+	current, err := readState()
+	if err != nil {
+		return nil, err
+	}
+	if current.SchemaVersion >= SchemaVersion {
+		// Up to date, or written by a newer version which knows its own layout better
+		return nil, nil
+	}
+
+	var changes []string
+	for _, m := range migrations {
+		if m.version <= current.SchemaVersion {
+			continue
+		}
+		applied, err := m.apply()
+		if err != nil {
+			return changes, fmt.Errorf("%s: %w", m.description, err)
+		}
+		changes = append(changes, applied...)
+
+		current.SchemaVersion = m.version
+		if err := writeState(current); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+func statePath() string {
+	return filepath.Join(paths.StateDir(), stateFileName)
+}
+
+func readState() (state, error) {
+	var current state
+
+	content, err := os.ReadFile(statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return current, nil
+	}
+	if err != nil {
+		return current, fmt.Errorf("read state: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &current); err != nil {
+		return current, fmt.Errorf("decode state: %w", err)
+	}
+	return current, nil
+}
+
+func writeState(current state) error {
+	content, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode state: %w", err)
+	}
+
+	path := statePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	return nil
+}
+
+// moveLegacyFiles moves the files to the XDG dirs or $BITRISE_REMOTE_ACCESS_HOME, if one of them is set,
+// and points the paths in the SSH configs to the new location.
+func moveLegacyFiles() ([]string, error) {
+	legacyDir := paths.LegacyDir()
+	stateDir := paths.StateDir()
+
+	var changes []string
+	move := func(names []string, dir string) error {
+		if filepath.Clean(dir) == filepath.Clean(legacyDir) {
+			return nil
+		}
+		for _, name := range names {
+			moved, err := moveFile(filepath.Join(legacyDir, name), filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			if moved {
+				changes = append(changes, fmt.Sprintf("Moved %s to %s", name, dir))
+			}
+		}
+		return nil
+	}
+	if err := move(legacyStateFiles, stateDir); err != nil {
+		return changes, err
+	}
+	if err := move(legacyConfigFiles, paths.ConfigDir()); err != nil {
+		return changes, err
+	}
+	if filepath.Clean(stateDir) == filepath.Clean(legacyDir) {
+		return changes, nil
+	}
+
+	// The host entry refers to the known hosts next to it
+	bitriseConfig := filepath.Join(stateDir, "ssh_config")
+	updated, err := replaceInFile(bitriseConfig, func(content string) string {
+		return strings.ReplaceAll(content, legacyDir, stateDir)
+	})
+	if err != nil {
+		return changes, err
+	}
+	if updated {
+		changes = append(changes, fmt.Sprintf("Updated the paths in %s", bitriseConfig))
+	}
+
+	userConfig := filepath.Join(paths.SSHDir(), "config")
+	if info, err := os.Lstat(userConfig); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		// Managed by a dotfile manager, the setup includes the new location from a drop-in or asks the user to
+		return changes, nil
+	}
+	legacyIncludes := []string{
+		"Include " + filepath.Join(legacyDir, "ssh_config"),
+		"Include ~/.bitrise/remote-access/ssh_config",
+	}
+	updated, err = replaceInFile(userConfig, func(content string) string {
+		lines := strings.Split(content, "\n")
+		for i, line := range lines {
+			for _, legacyInclude := range legacyIncludes {
+				if strings.TrimSpace(line) == legacyInclude {
+					lines[i] = "Include " + bitriseConfig
+				}
+			}
+		}
+		return strings.Join(lines, "\n")
+	})
+	if err != nil {
+		return changes, err
+	}
+	if updated {
+		changes = append(changes, fmt.Sprintf("Pointed the Include line of %s to %s", userConfig, bitriseConfig))
+	}
+	return changes, nil
+}
+
+// removeSharedKey removes the key every session used to share, unless the host entry still refers to it,
+// eg. a session opened by an earlier version is still in use.
+func removeSharedKey() ([]string, error) {
+	keyPath := filepath.Join(paths.SSHDir(), legacySharedKeyName)
+	if _, err := os.Stat(keyPath); err != nil {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(paths.StateDir(), "ssh_config"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read SSH config: %w", err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.EqualFold(fields[0], "IdentityFile") && filepath.Base(fields[1]) == legacySharedKeyName {
+			return nil, nil
+		}
+	}
+
+	for _, path := range []string{keyPath, keyPath + ".pub"} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("remove key: %w", err)
+		}
+	}
+	return []string{fmt.Sprintf("Removed the shared key %s, every session generates its own now", keyPath)}, nil
+}
+
+// moveFile moves src to dst, unless dst exists already, which was written by the current version.
+func moveFile(src, dst string) (bool, error) {
+	if _, err := os.Stat(src); err != nil {
+		return false, nil
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, fmt.Errorf("create directory: %w", err)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return true, nil
+	}
+
+	// The dirs may be on different file systems
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", src, err)
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(dst, content, info.Mode().Perm()); err != nil {
+		return false, fmt.Errorf("write %s: %w", dst, err)
+	}
+	if err := os.Remove(src); err != nil {
+		return false, fmt.Errorf("remove %s: %w", src, err)
+	}
+	return true, nil
+}
+
+func replaceInFile(path string, replace func(content string) string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	updated := replace(string(content))
+	if updated == string(content) {
+		return false, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(path, []byte(updated), info.Mode().Perm()); err != nil {
+		return false, fmt.Errorf("write %s: %w", path, err)
+	}
+	return true, nil
+}
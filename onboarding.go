@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/auth"
+	"github.com/bitrise-io/bitrise-remote-access-cli/bitrise"
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/settings"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/urfave/cli/v3"
+)
+
+// onboardingProfileName is the name of the token profile created by the onboarding.
+const onboardingProfileName = "default"
+
+// runOnboarding checks the prerequisites and asks for the user's defaults, then saves them to the settings file
+// so the later runs don't ask again. Every question can be skipped, the defaults are kept then.
+func runOnboarding() error {
+	logger.Info(i18n.T("Welcome! A few questions to set up the defaults, run `setup` to change them later"))
+	current, err := settings.Load()
+	if err != nil {
+		logger.Warn(err)
+	}
+
+	locales := []string{"", i18n.English, i18n.Japanese}
+	choice, err := logger.Choose(i18n.T("Language of the messages"), []string{i18n.T("System default"), "English", "日本語"})
+	if err != nil {
+		return fmt.Errorf("ask for language: %w", err)
+	}
+	current.Locale = locales[choice]
+	i18n.SetLocale(current.Locale)
+
+	checkPrerequisites()
+
+	var identifiers []string
+	names := []string{i18n.T("Detect it every time")}
+	for _, ide := range supportedIDEs {
+		if ide.SupportsCurrentPlatform() {
+			identifiers = append(identifiers, ide.Identifier)
+			names = append(names, ide.Name)
+		}
+	}
+	choice, err = logger.Choose(i18n.T("Default editor of the auto command"), names)
+	if err != nil {
+		return fmt.Errorf("ask for default editor: %w", err)
+	}
+	current.DefaultIDE = ""
+	if choice > 0 {
+		current.DefaultIDE = identifiers[choice-1]
+	}
+
+	if auth.UsesKeychain() {
+		options := []string{settings.PasswordAsk, settings.PasswordStore, settings.PasswordForget}
+		choice, err := logger.Choose(i18n.T("Keep the SSH password in the keychain until you disconnect?"), []string{
+			i18n.T("Ask every time"),
+			i18n.T("Always, the commands of the session won't ask for it"),
+			i18n.T("Never"),
+		})
+		if err != nil {
+			return fmt.Errorf("ask for keychain usage: %w", err)
+		}
+		current.Password = options[choice]
+	}
+
+	current.Telemetry, err = logger.Confirm(
+		i18n.T("Send anonymous usage metrics?\nOnly the commands, their duration and outcome, never hosts, paths or passwords."),
+		i18n.T("Thanks, metrics enabled"),
+		i18n.T("Metrics disabled"))
+	if err != nil {
+		return fmt.Errorf("ask for telemetry: %w", err)
+	}
+
+	if token := apiToken(); token == "" {
+		if err := onboardAPIToken(); err != nil {
+			logger.Warn(err)
+		}
+	}
+
+	current.OnboardedAt = time.Now()
+	if err := settings.Save(current); err != nil {
+		return err
+	}
+	logger.Success(i18n.T("Settings saved to %s", settings.Path()))
+	return nil
+}
+
+// checkPrerequisites reports what's missing for a connection, without stopping the onboarding.
+func checkPrerequisites() {
+	var lines []string
+	if path, err := ssh.FindOpenSSH(); err != nil {
+		lines = append(lines, "✗ "+err.Error())
+	} else {
+		lines = append(lines, "✓ "+i18n.T("OpenSSH client: %s", path))
+	}
+
+	var installed []string
+	for _, ide := range supportedIDEs {
+		if ide.SupportsCurrentPlatform() && ide.OnTestPath != nil {
+			if _, found := ide.OnTestPath(); found {
+				installed = append(installed, ide.Name)
+			}
+		}
+	}
+	if len(installed) == 0 {
+		lines = append(lines, "✗ "+i18n.T("No editor found in $PATH, the shell can still be used"))
+	} else {
+		lines = append(lines, "✓ "+i18n.T("Editors: %s", strings.Join(installed, ", ")))
+	}
+
+	if auth.UsesKeychain() {
+		lines = append(lines, "✓ "+i18n.T("Keychain available"))
+	} else {
+		lines = append(lines, "✗ "+i18n.T("No keychain found, tokens are stored in a file only readable by you"))
+	}
+	logger.PrintFormattedOutput(i18n.T("Prerequisites"), strings.Join(lines, "\n"))
+}
+
+// onboardAPIToken offers to store a personal access token for the API-driven features, eg. rebuild.
+func onboardAPIToken() error {
+	configure, err := logger.Confirm(
+		i18n.T("Set up a Bitrise personal access token?\nIt's needed by rebuild and for explaining failed connections."),
+		"",
+		i18n.T("Skipped, run `%s %s <NAME>` later", authCommand, loginCommand))
+	if err != nil || !configure {
+		return nil
+	}
+
+	token, err := logger.Password(i18n.T("Personal access token"))
+	if err != nil {
+		return fmt.Errorf("ask for token: %w", err)
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil
+	}
+
+	user, err := bitrise.NewClient(token).CurrentUser()
+	if err != nil {
+		return fmt.Errorf("validate token: %w", err)
+	}
+	if err := auth.Login(auth.Profile{Name: onboardingProfileName, Username: user.Username}, token); err != nil {
+		return err
+	}
+	logger.Success(i18n.T("Logged in as %s", user.Username))
+	return nil
+}
+
+// needsOnboarding reports whether this is the first run and there is a terminal to ask on.
+func needsOnboarding() bool {
+	if jsonOutput || !logger.IsInteractive() {
+		return false
+	}
+	return !settings.Exists()
+}
+
+func setup(ctx context.Context, cliCmd *cli.Command) error {
+	if !logger.IsInteractive() {
+		return failure.New(failure.Config, fmt.Errorf("the setup needs a terminal to ask on"))
+	}
+	if err := runOnboarding(); err != nil {
+		return failure.New(failure.Config, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const (
+	// HomeEnvVar overrides the directory of every file the CLI manages, eg. in containers or shared homes.
+	HomeEnvVar = "BITRISE_REMOTE_ACCESS_HOME"
+
+	xdgConfigHomeEnvVar = "XDG_CONFIG_HOME"
+	xdgStateHomeEnvVar  = "XDG_STATE_HOME"
+	xdgAppDirName       = "bitrise-remote-access"
+)
+
+var configDirOverride, homeDirOverride string
+
+// SetConfigDir overrides the directory of every file the CLI manages, it takes precedence over HomeEnvVar.
+func SetConfigDir(dir string) {
+	configDirOverride = dir
+}
+
+// SetHomeDir overrides the home directory, so ~/.ssh and the default dirs are resolved in it, eg. in a
+// throwaway directory. An empty dir restores the user's home directory.
+func SetHomeDir(dir string) {
+	homeDirOverride = dir
+}
+
+// HomeDir returns the home directory of the current user.
+func HomeDir() string {
+	if homeDirOverride != "" {
+		return homeDirOverride
+	}
+	if runtime.GOOS == "windows" {
+		return os.Getenv("USERPROFILE")
+	}
+	return os.Getenv("HOME")
+}
+
+// SSHDir returns the directory where OpenSSH looks for the user's config and keys.
+func SSHDir() string {
+	return filepath.Join(HomeDir(), ".ssh")
+}
+
+// ConfigDir returns the directory of user edited files.
+// Resolution order: --config-dir, $BITRISE_REMOTE_ACCESS_HOME, $XDG_CONFIG_HOME, ~/.bitrise/remote-access.
+func ConfigDir() string {
+	return resolve(xdgConfigHomeEnvVar)
+}
+
+// StateDir returns the directory of files generated by the CLI, eg. the SSH config entry and known hosts.
+// Resolution order: --config-dir, $BITRISE_REMOTE_ACCESS_HOME, $XDG_STATE_HOME, ~/.bitrise/remote-access.
+func StateDir() string {
+	return resolve(xdgStateHomeEnvVar)
+}
+
+// LegacyDir returns the directory used by earlier versions for every file.
+func LegacyDir() string {
+	return filepath.Join(HomeDir(), ".bitrise", "remote-access")
+}
+
+func resolve(xdgEnvVar string) string {
+	if configDirOverride != "" {
+		return configDirOverride
+	}
+	if dir := os.Getenv(HomeEnvVar); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv(xdgEnvVar); dir != "" {
+		return filepath.Join(dir, xdgAppDirName)
+	}
+	return LegacyDir()
+}
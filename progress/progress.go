@@ -0,0 +1,84 @@
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	Started   Status = "started"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Skipped   Status = "skipped"
+	// Progressed is reported by long-running stages, eg. the bytes copied of a large file
+	Progressed Status = "progressed"
+)
+
+// Event is a change in the state of a setup stage, eg. the remote environment was detected.
+type Event struct {
+	Stage    string            `json:"stage"`
+	Status   Status            `json:"status"`
+	Message  string            `json:"message"`
+	Error    string            `json:"error,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+// Sink consumes the events, eg. prints them to the terminal.
+type Sink interface {
+	Handle(event Event)
+}
+
+var (
+	mu    sync.Mutex
+	sinks = []Sink{TerminalSink{}}
+)
+
+// SetSinks replaces the sinks, the terminal sink is used by default.
+func SetSinks(newSinks ...Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = newSinks
+}
+
+func AddSink(sink Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = append(sinks, sink)
+}
+
+// Emit sends the event to every sink. Stages run concurrently, so sinks are called one event at a time.
+func Emit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, sink := range sinks {
+		sink.Handle(event)
+	}
+}
+
+func Start(stage, message string) {
+	Emit(Event{Stage: stage, Status: Started, Message: message})
+}
+
+func Succeed(stage, message string) {
+	Emit(Event{Stage: stage, Status: Succeeded, Message: message})
+}
+
+func Skip(stage, message string) {
+	Emit(Event{Stage: stage, Status: Skipped, Message: message})
+}
+
+// Fail reports a failed stage, the message describes what failed, eg. copy README file to remote.
+func Fail(stage, message string, err error) {
+	event := Event{Stage: stage, Status: Failed, Message: message}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	Emit(event)
+}
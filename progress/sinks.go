@@ -0,0 +1,111 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+)
+
+// TerminalSink prints the events with the logger.
+type TerminalSink struct{}
+
+func (TerminalSink) Handle(event Event) {
+	switch event.Status {
+	case Started, Skipped, Progressed:
+		logger.Info(event.Message)
+	case Succeeded:
+		logger.Success(event.Message)
+	case Failed:
+		if event.Error != "" {
+			logger.Warnf("%s: %s", event.Message, event.Error)
+		} else {
+			logger.Warn(event.Message)
+		}
+	}
+}
+
+// JSONSink writes every event as a line of JSON, for scripts and editors driving the CLI.
+type JSONSink struct {
+	encoder *json.Encoder
+}
+
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{encoder: json.NewEncoder(w)}
+}
+
+func (s *JSONSink) Handle(event Event) {
+	_ = s.encoder.Encode(event)
+}
+
+// FileSink appends the events to a log file, eg. to attach it to a support request.
+type FileSink struct {
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open log file: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Handle(event Event) {
+	line := fmt.Sprintf("%s [%s] %s: %s", event.Time.Format(time.RFC3339), event.Status, event.Stage, event.Message)
+	if event.Error != "" {
+		line += ": " + event.Error
+	}
+	for key, value := range event.Metadata {
+		line += fmt.Sprintf(" %s=%s", key, value)
+	}
+	_, _ = fmt.Fprintln(s.file, line)
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// NotificationSink shows a desktop notification when one of the stages finishes,
+// so the setup can run in the background while doing something else.
+type NotificationSink struct {
+	Stages []string
+}
+
+func (s NotificationSink) Handle(event Event) {
+	if event.Status != Succeeded && event.Status != Failed {
+		return
+	}
+	watched := false
+	for _, stage := range s.Stages {
+		watched = watched || stage == event.Stage
+	}
+	if !watched {
+		return
+	}
+
+	message := event.Message
+	if event.Error != "" {
+		message += ": " + event.Error
+	}
+	notify("Bitrise Remote Access", message)
+}
+
+func notify(title, message string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", fmt.Sprintf("display notification %q with title %q", message, title))
+	case "linux":
+		cmd = exec.Command("notify-send", title, message)
+	default:
+		return
+	}
+	// Notifications are best effort, eg. notify-send is missing on headless machines
+	_ = cmd.Run()
+}
@@ -0,0 +1,94 @@
+// Package recording writes terminal sessions in the asciicast v2 format, they can be replayed with
+// `asciinema play` or shared on asciinema.org.
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+type header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder is an io.Writer that records everything written to it as output events.
+type Recorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	start time.Time
+}
+
+// Create starts a recording at the path, the terminal size is taken from $COLUMNS and $LINES if set.
+func Create(path, title string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create recording: %w", err)
+	}
+
+	start := time.Now()
+	content, err := json.Marshal(header{
+		Version:   2,
+		Width:     envInt("COLUMNS", defaultWidth),
+		Height:    envInt("LINES", defaultHeight),
+		Timestamp: start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("write recording header: %w", err)
+	}
+
+	return &Recorder{file: file, start: start}, nil
+}
+
+// Write records p as output at the time since the start of the recording.
+func (r *Recorder) Write(p []byte) (int, error) {
+	event, err := json.Marshal([]any{time.Since(r.start).Seconds(), "o", string(p)})
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Write(append(event, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close finishes the recording.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
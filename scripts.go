@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	"github.com/bitrise-io/bitrise-remote-access-cli/scripts"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/urfave/cli/v3"
+)
+
+// scriptCommands makes a subcommand of every script, its arguments are passed to the script as they are.
+func scriptCommands(list []scripts.Script) []*cli.Command {
+	var commands []*cli.Command
+	for _, script := range list {
+		usage := script.Description
+		if usage == "" {
+			usage = fmt.Sprintf("Run %s on the VM", script.Path)
+		}
+		commands = append(commands, &cli.Command{
+			Name:            script.Name,
+			Usage:           usage,
+			UsageText:       fmt.Sprintf("%s %s %s [ARGS...]", cliName, runCommand, script.Name),
+			SkipFlagParsing: true,
+			Action: func(ctx context.Context, cliCmd *cli.Command) error {
+				return runScript(cliCmd, script)
+			},
+		})
+	}
+	return commands
+}
+
+func listScripts(ctx context.Context, cliCmd *cli.Command) error {
+	list, err := scripts.List()
+	if err != nil {
+		logger.Warn(err)
+	}
+	if name := cliCmd.Args().First(); name != "" {
+		return failure.New(failure.Config, fmt.Errorf("no script %s in %s or %s", name, scripts.RepoDirName, filepath.Join(paths.ConfigDir(), scripts.DirName)))
+	}
+	if cliCmd.Bool(jsonFlag) {
+		return json.NewEncoder(os.Stdout).Encode(list)
+	}
+	if len(list) == 0 {
+		logger.Infof("No scripts found, add them to %s in the repo or to %s", scripts.RepoDirName, filepath.Join(paths.ConfigDir(), scripts.DirName))
+		return nil
+	}
+	for _, script := range list {
+		fmt.Printf("%-24s  %s\n", script.Name, script.Description)
+	}
+	return nil
+}
+
+func runScript(cliCmd *cli.Command, script scripts.Script) error {
+	content, err := os.ReadFile(script.Path)
+	if err != nil {
+		return failure.New(failure.Config, fmt.Errorf("read script: %w", err))
+	}
+
+	logger.Infof("Running %s on the VM...", script.Name)
+	if err := ssh.RunScript(filepath.Base(script.Path), content, cliCmd.Args().Slice(), os.Stdout, passwordFlag(cliCmd)); err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+	logger.Successf("%s finished", script.Name)
+	return nil
+}
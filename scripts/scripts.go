@@ -0,0 +1,111 @@
+// Package scripts finds the debug scripts a team keeps in its repo or a user in the config dir, eg. one that clears
+// DerivedData and runs the unit tests again, so they can be run on the VM by name.
+package scripts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+)
+
+const (
+	// DirName is the directory of the scripts in the config dir
+	DirName = "scripts"
+	// RepoDirName is the directory of the scripts in the project repo, next to the team config
+	RepoDirName = ".bitrise-remote/scripts"
+)
+
+// Script is a file run on the VM, named after the file without its extension.
+type Script struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Description is the first comment of the script, eg. # Clears DerivedData and runs the unit tests
+	Description string `json:"description,omitempty"`
+}
+
+// List returns the scripts of the repo the working directory is in and the ones of the config dir, sorted by
+// name. The repo's script wins if both have one with the same name.
+func List() ([]Script, error) {
+	var dirs []string
+	if repoDir := findRepoDir(); repoDir != "" {
+		dirs = append(dirs, repoDir)
+	}
+	dirs = append(dirs, filepath.Join(paths.ConfigDir(), DirName))
+
+	var scripts []Script
+	var errs []error
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, fmt.Errorf("read scripts: %w", err))
+			}
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+			if slices.ContainsFunc(scripts, func(s Script) bool { return s.Name == name }) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			scripts = append(scripts, Script{Name: name, Path: path, Description: description(path)})
+		}
+	}
+
+	slices.SortFunc(scripts, func(a, b Script) int { return strings.Compare(a.Name, b.Name) })
+	return scripts, errors.Join(errs...)
+}
+
+// findRepoDir looks for the scripts directory in the working directory and its parents up to the repo root.
+func findRepoDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	for {
+		if info, err := os.Stat(filepath.Join(dir, RepoDirName)); err == nil && info.IsDir() {
+			return filepath.Join(dir, RepoDirName)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// description returns the first comment line after the shebang, empty if the script doesn't start with one.
+func description(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#!"), line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			return strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+		return ""
+	}
+	return ""
+}
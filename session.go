@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/auth"
+	"github.com/bitrise-io/bitrise-remote-access-cli/bitrise"
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+	"github.com/bitrise-io/bitrise-remote-access-cli/settings"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/urfave/cli/v3"
+)
+
+func exportSession(ctx context.Context, cliCmd *cli.Command) error {
+	expiry := defaultBundleExpiry
+	if value := cliCmd.String(expiresFlag); value != "" {
+		var err error
+		if expiry, err = time.ParseDuration(value); err != nil || expiry <= 0 {
+			return failure.New(failure.Config, fmt.Errorf("invalid --%s: %s", expiresFlag, value))
+		}
+	}
+
+	includeKey := cliCmd.Bool(includeKeyFlag)
+	bundle, err := ssh.Export(includeKey, expiry)
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+
+	content, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode bundle: %w", err)
+	}
+
+	if includeKey {
+		logger.Warn("The bundle contains the private SSH key of the session, share it only over a private channel")
+	} else {
+		logger.Info("The bundle has no SSH key, your teammate will need the password of the build too")
+	}
+
+	output := cliCmd.String(outputFlag)
+	if output == "" {
+		fmt.Println(string(content))
+		return nil
+	}
+	// The key makes it as sensitive as the key file itself
+	if err := os.WriteFile(output, append(content, '\n'), 0600); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	logger.Successf("Bundle written to %s, it can be imported until %s", output, bundle.ExpiresAt.Local().Format(time.Kitchen))
+	return nil
+}
+
+func importSession(ctx context.Context, cliCmd *cli.Command) error {
+	file := cliCmd.Args().First()
+	if file == "" {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("bundle file is required, - reads the standard input"))
+	}
+
+	var content []byte
+	var err error
+	if file == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return failure.New(failure.Config, fmt.Errorf("read bundle: %w", err))
+	}
+
+	var bundle ssh.Bundle
+	if err := json.Unmarshal(content, &bundle); err != nil {
+		return failure.New(failure.Config, fmt.Errorf("decode bundle: %w", err))
+	}
+
+	if err := ssh.Import(&bundle); err != nil {
+		return failure.New(failure.Config, err)
+	}
+
+	logger.Successf("Connection to %s imported, connect with `%s` or open %s in your editor", bundle.HostName, shellJoin(ssh.SSHCommand()), ssh.BitriseHostPattern)
+	if bundle.PrivateKey == "" {
+		logger.Info("The bundle has no SSH key, ask for the password of the build")
+	}
+	return nil
+}
+
+func disconnect(ctx context.Context, cliCmd *cli.Command) error {
+	jsonOutput = cliCmd.Bool(jsonFlag)
+	if jsonOutput {
+		progress.SetSinks(progress.NewJSONSink(os.Stdout))
+	}
+	if err := ssh.Disconnect(); err != nil {
+		return err
+	}
+	if err := auth.ForgetSessionPassword(); err != nil {
+		logger.Warn(err)
+	}
+	return nil
+}
+
+// refresh switches the last session to new credentials, eg. when the build restarted the remote access step and the
+// stored password stopped working.
+func refresh(ctx context.Context, cliCmd *cli.Command) error {
+	host, port, user := cliCmd.String(sshHostFlag), cliCmd.String(sshPortFlag), cliCmd.String(sshUserFlag)
+	// The stored password is the one that stopped working
+	password := cliCmd.String(sshPasswordFlag)
+
+	appSlug, buildSlug := cliCmd.String(appSlugFlag), cliCmd.String(buildSlugFlag)
+	if token := apiToken(); password == "" && token != "" && appSlug != "" && buildSlug != "" {
+		access, err := bitrise.NewClient(token).RemoteAccess(appSlug, buildSlug)
+		if err != nil {
+			return failure.New(failure.Auth, err)
+		}
+		host, port, user, password = access.Host, access.Port, access.User, access.Password
+	}
+
+	if password == "" {
+		entered, err := logger.Password(i18n.T("New SSH password of the VM"))
+		if err != nil || entered == "" {
+			return failure.New(failure.Config, fmt.Errorf("the new password is required, pass it with --%s or set --%s and --%s", sshPasswordFlag, appSlugFlag, buildSlugFlag))
+		}
+		password = entered
+	}
+
+	_, stored := auth.SessionPassword()
+	if err := ssh.RefreshCredentials(host, port, user, &password); err != nil {
+		return err
+	}
+
+	userSettings, err := settings.Load()
+	if err != nil {
+		logger.Warn(err)
+	}
+	if stored || userSettings.Password == settings.PasswordStore {
+		if err := auth.StoreSessionPassword(password); err != nil {
+			logger.Warn(err)
+		}
+	}
+
+	logger.Resultf("Session refreshed, the editors and %s, %s and %s use the new credentials", repairCommand, pushCommand, pullCommand)
+	return nil
+}
+
+func repair(ctx context.Context, cliCmd *cli.Command) error {
+	jsonOutput = cliCmd.Bool(jsonFlag)
+	if jsonOutput {
+		progress.SetSinks(progress.NewJSONSink(os.Stdout))
+	}
+
+	password := passwordFlag(cliCmd)
+
+	return ssh.Repair(password, cliCmd.Bool(dryRunFlag))
+}
@@ -0,0 +1,84 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+)
+
+// FileName is the file of the user's settings in the config dir, written by the onboarding.
+const FileName = "settings.json"
+
+// Password storage choices, the empty one asks every time.
+const (
+	PasswordAsk    = ""
+	PasswordStore  = "store"
+	PasswordForget = "never"
+)
+
+// Settings are the user's defaults, the flags and the team config take precedence over them.
+type Settings struct {
+	// DefaultIDE is the identifier of the IDE the auto command opens, empty to detect it
+	DefaultIDE string `json:"default_ide,omitempty"`
+	// Password tells whether the SSH password is kept in the keychain for the session
+	Password string `json:"password,omitempty"`
+	// Locale is the language of the messages, eg. ja, empty to follow the system
+	Locale string `json:"locale,omitempty"`
+	// Telemetry is the opt-in to sending anonymous usage metrics
+	Telemetry bool `json:"telemetry"`
+	// Aliases are the user's shorthands of whole invocations, by name, eg. ios-debug for
+	// "vscode --build-from-clipboard --forward 8080:localhost:8080"
+	Aliases     map[string]string `json:"aliases,omitempty"`
+	OnboardedAt time.Time         `json:"onboarded_at"`
+}
+
+// Path returns the settings file.
+func Path() string {
+	return filepath.Join(paths.ConfigDir(), FileName)
+}
+
+// Exists reports whether the settings were saved, ie. the onboarding ran.
+func Exists() bool {
+	_, err := os.Stat(Path())
+	return err == nil
+}
+
+// Load returns the saved settings, the zero value if there are none.
+func Load() (Settings, error) {
+	var settings Settings
+
+	content, err := os.ReadFile(Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("read settings: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("decode settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Save writes the settings.
+func Save(settings Settings) error {
+	content, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode settings: %w", err)
+	}
+
+	path := Path()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("write settings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/ide"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/recording"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+)
+
+const (
+	ideIdentifier = "shell"
+	ideName       = "Terminal shell"
+
+	// Prints the path of mosh-server, installing it with the stack's package manager if needed.
+	// Non-interactive sessions don't load the shell profile, so Homebrew's bin dirs are added manually.
+	moshServerInstallScript = `PATH="$PATH:/opt/homebrew/bin:/usr/local/bin"; ` +
+		`command -v mosh-server >/dev/null 2>&1 || ` +
+		`{ if command -v brew >/dev/null 2>&1; then brew install mosh; else sudo apt-get install -y mosh; fi; } >/dev/null 2>&1; ` +
+		`command -v mosh-server`
+)
+
+var IdeData = ide.IDE{
+	Identifier: ideIdentifier,
+	Name:       ideName,
+	Aliases:    []string{"terminal"},
+	Capabilities: ide.Capabilities{
+		KeyAuth:       true,
+		PasswordPaste: true,
+		FolderURI:     true,
+	},
+	OnOpen:     openShell,
+	OnTestPath: isSSHInstalled}
+
+func openShell(hostPattern, folderPath, additionalInfo string, options ide.OpenOptions) error {
+	sshPath, installed := isSSHInstalled()
+	if !installed {
+		return fmt.Errorf("ssh client not found")
+	}
+
+	if additionalInfo != "" {
+		logger.PrintFormattedOutput(fmt.Sprintf("Opening %s", ideName), fmt.Sprintf("Source code location:\n\n%s\n\n%s", folderPath, additionalInfo))
+	} else {
+		logger.Infof("Opening shell in %s...", folderPath)
+	}
+
+	if options.Mosh && options.RecordPath != "" {
+		logger.Warn("mosh sessions can't be recorded, using SSH instead")
+	} else if options.Mosh {
+		err := openMosh(sshPath, hostPattern, folderPath)
+		if err == nil {
+			return nil
+		}
+		logger.Warnf("mosh session: %s, falling back to SSH", err)
+	}
+
+	args := []string{"-t", hostPattern}
+	if folderPath != "" {
+		args = append(args, fmt.Sprintf("cd %q && exec $SHELL -l", folderPath))
+	}
+
+	if options.RecordPath != "" {
+		return runRecorded(options.RecordPath, sshPath, args...)
+	}
+
+	if err := runInteractive(sshPath, args...); err != nil {
+		return fmt.Errorf("run remote shell: %w", err)
+	}
+
+	return nil
+}
+
+// runRecorded runs the remote shell with its output recorded too. The input stays the terminal,
+// so ssh still allocates a pseudo terminal on the remote and the session works as usual.
+func runRecorded(recordPath, sshPath string, args ...string) error {
+	recorder, err := recording.Create(recordPath, fmt.Sprintf("Bitrise remote access %s", time.Now().Format(time.DateTime)))
+	if err != nil {
+		return err
+	}
+	defer recorder.Close()
+
+	logger.Infof("Recording the session to %s", recordPath)
+
+	cmd := exec.Command(sshPath, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, recorder)
+	cmd.Stderr = io.MultiWriter(os.Stderr, recorder)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("run remote shell: %w", err)
+	}
+
+	logger.Successf("Session recorded, replay it with `asciinema play %s`", recordPath)
+	return nil
+}
+
+// openMosh starts a mosh session, installing mosh-server on the VM if it is missing.
+func openMosh(sshPath, hostPattern, folderPath string) error {
+	moshPath, err := exec.LookPath("mosh")
+	if err != nil {
+		return fmt.Errorf("mosh client not found in $PATH")
+	}
+
+	logger.Info("Ensuring mosh-server is available on remote...")
+	serverPath, err := ensureRemoteMoshServer(sshPath, hostPattern)
+	if err != nil {
+		return err
+	}
+	logger.Success("mosh-server available")
+
+	// mosh negotiates the UDP port of the server over SSH, so it uses the same config entry
+	args := []string{"--ssh=" + sshPath, "--server=" + serverPath, hostPattern}
+	if folderPath != "" {
+		args = append(args, "--", "sh", "-c", fmt.Sprintf("cd %q && exec $SHELL -l", folderPath))
+	}
+
+	return runInteractive(moshPath, args...)
+}
+
+func ensureRemoteMoshServer(sshPath, hostPattern string) (string, error) {
+	cmd := exec.Command(sshPath, hostPattern, moshServerInstallScript)
+	out, err := cmd.Output()
+	serverPath := strings.TrimSpace(string(out))
+	if err != nil || serverPath == "" {
+		return "", fmt.Errorf("install mosh-server on remote: %v", err)
+	}
+	return serverPath, nil
+}
+
+func runInteractive(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func isSSHInstalled() (string, bool) {
+	sshPath, err := ssh.FindOpenSSH()
+	return sshPath, err == nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/urfave/cli/v3"
+)
+
+func simList(ctx context.Context, cliCmd *cli.Command) error {
+	simulators, err := ssh.ListSimulators(passwordFlag(cliCmd))
+	if err != nil {
+		return err
+	}
+	if cliCmd.Bool(jsonFlag) {
+		return json.NewEncoder(os.Stdout).Encode(simulators)
+	}
+	if len(simulators) == 0 {
+		logger.Info("No simulators found on the VM")
+		return nil
+	}
+	for _, simulator := range simulators {
+		fmt.Printf("%-8s  %-14s  %-36s  %s\n", simulator.State, simulator.Runtime, simulator.UDID, simulator.Name)
+	}
+	return nil
+}
+
+func simBoot(ctx context.Context, cliCmd *cli.Command) error {
+	device := cliCmd.Args().First()
+	if device == "" {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("simulator to boot is required"))
+	}
+
+	logger.Infof("Booting %s...", device)
+	simulator, err := ssh.BootSimulator(device, passwordFlag(cliCmd))
+	if err != nil {
+		return err
+	}
+	logger.Successf("%s (%s) is booted", simulator.Name, simulator.Runtime)
+	return nil
+}
+
+func simShutdown(ctx context.Context, cliCmd *cli.Command) error {
+	device := cliCmd.Args().First()
+	if err := ssh.ShutdownSimulators(device, passwordFlag(cliCmd)); err != nil {
+		return err
+	}
+	if device == "" {
+		logger.Success("Every simulator is shut down")
+	} else {
+		logger.Successf("%s is shut down", device)
+	}
+	return nil
+}
+
+func emulatorList(ctx context.Context, cliCmd *cli.Command) error {
+	emulators, err := ssh.ListEmulators(passwordFlag(cliCmd))
+	if err != nil {
+		return err
+	}
+	if cliCmd.Bool(jsonFlag) {
+		return json.NewEncoder(os.Stdout).Encode(emulators)
+	}
+	if len(emulators) == 0 {
+		logger.Info("No Android virtual devices found on the VM")
+		return nil
+	}
+	for _, emulator := range emulators {
+		state := "stopped"
+		if emulator.Serial != "" {
+			state = emulator.Serial
+		}
+		fmt.Printf("%-14s  %s\n", state, emulator.Name)
+	}
+	return nil
+}
+
+func emulatorStart(ctx context.Context, cliCmd *cli.Command) error {
+	name := cliCmd.Args().First()
+	if name == "" {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("name of the Android virtual device to start is required"))
+	}
+
+	logger.Infof("Starting %s...", name)
+	emulator, err := ssh.StartEmulator(name, passwordFlag(cliCmd))
+	if err != nil {
+		return err
+	}
+	logger.Successf("%s is running as %s", emulator.Name, emulator.Serial)
+	return nil
+}
@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const StageLink = "link"
+
+// AdaptiveThresholds are the round-trip times the setup adapts to. Zero durations keep the defaults,
+// which are the limits `check` rates the link by.
+type AdaptiveThresholds struct {
+	// Slow turns on compression and warns that Remote - SSH may be sluggish
+	Slow time.Duration
+	// VerySlow also skips the optional steps, eg. the README copy and the extension installs
+	VerySlow time.Duration
+	// Disabled keeps the setup the same on every link
+	Disabled bool
+}
+
+var adaptiveThresholds = AdaptiveThresholds{Slow: goodRTT, VerySlow: usableRTT}
+
+// SetAdaptiveThresholds sets when the setup is adapted to a slow link, eg. from the team config.
+func SetAdaptiveThresholds(thresholds AdaptiveThresholds) {
+	if thresholds.Slow == 0 {
+		thresholds.Slow = goodRTT
+	}
+	if thresholds.VerySlow == 0 {
+		thresholds.VerySlow = usableRTT
+	}
+	adaptiveThresholds = thresholds
+}
+
+type linkSpeed int
+
+const (
+	linkFast linkSpeed = iota
+	linkSlow
+	linkVerySlow
+)
+
+// adaptToLink measures the round-trip time and adapts the config entry to it, the IDE's SSH client compresses
+// the traffic on slow links. The measurement takes a few keepalives, a failure leaves the setup as it is.
+func adaptToLink(client *cryptoSSH.Client, configEntry *configEntry) linkSpeed {
+	if adaptiveThresholds.Disabled {
+		return linkFast
+	}
+
+	progress.Start(StageLink, i18n.T("Measuring round-trip time..."))
+	rtt, err := measureRTT(client)
+	if err != nil {
+		progress.Fail(StageLink, "measure round-trip time", err)
+		return linkFast
+	}
+
+	speed := linkFast
+	switch {
+	case rtt > adaptiveThresholds.VerySlow:
+		speed = linkVerySlow
+	case rtt > adaptiveThresholds.Slow:
+		speed = linkSlow
+	}
+
+	progress.Emit(progress.Event{
+		Stage:    StageLink,
+		Status:   progress.Succeeded,
+		Message:  fmt.Sprintf("Round-trip time: %s", rtt.Round(time.Millisecond)),
+		Metadata: map[string]string{"rtt_ms": fmt.Sprint(rtt.Milliseconds())},
+	})
+
+	if speed == linkFast {
+		return speed
+	}
+	configEntry.Tuning.Compression = true
+	if speed == linkVerySlow {
+		logger.Warn(i18n.T("The link is very slow, compression is turned on and optional steps are skipped. Remote - SSH may be sluggish."))
+	} else {
+		logger.Warn(i18n.T("The link is slow, compression is turned on. Remote - SSH may be sluggish."))
+	}
+	return speed
+}
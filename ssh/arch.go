@@ -0,0 +1,135 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// archScript prints the architecture of the shell, of the hardware and of the Xcode toolchain as "key value" lines.
+// hw.optional.arm64 is only set on Apple silicon, sysctl.proc_translated only for processes under Rosetta.
+const archScript = `echo "machine $(uname -m)"
+if [ "$(sysctl -n hw.optional.arm64 2>/dev/null)" = 1 ]; then echo "hardware arm64"; else echo "hardware $(uname -m)"; fi
+[ "$(sysctl -n sysctl.proc_translated 2>/dev/null)" = 1 ] && echo "translated 1"
+command -v xcrun >/dev/null 2>&1 && echo "toolchain $(lipo -archs "$(xcrun -f clang 2>/dev/null)" 2>/dev/null)"
+true
+`
+
+// Arch is the CPU architecture of a machine, with the naming of uname, eg. arm64 or x86_64.
+type Arch struct {
+	// Machine is the architecture the shell runs as, x86_64 under Rosetta on Apple silicon
+	Machine string `json:"machine"`
+	// Hardware is the architecture of the CPU
+	Hardware   string `json:"hardware"`
+	Translated bool   `json:"translated,omitempty"`
+	// Toolchain lists the architectures the Xcode toolchain's binaries are built for, empty without Xcode
+	Toolchain []string `json:"toolchain,omitempty"`
+}
+
+func (a Arch) String() string {
+	if a.Translated {
+		return fmt.Sprintf("%s under Rosetta on %s", a.Machine, a.Hardware)
+	}
+	return a.Hardware
+}
+
+// values keys the fields like the tools of a snapshot, so they are diffed the same way.
+func (a *Arch) values() map[string]string {
+	if a == nil {
+		return nil
+	}
+	values := map[string]string{"machine": a.Machine, "hardware": a.Hardware}
+	if a.Translated {
+		values["translated"] = "yes"
+	}
+	if len(a.Toolchain) > 0 {
+		values["toolchain"] = strings.Join(a.Toolchain, " ")
+	}
+	return values
+}
+
+// DetectArch returns the architecture of the VM of the last session.
+func DetectArch(password *string) (*Arch, error) {
+	var arch *Arch
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		var err error
+		arch, err = detectArch(client)
+		return err
+	})
+	return arch, err
+}
+
+func detectArch(client *cryptoSSH.Client) (*Arch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	output, err := runCommandOutput(ctx, client, archScript)
+	if err != nil {
+		return nil, fmt.Errorf("detect architecture: %w", err)
+	}
+	return parseArch(output), nil
+}
+
+// parseArch reads the lines printed by archScript.
+func parseArch(output string) *Arch {
+	arch := &Arch{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		value = strings.TrimSpace(value)
+		switch key {
+		case "machine":
+			arch.Machine = value
+		case "hardware":
+			arch.Hardware = value
+		case "translated":
+			arch.Translated = value == "1"
+		case "toolchain":
+			arch.Toolchain = strings.Fields(value)
+		}
+	}
+	return arch
+}
+
+// LocalArch returns the architecture of this machine. The CLI might be an x86_64 build running under Rosetta, so
+// the hardware is asked on macOS.
+func LocalArch() Arch {
+	machine := runtime.GOARCH
+	switch machine {
+	case "amd64":
+		machine = "x86_64"
+	case "386":
+		machine = "i386"
+	}
+	arch := Arch{Machine: machine, Hardware: machine}
+
+	if runtime.GOOS == "darwin" {
+		if out, err := localCommands.Output("sysctl", "-n", "hw.optional.arm64"); err == nil && strings.TrimSpace(string(out)) == "1" {
+			arch.Hardware = "arm64"
+			arch.Translated = machine != "arm64"
+		}
+	}
+	return arch
+}
+
+// ArchWarnings returns the differences between the VM and this machine that make an issue reproduce on one of them
+// only, eg. a simulator that only has an arm64 slice.
+func ArchWarnings(remote *Arch, local Arch) []string {
+	var warnings []string
+	if remote.Translated {
+		warnings = append(warnings, fmt.Sprintf("The shell on the VM runs as %s under Rosetta, the tools started from it build and run %s code, not %s",
+			remote.Machine, remote.Machine, remote.Hardware))
+	}
+	if remote.Hardware != "" && remote.Hardware != local.Hardware {
+		warnings = append(warnings, fmt.Sprintf("The VM is %s, this machine is %s: architecture specific issues, eg. of arm64-only simulators or x86_64-only dependencies, might not reproduce locally",
+			remote.Hardware, local.Hardware))
+	}
+	if len(remote.Toolchain) > 0 && !slices.Contains(remote.Toolchain, remote.Hardware) {
+		warnings = append(warnings, fmt.Sprintf("The Xcode toolchain on the VM is built for %s only, it runs under Rosetta on %s",
+			strings.Join(remote.Toolchain, " "), remote.Hardware))
+	}
+	return warnings
+}
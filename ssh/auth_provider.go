@@ -0,0 +1,211 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// accessTokenRenewMargin is how long before it expires a token is replaced, so it doesn't expire mid-handshake
+const accessTokenRenewMargin = 30 * time.Second
+
+// authProvider is a way of authenticating to the VM. The credentials of every provider that applies to the entry
+// are offered in one handshake, so a new mechanism, eg. certificates derived from an OIDC token, is a new provider.
+type authProvider interface {
+	// applies reports whether the provider has credentials for the entry
+	applies(entry *configEntry) bool
+	credentials(entry *configEntry) (authCredentials, error)
+}
+
+// authCredentials are what a provider offers. The client only tries the first method of a kind, so the public
+// keys of all the providers are offered by the same method, and the passwords by the same retried one.
+type authCredentials struct {
+	signers   []cryptoSSH.Signer
+	passwords []passwordSource
+}
+
+// passwordSource returns a secret to answer the password prompts with.
+type passwordSource func() (string, error)
+
+// authProviders are asked in order, the short-lived token is offered before the static password
+var authProviders = []authProvider{accessTokenAuth{}, passwordAuth{}, sessionKeyAuth{}, certificateAuth{}}
+
+// authMethods returns the auth methods of the providers that apply to the entry.
+func authMethods(entry *configEntry) ([]cryptoSSH.AuthMethod, error) {
+	var methods []cryptoSSH.AuthMethod
+	var signers []cryptoSSH.Signer
+	var passwords []passwordSource
+	for _, provider := range authProviders {
+		if !provider.applies(entry) {
+			continue
+		}
+		if _, isSessionKey := provider.(sessionKeyAuth); entry.sessionKeyOnly && !isSessionKey {
+			continue
+		}
+		credentials, err := provider.credentials(entry)
+		if err != nil {
+			return nil, err
+		}
+		passwords = append(passwords, credentials.passwords...)
+		signers = append(signers, credentials.signers...)
+	}
+	if len(passwords) > 0 {
+		methods = append(methods, passwordMethods(passwords)...)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, cryptoSSH.PublicKeys(signers...))
+	}
+	return methods, nil
+}
+
+// hasCredentials reports whether the entry can be authenticated with before a session key exists.
+func hasCredentials(entry *configEntry) bool {
+	for _, provider := range authProviders {
+		if provider.applies(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+type passwordAuth struct{}
+
+func (passwordAuth) applies(entry *configEntry) bool {
+	return entry.Password != nil
+}
+
+func (passwordAuth) credentials(entry *configEntry) (authCredentials, error) {
+	password := *entry.Password
+	return authCredentials{passwords: []passwordSource{func() (string, error) { return password, nil }}}, nil
+}
+
+// passwordMethods answers the password and keyboard-interactive prompts with the sources in order, a rejected
+// answer is retried with the next one, eg. the static password after a rejected token. A source that fails is
+// skipped while there is another one.
+func passwordMethods(sources []passwordSource) []cryptoSSH.AuthMethod {
+	next := func(attempt *int) (string, error) {
+		for {
+			source := sources[min(*attempt, len(sources)-1)]
+			*attempt++
+			password, err := source()
+			if err == nil || *attempt >= len(sources) {
+				return password, err
+			}
+		}
+	}
+
+	var passwordAttempt, challengeAttempt int
+	return []cryptoSSH.AuthMethod{
+		cryptoSSH.RetryableAuthMethod(cryptoSSH.PasswordCallback(func() (string, error) {
+			return next(&passwordAttempt)
+		}), len(sources)),
+		cryptoSSH.RetryableAuthMethod(cryptoSSH.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			// A challenge without questions is only an instruction, it doesn't use up a source
+			if len(questions) == 0 {
+				return nil, nil
+			}
+			password, err := next(&challengeAttempt)
+			if err != nil {
+				return nil, err
+			}
+			return passwordChallenge(password)(name, instruction, questions, echos)
+		}), len(sources)),
+	}
+}
+
+type sessionKeyAuth struct{}
+
+func (sessionKeyAuth) applies(entry *configEntry) bool {
+	return entry.IdentityFile != ""
+}
+
+func (sessionKeyAuth) credentials(entry *configEntry) (authCredentials, error) {
+	if isSecurityKey(entry.IdentityFile) {
+		// Go's client can't talk to the authenticator, the password is used instead unless ssh-agent holds the key
+		signer, err := securityKeySigner(entry.IdentityFile)
+		if err == nil {
+			return authCredentials{signers: []cryptoSSH.Signer{signer}}, nil
+		}
+		if entry.Password == nil {
+			return authCredentials{}, failure.New(failure.Auth, fmt.Errorf("%w: %w", errSecurityKeyUnusable, err))
+		}
+		return authCredentials{}, nil
+	}
+
+	key, err := os.ReadFile(entry.IdentityFile)
+	if err != nil {
+		return authCredentials{}, fmt.Errorf("read private key: %w", err)
+	}
+	signer, err := cryptoSSH.ParsePrivateKey(key)
+	if err != nil {
+		return authCredentials{}, fmt.Errorf("parse private key: %w", err)
+	}
+	return authCredentials{signers: []cryptoSSH.Signer{signer}}, nil
+}
+
+type certificateAuth struct{}
+
+func (certificateAuth) applies(entry *configEntry) bool {
+	return entry.CertificateFile != ""
+}
+
+func (certificateAuth) credentials(entry *configEntry) (authCredentials, error) {
+	signer, err := certificateSigner(entry.CertificateFile)
+	if err != nil {
+		return authCredentials{}, failure.New(failure.Auth, fmt.Errorf("load certificate: %w", err))
+	}
+	return authCredentials{signers: []cryptoSSH.Signer{signer}}, nil
+}
+
+// AccessTokenSource returns a short-lived token the VM accepts in place of the password, and when it expires.
+type AccessTokenSource func() (token string, expiresAt time.Time, err error)
+
+var (
+	accessTokens AccessTokenSource
+	// tokenMu guards the token cached for the connections of the session, eg. the reconnects of the daemon
+	tokenMu          sync.Mutex
+	accessToken      string
+	accessTokenUntil time.Time
+)
+
+// SetAccessTokenSource authenticates the connections with the tokens of the source instead of a static password,
+// nil turns it off.
+func SetAccessTokenSource(source AccessTokenSource) {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	accessTokens = source
+	accessToken, accessTokenUntil = "", time.Time{}
+}
+
+type accessTokenAuth struct{}
+
+func (accessTokenAuth) applies(entry *configEntry) bool {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	return accessTokens != nil
+}
+
+// credentials answers the password prompts with the token, it's only requested when the VM asks for it.
+func (accessTokenAuth) credentials(entry *configEntry) (authCredentials, error) {
+	return authCredentials{passwords: []passwordSource{currentAccessToken}}, nil
+}
+
+// currentAccessToken returns the cached token, or a new one if it's about to expire.
+func currentAccessToken() (string, error) {
+	tokenMu.Lock()
+	defer tokenMu.Unlock()
+	if accessToken != "" && time.Until(accessTokenUntil) > accessTokenRenewMargin {
+		return accessToken, nil
+	}
+
+	token, expiresAt, err := accessTokens()
+	if err != nil {
+		return "", failure.New(failure.Auth, fmt.Errorf("get access token: %w", err))
+	}
+	accessToken, accessTokenUntil = token, expiresAt
+	return token, nil
+}
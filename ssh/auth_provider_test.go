@@ -0,0 +1,49 @@
+package ssh
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAccessTokenFallsBackToPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		tokenErr error
+		password *string
+		wantErr  bool
+	}{
+		{name: "accepted token", token: testPassword},
+		{name: "token before the password", token: testPassword, password: ptrTo("wrong")},
+		{name: "rejected token", token: "expired", password: ptrTo(testPassword)},
+		{name: "failing token source", tokenErr: errors.New("API unavailable"), password: ptrTo(testPassword)},
+		{name: "rejected token and password", token: "expired", password: ptrTo("wrong"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTempDirs(t)
+			server := newTestServer(t, nil)
+			server.use(t)
+			SetAccessTokenSource(func() (string, time.Time, error) {
+				return tt.token, time.Now().Add(time.Hour), tt.tokenErr
+			})
+			t.Cleanup(func() { SetAccessTokenSource(nil) })
+
+			entry := server.entry()
+			entry.Password = tt.password
+			client, err := connectSSHClient(entry)
+			if tt.wantErr {
+				if err == nil {
+					client.Close()
+					t.Error("connectSSHClient() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.Close()
+		})
+	}
+}
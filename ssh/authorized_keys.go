@@ -0,0 +1,116 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// authorizedKeyLine is a line of authorized_keys. Lines that are not keys, eg. comments, have no fingerprint.
+type authorizedKeyLine struct {
+	text        string
+	fingerprint string
+	comment     string
+}
+
+// parseAuthorizedKeyLine parses a line in any of the formats sshd accepts, with or without options and comment.
+func parseAuthorizedKeyLine(text string) authorizedKeyLine {
+	line := authorizedKeyLine{text: text}
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return line
+	}
+
+	key, comment, _, _, err := cryptoSSH.ParseAuthorizedKey([]byte(trimmed))
+	if err != nil {
+		return line
+	}
+	line.fingerprint = cryptoSSH.FingerprintSHA256(key)
+	line.comment = comment
+	return line
+}
+
+func parseAuthorizedKeys(content string) []authorizedKeyLine {
+	if content == "" {
+		return nil
+	}
+	var lines []authorizedKeyLine
+	for _, text := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		lines = append(lines, parseAuthorizedKeyLine(text))
+	}
+	return lines
+}
+
+func formatAuthorizedKeys(lines []authorizedKeyLine) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.text
+	}
+	return strings.Join(texts, "\n") + "\n"
+}
+
+// withAuthorizedKey returns authorized_keys with the key. An entry of the same key is kept whatever its comment and
+// options are. With replaceStale, the other keys with the same comment are dropped, they are the keys this machine
+// authorized for earlier sessions.
+func withAuthorizedKey(content, keyText string, replaceStale bool) (string, error) {
+	key := parseAuthorizedKeyLine(keyText)
+	if key.fingerprint == "" {
+		return "", fmt.Errorf("parse public key: %q is not in authorized_keys format", strings.TrimSpace(keyText))
+	}
+	// A comment every key of the CLI had would match the keys of teammates too
+	replaceStale = replaceStale && key.comment != "" && key.comment != sshKeyComment
+
+	var kept []authorizedKeyLine
+	present := false
+	for _, line := range parseAuthorizedKeys(content) {
+		switch {
+		case line.fingerprint == key.fingerprint:
+			if present {
+				// A duplicate of the key
+				continue
+			}
+			present = true
+		case replaceStale && line.fingerprint != "" && line.comment == key.comment:
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !present {
+		kept = append(kept, authorizedKeyLine{text: strings.TrimSpace(keyText)})
+	}
+	return formatAuthorizedKeys(kept), nil
+}
+
+// withoutAuthorizedKey returns authorized_keys without any entry of the key.
+func withoutAuthorizedKey(content, keyText string) (string, error) {
+	key := parseAuthorizedKeyLine(keyText)
+	if key.fingerprint == "" {
+		return "", fmt.Errorf("parse public key: %q is not in authorized_keys format", strings.TrimSpace(keyText))
+	}
+
+	var kept []authorizedKeyLine
+	for _, line := range parseAuthorizedKeys(content) {
+		if line.fingerprint != key.fingerprint {
+			kept = append(kept, line)
+		}
+	}
+	return formatAuthorizedKeys(kept), nil
+}
+
+// hasAuthorizedKey reports whether authorized_keys has the key, whatever the comment and the options of its entry.
+func hasAuthorizedKey(content, keyText string) bool {
+	key := parseAuthorizedKeyLine(keyText)
+	if key.fingerprint == "" {
+		return false
+	}
+	for _, line := range parseAuthorizedKeys(content) {
+		if line.fingerprint == key.fingerprint {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	triggeredWorkflowEnvVar = "BITRISE_TRIGGERED_WORKFLOW_ID"
+	tmpDirEnvVar            = "TMPDIR"
+)
+
+// buildContextEnvVars are read by readBuildContext, the setup reads them together with the rest of the environment
+var buildContextEnvVars = append([]string{sourceDirEnvVar, triggeredWorkflowEnvVar, tmpDirEnvVar, deployDirEnvVar}, xcodeRawLogEnvVars...)
+
+// buildContext is the part of the build's environment the workflow helpers need.
+type buildContext struct {
+	SourceDir string
+	Workflow  string
+	TmpDir    string
+	DeployDir string
+	// RawLogs are the raw xcodebuild logs the Xcode steps exported
+	RawLogs []string
+}
+
+// readBuildContext reads the build's environment, which is only set in login shells.
+func readBuildContext(client *cryptoSSH.Client) (*buildContext, error) {
+	envMap, err := runWithPty(client, &buildContextEnvVars, "echo $", true)
+	if err != nil {
+		return nil, fmt.Errorf("detect remote environment: %w", err)
+	}
+	return newBuildContext(envMap), nil
+}
+
+func newBuildContext(envMap map[string]string) *buildContext {
+	build := &buildContext{
+		SourceDir: strings.TrimSpace(envMap[sourceDirEnvVar]),
+		Workflow:  strings.TrimSpace(envMap[triggeredWorkflowEnvVar]),
+		TmpDir:    strings.TrimSpace(envMap[tmpDirEnvVar]),
+		DeployDir: strings.TrimSpace(envMap[deployDirEnvVar]),
+	}
+	for _, envVar := range xcodeRawLogEnvVars {
+		if rawLog := strings.TrimSpace(envMap[envVar]); rawLog != "" {
+			build.RawLogs = append(build.RawLogs, rawLog)
+		}
+	}
+	return build
+}
+
+// findBitriseYML returns the path of the build's bitrise.yml, the one in the repository is used if there is one,
+// otherwise the newest one the build downloaded to its temp dir.
+func findBitriseYML(client *cryptoSSH.Client, build *buildContext) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	var candidates []string
+	if build.SourceDir != "" {
+		candidates = append(candidates, fmt.Sprintf("[ -f %[1]s ] && echo %[1]s", shellQuote(build.SourceDir+"/bitrise.yml")))
+	}
+	tmpDir := build.TmpDir
+	if tmpDir == "" {
+		tmpDir = "/tmp"
+	}
+	candidates = append(candidates, fmt.Sprintf("find %s -maxdepth 3 -name bitrise.yml -type f 2>/dev/null | xargs ls -t 2>/dev/null | head -n 1", shellQuote(tmpDir)))
+
+	output, _ := runCommandOutput(ctx, client, "{ "+strings.Join(candidates, "; ")+"; } | head -n 1")
+	configPath := strings.TrimSpace(output)
+	if configPath == "" {
+		return "", fmt.Errorf("bitrise.yml of the build not found on the VM")
+	}
+	return configPath, nil
+}
+
+// readBitriseYML reads and decodes the build's bitrise.yml, the decoded config keeps every key of the file.
+func readBitriseYML(client *cryptoSSH.Client, configPath string) (map[string]any, error) {
+	content, err := readRemoteFile(client, configPath)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", configPath, err)
+	}
+
+	config := map[string]any{}
+	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", configPath, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,152 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+)
+
+const (
+	bundleVersion = 1
+	// sharedKeySuffix marks the keys imported from a bundle, they belong to the teammate who exported them
+	sharedKeySuffix = "_shared"
+)
+
+// Bundle is a portable copy of the connection of the last session, so a teammate can join the same VM.
+type Bundle struct {
+	Version    int       `json:"version"`
+	HostName   string    `json:"hostname"`
+	Port       string    `json:"port"`
+	User       string    `json:"user"`
+	KnownHosts []string  `json:"known_hosts,omitempty"`
+	PrivateKey string    `json:"private_key,omitempty"`
+	PublicKey  string    `json:"public_key,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Export returns the bundle of the last session. The private key is only included if asked for,
+// without it the teammate needs the password too.
+func Export(includeKey bool, validFor time.Duration) (*Bundle, error) {
+	configEntry, err := readSSHClientConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no session to export, connect to a build first")
+		}
+		return nil, fmt.Errorf("read SSH config entry: %w", err)
+	}
+
+	now := time.Now()
+	bundle := &Bundle{
+		Version:   bundleVersion,
+		HostName:  configEntry.HostName,
+		Port:      configEntry.Port,
+		User:      configEntry.User,
+		CreatedAt: now,
+		ExpiresAt: now.Add(validFor),
+	}
+
+	if content, err := os.ReadFile(bitriseKnownHostsPath()); err == nil {
+		address := knownHostsAddress(configEntry)
+		for _, line := range strings.Split(string(content), "\n") {
+			if knownHostsLineMatches(line, address) {
+				bundle.KnownHosts = append(bundle.KnownHosts, line)
+			}
+		}
+	}
+
+	if includeKey {
+		if configEntry.IdentityFile == "" {
+			return nil, fmt.Errorf("the session has no SSH key, share the password instead")
+		}
+		privateKey, err := os.ReadFile(configEntry.IdentityFile)
+		if err != nil {
+			return nil, fmt.Errorf("read private key: %w", err)
+		}
+		publicKey, err := os.ReadFile(configEntry.IdentityFile + ".pub")
+		if err != nil {
+			return nil, fmt.Errorf("read public key: %w", err)
+		}
+		bundle.PrivateKey = string(privateKey)
+		bundle.PublicKey = string(publicKey)
+	}
+
+	return bundle, nil
+}
+
+// Import sets up the connection of the bundle like a session of our own: the host entry, the known host
+// and the key if the bundle has one.
+func Import(bundle *Bundle) error {
+	if bundle.Version != bundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	if time.Now().After(bundle.ExpiresAt) {
+		return fmt.Errorf("the bundle expired at %s, ask for a new one", bundle.ExpiresAt.Local().Format(time.RFC1123))
+	}
+
+	configEntry := &configEntry{
+		Host:           BitriseHostPattern,
+		HostName:       bundle.HostName,
+		User:           bundle.User,
+		Port:           bundle.Port,
+		KnownHostsFile: bitriseKnownHostsPath(),
+	}
+	if configEntry.HostName == "" || configEntry.Port == "" || configEntry.User == "" {
+		return fmt.Errorf("the bundle is missing the host, port or user")
+	}
+
+	if err := removeHostKey(configEntry); err != nil {
+		return fmt.Errorf("remove old host key: %w", err)
+	}
+	if len(bundle.KnownHosts) > 0 {
+		if err := appendKnownHosts(bitriseKnownHostsPath(), bundle.KnownHosts); err != nil {
+			return fmt.Errorf("add host key: %w", err)
+		}
+	}
+
+	useIdentityKey := bundle.PrivateKey != ""
+	if useIdentityKey {
+		keyPath := filepath.Join(paths.SSHDir(), sshKeyPrefix+sharedKeySuffix)
+		if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+			return fmt.Errorf("create directory: %w", err)
+		}
+		defer interrupt.Track(keyPath)()
+		defer interrupt.Track(keyPath + ".pub")()
+		if err := os.WriteFile(keyPath, []byte(bundle.PrivateKey), 0600); err != nil {
+			return fmt.Errorf("write private key: %w", err)
+		}
+		if err := os.WriteFile(keyPath+".pub", []byte(bundle.PublicKey), 0644); err != nil {
+			return fmt.Errorf("write public key: %w", err)
+		}
+		configEntry.IdentityFile = keyPath
+	}
+
+	return setupClientConfig(configEntry, useIdentityKey, false)
+}
+
+// isSharedKey reports whether the key was imported from a teammate's bundle. It is authorized on the VM
+// for the teammate too, so it's not revoked when disconnecting.
+func isSharedKey(keyPath string) bool {
+	return strings.HasSuffix(keyPath, sshKeyPrefix+sharedKeySuffix)
+}
+
+func appendKnownHosts(path string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	defer interrupt.Track(path)()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(strings.Join(lines, "\n") + "\n")
+	return err
+}
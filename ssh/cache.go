@@ -0,0 +1,122 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	// cacheIncludePathsEnvVar lists the paths cached by the legacy Cache:Push step, one per line
+	cacheIncludePathsEnvVar = "BITRISE_CACHE_INCLUDE_PATHS"
+	// cacheArchivePattern matches the archives the key-based cache steps download and create in the temp dir
+	cacheArchivePattern = "*cache*.t*"
+)
+
+// CacheEntry is a cached path or a cache archive on the VM.
+type CacheEntry struct {
+	Path string
+	// Archive is set for the archives of the key-based cache steps, the rest are the paths they are extracted to
+	Archive bool
+	// SizeKB is -1 if the path doesn't exist
+	SizeKB int64
+}
+
+// ListCache returns the build cache paths and archives on the VM of the last session.
+// The paths come from the build's environment, the archives are looked for in its temp dir.
+func ListCache(password *string) ([]CacheEntry, error) {
+	var entries []CacheEntry
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		var err error
+		entries, err = listCache(client)
+		return err
+	})
+	return entries, err
+}
+
+func listCache(client *cryptoSSH.Client) ([]CacheEntry, error) {
+	// The build's environment is only set in login shells, the lines are joined to fit in a single result
+	includeCmd := fmt.Sprintf(`printf '%%s' "$%s" | tr '\n' '\t'`, cacheIncludePathsEnvVar)
+	tmpCmd := `printf '%s' "${TMPDIR:-/tmp}"`
+	results, err := runWithPty(client, &[]string{includeCmd, tmpCmd}, "", true)
+	if err != nil {
+		return nil, fmt.Errorf("read cache paths: %w", err)
+	}
+
+	var entries []CacheEntry
+	for _, line := range strings.Split(results[includeCmd], "\t") {
+		// Paths can have a change indicator file after ->, eg. ./node_modules -> ./package-lock.json
+		cachePath, _, _ := strings.Cut(line, "->")
+		if cachePath = strings.TrimSpace(cachePath); cachePath != "" {
+			entries = append(entries, CacheEntry{Path: cachePath})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+	tmpDir := strings.TrimSpace(results[tmpCmd])
+	if tmpDir == "" {
+		tmpDir = "/tmp"
+	}
+	archives, err := runCommandOutput(ctx, client, fmt.Sprintf("find %s -maxdepth 2 -type f -name %s 2>/dev/null", shellQuote(tmpDir), shellQuote(cacheArchivePattern)))
+	if err == nil {
+		for _, archive := range strings.Split(strings.TrimSpace(archives), "\n") {
+			if archive != "" {
+				entries = append(entries, CacheEntry{Path: archive, Archive: true})
+			}
+		}
+	}
+
+	for i := range entries {
+		entries[i].SizeKB = remoteSizeKB(client, entries[i].Path)
+	}
+	return entries, nil
+}
+
+// remoteSizeKB returns the disk usage of the path in kilobytes, -1 if it doesn't exist.
+func remoteSizeKB(client *cryptoSSH.Client, remotePath string) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	output, err := runCommandOutput(ctx, client, "du -sk "+expandableQuote(remotePath))
+	if err != nil {
+		return -1
+	}
+	size, err := strconv.ParseInt(strings.Fields(output + " -1")[0], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// PurgeCache deletes the cache paths and archives from the VM, eg. to check whether a corrupted cache broke the build.
+func PurgeCache(paths []string, password *string) error {
+	return withClient(password, func(client *cryptoSSH.Client) error {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultSessionTimeout)
+		defer cancel()
+
+		for _, cachePath := range paths {
+			if cachePath == "" || path.Clean(cachePath) == "/" || path.Clean(cachePath) == "~" {
+				return fmt.Errorf("refusing to delete %q", cachePath)
+			}
+			if _, err := runCommandOutput(ctx, client, "rm -rf "+expandableQuote(cachePath)); err != nil {
+				return fmt.Errorf("delete %s: %w", cachePath, err)
+			}
+		}
+		return nil
+	})
+}
+
+// expandableQuote quotes the path but keeps a leading ~ or $HOME working, the cache paths are often given that way.
+func expandableQuote(remotePath string) string {
+	for _, prefix := range []string{"~/", "$HOME/"} {
+		if rest, found := strings.CutPrefix(remotePath, prefix); found {
+			return `"$HOME"/` + shellQuote(rest)
+		}
+	}
+	return shellQuote(remotePath)
+}
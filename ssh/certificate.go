@@ -0,0 +1,133 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// certificateSuffix is how OpenSSH names a certificate, after the private key it was issued for
+const certificateSuffix = "-cert.pub"
+
+// certificateFile is the SSH certificate the connections authenticate with, next to the password or the session key
+var certificateFile string
+
+// SetCertificate authenticates the connections with the SSH certificate at path, signed by a CA the VM trusts.
+// The private key is expected next to it, eg. ~/.ssh/id_ed25519 for ~/.ssh/id_ed25519-cert.pub, or in ssh-agent.
+func SetCertificate(path string) error {
+	if path == "" {
+		certificateFile = ""
+		return nil
+	}
+	if _, err := readCertificate(path); err != nil {
+		return err
+	}
+	certificateFile = expandHomeDir(path)
+	return nil
+}
+
+func readCertificate(path string) (*cryptoSSH.Certificate, error) {
+	content, err := os.ReadFile(expandHomeDir(path))
+	if err != nil {
+		return nil, fmt.Errorf("read certificate: %w", err)
+	}
+	key, _, _, _, err := cryptoSSH.ParseAuthorizedKey(content)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate %s: %w", path, err)
+	}
+	cert, ok := key.(*cryptoSSH.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is a public key, not a certificate", path)
+	}
+	if cert.CertType != cryptoSSH.UserCert {
+		return nil, fmt.Errorf("%s is a host certificate, a user certificate is needed", path)
+	}
+	return cert, nil
+}
+
+// certificateKeyPath returns the private key OpenSSH pairs with the certificate.
+func certificateKeyPath(certPath string) string {
+	return strings.TrimSuffix(certPath, certificateSuffix)
+}
+
+// checkCertificate checks that the certificate is valid now and lets the user log in, the VM would reject it
+// with an unhelpful "unable to authenticate" otherwise.
+func checkCertificate(path, user string) error {
+	cert, err := readCertificate(path)
+	if err != nil {
+		return err
+	}
+
+	now := uint64(time.Now().Unix())
+	if now < cert.ValidAfter {
+		return fmt.Errorf("the certificate %s is only valid from %s", path, time.Unix(int64(cert.ValidAfter), 0).Format(time.RFC3339))
+	}
+	if cert.ValidBefore != cryptoSSH.CertTimeInfinity && now >= cert.ValidBefore {
+		return fmt.Errorf("the certificate %s expired at %s, get a new one from your CA", path, time.Unix(int64(cert.ValidBefore), 0).Format(time.RFC3339))
+	}
+	// A certificate without principals is valid for any user
+	if len(cert.ValidPrincipals) > 0 && !slices.Contains(cert.ValidPrincipals, user) {
+		return fmt.Errorf("the certificate %s doesn't cover the user %s of the VM, only %s", path, user, strings.Join(cert.ValidPrincipals, ", "))
+	}
+	return nil
+}
+
+// certificateSigner signs with the private key of the certificate, read from the file next to it or, if that is
+// missing or protected by a passphrase, from ssh-agent.
+func certificateSigner(path string) (cryptoSSH.Signer, error) {
+	cert, err := readCertificate(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPath := certificateKeyPath(path)
+	var keyErr error
+	if keyPath == path {
+		keyErr = fmt.Errorf("the private key of %s isn't next to it, its name has to end in %s", path, certificateSuffix)
+	} else if key, err := os.ReadFile(keyPath); err != nil {
+		keyErr = fmt.Errorf("read private key: %w", err)
+	} else if signer, err := cryptoSSH.ParsePrivateKey(key); err != nil {
+		keyErr = fmt.Errorf("parse private key: %w", err)
+	} else {
+		return cryptoSSH.NewCertSigner(cert, signer)
+	}
+
+	signer, err := agentSigner(cert.Key)
+	if err != nil {
+		return nil, errors.Join(keyErr, err)
+	}
+	return cryptoSSH.NewCertSigner(cert, signer)
+}
+
+// agentSigner returns the key of ssh-agent with the public key.
+func agentSigner(publicKey cryptoSSH.PublicKey) (cryptoSSH.Signer, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("no ssh-agent running")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("connect to ssh-agent: %w", err)
+	}
+	// The signer keeps using the connection for the whole session
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("list ssh-agent keys: %w", err)
+	}
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), publicKey.Marshal()) {
+			return signer, nil
+		}
+	}
+	conn.Close()
+	return nil, fmt.Errorf("ssh-agent doesn't hold the private key")
+}
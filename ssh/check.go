@@ -0,0 +1,144 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	rttSamples         = 5
+	throughputTestSize = 4 * 1024 * 1024
+
+	// Remote - SSH gets sluggish above these values
+	goodRTT        = 150 * time.Millisecond
+	usableRTT      = 400 * time.Millisecond
+	goodThroughput = 1024 * 1024 // bytes per second
+)
+
+type linkQuality struct {
+	dialTime   time.Duration
+	rtt        time.Duration
+	throughput float64
+	sftpErr    error
+}
+
+// CheckConnection connects to the host and measures whether the link is good enough for Remote - SSH.
+// Without a host, the host of the last session's SSH config entry is checked.
+func CheckConnection(host, port, user string, password *string) error {
+	var configEntry *configEntry
+	var err error
+	if host == "" {
+		configEntry, err = readSSHClientConfig()
+		if err != nil {
+			return ConfigErr{err: fmt.Errorf("no host given and no previous session found: %w", err)}
+		}
+		configEntry.Password = password
+	} else {
+		configEntry, err = createClientConfig(host, port, user, password)
+		if err != nil {
+			return ConfigErr{err: err}
+		}
+	}
+
+	logger.Infof("Connecting to %s...", net.JoinHostPort(configEntry.HostName, configEntry.Port))
+	start := time.Now()
+	client, err := connectSSHClient(configEntry)
+	if err != nil {
+		return fmt.Errorf("connect to remote host, the VM is not reachable from this network or the build has finished: %w", err)
+	}
+	defer client.Close()
+
+	quality := linkQuality{dialTime: time.Since(start)}
+	logger.Success("Connected")
+
+	logger.Info("Measuring round-trip time...")
+	if quality.rtt, err = measureRTT(client); err != nil {
+		return fmt.Errorf("measure round-trip time: %w", err)
+	}
+
+	logger.Info("Measuring throughput...")
+	if quality.throughput, err = measureThroughput(client); err != nil {
+		return fmt.Errorf("measure throughput: %w", err)
+	}
+
+	logger.Info("Verifying SFTP...")
+	quality.sftpErr = verifySFTP(client)
+
+	logger.PrintFormattedOutput("Connection check", quality.report())
+	return nil
+}
+
+// measureRTT returns the best of a few keepalive round trips, which is the closest to the network latency.
+func measureRTT(client *cryptoSSH.Client) (time.Duration, error) {
+	var best time.Duration
+	for i := 0; i < rttSamples; i++ {
+		start := time.Now()
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			return 0, err
+		}
+		if rtt := time.Since(start); best == 0 || rtt < best {
+			best = rtt
+		}
+	}
+	return best, nil
+}
+
+// measureThroughput uploads a block of data over an SSH channel and returns the speed in bytes per second.
+func measureThroughput(client *cryptoSSH.Client) (float64, error) {
+	session, err := createSSHSession(client)
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	session.Stdin = bytes.NewReader(make([]byte, throughputTestSize))
+
+	start := time.Now()
+	if err := session.Run("cat > /dev/null"); err != nil {
+		return 0, err
+	}
+
+	return throughputTestSize / time.Since(start).Seconds(), nil
+}
+
+func verifySFTP(client *cryptoSSH.Client) error {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return err
+	}
+	defer sftpClient.Close()
+
+	_, err = sftpClient.Getwd()
+	return err
+}
+
+func (q linkQuality) report() string {
+	var report strings.Builder
+	fmt.Fprintf(&report, "Connection setup: %s\n", q.dialTime.Round(time.Millisecond))
+	fmt.Fprintf(&report, "Round-trip time:  %s\n", q.rtt.Round(time.Millisecond))
+	fmt.Fprintf(&report, "Throughput:       %.2f MB/s\n", q.throughput/(1024*1024))
+	if q.sftpErr != nil {
+		fmt.Fprintf(&report, "SFTP:             failed (%s)\n", q.sftpErr)
+	} else {
+		fmt.Fprintf(&report, "SFTP:             works\n")
+	}
+	report.WriteString("\n")
+
+	switch {
+	case q.rtt > usableRTT:
+		report.WriteString("The latency is too high for Remote - SSH, expect lagging. A different network might help.")
+	case q.rtt > goodRTT || q.throughput < goodThroughput:
+		report.WriteString("The link is usable, but Remote - SSH might feel slow.")
+	default:
+		report.WriteString("The link is good enough for Remote - SSH.")
+	}
+
+	return report.String()
+}
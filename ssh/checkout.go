@@ -0,0 +1,108 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// checkoutStashMessage marks the stash of the build's changes, so it can be told apart from the user's own
+const checkoutStashMessage = "bitrise-remote-access: build state before checking out %s"
+
+// pullRequestPattern matches a pull or merge request given as #123, pr/123, !123 or by its URL
+var pullRequestPattern = regexp.MustCompile(`^(?:#|!|pr/|.*/pull/|.*/merge_requests/|.*/pull-requests/)(\d+)/?$`)
+
+// CheckoutResult tells how to get back to the state the build left the source directory in.
+type CheckoutResult struct {
+	// Previous is the branch or commit that was checked out
+	Previous string
+	// Stashed is set if the changes of the build were stashed
+	Stashed bool
+	// Branch is the checked out branch, empty if a pull request was checked out detached
+	Branch string
+}
+
+// Checkout fetches the branch or pull request from origin and checks it out in the source directory of the
+// VM of the last session. The changes the build made are stashed first. The git output is written to output.
+func Checkout(ref string, output io.Writer, password *string) (*CheckoutResult, error) {
+	var result *CheckoutResult
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		build, err := readBuildContext(client)
+		if err != nil {
+			return err
+		}
+		if build.SourceDir == "" {
+			return fmt.Errorf("the source directory of the build is not set on the VM")
+		}
+		git := "git -C " + shellQuote(build.SourceDir)
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+		defer cancel()
+
+		origin, err := runCommandOutput(ctx, client, git+" remote get-url origin")
+		if err != nil {
+			return fmt.Errorf("read the origin of %s, is it a git repository?: %w", build.SourceDir, err)
+		}
+		refspec, branch := checkoutRefspec(ref, strings.TrimSpace(origin))
+
+		result = &CheckoutResult{Branch: branch}
+		previous, err := runCommandOutput(ctx, client, git+" symbolic-ref -q --short HEAD || "+git+" rev-parse HEAD")
+		if err != nil {
+			return fmt.Errorf("read the checked out ref: %w", err)
+		}
+		result.Previous = strings.TrimSpace(previous)
+
+		// Build outputs in ignored paths, eg. node_modules, are kept, stashing them would only slow the next build down
+		status, err := runCommandOutput(ctx, client, git+" status --porcelain")
+		if err != nil {
+			return fmt.Errorf("read the changes of the build: %w", err)
+		}
+		if strings.TrimSpace(status) != "" {
+			stash := fmt.Sprintf("%s stash push --include-untracked -m %s", git, shellQuote(fmt.Sprintf(checkoutStashMessage, ref)))
+			if _, err := runCommandOutput(ctx, client, stash); err != nil {
+				return fmt.Errorf("stash the changes of the build: %w", err)
+			}
+			result.Stashed = true
+		}
+
+		// The credentials the build cloned with may be gone, git must fail instead of asking for them
+		commands := []string{fmt.Sprintf("GIT_TERMINAL_PROMPT=0 %s fetch origin %s", git, shellQuote(refspec))}
+		if branch != "" {
+			// An existing local branch is only fast-forwarded, commits made on the VM are not thrown away
+			commands = append(commands, fmt.Sprintf("if %[1]s show-ref -q --verify refs/heads/%[2]s; then %[1]s checkout %[2]s && %[1]s merge --ff-only origin/%[2]s; else %[1]s checkout -b %[2]s --track origin/%[2]s; fi",
+				git, shellQuote(branch)))
+		} else {
+			commands = append(commands, git+" checkout --detach FETCH_HEAD")
+		}
+		if err := runInLoginShell(client, strings.Join(commands, " && "), output); err != nil {
+			if result.Stashed {
+				return fmt.Errorf("check out %s, the build's changes are in the stash: %w", ref, err)
+			}
+			return fmt.Errorf("check out %s: %w", ref, err)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// checkoutRefspec returns the refspec fetching the ref and the branch it checks out, empty for pull requests.
+// Pull requests are fetched from the ref their host keeps them under.
+func checkoutRefspec(ref, origin string) (refspec, branch string) {
+	if match := pullRequestPattern.FindStringSubmatch(ref); match != nil {
+		switch {
+		case strings.Contains(origin, "gitlab"):
+			return fmt.Sprintf("refs/merge-requests/%s/head", match[1]), ""
+		case strings.Contains(origin, "bitbucket"):
+			// Bitbucket Cloud doesn't publish pull request refs, only Bitbucket Server does
+			return fmt.Sprintf("refs/pull-requests/%s/from", match[1]), ""
+		}
+		return fmt.Sprintf("refs/pull/%s/head", match[1]), ""
+	}
+
+	branch = strings.TrimPrefix(strings.TrimPrefix(ref, "refs/heads/"), "origin/")
+	return fmt.Sprintf("+refs/heads/%[1]s:refs/remotes/origin/%[1]s", branch), branch
+}
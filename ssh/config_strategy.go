@@ -0,0 +1,196 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+)
+
+const (
+	dropInName = "bitrise-remote-access"
+	// configFileOverrideMarker records that the user's SSH config is left alone and VS Code reads the Bitrise
+	// config through its remote.SSH.configFile setting instead
+	configFileOverrideMarker = "vscode_config_file"
+)
+
+// readOnlyReason tells why the SSH config mustn't be rewritten, empty if it can be. A symlink is never written
+// through, it points into the store of a dotfile manager like chezmoi or home-manager, which would overwrite or
+// reject the change.
+func readOnlyReason(configPath string) string {
+	info, err := os.Lstat(configPath)
+	if err != nil {
+		// A missing config is created
+		return ""
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if target, err := filepath.EvalSymlinks(configPath); err == nil {
+			return fmt.Sprintf("%s is a symlink to %s", configPath, target)
+		}
+		return fmt.Sprintf("%s is a symlink", configPath)
+	}
+
+	file, err := os.OpenFile(configPath, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Sprintf("%s is read-only", configPath)
+	}
+	file.Close()
+	return ""
+}
+
+// dropInPath returns the file to include the Bitrise config from if the SSH config already includes the files of
+// a writable directory, eg. Include config.d/*, empty if it doesn't. Only the Include lines before the first Host
+// or Match block count, the ones in a block only apply to its hosts.
+func dropInPath(configPath string) string {
+	file, err := os.Open(configPath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	// Relative paths are relative to ~/.ssh and ~ is the home the config belongs to
+	sshDir := filepath.Dir(configPath)
+	home := filepath.Dir(sshDir)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.Replace(scanner.Text(), "=", " ", 1))
+		if len(fields) < 2 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "host", "match":
+			return ""
+		case "include":
+		default:
+			continue
+		}
+
+		for _, pattern := range fields[1:] {
+			if strings.HasPrefix(pattern, "~/") {
+				pattern = filepath.Join(home, pattern[2:])
+			} else if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(sshDir, pattern)
+			}
+			if path := dropInFile(pattern); path != "" {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// dropInFile returns the file in the directory of the pattern the pattern matches, empty if the directory
+// can't be written or the pattern only matches given files.
+func dropInFile(pattern string) string {
+	dir, glob := filepath.Split(pattern)
+	if !strings.ContainsAny(glob, "*?[") || strings.ContainsAny(dir, "*?[") {
+		return ""
+	}
+	info, err := os.Lstat(filepath.Clean(dir))
+	if err != nil || !info.IsDir() || info.Mode().Perm()&0200 == 0 {
+		return ""
+	}
+
+	// ssh reads the matching files in lexical order, the first one wins over the others
+	for _, name := range []string{"00-" + dropInName, "00-" + dropInName + ".conf", dropInName, dropInName + ".conf"} {
+		if matched, _ := filepath.Match(glob, name); matched {
+			return filepath.Join(dir, name)
+		}
+	}
+	return ""
+}
+
+func writeDropIn(path, includePath string) error {
+	content := fmt.Sprintf("# Added by Bitrise\nInclude %s\n", includePath)
+	if existing, err := os.ReadFile(path); err == nil && string(existing) == content {
+		return nil
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// manualIncludeErr explains how to add the Include line to a config that is generated from another file.
+func manualIncludeErr(configPath, includePath, reason string) error {
+	return ConfigErr{err: fmt.Errorf(`%s, so it isn't changed. Add these lines to the top of its source, eg. with `+
+		"`chezmoi edit %s` or the programs.ssh.includes option of home-manager, apply it and connect again:\n\n# Added by Bitrise\nInclude %s",
+		reason, configPath, includePath)}
+}
+
+// configFileOverridden reports whether VS Code was set up to read the Bitrise config instead of the user's.
+func configFileOverridden() bool {
+	_, err := os.Stat(filepath.Join(paths.StateDir(), configFileOverrideMarker))
+	return err == nil
+}
+
+// chooseClientConfigStrategy decides how the editors find the host when the user's SSH config can't be changed
+// and doesn't include a writable directory either. It's asked before connecting, as the plan runs next to the
+// remote setup.
+func chooseClientConfigStrategy() error {
+	configPath, includePath := sshConfigPath(), bitriseConfigPath()
+	if isClientConfigIncluded(configPath, includePath) || configFileOverridden() {
+		return nil
+	}
+	reason := readOnlyReason(configPath)
+	if reason == "" || dropInPath(configPath) != "" {
+		return nil
+	}
+	if !logger.IsInteractive() {
+		return manualIncludeErr(configPath, includePath, reason)
+	}
+
+	choice, err := logger.Choose(i18n.T("%s, so it isn't changed. How should the editors find the Bitrise host?", reason), []string{
+		i18n.T("Only VS Code, through its remote.SSH.configFile setting"),
+		i18n.T("Show me the lines to add to the source of my SSH config"),
+	})
+	if err != nil {
+		return fmt.Errorf("choose SSH config strategy: %w", err)
+	}
+	if choice != 0 {
+		return manualIncludeErr(configPath, includePath, reason)
+	}
+
+	markerPath := filepath.Join(paths.StateDir(), configFileOverrideMarker)
+	if err := os.MkdirAll(filepath.Dir(markerPath), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	if err := os.WriteFile(markerPath, []byte(includePath+"\n"), 0644); err != nil {
+		return fmt.Errorf("record SSH config strategy: %w", err)
+	}
+	logger.PrintFormattedOutput(i18n.T("Add this to your VS Code settings"),
+		fmt.Sprintf("\"remote.SSH.configFile\": %q\n\n%s", includePath,
+			i18n.T("Other editors can't find %s, `ssh -F %s %s` still works from the terminal.", BitriseHostPattern, includePath, BitriseHostPattern)))
+	return nil
+}
+
+// includeReadOnlyClientConfig includes the Bitrise config from the drop-in directory of a config that can't be
+// rewritten.
+func includeReadOnlyClientConfig(configPath, includePath, reason string) error {
+	path := dropInPath(configPath)
+	if path == "" {
+		return manualIncludeErr(configPath, includePath, reason)
+	}
+	if err := writeDropIn(path, includePath); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	logger.Info(i18n.T("%s, included the Bitrise SSH config from %s instead", reason, path))
+	return nil
+}
+
+// isDropInIncluded reports whether the drop-in of the config includes the Bitrise config.
+func isDropInIncluded(configPath, includePath string) bool {
+	path := dropInPath(configPath)
+	if path == "" {
+		return false
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(strings.Split(string(content), "\n"), fmt.Sprintf("Include %s", includePath))
+}
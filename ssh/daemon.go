@@ -0,0 +1,293 @@
+package ssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	daemonSocketFileName    = "daemon.sock"
+	daemonKeepaliveInterval = 15 * time.Second
+	daemonControlTimeout    = 5 * time.Second
+
+	daemonStatusRequest = "status"
+	daemonStopRequest   = "stop"
+)
+
+// ErrDaemonNotRunning is returned when there is no daemon to control.
+var ErrDaemonNotRunning = errors.New("the daemon is not running")
+
+// DaemonStatus is reported by a running daemon.
+type DaemonStatus struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Connected bool      `json:"connected"`
+	StartedAt time.Time `json:"started_at"`
+	// Reconnects counts the times the connection was lost and made again
+	Reconnects int      `json:"reconnects"`
+	Forwards   []string `json:"forwards,omitempty"`
+	LastError  string   `json:"last_error,omitempty"`
+}
+
+// DaemonSocketPath returns the control socket of the daemon.
+func DaemonSocketPath() string {
+	return filepath.Join(paths.StateDir(), daemonSocketFileName)
+}
+
+// daemon keeps the connection to the VM of the last session and its forwards alive.
+type daemon struct {
+	configEntry *configEntry
+	mu          sync.Mutex
+	status      DaemonStatus
+	client      *cryptoSSH.Client
+	closers     []io.Closer
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// RunDaemon connects to the VM of the last session, opens the forwards of its SSH config entry and keeps them
+// alive until StopDaemon is called or stop is closed. A lost connection is made again with the forwards, so
+// the editors reconnecting through the forwards find them in place. The subcommands use the connection too,
+// see connectSharedConnection. Runs in the foreground, the caller detaches it.
+func RunDaemon(password *string, stop <-chan struct{}) error {
+	configEntry, err := readSSHClientConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ConfigErr{err: fmt.Errorf("no session found, connect to the build first")}
+		}
+		return fmt.Errorf("read SSH config entry: %w", err)
+	}
+	configEntry.Password = password
+	if _, err := os.Stat(configEntry.IdentityFile); err != nil {
+		configEntry.IdentityFile = ""
+	}
+
+	if _, err := QueryDaemon(); err == nil {
+		return ConfigErr{err: fmt.Errorf("the daemon is already running")}
+	}
+	// A daemon that didn't exit cleanly leaves its socket behind
+	_ = os.Remove(DaemonSocketPath())
+	listener, err := net.Listen("unix", DaemonSocketPath())
+	if err != nil {
+		return fmt.Errorf("listen on control socket: %w", err)
+	}
+	defer os.Remove(DaemonSocketPath())
+	defer listener.Close()
+
+	d := &daemon{
+		configEntry: configEntry,
+		status:      DaemonStatus{PID: os.Getpid(), Host: configEntry.HostName, StartedAt: time.Now()},
+		stop:        make(chan struct{}),
+	}
+	if err := d.connect(); err != nil {
+		return err
+	}
+	defer d.disconnect()
+
+	shared, err := d.shareConnection()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sharedConnectionSocketPath())
+	defer shared.Close()
+
+	go d.serve(listener)
+	go func() {
+		select {
+		case <-stop:
+			d.shutdown()
+		case <-d.stop:
+		}
+	}()
+
+	logger.Infof("Daemon connected to %s, keeping the connection alive", configEntry.HostName)
+	ticker := time.NewTicker(daemonKeepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			logger.Info("Daemon stopped")
+			return nil
+		case <-ticker.C:
+			d.keepalive()
+		}
+	}
+}
+
+// connect makes the connection and opens the forwards.
+func (d *daemon) connect() error {
+	client, err := connectSSHClient(d.configEntry)
+	if err != nil {
+		return err
+	}
+
+	var closers []io.Closer
+	var forwards []string
+	for _, forward := range d.configEntry.LocalForwards {
+		localPort, remoteAddress, err := parseForward(forward)
+		if err != nil {
+			logger.Warnf("forward %s: %s", forward, err)
+			continue
+		}
+		t, err := openTunnel(client, localPort, remoteAddress)
+		if err != nil {
+			logger.Warnf("forward %s: %s", forward, err)
+			continue
+		}
+		closers = append(closers, t)
+		forwards = append(forwards, fmt.Sprintf("localhost:%d -> %s", localPort, remoteAddress))
+	}
+	for _, forward := range d.configEntry.RemoteForwards {
+		remotePort, localAddress, err := parseForward(forward)
+		if err != nil {
+			logger.Warnf("forward %s: %s", forward, err)
+			continue
+		}
+		t, err := openReverseTunnel(client, remotePort, localAddress)
+		if err != nil {
+			logger.Warnf("forward %s: %s", forward, err)
+			continue
+		}
+		closers = append(closers, t)
+		forwards = append(forwards, fmt.Sprintf("VM localhost:%d -> %s", remotePort, localAddress))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.client, d.closers = client, closers
+	d.status.Connected = true
+	d.status.Forwards = forwards
+	d.status.LastError = ""
+	return nil
+}
+
+// currentClient returns the connection to the VM, nil while reconnecting.
+func (d *daemon) currentClient() *cryptoSSH.Client {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.client
+}
+
+func (d *daemon) disconnect() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, closer := range d.closers {
+		_ = closer.Close()
+	}
+	if d.client != nil {
+		_ = d.client.Close()
+	}
+	d.client, d.closers = nil, nil
+	d.status.Connected = false
+	d.status.Forwards = nil
+}
+
+// keepalive checks the connection and makes it again when it was lost.
+func (d *daemon) keepalive() {
+	if client := d.currentClient(); client != nil {
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+			return
+		}
+		logger.Warn("Connection lost, reconnecting...")
+		d.disconnect()
+	}
+
+	if err := d.connect(); err != nil {
+		d.mu.Lock()
+		d.status.LastError = err.Error()
+		d.mu.Unlock()
+		logger.Warnf("reconnect: %s", err)
+		return
+	}
+	d.mu.Lock()
+	d.status.Reconnects++
+	d.mu.Unlock()
+	logger.Info("Reconnected")
+}
+
+func (d *daemon) shutdown() {
+	d.stopOnce.Do(func() { close(d.stop) })
+}
+
+// serve answers the requests of the control socket, one line each.
+func (d *daemon) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(daemonControlTimeout))
+
+			request, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				return
+			}
+			d.mu.Lock()
+			status := d.status
+			d.mu.Unlock()
+			_ = json.NewEncoder(conn).Encode(status)
+
+			if strings.TrimSpace(request) == daemonStopRequest {
+				d.shutdown()
+			}
+		}()
+	}
+}
+
+// QueryDaemon returns the status of the running daemon, ErrDaemonNotRunning without one.
+func QueryDaemon() (*DaemonStatus, error) {
+	return controlDaemon(daemonStatusRequest)
+}
+
+// StopDaemon stops the running daemon, closing its connection and forwards.
+func StopDaemon() error {
+	_, err := controlDaemon(daemonStopRequest)
+	return err
+}
+
+func controlDaemon(request string) (*DaemonStatus, error) {
+	conn, err := net.DialTimeout("unix", DaemonSocketPath(), daemonControlTimeout)
+	if err != nil {
+		return nil, ErrDaemonNotRunning
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(daemonControlTimeout))
+
+	if _, err := fmt.Fprintln(conn, request); err != nil {
+		return nil, fmt.Errorf("send request to daemon: %w", err)
+	}
+	var status DaemonStatus
+	if err := json.NewDecoder(conn).Decode(&status); err != nil {
+		return nil, fmt.Errorf("read daemon response: %w", err)
+	}
+	return &status, nil
+}
+
+// parseForward splits a LocalForward or RemoteForward value, eg. 8080 localhost:3000.
+func parseForward(forward string) (int, string, error) {
+	fields := strings.Fields(forward)
+	if len(fields) != 2 {
+		return 0, "", fmt.Errorf("invalid forward: %s", forward)
+	}
+	port, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid port: %s", fields[0])
+	}
+	return port, fields[1], nil
+}
@@ -0,0 +1,120 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// DefaultDebugserverPort is the port debugserver listens on, on the VM and locally
+const DefaultDebugserverPort = 1234
+
+// debugserverPathScript prints the path of the debugserver of the selected Xcode
+const debugserverPathScript = `p="$(xcode-select -p)/../SharedFrameworks/LLDB.framework/Resources/debugserver"; ` +
+	`[ -x "$p" ] || p="$(xcrun -f debugserver 2>/dev/null)"; [ -x "$p" ] && echo "$p"`
+
+// DebugSession is a remote debugging server attached to a process on the VM, reachable through a local port.
+type DebugSession struct {
+	PID       int
+	LocalPort int
+	// Done is closed when the debugging server exits, eg. when the debugger detaches
+	Done <-chan error
+	stop func()
+}
+
+// Stop ends the debugging server and the forward.
+func (s *DebugSession) Stop() {
+	s.stop()
+}
+
+// StartDebugserver attaches debugserver to the process on the macOS VM of the last session and forwards
+// localhost:port to it. The process is a PID or a name, the newest matching process is used for a name,
+// eg. the simulator app of a crashing test host.
+func StartDebugserver(process string, port int, password *string) (*DebugSession, error) {
+	client, err := connectLastSession(password)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := startDebugserver(client, process, port)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+func startDebugserver(client *cryptoSSH.Client, process string, port int) (*DebugSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	pid, err := findProcess(ctx, client, process)
+	if err != nil {
+		return nil, err
+	}
+
+	debugserverPath, err := runCommandOutput(ctx, client, debugserverPathScript)
+	if err != nil || strings.TrimSpace(debugserverPath) == "" {
+		return nil, fmt.Errorf("debugserver not found on the VM, is Xcode installed?")
+	}
+
+	command := fmt.Sprintf("%s 127.0.0.1:%d --attach=%d", shellQuote(strings.TrimSpace(debugserverPath)), port, pid)
+	return startDebugCommand(client, command, pid, port, nil)
+}
+
+// startDebugCommand runs the debugging server on the VM and forwards the local port to it.
+// The output of the command is written to output, it is discarded if output is nil.
+func startDebugCommand(client *cryptoSSH.Client, command string, pid, port int, output io.Writer) (*DebugSession, error) {
+	remote, err := createSSHSession(client)
+	if err != nil {
+		return nil, err
+	}
+	// The server is hung up with the terminal when the session is closed, so it doesn't outlive the helper
+	if err := remote.RequestPty("xterm", 80, 40, cryptoSSH.TerminalModes{}); err != nil {
+		remote.Close()
+		return nil, fmt.Errorf("request pty: %w", err)
+	}
+	remote.Stdout = output
+	if err := remote.Start(posixCommand(client, command)); err != nil {
+		remote.Close()
+		return nil, fmt.Errorf("start %q: %w", command, err)
+	}
+
+	forward, err := openTunnel(client, port, fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		remote.Close()
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- remote.Wait() }()
+
+	return &DebugSession{
+		PID:       pid,
+		LocalPort: port,
+		Done:      done,
+		stop: func() {
+			forward.Close()
+			remote.Close()
+			client.Close()
+		},
+	}, nil
+}
+
+// findProcess returns the PID of the process, a number is taken as a PID as it is.
+func findProcess(ctx context.Context, client *cryptoSSH.Client, process string) (int, error) {
+	if pid, err := strconv.Atoi(process); err == nil {
+		return pid, nil
+	}
+
+	output, err := runCommandOutput(ctx, client, "pgrep -n -f "+shellQuote(process))
+	pid, convErr := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil || convErr != nil {
+		return 0, fmt.Errorf("no process matching %q on the VM", process)
+	}
+	return pid, nil
+}
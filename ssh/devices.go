@@ -0,0 +1,305 @@
+package ssh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	// simulatorBootTimeout covers the first boot of a runtime, which is much slower than the later ones
+	simulatorBootTimeout = 5 * time.Minute
+	emulatorBootTimeout  = 5 * time.Minute
+
+	simRuntimePrefix = "com.apple.CoreSimulator.SimRuntime."
+	// firstEmulatorPort is the console port of the first emulator, the next ones take every second port
+	firstEmulatorPort = 5554
+	lastEmulatorPort  = 5682
+)
+
+var androidHomeEnvVars = []string{"ANDROID_HOME", "ANDROID_SDK_ROOT"}
+
+// Simulator is an iOS, watchOS, tvOS or visionOS simulator on the VM.
+type Simulator struct {
+	UDID    string `json:"udid"`
+	Name    string `json:"name"`
+	Runtime string `json:"runtime"`
+	// State is the state simctl reports, eg. Booted or Shutdown
+	State string `json:"state"`
+}
+
+// Emulator is an Android virtual device on the VM.
+type Emulator struct {
+	Name string `json:"name"`
+	// Serial is the adb serial of the running emulator, eg. emulator-5554, empty if it's not running
+	Serial string `json:"serial,omitempty"`
+}
+
+// ListSimulators returns the available simulators of the VM of the last session.
+func ListSimulators(password *string) ([]Simulator, error) {
+	var simulators []Simulator
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		var err error
+		simulators, err = listSimulators(client)
+		return err
+	})
+	return simulators, err
+}
+
+func listSimulators(client *cryptoSSH.Client) ([]Simulator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	output, err := runCommandOutput(ctx, client, "xcrun simctl list devices available -j")
+	if err != nil {
+		return nil, fmt.Errorf("list simulators, is Xcode installed on the VM?: %w", err)
+	}
+
+	var list struct {
+		Devices map[string][]Simulator `json:"devices"`
+	}
+	if err := json.Unmarshal([]byte(output), &list); err != nil {
+		return nil, fmt.Errorf("decode simulator list: %w", err)
+	}
+
+	var simulators []Simulator
+	for runtime, devices := range list.Devices {
+		for _, device := range devices {
+			device.Runtime = runtimeName(runtime)
+			simulators = append(simulators, device)
+		}
+	}
+	slices.SortFunc(simulators, func(a, b Simulator) int {
+		if c := strings.Compare(a.Runtime, b.Runtime); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return simulators, nil
+}
+
+// runtimeName turns a runtime identifier into its display name, eg. com.apple.CoreSimulator.SimRuntime.iOS-17-5
+// into iOS 17.5.
+func runtimeName(identifier string) string {
+	name := strings.TrimPrefix(identifier, simRuntimePrefix)
+	platform, version, found := strings.Cut(name, "-")
+	if !found {
+		return name
+	}
+	return platform + " " + strings.ReplaceAll(version, "-", ".")
+}
+
+// findSimulator returns the simulator with the UDID or name. A name can be qualified with the runtime, eg.
+// "iPhone 15 (iOS 17.5)", when the simulator exists for more runtimes.
+func findSimulator(simulators []Simulator, device string) (Simulator, error) {
+	var matches []Simulator
+	for _, simulator := range simulators {
+		if strings.EqualFold(simulator.UDID, device) {
+			return simulator, nil
+		}
+		if strings.EqualFold(simulator.Name, device) || strings.EqualFold(fmt.Sprintf("%s (%s)", simulator.Name, simulator.Runtime), device) {
+			matches = append(matches, simulator)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return Simulator{}, fmt.Errorf("no simulator %q on the VM", device)
+	case 1:
+		return matches[0], nil
+	}
+	var names []string
+	for _, match := range matches {
+		names = append(names, fmt.Sprintf("%q", fmt.Sprintf("%s (%s)", match.Name, match.Runtime)))
+	}
+	return Simulator{}, fmt.Errorf("more simulators are called %q, give the UDID or one of %s", device, strings.Join(names, ", "))
+}
+
+// BootSimulator boots the simulator on the VM and waits until it finished booting. Booted simulators are left
+// as they are.
+func BootSimulator(device string, password *string) (Simulator, error) {
+	var simulator Simulator
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		simulators, err := listSimulators(client)
+		if err != nil {
+			return err
+		}
+		if simulator, err = findSimulator(simulators, device); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), simulatorBootTimeout)
+		defer cancel()
+		// bootstatus -b boots the simulator if needed and returns once it's ready
+		if _, err := runCommandOutput(ctx, client, "xcrun simctl bootstatus "+shellQuote(simulator.UDID)+" -b"); err != nil {
+			return fmt.Errorf("boot %s: %w", simulator.Name, err)
+		}
+		simulator.State = "Booted"
+		return nil
+	})
+	return simulator, err
+}
+
+// ShutdownSimulators shuts the simulator down on the VM, every booted one without a device.
+func ShutdownSimulators(device string, password *string) error {
+	return withClient(password, func(client *cryptoSSH.Client) error {
+		target := "all"
+		if device != "" {
+			simulators, err := listSimulators(client)
+			if err != nil {
+				return err
+			}
+			simulator, err := findSimulator(simulators, device)
+			if err != nil {
+				return err
+			}
+			if simulator.State == "Shutdown" {
+				return nil
+			}
+			target = simulator.UDID
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+		defer cancel()
+		if _, err := runCommandOutput(ctx, client, "xcrun simctl shutdown "+shellQuote(target)); err != nil {
+			return fmt.Errorf("shut down simulator: %w", err)
+		}
+		return nil
+	})
+}
+
+// androidTools returns the paths of the emulator and adb of the VM's Android SDK.
+func androidTools(client *cryptoSSH.Client) (emulator, adb string, err error) {
+	// The SDK's location is only set in login shells
+	envMap, err := runWithPty(client, &androidHomeEnvVars, "echo $", true)
+	if err != nil {
+		return "", "", fmt.Errorf("detect Android SDK: %w", err)
+	}
+	for _, envVar := range androidHomeEnvVars {
+		if sdk := strings.TrimSpace(envMap[envVar]); sdk != "" {
+			return sdk + "/emulator/emulator", sdk + "/platform-tools/adb", nil
+		}
+	}
+	return "", "", fmt.Errorf("the Android SDK is not set up on the VM, neither of %s is set", strings.Join(androidHomeEnvVars, ", "))
+}
+
+// ListEmulators returns the Android virtual devices of the VM of the last session.
+func ListEmulators(password *string) ([]Emulator, error) {
+	var emulators []Emulator
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		emulatorPath, adbPath, err := androidTools(client)
+		if err != nil {
+			return err
+		}
+		emulators, err = listEmulators(client, emulatorPath, adbPath)
+		return err
+	})
+	return emulators, err
+}
+
+func listEmulators(client *cryptoSSH.Client, emulatorPath, adbPath string) ([]Emulator, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	output, err := runCommandOutput(ctx, client, shellQuote(emulatorPath)+" -list-avds")
+	if err != nil {
+		return nil, fmt.Errorf("list Android virtual devices: %w", err)
+	}
+	var emulators []Emulator
+	for _, name := range strings.Split(output, "\n") {
+		// The emulator prints its own warnings among the names
+		if name = strings.TrimSpace(name); name != "" && !strings.Contains(name, " ") {
+			emulators = append(emulators, Emulator{Name: name})
+		}
+	}
+
+	for serial, name := range runningEmulators(ctx, client, adbPath) {
+		for i := range emulators {
+			if emulators[i].Name == name {
+				emulators[i].Serial = serial
+			}
+		}
+	}
+	return emulators, nil
+}
+
+// runningEmulators maps the serials of the running emulators to their virtual device.
+func runningEmulators(ctx context.Context, client *cryptoSSH.Client, adbPath string) map[string]string {
+	running := map[string]string{}
+	output, err := runCommandOutput(ctx, client, shellQuote(adbPath)+" devices")
+	if err != nil {
+		return running
+	}
+	for _, line := range strings.Split(output, "\n") {
+		serial, _, _ := strings.Cut(strings.TrimSpace(line), "\t")
+		if !strings.HasPrefix(serial, "emulator-") {
+			continue
+		}
+		// The first line of the console's answer is the name, the second OK
+		name, _ := runCommandOutput(ctx, client, fmt.Sprintf("%s -s %s emu avd name", shellQuote(adbPath), serial))
+		name, _, _ = strings.Cut(strings.TrimSpace(name), "\n")
+		running[serial] = strings.TrimSpace(name)
+	}
+	return running
+}
+
+// StartEmulator starts the virtual device on the VM without a window and waits until Android finished booting.
+// A running emulator of the device is returned as it is.
+func StartEmulator(name string, password *string) (Emulator, error) {
+	var emulator Emulator
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		emulatorPath, adbPath, err := androidTools(client)
+		if err != nil {
+			return err
+		}
+		emulators, err := listEmulators(client, emulatorPath, adbPath)
+		if err != nil {
+			return err
+		}
+		index := slices.IndexFunc(emulators, func(e Emulator) bool { return e.Name == name })
+		if index < 0 {
+			return fmt.Errorf("no Android virtual device %q on the VM", name)
+		}
+		if emulator = emulators[index]; emulator.Serial != "" {
+			return nil
+		}
+
+		port, err := freeEmulatorPort(emulators)
+		if err != nil {
+			return err
+		}
+		emulator.Serial = fmt.Sprintf("emulator-%d", port)
+
+		ctx, cancel := context.WithTimeout(context.Background(), emulatorBootTimeout)
+		defer cancel()
+		// The emulator outlives the session, its output goes to a log next to the other temp files
+		start := fmt.Sprintf("nohup %s -avd %s -port %d -no-window -no-audio -no-boot-anim </dev/null >/tmp/bitrise-emulator-%d.log 2>&1 &",
+			shellQuote(emulatorPath), shellQuote(name), port, port)
+		if err := runCommand(ctx, client, start); err != nil {
+			return fmt.Errorf("start emulator: %w", err)
+		}
+		wait := fmt.Sprintf(`%s -s %s wait-for-device shell 'while [ "$(getprop sys.boot_completed | tr -d "\r")" != 1 ]; do sleep 2; done'`,
+			shellQuote(adbPath), emulator.Serial)
+		if err := runCommand(ctx, client, wait); err != nil {
+			return fmt.Errorf("wait for %s to boot, see /tmp/bitrise-emulator-%d.log on the VM: %w", name, port, err)
+		}
+		return nil
+	})
+	return emulator, err
+}
+
+func freeEmulatorPort(emulators []Emulator) (int, error) {
+	for port := firstEmulatorPort; port <= lastEmulatorPort; port += 2 {
+		serial := "emulator-" + strconv.Itoa(port)
+		if !slices.ContainsFunc(emulators, func(e Emulator) bool { return e.Serial == serial }) {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("every emulator port is taken on the VM")
+}
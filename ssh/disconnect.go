@@ -0,0 +1,152 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+	"github.com/kevinburke/ssh_config"
+)
+
+// Disconnect tears down the state left behind by the last session: it revokes the
+// session key on the remote (while the VM is still alive), deletes the key locally,
+// removes the generated host entry and clears the host from known_hosts.
+func Disconnect() error {
+	configEntry, err := readSSHClientConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Info(i18n.T("No session to disconnect from"))
+			return nil
+		}
+		return fmt.Errorf("read SSH config entry: %w", err)
+	}
+
+	// The daemon would reconnect with the key about to be revoked
+	if err := StopDaemon(); err == nil {
+		progress.Succeed(StageDisconnect, i18n.T("Daemon stopped"))
+	}
+
+	if configEntry.IdentityFile != "" && isSharedKey(configEntry.IdentityFile) {
+		// Revoking the key would lock out the teammate who shared the session
+		if err := removeLocalKey(configEntry.IdentityFile); err != nil {
+			progress.Fail(StageDisconnect, "remove local SSH key", err)
+		}
+	} else if configEntry.IdentityFile != "" {
+		progress.Start(StageDisconnect, i18n.T("Removing SSH key from remote..."))
+		client, err := connectSSHClient(configEntry)
+		if err != nil {
+			progress.Fail(StageDisconnect, "connect to remote host", err)
+		} else {
+			if err := (authorizedKeyResource{keyPath: configEntry.IdentityFile}).remove(client); err != nil {
+				progress.Fail(StageDisconnect, "remove SSH key from remote", err)
+			} else {
+				progress.Succeed(StageDisconnect, i18n.T("SSH key removed from remote"))
+			}
+			if err := removeShellConfigBlocks(client); err != nil {
+				progress.Fail(StageDisconnect, "remove message of the day from shell configs", err)
+			} else {
+				progress.Succeed(StageDisconnect, i18n.T("Shell configs restored"))
+			}
+			client.Close()
+		}
+
+		if err := removeLocalKey(configEntry.IdentityFile); err != nil {
+			progress.Fail(StageDisconnect, "remove local SSH key", err)
+		}
+	}
+
+	progress.Start(StageDisconnect, i18n.T("Removing host key..."))
+	if err := removeHostKey(configEntry); err != nil {
+		progress.Fail(StageDisconnect, "remove host key", err)
+	} else {
+		progress.Succeed(StageDisconnect, i18n.T("No host keys remaining"))
+	}
+
+	progress.Start(StageDisconnect, i18n.T("Removing SSH config entry..."))
+	err = withStateLock(func() error {
+		if err := os.Remove(bitriseConfigPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		progress.Fail(StageDisconnect, "remove SSH config entry", err)
+		return fmt.Errorf("remove SSH config entry: %w", err)
+	}
+	progress.Succeed(StageDisconnect, i18n.T("SSH config entry removed"))
+
+	if IsWSL() {
+		if err := removeWindowsMirror(); err != nil {
+			progress.Fail(StageDisconnect, "remove Windows SSH config entry", err)
+		}
+	}
+
+	return nil
+}
+
+// readSSHClientConfig reads back the host entry written by writeSSHClientConfig.
+func readSSHClientConfig() (*configEntry, error) {
+	file, err := os.Open(bitriseConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, err := ssh_config.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+
+	get := func(key string) string {
+		value, _ := config.Get(BitriseHostPattern, key)
+		return value
+	}
+
+	var tuning Tuning
+	tuning.Compression = get("Compression") == "yes"
+	if ciphers := get("Ciphers"); ciphers != "" {
+		tuning.Ciphers = strings.Split(ciphers, ",")
+	}
+	if macs := get("MACs"); macs != "" {
+		tuning.MACs = strings.Split(macs, ",")
+	}
+
+	entry := &configEntry{
+		Host:            BitriseHostPattern,
+		HostName:        strings.ReplaceAll(get("HostName"), "%%", "%"),
+		User:            get("User"),
+		Port:            get("Port"),
+		CertificateFile: expandHomeDir(get("CertificateFile")),
+		Tuning:          tuning,
+		WebSocketURL:    proxyCommandEndpoint(get("ProxyCommand")),
+		BindAddress:     get("BindAddress"),
+	}
+	// The key of the certificate is the user's own, only the session key is managed
+	identityFiles, _ := config.GetAll(BitriseHostPattern, "IdentityFile")
+	for _, identityFile := range identityFiles {
+		identityFile = expandHomeDir(identityFile)
+		if entry.CertificateFile == "" || identityFile != certificateKeyPath(entry.CertificateFile) {
+			entry.IdentityFile = identityFile
+			break
+		}
+	}
+	if entry.HostName == "" {
+		return nil, fmt.Errorf("no %s host found", BitriseHostPattern)
+	}
+	entry.LocalForwards, _ = config.GetAll(BitriseHostPattern, "LocalForward")
+	entry.RemoteForwards, _ = config.GetAll(BitriseHostPattern, "RemoteForward")
+
+	return entry, nil
+}
+
+func expandHomeDir(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(paths.HomeDir(), path[2:])
+	}
+	return path
+}
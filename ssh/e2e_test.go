@@ -0,0 +1,178 @@
+//go:build e2e
+
+package ssh
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The end-to-end tests run the whole setup and the file transfers against the in-process server emulating the
+// stacks, with the local programs faked. Run them with `make e2e`.
+
+func TestE2ESetupMacOS(t *testing.T) {
+	useTempDirs(t)
+	useFakeRunner(t, &fakeRunner{})
+	server := newTestServer(t, macOSStack())
+	server.use(t)
+
+	password := testPassword
+	var opened string
+	err := SetupSSH("10.0.0.1", "22", "vagrant", &password, Tuning{}, true, func(useIdentityKey bool, folderPath string, info LaunchInfo) error {
+		if !useIdentityKey {
+			t.Error("the IDE is opened with the password, want the session key")
+		}
+		opened = folderPath
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened != server.path("git") {
+		t.Errorf("opened %q, want the source dir", opened)
+	}
+
+	// The editor connects with the written entry and the session key alone
+	entry, err := readSSHClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.IdentityFile != sessionKeyPath("build-slug") {
+		t.Errorf("IdentityFile = %q, want the session key of the build", entry.IdentityFile)
+	}
+	entry.sessionKeyOnly = true
+	client, err := connectSSHClient(entry)
+	if err != nil {
+		t.Fatalf("connect with the written entry: %s", err)
+	}
+	client.Close()
+
+	for _, shellConfig := range motdShellConfigs {
+		content, err := os.ReadFile(server.path(strings.TrimPrefix(shellConfig, "~/")))
+		if err != nil {
+			t.Fatalf("%s not written: %s", shellConfig, err)
+		}
+		if !strings.Contains(string(content), motdCommand) {
+			t.Errorf("%s = %q, want the message of the day", shellConfig, content)
+		}
+	}
+}
+
+func TestE2ESetupLinux(t *testing.T) {
+	useTempDirs(t)
+	useFakeRunner(t, &fakeRunner{})
+	server := newTestServer(t, linuxStack())
+	server.use(t)
+
+	password := testPassword
+	err := SetupSSH("10.0.0.1", "22", "vagrant", &password, Tuning{}, true, func(useIdentityKey bool, folderPath string, info LaunchInfo) error {
+		if useIdentityKey {
+			t.Error("the IDE is opened with the session key, the Linux stacks only take the password")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := readSSHClientConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.IdentityFile != "" {
+		t.Errorf("IdentityFile = %q, want none", entry.IdentityFile)
+	}
+	if _, err := os.Stat(server.path(authorizedKeysPath)); !os.IsNotExist(err) {
+		t.Errorf("authorized_keys is written on a Linux stack: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(server.path("src"), remoteReadmeFileName)); err != nil {
+		t.Errorf("README not copied: %s", err)
+	}
+}
+
+func TestE2ERunWithPty(t *testing.T) {
+	useTempDirs(t)
+	server := newTestServer(t, macOSStack())
+	server.use(t)
+
+	client, err := connectSSHClient(server.entry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	commands := []string{osTypeEnvVar, buildSlugEnvVar, "UNSET_VARIABLE"}
+	results, err := runWithPty(client, &commands, "echo $", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[osTypeEnvVar] != "darwin23" || results[buildSlugEnvVar] != "build-slug" {
+		t.Errorf("runWithPty() = %v, want the stack's environment", results)
+	}
+	if results["UNSET_VARIABLE"] != "" {
+		t.Errorf("unset variable = %q, want empty", results["UNSET_VARIABLE"])
+	}
+
+	// The results of the commands finished before the stuck one are kept
+	stuck := []string{"echo first", "sleep 5", "echo never"}
+	results, err = runWithPtyContext(context.Background(), client, &stuck, "", true, 500*time.Millisecond)
+	if !errors.Is(err, ErrRemoteTimeout) {
+		t.Fatalf("runWithPtyContext() error = %v, want a timeout", err)
+	}
+	if results["echo first"] != "first" {
+		t.Errorf("results = %v, want the first command's", results)
+	}
+}
+
+func TestE2EPushPull(t *testing.T) {
+	useTempDirs(t)
+	useFakeRunner(t, &fakeRunner{})
+	server := newTestServer(t, macOSStack())
+	server.use(t)
+
+	password := testPassword
+	err := SetupSSH("10.0.0.1", "22", "vagrant", &password, Tuning{}, true, func(bool, string, LaunchInfo) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := t.TempDir()
+	files := map[string]string{
+		"a.txt":        "a",
+		"nested/b.txt": strings.Repeat("b", 1<<20),
+	}
+	for name, content := range files {
+		path := filepath.Join(local, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	remote := server.path("pushed")
+	if err := Push(local, remote, &password, TransferOptions{}); err != nil {
+		t.Fatalf("push: %s", err)
+	}
+	pulled := t.TempDir()
+	if err := Pull(remote, pulled, &password, TransferOptions{}); err != nil {
+		t.Fatalf("pull: %s", err)
+	}
+
+	for name, want := range files {
+		for _, root := range []string{remote, pulled} {
+			got, err := os.ReadFile(filepath.Join(root, name))
+			if err != nil {
+				t.Errorf("%s: %s", name, err)
+			} else if string(got) != want {
+				t.Errorf("%s in %s has %d bytes, want %d", name, root, len(got), len(want))
+			}
+		}
+	}
+}
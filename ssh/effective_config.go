@@ -0,0 +1,210 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	"github.com/kevinburke/ssh_config"
+)
+
+// sshOptions are the options OpenSSH applies to a host, keyed by the lowercase directive. Directives that can be
+// given more than once, eg. IdentityFile, keep every value in order.
+type sshOptions map[string][]string
+
+func (o sshOptions) get(key string) string {
+	if values := o[strings.ToLower(key)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// inspectedOptions are read from the config files when ssh -G is not available.
+var inspectedOptions = []string{"HostName", "User", "Port", "IdentityFile", "ProxyCommand", "ProxyJump", "ControlMaster", "RemoteCommand"}
+
+// effectiveOptions returns the options the editors' ssh applies to the host, with every Host and Match block of the
+// user's config evaluated. ssh -G is asked, as only OpenSSH knows its own precedence rules; without it the user's
+// config is read.
+func effectiveOptions(host string) (sshOptions, error) {
+	configPath := sshConfigPath()
+	if configFileOverridden() {
+		// VS Code reads the Bitrise config alone
+		configPath = bitriseConfigPath()
+	}
+
+	if sshPath, err := FindOpenSSH(); err == nil {
+		args := []string{"-G", host}
+		if home, err := os.UserHomeDir(); err != nil || home != paths.HomeDir() || configPath != sshConfigPath() {
+			// ssh reads the config of the user's real home, not of the overridden one
+			args = append([]string{"-F", configPath}, args...)
+		}
+		out, err := localCommands.Output(sshPath, args...)
+		if err != nil {
+			return nil, fmt.Errorf("ssh -G %s: %w", host, err)
+		}
+		return parseSSHOptions(string(out)), nil
+	}
+
+	file, err := os.Open(configPath)
+	if os.IsNotExist(err) {
+		return sshOptions{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, err := ssh_config.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+
+	options := sshOptions{}
+	for _, key := range inspectedOptions {
+		values, err := config.GetAll(host, key)
+		if err != nil {
+			return nil, fmt.Errorf("get %s: %w", key, err)
+		}
+		if len(values) > 0 {
+			options[strings.ToLower(key)] = values
+		}
+	}
+	return options, nil
+}
+
+// parseSSHOptions parses the "key value" lines printed by ssh -G.
+func parseSSHOptions(output string) sshOptions {
+	options := sshOptions{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), " ")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(key)
+		options[key] = append(options[key], strings.TrimSpace(value))
+	}
+	return options
+}
+
+// optionConflict is a directive of another Host block that applies to the Bitrise host too.
+type optionConflict struct {
+	directive string
+	value     string
+	problem   string
+	override  string
+}
+
+// conflictingOptions returns the options set by other blocks, eg. Host *, that break the connection to the VM.
+// The generated entry comes first, so its own options win; these are the ones it doesn't set.
+func conflictingOptions(options sshOptions, entry *configEntry, useIdentityKey bool) []optionConflict {
+	var conflicts []optionConflict
+	set := func(key string) (string, bool) {
+		value := options.get(key)
+		return value, value != "" && !strings.EqualFold(value, "none")
+	}
+
+	if entry.WebSocketURL == "" {
+		if value, ok := set("ProxyCommand"); ok {
+			conflicts = append(conflicts, optionConflict{"ProxyCommand", value, "the VM is reached through a proxy meant for other hosts", "ProxyCommand none"})
+		}
+		if value, ok := set("ProxyJump"); ok {
+			conflicts = append(conflicts, optionConflict{"ProxyJump", value, "the VM is reached through a jump host meant for other hosts", "ProxyJump none"})
+		}
+	}
+
+	if value, ok := set("ControlMaster"); ok && !strings.EqualFold(value, "no") && !strings.EqualFold(value, "false") {
+		conflicts = append(conflicts, optionConflict{"ControlMaster", value, "a shared connection outlives the VM and a reconnect reuses its dead socket", "ControlMaster no"})
+	}
+
+	if value, ok := set("RemoteCommand"); ok {
+		conflicts = append(conflicts, optionConflict{"RemoteCommand", value, "Remote - SSH can't start its server in a session that runs another command", "RemoteCommand none"})
+	}
+
+	if useIdentityKey {
+		for _, identityFile := range options[strings.ToLower("IdentityFile")] {
+			if samePath(identityFile, entry.IdentityFile) {
+				continue
+			}
+			if entry.CertificateFile != "" && samePath(identityFile, certificateKeyPath(entry.CertificateFile)) {
+				continue
+			}
+			conflicts = append(conflicts, optionConflict{"IdentityFile", identityFile, "the key is offered too, the VM closes the connection after too many rejected keys", ""})
+		}
+	}
+
+	return conflicts
+}
+
+// samePath reports whether the path from an SSH config is the local path.
+func samePath(configPath, path string) bool {
+	configPath = filepath.Clean(filepath.FromSlash(expandHomeDir(configPath)))
+	path = filepath.Clean(filepath.FromSlash(path))
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(configPath, path)
+	}
+	return configPath == path
+}
+
+// warnConflictingOptions warns about the options other blocks of the user's SSH config apply to the Bitrise host,
+// with the overrides that keep them away from it.
+func warnConflictingOptions(entry *configEntry, useIdentityKey bool) error {
+	options, err := effectiveOptions(entry.Host)
+	if err != nil {
+		return fmt.Errorf("evaluate the SSH config: %w", err)
+	}
+
+	conflicts := conflictingOptions(options, entry, useIdentityKey)
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	var lines, overrides []string
+	for _, conflict := range conflicts {
+		lines = append(lines, fmt.Sprintf("- %s %s: %s", conflict.directive, conflict.value, conflict.problem))
+		if conflict.override != "" {
+			overrides = append(overrides, "  "+conflict.override)
+		}
+	}
+
+	suggestion := fmt.Sprintf("Exclude the host from the block that sets them, eg. Host * !%s", entry.Host)
+	if len(overrides) > 0 {
+		suggestion += fmt.Sprintf(", or override them in a block before it in %s:\n\nHost %s\n%s", sshConfigPath(), entry.Host, strings.Join(overrides, "\n"))
+	}
+	logger.PrintFormattedOutput(
+		fmt.Sprintf("Other blocks of your SSH config apply to %s", entry.Host),
+		strings.Join(lines, "\n")+"\n\n"+suggestion)
+	return nil
+}
+
+// verifyEffectiveConfig checks that ssh resolves the host to the generated entry, eg. the Include line wasn't moved
+// below a block that sets the same options, before the editors are handed the host.
+func verifyEffectiveConfig(entry *configEntry, useIdentityKey bool) error {
+	options, err := effectiveOptions(entry.Host)
+	if err != nil {
+		return fmt.Errorf("evaluate the SSH config: %w", err)
+	}
+
+	var mismatches []string
+	check := func(directive, want string, matches func(got, want string) bool) {
+		if got := options.get(directive); !matches(got, want) {
+			mismatches = append(mismatches, fmt.Sprintf("- %s is %q instead of %q", directive, got, want))
+		}
+	}
+	// ssh lowercases the host name
+	check("HostName", entry.HostName, strings.EqualFold)
+	check("User", entry.User, func(got, want string) bool { return got == want })
+	check("Port", entry.Port, func(got, want string) bool { return got == want })
+	if useIdentityKey {
+		check("IdentityFile", entry.IdentityFile, samePath)
+	}
+
+	if len(mismatches) > 0 {
+		return ConfigErr{err: fmt.Errorf("ssh doesn't resolve %s to the generated entry, the Include %s line has to come before the blocks that set these in %s:\n%s",
+			entry.Host, bitriseConfigPath(), sshConfigPath(), strings.Join(mismatches, "\n"))}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEffectiveOptions(t *testing.T) {
+	useTempDirs(t)
+
+	t.Run("ssh -G", func(t *testing.T) {
+		runner := &fakeRunner{
+			installed: map[string]bool{"ssh": true},
+			outputs: map[string]fakeOutput{
+				"ssh": {out: "hostname 10.0.0.1\nuser vagrant\nidentityfile ~/.ssh/id_a\nidentityfile ~/.ssh/id_b\n"},
+			},
+		}
+		useFakeRunner(t, runner)
+
+		options, err := effectiveOptions(BitriseHostPattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := options.get("HostName"); got != "10.0.0.1" {
+			t.Errorf("HostName = %q, want 10.0.0.1", got)
+		}
+		if got := options["identityfile"]; len(got) != 2 {
+			t.Errorf("IdentityFile = %v, want both values in order", got)
+		}
+		if len(runner.calls) != 1 || runner.calls[0][len(runner.calls[0])-1] != BitriseHostPattern {
+			t.Errorf("ran %v, want ssh -G %s", runner.calls, BitriseHostPattern)
+		}
+	})
+
+	t.Run("without ssh", func(t *testing.T) {
+		useFakeRunner(t, &fakeRunner{})
+
+		config := "Host *\n  ProxyJump jump.example.com\n\nHost other\n  User someone\n"
+		if err := os.MkdirAll(filepath.Dir(sshConfigPath()), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(sshConfigPath(), []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		options, err := effectiveOptions(BitriseHostPattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := options.get("ProxyJump"); got != "jump.example.com" {
+			t.Errorf("ProxyJump = %q, want the one of Host *", got)
+		}
+		if got := options.get("User"); got != "" {
+			t.Errorf("User = %q, want none, it's another host's", got)
+		}
+	})
+}
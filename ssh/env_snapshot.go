@@ -0,0 +1,247 @@
+package ssh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	envSnapshotScriptPath = "/tmp/bitrise-remote-access-env.sh"
+	// envCaptureTimeout is how long the capture script may run, listing the SDKs and simulator runtimes of a VM
+	// can take longer than a single command is allowed to
+	envCaptureTimeout = 3 * time.Minute
+	// envCleanupTimeout is how long removing the script may take, it's only a leftover in /tmp if it fails
+	envCleanupTimeout = 10 * time.Second
+
+	// envSnapshotScript prints the environment, the versions of the usual build tools, the architecture and the
+	// installed SDKs in sections, the tools are looked up in the login shell so their paths match the build's
+	envSnapshotScript = `v() { command -v "$1" >/dev/null 2>&1 || return 0; printf '%s\t' "$1"; "$@" 2>&1 | grep -v '^$' | head -n 2 | tr '\n' ' '; echo; }
+echo '### env'
+env
+echo '### tools'
+v xcodebuild -version
+v swift --version
+v java -version
+v node --version
+v npm --version
+v yarn --version
+v ruby --version
+v bundle --version
+v pod --version
+v python3 --version
+v go version
+v flutter --version
+echo '### arch'
+` + archScript + `echo '### sdks'
+command -v xcodebuild >/dev/null 2>&1 && xcodebuild -showsdks 2>/dev/null | sed -n 's/.*-sdk /sdk /p'
+command -v xcrun >/dev/null 2>&1 && xcrun simctl list runtimes 2>/dev/null | sed -n 's/ (.*//p' | sed 's/^/runtime /'
+if [ -n "$ANDROID_HOME" ]; then for d in "$ANDROID_HOME"/platforms/* "$ANDROID_HOME"/build-tools/* "$ANDROID_HOME"/ndk/*; do [ -e "$d" ] && echo "android ${d#"$ANDROID_HOME"/}"; done; fi
+true
+`
+)
+
+// volatileEnvVars change with every connection, so they are left out of the snapshots
+var volatileEnvVars = []string{"_", "PWD", "OLDPWD", "SHLVL", "SSH_CLIENT", "SSH_CONNECTION", "SSH_TTY", "SSH_AUTH_SOCK", "TERM_SESSION_ID"}
+
+// secretEnvVarPattern matches the variables only a digest of is kept, so snapshots can be shared
+var secretEnvVarPattern = regexp.MustCompile(`(?i)TOKEN|SECRET|PASSWORD|PASSPHRASE|CREDENTIAL|API_?KEY|PRIVATE|AUTH`)
+
+// envVarLinePattern matches the first line of a variable in the output of env, the rest are continuation lines
+var envVarLinePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// EnvSnapshot is the environment of a build's VM, captured to compare it with another build.
+type EnvSnapshot struct {
+	BuildSlug  string            `json:"build_slug,omitempty"`
+	CapturedAt time.Time         `json:"captured_at"`
+	Env        map[string]string `json:"env"`
+	Tools      map[string]string `json:"tools"`
+	SDKs       []string          `json:"sdks"`
+	Arch       *Arch             `json:"arch,omitempty"`
+}
+
+// EnvChange is a difference between two snapshots, Old or New is empty if the item was added or removed.
+type EnvChange struct {
+	// Section is env, tool, sdk or arch
+	Section string
+	Name    string
+	Old     string
+	New     string
+}
+
+// CaptureEnv captures the environment of the VM of the last session.
+func CaptureEnv(password *string) (*EnvSnapshot, error) {
+	var snapshot *EnvSnapshot
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		var err error
+		snapshot, err = captureEnv(client)
+		return err
+	})
+	return snapshot, err
+}
+
+func captureEnv(client *cryptoSSH.Client) (*EnvSnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), envCaptureTimeout)
+	defer cancel()
+
+	// The script is uploaded so the command typed into the login shell stays short
+	upload := fmt.Sprintf("cat > %s <<'BITRISE_ENV_EOF'\n%sBITRISE_ENV_EOF", envSnapshotScriptPath, envSnapshotScript)
+	if err := runCommand(ctx, client, upload); err != nil {
+		return nil, fmt.Errorf("upload capture script: %w", err)
+	}
+	// The script is removed even if the capture timed out
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), envCleanupTimeout)
+		defer cancel()
+		_ = runCommand(cleanupCtx, client, "rm -f "+envSnapshotScriptPath)
+	}()
+
+	// The build's environment is only set in login shells, the output is encoded to fit in a single result
+	captureCmd := fmt.Sprintf("sh %s 2>/dev/null | base64 | tr -d '\\n'", envSnapshotScriptPath)
+	results, err := runWithPtyContext(ctx, client, &[]string{captureCmd}, "", true, envCaptureTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("capture environment: %w", err)
+	}
+	output, err := base64.StdEncoding.DecodeString(strings.TrimSpace(results[captureCmd]))
+	if err != nil {
+		return nil, fmt.Errorf("decode environment: %w", err)
+	}
+
+	snapshot := parseEnvSnapshot(string(output))
+	snapshot.BuildSlug = snapshot.Env[buildSlugEnvVar]
+	snapshot.CapturedAt = time.Now()
+	return snapshot, nil
+}
+
+// parseEnvSnapshot reads the sections printed by envSnapshotScript.
+func parseEnvSnapshot(output string) *EnvSnapshot {
+	snapshot := &EnvSnapshot{Env: map[string]string{}, Tools: map[string]string{}}
+
+	var section, lastVar string
+	var archLines []string
+	for _, line := range strings.Split(output, "\n") {
+		if name, ok := strings.CutPrefix(line, "### "); ok {
+			section = name
+			continue
+		}
+
+		switch section {
+		case "env":
+			if !envVarLinePattern.MatchString(line) {
+				// Values with line breaks continue on the next lines
+				if lastVar != "" {
+					snapshot.Env[lastVar] += "\n" + line
+				}
+				continue
+			}
+			name, value, _ := strings.Cut(line, "=")
+			lastVar = name
+			snapshot.Env[name] = value
+		case "tools":
+			if name, version, ok := strings.Cut(line, "\t"); ok {
+				snapshot.Tools[name] = strings.TrimSpace(version)
+			}
+		case "arch":
+			archLines = append(archLines, line)
+		case "sdks":
+			if line = strings.TrimSpace(line); line != "" {
+				snapshot.SDKs = append(snapshot.SDKs, line)
+			}
+		}
+	}
+
+	for _, name := range volatileEnvVars {
+		delete(snapshot.Env, name)
+	}
+	for name, value := range snapshot.Env {
+		if secretEnvVarPattern.MatchString(name) {
+			snapshot.Env[name] = secretDigest(value)
+		}
+	}
+	slices.Sort(snapshot.SDKs)
+	if len(archLines) > 0 {
+		snapshot.Arch = parseArch(strings.Join(archLines, "\n"))
+	}
+	return snapshot
+}
+
+// secretDigest replaces a secret with a short digest, which still shows whether it changed.
+func secretDigest(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// SaveEnvSnapshot writes the snapshot to the file as JSON.
+func SaveEnvSnapshot(snapshot *EnvSnapshot, path string) error {
+	content, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadEnvSnapshot reads a snapshot saved by SaveEnvSnapshot.
+func LoadEnvSnapshot(path string) (*EnvSnapshot, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var snapshot EnvSnapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return nil, fmt.Errorf("decode snapshot %s: %w", path, err)
+	}
+	return &snapshot, nil
+}
+
+// DiffEnv returns the changes from the old snapshot to the new one, ordered by section and name.
+func DiffEnv(old, new *EnvSnapshot) []EnvChange {
+	var changes []EnvChange
+	changes = append(changes, diffValues("tool", old.Tools, new.Tools)...)
+	changes = append(changes, diffValues("sdk", setOf(old.SDKs), setOf(new.SDKs))...)
+	// Snapshots of earlier versions have no architecture
+	if old.Arch != nil && new.Arch != nil {
+		changes = append(changes, diffValues("arch", old.Arch.values(), new.Arch.values())...)
+	}
+	changes = append(changes, diffValues("env", old.Env, new.Env)...)
+	return changes
+}
+
+func diffValues(section string, old, new map[string]string) []EnvChange {
+	var changes []EnvChange
+	for name, oldValue := range old {
+		if newValue, ok := new[name]; !ok || newValue != oldValue {
+			changes = append(changes, EnvChange{Section: section, Name: name, Old: oldValue, New: newValue})
+		}
+	}
+	for name, newValue := range new {
+		if _, ok := old[name]; !ok {
+			changes = append(changes, EnvChange{Section: section, Name: name, New: newValue})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b EnvChange) int { return strings.Compare(a.Name, b.Name) })
+	return changes
+}
+
+// setOf turns the list into a map, so SDKs are diffed the same way as the tools, by presence.
+func setOf(items []string) map[string]string {
+	set := make(map[string]string, len(items))
+	for _, item := range items {
+		set[item] = item
+	}
+	return set
+}
@@ -0,0 +1,301 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	gliderSSH "github.com/gliderlabs/ssh"
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const testPassword = "secret"
+
+// fakeRunner is a CommandRunner with canned outputs instead of the local programs, it records what was run.
+type fakeRunner struct {
+	mu sync.Mutex
+	// installed are the programs LookPath finds, the others are reported missing
+	installed map[string]bool
+	// outputs are keyed by the program name
+	outputs map[string]fakeOutput
+	calls   [][]string
+}
+
+type fakeOutput struct {
+	out string
+	err error
+}
+
+func (r *fakeRunner) LookPath(file string) (string, error) {
+	if !r.installed[file] {
+		return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+	}
+	return filepath.Join("/fake/bin", file), nil
+}
+
+func (r *fakeRunner) Output(name string, args ...string) ([]byte, error) {
+	return r.run(name, args)
+}
+
+func (r *fakeRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	return r.run(name, args)
+}
+
+func (r *fakeRunner) run(name string, args []string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, append([]string{filepath.Base(name)}, args...))
+
+	output, ok := r.outputs[filepath.Base(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s: no canned output", name)
+	}
+	return []byte(output.out), output.err
+}
+
+// useFakeRunner replaces the local programs for the test.
+func useFakeRunner(t *testing.T, runner *fakeRunner) {
+	t.Helper()
+	SetCommandRunner(runner)
+	t.Cleanup(func() { SetCommandRunner(nil) })
+}
+
+// useTempDirs points the home and config dirs to throwaway directories for the test.
+func useTempDirs(t *testing.T) {
+	t.Helper()
+	paths.SetHomeDir(t.TempDir())
+	paths.SetConfigDir(t.TempDir())
+	t.Cleanup(func() {
+		paths.SetHomeDir("")
+		paths.SetConfigDir("")
+	})
+}
+
+// macOSStack is the environment of a macOS stack VM as the setup reads it.
+func macOSStack() map[string]string {
+	return map[string]string{
+		osTypeEnvVar:    "darwin23",
+		sourceDirEnvVar: "~/git",
+		buildSlugEnvVar: "build-slug",
+		revisionEnvVar:  "osx-xcode-16.0.x-1",
+		tmpDirEnvVar:    "~/tmp",
+		deployDirEnvVar: "~/deploy",
+	}
+}
+
+// linuxStack is the environment of a Linux stack container as the setup reads it, the stack revision has a
+// different variable there.
+func linuxStack() map[string]string {
+	return map[string]string{
+		osTypeEnvVar:         "linux-gnu",
+		sourceDirEnvVar:      "~/src",
+		buildSlugEnvVar:      "build-slug",
+		revisionEnvVarUbuntu: "ubuntu-noble-24.04-bitrise-2024-1",
+		deployDirEnvVar:      "~/deploy",
+	}
+}
+
+// testServer is an SSH server in the test process standing in for the VM. Its sessions run the commands with the
+// local sh in a throwaway home directory, with the given environment, and it serves SFTP from the same directory.
+// The values of the environment starting with ~/ are in the home directory.
+// It accepts the test password and the keys of its authorized_keys, like sshd.
+type testServer struct {
+	Home    string
+	env     []string
+	server  *gliderSSH.Server
+	address string
+	hostKey cryptoSSH.PublicKey
+}
+
+func newTestServer(t *testing.T, env map[string]string) *testServer {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("the test server runs the commands with sh")
+	}
+
+	s := &testServer{Home: t.TempDir()}
+	s.env = append(s.env, "HOME="+s.Home, "SHELL=/bin/sh", "PATH="+os.Getenv("PATH"))
+	for key, value := range env {
+		// The paths of the stack are kept in the home directory, eg. ~/git as the source dir
+		if strings.HasPrefix(value, "~/") {
+			value = filepath.Join(s.Home, value[2:])
+		}
+		s.env = append(s.env, key+"="+value)
+	}
+
+	s.server = &gliderSSH.Server{
+		Handler: s.handleSession,
+		PasswordHandler: func(ctx gliderSSH.Context, password string) bool {
+			return password == testPassword
+		},
+		PublicKeyHandler: s.isAuthorized,
+		SubsystemHandlers: map[string]gliderSSH.SubsystemHandler{
+			"sftp": s.handleSFTP,
+		},
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.address = listener.Addr().String()
+
+	go func() { _ = s.server.Serve(listener) }()
+	t.Cleanup(func() { _ = s.server.Close() })
+
+	// The host key is generated by Serve, it's read back with a handshake
+	hostKeys := make(chan cryptoSSH.PublicKey, 1)
+	config := &cryptoSSH.ClientConfig{
+		User: "vagrant",
+		Auth: []cryptoSSH.AuthMethod{cryptoSSH.Password(testPassword)},
+		HostKeyCallback: func(hostname string, remote net.Addr, key cryptoSSH.PublicKey) error {
+			hostKeys <- key
+			return nil
+		},
+	}
+	client, err := cryptoSSH.Dial("tcp", s.address, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	s.hostKey = <-hostKeys
+
+	return s
+}
+
+// Dial connects to the server whatever address the config entry has, it's the Transport of the tests.
+func (s *testServer) Dial(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", s.address)
+}
+
+// use makes the SSH clients of the test connect to the server.
+func (s *testServer) use(t *testing.T) {
+	t.Helper()
+	SetTransport(s)
+	t.Cleanup(func() { SetTransport(nil) })
+}
+
+// entry returns a config entry of the server logging in with the test password.
+func (s *testServer) entry() *configEntry {
+	password := testPassword
+	return &configEntry{
+		Host:           BitriseHostPattern,
+		HostName:       "10.0.0.1",
+		Port:           "22",
+		User:           "vagrant",
+		Password:       &password,
+		KnownHostsFile: bitriseKnownHostsPath(),
+	}
+}
+
+// path returns the path of a file in the server's home directory.
+func (s *testServer) path(name string) string {
+	return filepath.Join(s.Home, name)
+}
+
+func (s *testServer) isAuthorized(ctx gliderSSH.Context, key gliderSSH.PublicKey) bool {
+	content, err := os.ReadFile(s.path(authorizedKeysPath))
+	if err != nil {
+		return false
+	}
+	for len(content) > 0 {
+		authorized, _, _, rest, err := cryptoSSH.ParseAuthorizedKey(content)
+		if err != nil {
+			return false
+		}
+		if gliderSSH.KeysEqual(authorized, key) {
+			return true
+		}
+		content = rest
+	}
+	return false
+}
+
+// handleSession runs the command of an exec request with sh -c, a shell request reads the commands from the input.
+// The input of a terminal ends the lines with a carriage return, a real pty turns them to newlines for the shell.
+func (s *testServer) handleSession(session gliderSSH.Session) {
+	cmd := exec.CommandContext(session.Context(), "sh")
+	var input io.Reader = session
+	if raw := session.RawCommand(); raw != "" {
+		cmd = exec.CommandContext(session.Context(), "sh", "-c", raw)
+	} else if _, _, isPty := session.Pty(); isPty {
+		input = carriageReturnReader{session}
+	}
+	cmd.Dir = s.Home
+	cmd.Env = append(session.Environ(), s.env...)
+	cmd.Stdout = session
+	cmd.Stderr = session.Stderr()
+
+	// Like sshd, the session ends when the command exits, even if the client keeps the input open
+	stdin, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err == nil {
+		go func() {
+			_, _ = io.Copy(stdin, input)
+			stdin.Close()
+		}()
+		err = cmd.Wait()
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		_ = session.Exit(0)
+	case errors.As(err, &exitErr):
+		_ = session.Exit(exitErr.ExitCode())
+	default:
+		fmt.Fprintln(session.Stderr(), err)
+		_ = session.Exit(255)
+	}
+}
+
+func (s *testServer) handleSFTP(session gliderSSH.Session) {
+	server, err := sftp.NewServer(session, sftp.WithServerWorkingDirectory(s.Home))
+	if err != nil {
+		_ = session.Exit(1)
+		return
+	}
+	if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+		_ = session.Exit(1)
+		return
+	}
+	_ = session.Exit(0)
+}
+
+// carriageReturnReader turns the carriage returns of the input to newlines.
+type carriageReturnReader struct {
+	reader io.Reader
+}
+
+func (r carriageReturnReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	for i := range p[:n] {
+		if p[i] == '\r' {
+			p[i] = '\n'
+		}
+	}
+	return n, err
+}
+
+// knownHostsContain reports whether the Bitrise known_hosts file has the key of the server.
+func knownHostsContain(t *testing.T, key cryptoSSH.PublicKey) bool {
+	t.Helper()
+	content, err := os.ReadFile(bitriseKnownHostsPath())
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(content), strings.TrimSpace(string(cryptoSSH.MarshalAuthorizedKey(key))))
+}
@@ -0,0 +1,59 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+)
+
+// localForwards holds the LocalForward values of the host entry, eg. 8080 localhost:3000
+var localForwards []string
+
+// remoteForwards holds the RemoteForward values of the host entry, eg. 8097 localhost:8097
+var remoteForwards []string
+
+// remoteEnv is exported in the shells of the VM, in the managed block of the shell configs
+var remoteEnv map[string]string
+
+// SetLocalForwards sets the ports forwarded from the local machine to the VM, in the format of
+// <port> or <local port>:<remote host>:<remote port>.
+func SetLocalForwards(forwards []string) error {
+	values, err := forwardValues(forwards)
+	if err != nil {
+		return err
+	}
+	localForwards = values
+	return nil
+}
+
+// SetRemoteForwards sets the ports forwarded from the VM to the local machine, in the format of
+// <port> or <remote port>:<local host>:<local port>.
+func SetRemoteForwards(forwards []string) error {
+	values, err := forwardValues(forwards)
+	if err != nil {
+		return err
+	}
+	remoteForwards = values
+	return nil
+}
+
+// SetRemoteEnv sets the environment variables exported in the shells of the VM.
+func SetRemoteEnv(env map[string]string) {
+	remoteEnv = env
+}
+
+// forwardValues converts the forwards to the format of the SSH config.
+func forwardValues(forwards []string) ([]string, error) {
+	var values []string
+	for _, forward := range forwards {
+		parts := strings.Split(strings.TrimSpace(forward), ":")
+		switch len(parts) {
+		case 1:
+			values = append(values, fmt.Sprintf("%s localhost:%s", parts[0], parts[0]))
+		case 3:
+			values = append(values, fmt.Sprintf("%s %s:%s", parts[0], parts[1], parts[2]))
+		default:
+			return nil, fmt.Errorf("invalid port forward: %s", forward)
+		}
+	}
+	return values, nil
+}
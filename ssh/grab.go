@@ -0,0 +1,166 @@
+package ssh
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// Artifacts that grab can find on the VM
+const (
+	GrabXCResult    = "xcresult"
+	GrabDerivedData = "deriveddata"
+)
+
+const (
+	derivedDataPath = "Library/Developer/Xcode/DerivedData"
+	deployDirEnvVar = "BITRISE_DEPLOY_DIR"
+)
+
+// Grab finds the newest artifact of the kind on the VM of the last session, archives it remotely and extracts it
+// into localDir. The local path of the artifact is returned.
+func Grab(kind, localDir string, password *string) (string, error) {
+	var localPath string
+	err := withSFTP(password, DefaultTransferConcurrency, func(client *cryptoSSH.Client, sftpClient *sftp.Client) error {
+		progress.Start(StageTransfer, fmt.Sprintf("Looking for the newest %s...", kind))
+		remotePath, err := newestArtifact(client, kind)
+		if err != nil {
+			progress.Fail(StageTransfer, "find "+kind, err)
+			return err
+		}
+		progress.Succeed(StageTransfer, "Found "+remotePath)
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultSessionTimeout)
+		defer cancel()
+
+		// Bundles have many small files, a single archive is much faster to copy than the tree
+		archivePath := fmt.Sprintf("/tmp/bitrise-remote-access-%s.tar.gz", kind)
+		archiveCmd := fmt.Sprintf("tar -czf %s -C %s %s", shellQuote(archivePath), shellQuote(path.Dir(remotePath)), shellQuote(path.Base(remotePath)))
+		progress.Start(StageTransfer, "Archiving on the VM...")
+		if _, err := runCommandOutput(ctx, client, archiveCmd); err != nil {
+			progress.Fail(StageTransfer, "archive "+remotePath, err)
+			return fmt.Errorf("archive %s: %w", remotePath, err)
+		}
+		defer sftpClient.Remove(archivePath)
+		progress.Succeed(StageTransfer, "Archived")
+
+		archive, err := sftpClient.Open(archivePath)
+		if err != nil {
+			return fmt.Errorf("open archive: %w", err)
+		}
+		defer archive.Close()
+
+		var total int64
+		if info, err := archive.Stat(); err == nil {
+			total = info.Size()
+		}
+		reader, writer := io.Pipe()
+		// Closing the reader stops the copy if the extraction ends early
+		defer reader.Close()
+		go func() {
+			_, err := streamCopy(writer, archive, path.Base(remotePath), 0, total)
+			writer.CloseWithError(err)
+		}()
+
+		if err := extractTarGz(reader, localDir); err != nil {
+			return fmt.Errorf("extract %s: %w", remotePath, err)
+		}
+		localPath = filepath.Join(localDir, path.Base(remotePath))
+		return nil
+	})
+	return localPath, err
+}
+
+// newestArtifact returns the remote path of the most recently modified artifact of the kind.
+func newestArtifact(client *cryptoSSH.Client, kind string) (string, error) {
+	var find string
+	switch kind {
+	case GrabXCResult:
+		// Test steps write the bundles to DerivedData, the deploy dir or the source dir
+		results, err := runWithPty(client, &[]string{sourceDirEnvVar, deployDirEnvVar}, "echo $", true)
+		if err != nil {
+			return "", fmt.Errorf("detect remote environment: %w", err)
+		}
+		roots := []string{`"$HOME"/` + derivedDataPath}
+		for _, envVar := range []string{sourceDirEnvVar, deployDirEnvVar} {
+			if dir := strings.TrimSpace(results[envVar]); dir != "" {
+				roots = append(roots, shellQuote(dir))
+			}
+		}
+		find = fmt.Sprintf(`find %s -maxdepth 6 -type d -name '*.xcresult' -prune -print0 2>/dev/null`, strings.Join(roots, " "))
+	case GrabDerivedData:
+		find = fmt.Sprintf(`find "$HOME"/%s -mindepth 1 -maxdepth 1 -type d -print0 2>/dev/null`, derivedDataPath)
+	default:
+		return "", fmt.Errorf("unknown artifact %q, expected %s or %s", kind, GrabXCResult, GrabDerivedData)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	output, _ := runCommandOutput(ctx, client, find+" | xargs -0 ls -dt 2>/dev/null | head -n 1")
+	newest := strings.TrimSpace(output)
+	if newest == "" {
+		return "", fmt.Errorf("no %s found on the VM, did the build get that far?", kind)
+	}
+	return newest, nil
+}
+
+// extractTarGz extracts the archive into dir, entries pointing outside of it are rejected.
+func extractTarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(header.Mode).Perm()|0700); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			_ = os.Remove(target)
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, archive)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
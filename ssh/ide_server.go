@@ -0,0 +1,130 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	ideServerPollInterval = 3 * time.Second
+	ideServerLogTailLines = 20
+)
+
+// IDEServer is the server an editor starts on the VM once it connected, eg. the VS Code server.
+type IDEServer struct {
+	// Name is shown in the errors, eg. VS Code server
+	Name string
+	// ProcessPattern matches the command line of the running server, as in pgrep -f
+	ProcessPattern string
+	// InstallDir is where the editor downloads the server to, relative to the home dir
+	InstallDir string
+	// LogGlobs match the logs of the server start, relative to the home dir
+	LogGlobs []string
+}
+
+// ideServers are the servers of the IDEs being opened, a running one means the VM is set up from an earlier session
+var ideServers []IDEServer
+
+// SetIDEServers sets the servers of the IDEs being opened, the setup keeps what a running one depends on.
+func SetIDEServers(servers ...IDEServer) {
+	ideServers = servers
+}
+
+// IDEServerErr means the editor was opened, but the server it needs on the VM didn't start.
+type IDEServerErr struct {
+	// Connected is set if the editor reached the VM, ie. the server was downloaded but failed to start
+	Connected bool
+	// Log is the end of the newest server log, empty if there is none
+	Log string
+	err error
+}
+
+func (e IDEServerErr) Error() string {
+	return e.err.Error()
+}
+
+func (e IDEServerErr) Unwrap() error {
+	return e.err
+}
+
+// WaitForIDEServer polls the VM of the last session until the editor's server runs on it. If it doesn't start in
+// time, an IDEServerErr tells how far the editor got.
+func WaitForIDEServer(server IDEServer, password *string, timeout time.Duration) error {
+	client, err := connectLastSession(password)
+	if err != nil {
+		return fmt.Errorf("connect to check the %s: %w", server.Name, err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(interrupt.Context(), timeout)
+	defer cancel()
+
+	for {
+		if ideServerRunning(ctx, client, server) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if interrupt.Context().Err() != nil {
+				return ctx.Err()
+			}
+			return diagnoseIDEServer(client, server, timeout)
+		case <-time.After(ideServerPollInterval):
+		}
+	}
+}
+
+func ideServerRunning(ctx context.Context, client *cryptoSSH.Client, server IDEServer) bool {
+	ctx, cancel := context.WithTimeout(ctx, defaultCommandTimeout)
+	defer cancel()
+
+	output, _ := runCommandOutput(ctx, client, fmt.Sprintf("pgrep -f %s >/dev/null && echo running", shellQuote(server.ProcessPattern)))
+	return strings.TrimSpace(output) == "running"
+}
+
+// runningIDEServers returns the names of the set servers running on the VM, eg. after the laptop slept and the
+// editor is reconnected to the same build.
+func runningIDEServers(client *cryptoSSH.Client) []string {
+	var running []string
+	for _, server := range ideServers {
+		if ideServerRunning(context.Background(), client, server) {
+			running = append(running, server.Name)
+		}
+	}
+	return running
+}
+
+// diagnoseIDEServer tells whether the editor connected at all: the server is only downloaded once it did.
+func diagnoseIDEServer(client *cryptoSSH.Client, server IDEServer, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	installed, _ := runCommandOutput(ctx, client, fmt.Sprintf(`[ -d "$HOME"/%s ] && echo installed`, server.InstallDir))
+	if strings.TrimSpace(installed) != "installed" {
+		return IDEServerErr{err: fmt.Errorf("the editor didn't connect to the VM in %s", timeout)}
+	}
+
+	serverErr := IDEServerErr{
+		Connected: true,
+		err:       fmt.Errorf("the %s didn't start on the VM in %s", server.Name, timeout),
+	}
+	var logs []string
+	for _, glob := range server.LogGlobs {
+		logs = append(logs, `"$HOME"/`+glob)
+	}
+	if len(logs) == 0 {
+		return serverErr
+	}
+
+	newest, _ := runCommandOutput(ctx, client, fmt.Sprintf("ls -t %s 2>/dev/null | head -n 1", strings.Join(logs, " ")))
+	if newest = strings.TrimSpace(newest); newest != "" {
+		serverErr.Log, _ = runCommandOutput(ctx, client, fmt.Sprintf("tail -n %d %s", ideServerLogTailLines, shellQuote(newest)))
+	}
+	return serverErr
+}
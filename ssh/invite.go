@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	githubKeysURL   = "https://github.com/%s.keys"
+	inviteKeyPrefix = "Bitrise remote access invite"
+)
+
+// githubUsernamePattern matches the usernames GitHub allows, alphanumeric with single hyphens in between
+var githubUsernamePattern = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9]|-[a-zA-Z0-9]){0,38}$`)
+
+// Invitation holds what a teammate needs to connect to the VM with their own key.
+type Invitation struct {
+	HostName string
+	Port     string
+	User     string
+	Keys     int
+}
+
+// ResolvePublicKeys reads the authorized_keys formatted keys of the file, or of the GitHub user if there is
+// no such file. Every key is validated, so a typo doesn't end up in the VM's authorized_keys.
+func ResolvePublicKeys(source string) ([]string, error) {
+	content, err := os.ReadFile(source)
+	if errors.Is(err, os.ErrNotExist) && githubUsernamePattern.MatchString(source) {
+		content, err = fetchGitHubKeys(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read public keys: %w", err)
+	}
+
+	var keys []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, _, _, err := cryptoSSH.ParseAuthorizedKey([]byte(line)); err != nil {
+			return nil, fmt.Errorf("invalid public key %q: %w", line, err)
+		}
+		keys = append(keys, line)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in %s", source)
+	}
+	return keys, nil
+}
+
+func fetchGitHubKeys(username string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(fmt.Sprintf(githubKeysURL, username))
+	if err != nil {
+		return nil, fmt.Errorf("fetch GitHub keys of %s: %w", username, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch GitHub keys of %s: %s", username, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Invite authorizes the teammate's keys on the VM of the last session, the password is only needed without a
+// session key. The keys are labelled with the name, so they can be told apart in authorized_keys.
+func Invite(name string, keys []string, password *string) (*Invitation, error) {
+	var invitation *Invitation
+	err := withSFTP(password, 1, func(client *cryptoSSH.Client, sftpClient *sftp.Client) error {
+		// A key that's already authorized, eg. with another label, is not added again
+		var updateErr error
+		err := updateRemoteFile(client, authorizedKeysPath, func(content string) string {
+			for _, key := range keys {
+				updated, err := withAuthorizedKey(content, inviteKeyLine(key, name), false)
+				if err != nil {
+					updateErr = err
+					return content
+				}
+				content = updated
+			}
+			return content
+		})
+		if err == nil {
+			err = updateErr
+		}
+		if err != nil {
+			return fmt.Errorf("add public key to remote authorized_keys: %w", err)
+		}
+		if err := ensureStrictModes(sftpClient); err != nil {
+			return fmt.Errorf("fix remote SSH permissions: %w", err)
+		}
+
+		configEntry, err := readSSHClientConfig()
+		if err != nil {
+			return fmt.Errorf("read SSH config entry: %w", err)
+		}
+		invitation = &Invitation{
+			HostName: configEntry.HostName,
+			Port:     configEntry.Port,
+			User:     configEntry.User,
+			Keys:     len(keys),
+		}
+		return nil
+	})
+	return invitation, err
+}
+
+// inviteKeyLine replaces the comment of the key with the label of the invite.
+func inviteKeyLine(key, name string) string {
+	fields := strings.Fields(key)
+	// The options before the key type are kept, only the comment after the key data is dropped
+	for i, field := range fields {
+		if strings.HasPrefix(field, "ssh-") || strings.HasPrefix(field, "ecdsa-") || strings.HasPrefix(field, "sk-") {
+			if i+1 < len(fields) {
+				fields = fields[:i+2]
+			}
+			break
+		}
+	}
+	return fmt.Sprintf("%s %s (%s)", strings.Join(fields, " "), inviteKeyPrefix, name)
+}
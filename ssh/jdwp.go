@@ -0,0 +1,112 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// DefaultJDWPPort is the port the JVM debug agent listens on, on the VM and locally
+const DefaultJDWPPort = 5005
+
+// jdwpAddressPattern matches the address of a JVM started with the debug agent, eg. -agentlib:jdwp=...,address=*:5005
+var jdwpAddressPattern = regexp.MustCompile(`jdwp=\S*address=(?:[^,\s]*:)?(\d+)`)
+
+// LaunchJDWP runs the command in the source dir of the Linux VM of the last session with the JVM debug agent
+// waiting for a debugger on port, and forwards localhost:port to it. Gradle commands debug the build itself,
+// other commands get the agent in JAVA_TOOL_OPTIONS. The output of the command is written to output.
+func LaunchJDWP(command string, port int, output io.Writer, password *string) (*DebugSession, error) {
+	client, err := connectLastSession(password)
+	if err != nil {
+		return nil, err
+	}
+
+	envMap, err := runWithPty(client, &[]string{sourceDirEnvVar}, "echo $", true)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("detect remote environment: %w", err)
+	}
+
+	launch := jdwpCommand(command, port)
+	if sourceDir := strings.TrimSpace(envMap[sourceDirEnvVar]); sourceDir != "" {
+		launch = fmt.Sprintf("cd %s && %s", shellQuote(sourceDir), launch)
+	}
+
+	session, err := startDebugCommand(client, launch, 0, port, output)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+// jdwpCommand adds the debug agent to the command. Gradle starts several JVMs, so the build is suspended
+// with its own property instead of JAVA_TOOL_OPTIONS that every JVM would try to listen with.
+func jdwpCommand(command string, port int) string {
+	fields := strings.Fields(command)
+	if len(fields) > 0 && (strings.HasSuffix(fields[0], "gradlew") || fields[0] == "gradle") {
+		return fmt.Sprintf("%s -Dorg.gradle.debug=true -Dorg.gradle.debug.port=%d --no-daemon", command, port)
+	}
+
+	agent := fmt.Sprintf("-agentlib:jdwp=transport=dt_socket,server=y,suspend=y,address=127.0.0.1:%d", port)
+	return fmt.Sprintf("JAVA_TOOL_OPTIONS=%s %s", shellQuote(agent), command)
+}
+
+// AttachJDWP forwards localPort to the debug agent of a JVM already running on the VM of the last session.
+// The process is a PID or a name, it has to be started with the -agentlib:jdwp option.
+func AttachJDWP(process string, localPort int, password *string) (*DebugSession, error) {
+	client, err := connectLastSession(password)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := attachJDWP(client, process, localPort)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+func attachJDWP(client *cryptoSSH.Client, process string, localPort int) (*DebugSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	pid, err := findProcess(ctx, client, process)
+	if err != nil {
+		return nil, err
+	}
+
+	commandLine, err := runCommandOutput(ctx, client, fmt.Sprintf("ps -o command= -p %d", pid))
+	if err != nil {
+		return nil, fmt.Errorf("read command line of process %d: %w", pid, err)
+	}
+	match := jdwpAddressPattern.FindStringSubmatch(commandLine)
+	if match == nil {
+		return nil, fmt.Errorf("process %d is not started with the JVM debug agent, launch it with the jdwp command instead", pid)
+	}
+	remotePort, _ := strconv.Atoi(match[1])
+
+	forward, err := openTunnel(client, localPort, fmt.Sprintf("127.0.0.1:%d", remotePort))
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- client.Wait() }()
+
+	return &DebugSession{
+		PID:       pid,
+		LocalPort: localPort,
+		Done:      done,
+		stop: func() {
+			forward.Close()
+			client.Close()
+		},
+	}, nil
+}
@@ -0,0 +1,153 @@
+package ssh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	sshdConfigPath   = "/etc/ssh/sshd_config"
+	sshdConfigDropIn = "/etc/ssh/sshd_config.d"
+)
+
+// verifyKeyAuth connects with the session key only, so a key the remote rejects is found before the editor tries it.
+// The returned error explains why sshd refuses the key, as far as it can be told from the remote files.
+func verifyKeyAuth(client *cryptoSSH.Client, configEntry *configEntry) error {
+	keyOnly := *configEntry
+	keyOnly.Password = nil
+	// The certificate or the access token would be accepted in place of the session key
+	keyOnly.sessionKeyOnly = true
+	keyOnly.readOnly = true
+
+	keyClient, err := connectSSHClient(&keyOnly)
+	if err == nil {
+		keyClient.Close()
+		return nil
+	}
+
+	reasons := diagnoseKeyAuth(client, configEntry)
+	if errors.Is(err, errSecurityKeyUnusable) && len(reasons) == 0 {
+		// ssh asks for the touch when the editor connects, that's the first time the key can be tried
+		logger.Info("The key on the security key is tried when the editor connects, touch it then")
+		return nil
+	}
+	if len(reasons) == 0 {
+		return fmt.Errorf("connect with SSH key: %w", err)
+	}
+	return fmt.Errorf("connect with SSH key: %w\n- %s", err, strings.Join(reasons, "\n- "))
+}
+
+// diagnoseKeyAuth lists the problems with the remote state that make sshd refuse public key auth.
+func diagnoseKeyAuth(client *cryptoSSH.Client, configEntry *configEntry) []string {
+	var reasons []string
+
+	if authorized, err := isKeyAuthorized(client, configEntry.IdentityFile); err == nil && !authorized {
+		reasons = append(reasons, fmt.Sprintf("the public key is missing from ~/%s", authorizedKeysPath))
+	}
+
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return append(reasons, fmt.Sprintf("the remote files could not be inspected: %s", err))
+	}
+	defer sftpClient.Close()
+
+	for _, item := range []struct {
+		path, name string
+	}{
+		{".", "the home directory"},
+		{path.Dir(authorizedKeysPath), "~/" + path.Dir(authorizedKeysPath)},
+		{authorizedKeysPath, "~/" + authorizedKeysPath},
+	} {
+		info, err := sftpClient.Stat(item.path)
+		if err != nil {
+			continue
+		}
+		if perm := info.Mode().Perm(); perm&0022 != 0 {
+			reasons = append(reasons, fmt.Sprintf("%s is writable by others (%s), sshd's StrictModes refuses the key", item.name, perm))
+		}
+	}
+
+	keyType := "ed25519"
+	if isSecurityKey(configEntry.IdentityFile) {
+		keyType = "sk-ssh-ed25519"
+	}
+	return append(reasons, diagnoseSSHDConfig(sftpClient, configEntry.User, keyType)...)
+}
+
+// diagnoseSSHDConfig checks the global options of the sshd config that disable public key auth for the user.
+// Options in Match blocks are not evaluated.
+func diagnoseSSHDConfig(sftpClient *sftp.Client, user, keyType string) []string {
+	options := map[string]string{}
+
+	configPaths := []string{sshdConfigPath}
+	if entries, err := sftpClient.ReadDir(sshdConfigDropIn); err == nil {
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".conf") {
+				configPaths = append(configPaths, path.Join(sshdConfigDropIn, entry.Name()))
+			}
+		}
+	}
+	for _, configPath := range configPaths {
+		file, err := sftpClient.Open(configPath)
+		if err != nil {
+			continue
+		}
+		readSSHDOptions(file, options)
+		file.Close()
+	}
+
+	var reasons []string
+	if strings.EqualFold(options["pubkeyauthentication"], "no") {
+		reasons = append(reasons, "sshd has PubkeyAuthentication disabled")
+	}
+	if files, ok := options["authorizedkeysfile"]; ok && !strings.Contains(files, authorizedKeysPath) {
+		reasons = append(reasons, fmt.Sprintf("sshd reads the keys from %s instead of ~/%s", files, authorizedKeysPath))
+	}
+	for _, option := range []string{"pubkeyacceptedalgorithms", "pubkeyacceptedkeytypes"} {
+		algorithms, ok := options[option]
+		if ok && !strings.HasPrefix(algorithms, "+") && !strings.Contains(algorithms, keyType) {
+			reasons = append(reasons, fmt.Sprintf("sshd doesn't accept %s keys (%s)", keyType, algorithms))
+		}
+	}
+	if users, ok := options["allowusers"]; ok && !allowsUser(users, user) {
+		reasons = append(reasons, fmt.Sprintf("%s is not in sshd's AllowUsers", user))
+	}
+	return reasons
+}
+
+// readSSHDOptions adds the options of the config to the map. Like sshd, the first value of an option wins.
+func readSSHDOptions(r io.Reader, options map[string]string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keyword, value, _ := strings.Cut(line, " ")
+		keyword = strings.ToLower(keyword)
+		if keyword == "match" {
+			return
+		}
+		if _, ok := options[keyword]; !ok {
+			options[keyword] = strings.TrimSpace(value)
+		}
+	}
+}
+
+// allowsUser reports whether the AllowUsers list may match the user, patterns are assumed to match.
+func allowsUser(allowUsers, user string) bool {
+	for _, pattern := range strings.Fields(allowUsers) {
+		if pattern == user || strings.HasPrefix(pattern, user+"@") || strings.ContainsAny(pattern, "*?") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	cryptoSSH "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const hashedHostPrefix = "|1|"
+
+// knownHostsFiles returns the known_hosts files that may contain entries of a Bitrise VM.
+func knownHostsFiles() []string {
+	return []string{
+		filepath.Join(paths.SSHDir(), "known_hosts"),
+		filepath.Join(paths.SSHDir(), "known_hosts2"),
+		bitriseKnownHostsPath(),
+	}
+}
+
+func bitriseKnownHostsPath() string {
+	return filepath.Join(paths.StateDir(), "known_hosts")
+}
+
+// knownHostsAddress returns the host in the format used by known_hosts, eg. [1.2.3.4]:2222.
+func knownHostsAddress(configEntry *configEntry) string {
+	return knownhosts.Normalize(net.JoinHostPort(configEntry.HostName, configEntry.Port))
+}
+
+// removeHostKey removes every entry of the host from the known_hosts files, including hashed ones.
+// The entries of the name a VPN address was looked up by are removed too, the addresses of a tailnet are
+// handed out to new VMs, so the key recorded for the name may belong to an earlier build.
+func removeHostKey(configEntry *configEntry) error {
+	return removeHostKeyFrom(configEntry, knownHostsFiles())
+}
+
+// removeUserHostKeys removes the entries of the host from the user's known_hosts files only. The entry of the
+// Bitrise specific file is replaced on connect, keeping it meanwhile doesn't make a running editor re-verify the host.
+func removeUserHostKeys(configEntry *configEntry) error {
+	return removeHostKeyFrom(configEntry, slices.DeleteFunc(knownHostsFiles(), func(path string) bool {
+		return path == bitriseKnownHostsPath()
+	}))
+}
+
+func removeHostKeyFrom(configEntry *configEntry, files []string) error {
+	addresses := []string{knownHostsAddress(configEntry)}
+	if configEntry.LookupName != "" {
+		addresses = append(addresses, knownhosts.Normalize(net.JoinHostPort(configEntry.LookupName, configEntry.Port)))
+	}
+
+	return withStateLock(func() error {
+		var errs []error
+		for _, address := range addresses {
+			for _, path := range files {
+				if err := removeKnownHost(path, address); err != nil {
+					errs = append(errs, fmt.Errorf("remove host key for %s from %s: %w", address, path, err))
+				}
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+func removeKnownHost(path, address string) error {
+	defer interrupt.Track(path)()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var kept bytes.Buffer
+	removed := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if knownHostsLineMatches(line, address) {
+			removed = true
+			continue
+		}
+		kept.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if !removed {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, kept.Bytes(), info.Mode().Perm())
+}
+
+// hasKnownHost reports whether the known_hosts file has an entry of the address.
+func hasKnownHost(path, address string) bool {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if knownHostsLineMatches(line, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// knownHostsLineMatches reports whether the known_hosts line is an entry of the address.
+// Marker lines (@cert-authority, @revoked) are never matched, they are not tied to a single VM.
+func knownHostsLineMatches(line, address string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+		return false
+	}
+
+	for _, host := range strings.Split(fields[0], ",") {
+		if strings.HasPrefix(host, hashedHostPrefix) {
+			if hashedHostMatches(host, address) {
+				return true
+			}
+		} else if host == address {
+			return true
+		}
+	}
+	return false
+}
+
+// hashedHostMatches checks a hashed host (|1|salt|hash) against the address, see HashKnownHosts in ssh_config(5).
+func hashedHostMatches(hashedHost, address string) bool {
+	parts := strings.Split(strings.TrimPrefix(hashedHost, hashedHostPrefix), "|")
+	if len(parts) != 2 {
+		return false
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// addHostKey records the host key in the Bitrise specific known_hosts file, the file is left as it is when the key
+// is already recorded, eg. on a reconnect to the same VM.
+func addHostKey(configEntry *configEntry, key cryptoSSH.PublicKey) error {
+	return withStateLock(func() error {
+		return recordHostKey(configEntry, key)
+	})
+}
+
+func recordHostKey(configEntry *configEntry, key cryptoSSH.PublicKey) error {
+	path := bitriseKnownHostsPath()
+	address := knownHostsAddress(configEntry)
+	line := knownhosts.Line([]string{address}, key)
+
+	if content, err := os.ReadFile(path); err == nil && slices.Contains(strings.Split(string(content), "\n"), line) {
+		return nil
+	}
+
+	if err := removeKnownHost(path, address); err != nil {
+		return fmt.Errorf("remove previous host key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	defer interrupt.Track(path)()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(line + "\n")
+	return err
+}
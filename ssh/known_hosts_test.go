@@ -0,0 +1,72 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestConnectRecordsHostKey(t *testing.T) {
+	useTempDirs(t)
+	server := newTestServer(t, nil)
+	server.use(t)
+	entry := server.entry()
+
+	// A reconnect to the same VM leaves the file as it is
+	for i := 0; i < 2; i++ {
+		client, err := connectSSHClient(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Close()
+	}
+
+	content, err := os.ReadFile(bitriseKnownHostsPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := knownhosts.Line([]string{knownHostsAddress(entry)}, server.hostKey)
+	if got := strings.TrimSpace(string(content)); got != want {
+		t.Errorf("known_hosts = %q, want %q", got, want)
+	}
+}
+
+func TestRemoveHostKey(t *testing.T) {
+	useTempDirs(t)
+	server := newTestServer(t, nil)
+	entry := server.entry()
+
+	other := "[10.0.0.2]:22 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDkZfKRDQ4zGnD0ZoNu2XTRVh8q0S4WpyyvKn1qJVnr0"
+	userKnownHosts := knownHostsFiles()[0]
+	content := knownhosts.Line([]string{knownHostsAddress(entry)}, server.hostKey) + "\n" + other + "\n"
+	if err := os.MkdirAll(filepath.Dir(userKnownHosts), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(userKnownHosts, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := addHostKey(entry, server.hostKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// The Bitrise file is kept while connecting, a running editor would have to verify the host again
+	if err := removeUserHostKeys(entry); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(userKnownHosts); strings.TrimSpace(string(got)) != other {
+		t.Errorf("user known_hosts = %q, want only the other host", got)
+	}
+	if !knownHostsContain(t, server.hostKey) {
+		t.Error("the Bitrise known_hosts entry is removed while connecting")
+	}
+
+	if err := removeHostKey(entry); err != nil {
+		t.Fatal(err)
+	}
+	if knownHostsContain(t, server.hostKey) {
+		t.Error("the Bitrise known_hosts entry is kept on disconnect")
+	}
+}
@@ -0,0 +1,152 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	managedBlockStart = "# >>> Bitrise remote access (managed block, removed by `bitrise :remote disconnect`) >>>"
+	managedBlockEnd   = "# <<< Bitrise remote access <<<"
+)
+
+// setManagedBlock replaces the managed block of the content with the lines, or appends it if there is none.
+// Lines added by earlier versions outside of the block are dropped, so the block doesn't duplicate them.
+func setManagedBlock(content string, lines []string) string {
+	content = removeManagedBlock(content)
+
+	var kept []string
+	for _, line := range strings.Split(content, "\n") {
+		if line == motdCommand {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	content = strings.TrimRight(strings.Join(kept, "\n"), "\n")
+
+	block := strings.Join(append(append([]string{managedBlockStart}, lines...), managedBlockEnd), "\n")
+	if content == "" {
+		return block + "\n"
+	}
+	return content + "\n\n" + block + "\n"
+}
+
+// removeManagedBlock returns the content without the managed block, the rest is kept as it is.
+func removeManagedBlock(content string) string {
+	start := strings.Index(content, managedBlockStart)
+	if start == -1 {
+		return content
+	}
+	end := strings.Index(content[start:], managedBlockEnd)
+	if end == -1 {
+		return content
+	}
+	end += start + len(managedBlockEnd)
+
+	before := strings.TrimRight(content[:start], "\n")
+	after := strings.TrimLeft(content[end:], "\n")
+	switch {
+	case before == "":
+		return after
+	case after == "":
+		return before + "\n"
+	default:
+		return before + "\n\n" + after
+	}
+}
+
+func hasManagedBlock(content string) bool {
+	return strings.Contains(content, managedBlockStart) && strings.Contains(content, managedBlockEnd)
+}
+
+// updateRemoteFile rewrites the remote file with the result of update, missing files are read as empty.
+// Unchanged files are not written. SFTP paths are relative to the home directory, so ~/ is dropped.
+func updateRemoteFile(client *cryptoSSH.Client, remotePath string, update func(string) string) error {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return fmt.Errorf("create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+
+	remotePath = strings.TrimPrefix(remotePath, "~/")
+
+	var content []byte
+	mode := os.FileMode(0644)
+	if file, err := sftpClient.Open(remotePath); err == nil {
+		content, err = io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("read %s: %w", remotePath, err)
+		}
+		if info, err := sftpClient.Stat(remotePath); err == nil {
+			mode = info.Mode().Perm()
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("open %s: %w", remotePath, err)
+	}
+
+	updated := update(string(content))
+	if updated == string(content) {
+		return nil
+	}
+
+	if err := sftpClient.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("create remote directories: %w", err)
+	}
+	file, err := sftpClient.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", remotePath, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write([]byte(updated)); err != nil {
+		return fmt.Errorf("write %s: %w", remotePath, err)
+	}
+	return sftpClient.Chmod(remotePath, mode)
+}
+
+// readRemoteFile returns the content of the remote file, empty if it doesn't exist.
+func readRemoteFile(client *cryptoSSH.Client, remotePath string) (string, error) {
+	var content string
+	err := updateRemoteFile(client, remotePath, func(current string) string {
+		content = current
+		return current
+	})
+	return content, err
+}
+
+// envExports returns the lines exporting the variables in the syntax of the shell, sorted by name.
+func envExports(env map[string]string, fish bool) []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		if fish {
+			lines[i] = fmt.Sprintf("set -gx %s %s", name, shellQuote(env[name]))
+		} else {
+			lines[i] = fmt.Sprintf("export %s=%s", name, shellQuote(env[name]))
+		}
+	}
+	return lines
+}
+
+// removeShellConfigBlocks removes the managed block from every shell config it may have been added to.
+func removeShellConfigBlocks(client *cryptoSSH.Client) error {
+	for _, shellConfig := range shellConfigsFor("fish") {
+		if err := (shellBlockResource{path: shellConfig}).remove(client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+)
+
+// Network modes of the connection
+const (
+	NetworkDirect = "direct"
+	NetworkVPN    = "vpn"
+)
+
+const (
+	// magicDNSResolver is the DNS server of Tailscale on every node, it resolves the names of the tailnet
+	magicDNSResolver  = "100.100.100.100:53"
+	vpnResolveTimeout = 5 * time.Second
+)
+
+var (
+	networkMode = NetworkDirect
+	// bindAddress is the local address the connections are made from, empty to let the OS pick
+	bindAddress string
+)
+
+// SetNetwork selects how the VM is reached. In vpn mode the hostname can be a MagicDNS name and the connection
+// isn't held back if it doesn't resolve. sourceInterface is an interface name or a local address to dial from,
+// eg. the Tailscale interface when the default route goes elsewhere.
+func SetNetwork(mode, sourceInterface string) error {
+	if mode == "" {
+		mode = NetworkDirect
+	}
+	if mode != NetworkDirect && mode != NetworkVPN {
+		return fmt.Errorf("unknown network mode %q, expected %s or %s", mode, NetworkDirect, NetworkVPN)
+	}
+	networkMode = mode
+
+	bindAddress = ""
+	if sourceInterface != "" {
+		address, err := interfaceAddress(sourceInterface)
+		if err != nil {
+			return err
+		}
+		bindAddress = address
+	}
+	return nil
+}
+
+// interfaceAddress returns the address of the interface to dial from, an address is returned as it is.
+// IPv4 addresses are preferred, the VPN addresses of the VMs usually are.
+func interfaceAddress(nameOrAddress string) (string, error) {
+	if _, err := netip.ParseAddr(nameOrAddress); err == nil {
+		return nameOrAddress, nil
+	}
+
+	iface, err := net.InterfaceByName(nameOrAddress)
+	if err != nil {
+		return "", fmt.Errorf("find interface %s: %w", nameOrAddress, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("read addresses of %s: %w", nameOrAddress, err)
+	}
+
+	var candidates []netip.Addr
+	for _, addr := range addrs {
+		if prefix, err := netip.ParsePrefix(addr.String()); err == nil && !prefix.Addr().IsLinkLocalUnicast() {
+			candidates = append(candidates, prefix.Addr())
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("interface %s has no usable address", nameOrAddress)
+	}
+	slices.SortStableFunc(candidates, func(a, b netip.Addr) int {
+		if a.Is4() == b.Is4() {
+			return 0
+		}
+		if a.Is4() {
+			return -1
+		}
+		return 1
+	})
+	return candidates[0].String(), nil
+}
+
+// resolveVPNHost returns the address to connect to in vpn mode. Names the system resolves are kept, so the
+// IDEs resolve them the same way, MagicDNS names are replaced by their address if only Tailscale knows them.
+// Unresolved names are kept too, the dial reports the problem.
+func resolveVPNHost(host string) string {
+	if _, err := netip.ParseAddr(host); err == nil {
+		return host
+	}
+	if _, err := net.LookupHost(host); err == nil {
+		return host
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vpnResolveTimeout)
+	defer cancel()
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, magicDNSResolver)
+		},
+	}
+	if addrs, err := resolver.LookupHost(ctx, host); err == nil && len(addrs) > 0 {
+		logger.Infof("Resolved %s to %s with MagicDNS", host, addrs[0])
+		return addrs[0]
+	}
+
+	logger.Warnf("%s could not be resolved, connecting anyway", host)
+	return host
+}
+
+// localAddr returns the address the dialer binds to, nil if none was selected.
+func localAddr(address string) net.Addr {
+	if address == "" {
+		return nil
+	}
+	return &net.TCPAddr{IP: net.ParseIP(address)}
+}
@@ -0,0 +1,42 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// FindOpenSSH returns the path of the ssh binary that VS Code's Remote - SSH extension will use.
+// On Windows this is the built-in OpenSSH client, without it the ssh.exe on $PATH (eg. Git for Windows) is used.
+func FindOpenSSH() (string, error) {
+	if runtime.GOOS == "windows" {
+		if _, err := os.Stat(windowsOpenSSHPath()); err == nil {
+			return windowsOpenSSHPath(), nil
+		}
+	}
+
+	path, err := localCommands.LookPath("ssh")
+	if err != nil {
+		if runtime.GOOS == "windows" {
+			return "", fmt.Errorf("no ssh client found, install the \"OpenSSH Client\" optional feature: %w", err)
+		}
+		return "", fmt.Errorf("ssh not found in $PATH: %w", err)
+	}
+	return path, nil
+}
+
+// IsWindowsOpenSSH reports whether path is the OpenSSH client built into Windows. Other ssh.exe builds
+// (eg. Git for Windows) do not understand the generated config reliably.
+func IsWindowsOpenSSH(path string) bool {
+	return strings.EqualFold(filepath.Clean(path), windowsOpenSSHPath())
+}
+
+func windowsOpenSSHPath() string {
+	systemRoot := os.Getenv("SystemRoot")
+	if systemRoot == "" {
+		systemRoot = `C:\Windows`
+	}
+	return filepath.Join(systemRoot, "System32", "OpenSSH", "ssh.exe")
+}
@@ -0,0 +1,164 @@
+package ssh
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+)
+
+// Step is a single change of the setup. Steps without apply are only described, eg. the ones made by the remote setup.
+type Step struct {
+	Remote      bool
+	Description string
+	// Optional steps only warn on failure
+	Optional bool
+	apply    func() error
+}
+
+// Plan lists the changes the setup makes on the local machine and the remote host.
+type Plan struct {
+	Steps []Step
+}
+
+func (p *Plan) local(description string, apply func() error) {
+	p.Steps = append(p.Steps, Step{Description: description, apply: apply})
+}
+
+func (p *Plan) optional(description string, apply func() error) {
+	p.Steps = append(p.Steps, Step{Description: description, Optional: true, apply: apply})
+}
+
+func (p *Plan) remote(description string, apply func() error) {
+	p.Steps = append(p.Steps, Step{Remote: true, Description: description, apply: apply})
+}
+
+func (p *Plan) append(other *Plan) {
+	p.Steps = append(p.Steps, other.Steps...)
+}
+
+// String lists the local and the remote changes.
+func (p *Plan) String() string {
+	var local, remote []string
+	for _, step := range p.Steps {
+		line := "- " + step.Description
+		if step.Optional {
+			line += " (optional)"
+		}
+		if step.Remote {
+			remote = append(remote, line)
+		} else {
+			local = append(local, line)
+		}
+	}
+
+	var builder strings.Builder
+	for _, section := range []struct {
+		title string
+		lines []string
+	}{{"Local changes", local}, {"Remote changes", remote}} {
+		if builder.Len() > 0 {
+			builder.WriteString("\n")
+		}
+		builder.WriteString(section.title + ":\n")
+		if len(section.lines) == 0 {
+			builder.WriteString("- none\n")
+		}
+		for _, line := range section.lines {
+			builder.WriteString(line + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// execute applies the steps, reporting them as the given stage.
+func (p *Plan) execute(stage string) error {
+	for _, step := range p.Steps {
+		if step.apply == nil {
+			continue
+		}
+
+		progress.Start(stage, step.Description+"...")
+		if err := step.apply(); err != nil {
+			progress.Fail(stage, step.Description, err)
+			if step.Optional {
+				continue
+			}
+			return err
+		}
+		progress.Succeed(stage, step.Description+": done")
+	}
+	return nil
+}
+
+// PlanSetup returns the changes SetupSSH would make without making them. The remote host is
+// connected to when the password is set, as the changes depend on its environment.
+func PlanSetup(host, port, user string, password *string, tuning Tuning, allowKeyAuth bool) (*Plan, error) {
+	config, err := createClientConfig(host, port, user, password)
+	if err != nil {
+		return nil, ConfigErr{err: err}
+	}
+	config.Tuning = tuning
+	config.readOnly = true
+
+	plan := &Plan{}
+	address := knownHostsAddress(config)
+	for _, knownHostsPath := range knownHostsFiles() {
+		if hasKnownHost(knownHostsPath, address) {
+			plan.local(fmt.Sprintf("Remove the host key of %s from %s", address, knownHostsPath), nil)
+		}
+	}
+
+	if password == nil {
+		plan.append(clientConfigPlan(config, false, IsWSL()))
+		return plan, nil
+	}
+
+	client, err := connectSSHClient(config)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	plan.local(fmt.Sprintf("Record the host key of %s in %s", address, bitriseKnownHostsPath()), nil)
+
+	envMap, err := runWithPty(client, &[]string{sourceDirEnvVar, osTypeEnvVar, buildSlugEnvVar, revisionEnvVar, revisionEnvVarUbuntu}, "echo $", true)
+	if err != nil {
+		return nil, err
+	}
+	osType, sourceDir := envMap[osTypeEnvVar], envMap[sourceDirEnvVar]
+	revision := envMap[revisionEnvVar]
+	if revision == "" {
+		revision = envMap[revisionEnvVarUbuntu]
+	}
+
+	useIdentityKey := isMacOS(osType) && allowKeyAuth
+	if useIdentityKey {
+		config.IdentityFile = sessionKeyPath(envMap[buildSlugEnvVar])
+
+		stale, err := staleLocalKeys(config.IdentityFile, time.Now())
+		if err != nil {
+			logger.Warnf("list SSH keys of earlier sessions: %s", err)
+		}
+		for _, keyPath := range stale {
+			plan.local(fmt.Sprintf("Remove the SSH key of an earlier session: %s", keyPath), nil)
+		}
+	}
+
+	// The Windows mirror is confirmed during the setup, it is listed as optional
+	plan.append(clientConfigPlan(config, useIdentityKey, IsWSL()))
+
+	// Only the resources that are not in place yet would be changed
+	setup := remoteSetup{osType: osType, sourceDir: sourceDir, revision: revision}
+	if useIdentityKey {
+		setup.identityFile = config.IdentityFile
+	}
+	for _, resource := range remoteResources(client, setup) {
+		if done, err := resource.check(client); err != nil || !done {
+			plan.remote(resource.description(), nil)
+		}
+	}
+
+	return plan, nil
+}
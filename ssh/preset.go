@@ -0,0 +1,47 @@
+package ssh
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Preset is a set of forwards and remote environment variables for attaching local tools to a dev server on the VM.
+type Preset struct {
+	Name        string
+	Description string
+	// LocalForwards reach the servers on the VM from the local machine
+	LocalForwards []string
+	// RemoteForwards reach the local tools from the app on the VM
+	RemoteForwards []string
+	// Env is exported in the shells of the VM
+	Env map[string]string
+}
+
+var presets = map[string]Preset{
+	"flutter": {
+		Name:          "flutter",
+		Description:   "Run the app with `flutter run --vm-service-port 8181 --disable-service-auth-codes` and attach DevTools to http://127.0.0.1:8181",
+		LocalForwards: []string{"8181", "9100"},
+	},
+	"metro": {
+		Name:           "metro",
+		Description:    "Metro is reachable on localhost:8081 and the app on the VM connects to the React DevTools running locally on 8097",
+		LocalForwards:  []string{"8081"},
+		RemoteForwards: []string{"8097"},
+		Env: map[string]string{
+			"RCT_METRO_PORT":                 "8081",
+			"REACT_NATIVE_PACKAGER_HOSTNAME": "localhost",
+		},
+	},
+}
+
+// FindPreset returns the preset of the name.
+func FindPreset(name string) (Preset, error) {
+	preset, found := presets[strings.ToLower(strings.TrimSpace(name))]
+	if !found {
+		return Preset{}, fmt.Errorf("unknown preset %q, available: %s", name, strings.Join(slices.Sorted(maps.Keys(presets)), ", "))
+	}
+	return preset, nil
+}
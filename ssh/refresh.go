@@ -0,0 +1,96 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+)
+
+// ErrPasswordRejected means the VM of the last session didn't accept the password, eg. the build restarted the
+// remote access step, which sets a new one.
+var ErrPasswordRejected = errors.New("the VM rejected the SSH password, it changes when the build restarts the remote access step")
+
+// RefreshCredentials updates the last session to the new connection parameters of its VM without setting it up
+// again. Empty parameters are kept. The host entry is rewritten if the address changed, the session key is
+// authorized again if the VM lost it, and the connection is verified with the new password.
+func RefreshCredentials(host, port, user string, password *string) error {
+	entry, err := readSSHClientConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ConfigErr{err: fmt.Errorf("no session found, connect to the build first")}
+		}
+		return fmt.Errorf("read SSH config entry: %w", err)
+	}
+	entry.KnownHostsFile = bitriseKnownHostsPath()
+
+	useIdentityKey := entry.IdentityFile != ""
+	if _, err := os.Stat(entry.IdentityFile); useIdentityKey && err != nil {
+		return ConfigErr{err: fmt.Errorf("the session key %s is gone, connect to the build again", entry.IdentityFile)}
+	}
+
+	moved := (host != "" && host != entry.HostName) || (port != "" && port != entry.Port) || (user != "" && user != entry.User)
+	if moved {
+		// The host key of the old address is of no use
+		if err := removeHostKey(entry); err != nil {
+			return fmt.Errorf("remove previous host key: %w", err)
+		}
+		entry.HostName = valueOr(host, entry.HostName)
+		entry.Port = valueOr(port, entry.Port)
+		entry.User = valueOr(user, entry.User)
+	}
+
+	progress.Start(StageRefresh, i18n.T("Connecting with the new credentials..."))
+	// Only the password is tried, so a rejected one isn't hidden by the key
+	passwordEntry := *entry
+	passwordEntry.IdentityFile = ""
+	passwordEntry.Password = password
+	client, err := connectSSHClient(&passwordEntry)
+	if err != nil {
+		progress.Fail(StageRefresh, "connect with the new credentials", err)
+		return err
+	}
+	defer client.Close()
+	progress.Succeed(StageRefresh, i18n.T("Connected with the new credentials"))
+
+	if useIdentityKey {
+		keyResource := authorizedKeyResource{keyPath: entry.IdentityFile}
+		if authorized, err := keyResource.check(client); err != nil || !authorized {
+			progress.Start(StageRefresh, i18n.T("Authorizing the session key again..."))
+			if err := keyResource.apply(client); err != nil {
+				progress.Fail(StageRefresh, "authorize the session key", err)
+				return fmt.Errorf("authorize the session key: %w", err)
+			}
+			progress.Succeed(StageRefresh, i18n.T("Session key authorized"))
+		}
+	}
+
+	if moved {
+		localForwards, remoteForwards = entry.LocalForwards, entry.RemoteForwards
+		if err := setupClientConfig(entry, useIdentityKey, IsWSL() && hasWindowsMirror()); err != nil {
+			return fmt.Errorf("update SSH config: %w", err)
+		}
+	}
+
+	if useIdentityKey {
+		// The editors connect with the key, so it has to work on its own
+		progress.Start(StageRefresh, i18n.T("Verifying the session key..."))
+		keyClient, err := connectSSHClient(entry)
+		if err != nil {
+			progress.Fail(StageRefresh, "connect with the session key", err)
+			return fmt.Errorf("connect with the session key: %w", err)
+		}
+		keyClient.Close()
+		progress.Succeed(StageRefresh, i18n.T("Session key accepted"))
+	}
+	return nil
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
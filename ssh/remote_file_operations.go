@@ -18,10 +18,33 @@ type copyItem struct {
 	Replace     *map[string]string
 	Append      bool
 	NoDuplicate bool
+	// Mode is set on the file after writing, the remote umask decides if it's zero
+	Mode os.FileMode
 }
 
 var ErrRemoteFileExists = errors.New("remote file already exists")
 
+// content returns the content to write with the placeholders replaced.
+func (item *copyItem) content() string {
+	content := item.Content
+	if item.Replace != nil {
+		for key, value := range *item.Replace {
+			content = strings.ReplaceAll(content, key, value)
+		}
+	}
+	return content
+}
+
+// isUpToDate compares the hash of the remote file with the content it would be written with,
+// for items replacing the whole file. Appended items are checked by their content, as the rest of the file is not known.
+func (item *copyItem) isUpToDate(client *cryptoSSH.Client, sftpClient *sftp.Client, written string) bool {
+	state, err := remoteFileState(client, item.RemotePath, written)
+	if (err != nil || state == fileUnknown) && sftpClient != nil {
+		state, err = remoteFileStateSFTP(sftpClient, item.RemotePath, written)
+	}
+	return err == nil && state == fileUnchanged
+}
+
 func copyItemSFTP(client *cryptoSSH.Client, item *copyItem) error {
 	sftpClient, err := sftp.NewClient(client)
 	if err != nil {
@@ -29,6 +52,11 @@ func copyItemSFTP(client *cryptoSSH.Client, item *copyItem) error {
 	}
 	defer sftpClient.Close()
 
+	replacesFile := item.NoDuplicate && !item.Append
+	if replacesFile && item.isUpToDate(client, sftpClient, item.content()) {
+		return ErrRemoteFileExists
+	}
+
 	if err := sftpClient.MkdirAll(filepath.Dir(item.RemotePath)); err != nil {
 		return fmt.Errorf("create remote directories: %w", err)
 	}
@@ -36,6 +64,8 @@ func copyItemSFTP(client *cryptoSSH.Client, item *copyItem) error {
 	flags := os.O_RDWR | os.O_CREATE
 	if item.Append {
 		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
 	}
 
 	dstFile, err := sftpClient.OpenFile(item.RemotePath, flags)
@@ -44,15 +74,9 @@ func copyItemSFTP(client *cryptoSSH.Client, item *copyItem) error {
 	}
 	defer dstFile.Close()
 
-	// Replace placeholders in content
-	modifiedContent := item.Content
-	if item.Replace != nil {
-		for key, value := range *item.Replace {
-			modifiedContent = strings.ReplaceAll(modifiedContent, key, value)
-		}
-	}
+	modifiedContent := item.content()
 
-	if item.NoDuplicate {
+	if item.NoDuplicate && item.Append {
 		content, err := io.ReadAll(dstFile)
 		if err != nil {
 			return fmt.Errorf("read destination file: %w", err)
@@ -65,14 +89,26 @@ func copyItemSFTP(client *cryptoSSH.Client, item *copyItem) error {
 		}
 	}
 
-	if _, err := dstFile.Write([]byte(modifiedContent)); err != nil {
+	if _, err := streamCopy(dstFile, strings.NewReader(modifiedContent), item.RemotePath, 0, int64(len(modifiedContent))); err != nil {
 		return fmt.Errorf("write destination file: %w", err)
 	}
 
+	if item.Mode != 0 {
+		if err := sftpClient.Chmod(item.RemotePath, item.Mode); err != nil {
+			return fmt.Errorf("set file mode: %w", err)
+		}
+	}
+
 	return nil
 }
 
 func copyItemSSH(client *cryptoSSH.Client, item *copyItem) error {
+	// Every line is written with echo, so the file ends up with a newline after each
+	written := item.content() + "\n"
+	if item.NoDuplicate && !item.Append && item.isUpToDate(client, nil, written) {
+		return ErrRemoteFileExists
+	}
+
 	// check if file exists
 	var exists bool
 	cmd := fmt.Sprintf("if [ -f %q ]; then echo exists; else echo missing; fi", item.RemotePath)
@@ -88,15 +124,9 @@ func copyItemSSH(client *cryptoSSH.Client, item *copyItem) error {
 		return fmt.Errorf("create remote directories: %w", err)
 	}
 
-	// Replace placeholders in content
-	modifiedContent := item.Content
-	if item.Replace != nil {
-		for key, value := range *item.Replace {
-			modifiedContent = strings.ReplaceAll(modifiedContent, key, value)
-		}
-	}
+	modifiedContent := item.content()
 
-	if item.NoDuplicate && exists {
+	if item.NoDuplicate && item.Append && exists {
 		cmd := fmt.Sprintf(`cat %q | tr '\n' ' '`, item.RemotePath)
 		contentResult, err := runWithPty(client, &[]string{cmd}, "", false)
 		if err != nil {
@@ -121,6 +151,9 @@ func copyItemSSH(client *cryptoSSH.Client, item *copyItem) error {
 		}
 		cmds = append(cmds, "echo '"+line+"'"+operator+item.RemotePath)
 	}
+	if item.Mode != 0 {
+		cmds = append(cmds, fmt.Sprintf("chmod %o %q", item.Mode, item.RemotePath))
+	}
 
 	if _, err := runWithPty(client, &cmds, "", false); err != nil {
 		return fmt.Errorf("write to remote file: %w", err)
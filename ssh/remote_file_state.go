@@ -0,0 +1,80 @@
+package ssh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// fileState is the state of a remote file compared to the content it should have.
+type fileState int
+
+const (
+	fileMissing fileState = iota
+	fileChanged
+	fileUnchanged
+	// fileUnknown is returned when the remote can't hash the file, eg. neither sha256sum nor shasum is installed
+	fileUnknown
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// remoteFileState hashes the remote file on the remote, so only the hash is transferred instead of the content.
+// sha256sum is available on Linux stacks, shasum on macOS ones.
+func remoteFileState(client *cryptoSSH.Client, remotePath, content string) (fileState, error) {
+	cmd := remoteHashCommand(remotePath)
+	result, err := runWithPty(client, &[]string{cmd}, "", true)
+	if err != nil {
+		return fileUnknown, fmt.Errorf("hash remote file: %w", err)
+	}
+
+	remoteHash := strings.TrimSpace(result[cmd])
+	switch {
+	case remoteHash == "missing":
+		return fileMissing, nil
+	case !sha256Pattern.MatchString(remoteHash):
+		return fileUnknown, nil
+	case remoteHash == contentHash(content):
+		return fileUnchanged, nil
+	default:
+		return fileChanged, nil
+	}
+}
+
+// remoteHashCommand prints the SHA-256 of the file, or missing if it doesn't exist.
+func remoteHashCommand(remotePath string) string {
+	return fmt.Sprintf(`if [ -f %q ]; then (sha256sum %q 2>/dev/null || shasum -a 256 %q 2>/dev/null) | cut -d ' ' -f 1; else echo missing; fi`, remotePath, remotePath, remotePath)
+}
+
+// remoteFileStateSFTP is the fallback of remoteFileState, it reads the file to hash it locally.
+func remoteFileStateSFTP(sftpClient *sftp.Client, remotePath, content string) (fileState, error) {
+	file, err := sftpClient.Open(remotePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fileMissing, nil
+		}
+		return fileUnknown, fmt.Errorf("open remote file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return fileUnknown, fmt.Errorf("read remote file: %w", err)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) == contentHash(content) {
+		return fileUnchanged, nil
+	}
+	return fileChanged, nil
+}
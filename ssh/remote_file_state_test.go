@@ -0,0 +1,169 @@
+package ssh
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// withoutHashTools returns the environment of a remote without sha256sum and shasum.
+func withoutHashTools(t *testing.T) map[string]string {
+	t.Helper()
+	bin := t.TempDir()
+	for _, program := range []string{"awk", "cut"} {
+		path, err := exec.LookPath(program)
+		if err != nil {
+			t.Skipf("%s is not installed", program)
+		}
+		if err := os.Symlink(path, filepath.Join(bin, program)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return map[string]string{"PATH": bin}
+}
+
+func TestRemoteFileState(t *testing.T) {
+	existing := "export A=1\n"
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		existing *string
+		content  string
+		want     fileState
+		wantSFTP fileState
+	}{
+		{name: "missing", content: existing, want: fileMissing, wantSFTP: fileMissing},
+		{name: "unchanged", existing: &existing, content: existing, want: fileUnchanged, wantSFTP: fileUnchanged},
+		{name: "changed", existing: &existing, content: "export A=2\n", want: fileChanged, wantSFTP: fileChanged},
+		{name: "no hash tool", env: withoutHashTools(t), existing: &existing, content: existing, want: fileUnknown, wantSFTP: fileUnchanged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every server has its own host key
+			useTempDirs(t)
+			server := newTestServer(t, tt.env)
+			server.use(t)
+			remotePath := server.path("profile")
+			if tt.existing != nil {
+				if err := os.WriteFile(remotePath, []byte(*tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			client, err := connectSSHClient(server.entry())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			state, err := remoteFileState(client, remotePath, tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != tt.want {
+				t.Errorf("remoteFileState() = %d, want %d", state, tt.want)
+			}
+
+			sftpClient, err := sftp.NewClient(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sftpClient.Close()
+			state, err = remoteFileStateSFTP(sftpClient, remotePath, tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != tt.wantSFTP {
+				t.Errorf("remoteFileStateSFTP() = %d, want %d", state, tt.wantSFTP)
+			}
+		})
+	}
+}
+
+func TestCopyItemSkipsUpToDateFile(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		copy func(*cryptoSSH.Client, *copyItem) error
+	}{
+		{name: "SFTP", copy: copyItemSFTP},
+		{name: "SFTP without hash tool", env: withoutHashTools(t), copy: copyItemSFTP},
+		{name: "SSH", copy: copyItemSSH},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every server has its own host key
+			useTempDirs(t)
+			server := newTestServer(t, tt.env)
+			server.use(t)
+			client, err := connectSSHClient(server.entry())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			item := &copyItem{
+				Content:     "export BUILD=placeholder",
+				RemotePath:  server.path("env/profile"),
+				Replace:     &map[string]string{"placeholder": "build-slug"},
+				NoDuplicate: true,
+			}
+
+			if err := tt.copy(client, item); err != nil {
+				t.Fatalf("first copy: %s", err)
+			}
+			if err := tt.copy(client, item); !errors.Is(err, ErrRemoteFileExists) {
+				t.Errorf("copy of an unchanged file = %v, want %s", err, ErrRemoteFileExists)
+			}
+
+			item.Replace = &map[string]string{"placeholder": "other-build"}
+			if err := tt.copy(client, item); err != nil {
+				t.Fatalf("copy of a changed file: %s", err)
+			}
+			content, err := os.ReadFile(item.RemotePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(content); got != "export BUILD=other-build" && got != "export BUILD=other-build\n" {
+				t.Errorf("remote file = %q, want the new content", got)
+			}
+		})
+	}
+}
+
+func TestCopyItemAppendsOnce(t *testing.T) {
+	useTempDirs(t)
+	server := newTestServer(t, nil)
+	server.use(t)
+
+	existing := "# the user's profile\n"
+	remotePath := server.path(".zshrc")
+	if err := os.WriteFile(remotePath, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	item := &copyItem{Content: "source ~/.bitrise_profile\n", RemotePath: remotePath, Append: true, NoDuplicate: true}
+
+	client, err := connectSSHClient(server.entry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := copyItemSFTP(client, item); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyItemSFTP(client, item); !errors.Is(err, ErrRemoteFileExists) {
+		t.Errorf("second append = %v, want %s", err, ErrRemoteFileExists)
+	}
+	content, err := os.ReadFile(remotePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := existing + item.Content; string(content) != want {
+		t.Errorf("remote file = %q, want %q", content, want)
+	}
+}
@@ -0,0 +1,48 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/pkg/sftp"
+)
+
+const (
+	sshDirMode         os.FileMode = 0700
+	authorizedKeysMode os.FileMode = 0600
+	readmeMode         os.FileMode = 0644
+)
+
+// ensureStrictModes fixes the permissions sshd requires with StrictModes (the default): public key auth is
+// refused if ~/.ssh or authorized_keys is writable by others. A writable home directory is only reported,
+// changing it could break the build.
+func ensureStrictModes(sftpClient *sftp.Client) error {
+	if info, err := sftpClient.Stat("."); err == nil && info.Mode().Perm()&0022 != 0 {
+		logger.Warnf("The remote home directory is writable by others (%s), sshd may refuse the SSH key", info.Mode().Perm())
+	}
+
+	for _, item := range []struct {
+		path string
+		mode os.FileMode
+	}{
+		{path.Dir(authorizedKeysPath), sshDirMode},
+		{authorizedKeysPath, authorizedKeysMode},
+	} {
+		info, err := sftpClient.Stat(item.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", item.path, err)
+		}
+		if info.Mode().Perm()&^item.mode == 0 {
+			continue
+		}
+		if err := sftpClient.Chmod(item.path, item.mode); err != nil {
+			return fmt.Errorf("chmod %s: %w", item.path, err)
+		}
+	}
+	return nil
+}
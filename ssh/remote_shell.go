@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const fishConfigPath = "~/.config/fish/config.fish"
+
+// nonPOSIXShells can't run the probing commands, eg. fish has no `if ...; then ...; fi`
+var nonPOSIXShells = []string{"fish", "csh", "tcsh", "nu", "xonsh", "elvish"}
+
+// remoteShells caches the login shell of every connection
+var remoteShells sync.Map
+
+// remoteShell returns the name of the user's login shell on the remote, eg. zsh.
+// $SHELL is printed the same way by every common shell, so the detection itself is shell agnostic.
+func remoteShell(client *cryptoSSH.Client) string {
+	if shell, ok := remoteShells.Load(client); ok {
+		return shell.(string)
+	}
+
+	shell := ""
+	if session, err := createSSHSession(client); err == nil {
+		if out, err := session.Output("echo $SHELL"); err == nil {
+			shell = path.Base(strings.TrimSpace(string(out)))
+		}
+		session.Close()
+	}
+
+	remoteShells.Store(client, shell)
+	return shell
+}
+
+// isPOSIXShell reports whether the login shell understands sh syntax, unknown shells are assumed to.
+func isPOSIXShell(shell string) bool {
+	return !slices.Contains(nonPOSIXShells, shell)
+}
+
+// posixCommand wraps the command with sh if the login shell of the remote would misread it.
+// Commands of exec requests are run by the login shell, so they can't bypass it otherwise.
+func posixCommand(client *cryptoSSH.Client, cmd string) string {
+	if isPOSIXShell(remoteShell(client)) {
+		return cmd
+	}
+	return "/bin/sh -c " + shellQuote(cmd)
+}
+
+// shellQuote single quotes the value for sh, the quotes inside are closed, escaped and reopened.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// shellConfigsFor returns the rc files the message of the day is added to.
+func shellConfigsFor(shell string) []string {
+	if shell == "fish" {
+		return append(slices.Clone(motdShellConfigs), fishConfigPath)
+	}
+	return motdShellConfigs
+}
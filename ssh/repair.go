@@ -0,0 +1,125 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// Repair compares the state left behind by the last setup with the expected one and reapplies the missing pieces,
+// eg. when the setup was interrupted after removing the host key but before writing the config.
+// The password is only needed if the session key is gone. With dryRun the drift is only reported.
+func Repair(password *string, dryRun bool) error {
+	configEntry, err := readSSHClientConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ConfigErr{err: fmt.Errorf("no session to repair, connect to the build first")}
+		}
+		return fmt.Errorf("read SSH config entry: %w", err)
+	}
+	configEntry.Password = password
+	configEntry.KnownHostsFile = bitriseKnownHostsPath()
+
+	plan := &Plan{}
+
+	if !isClientConfigIncluded(sshConfigPath(), bitriseConfigPath()) && !configFileOverridden() {
+		plan.local(fmt.Sprintf("Include %s in %s", bitriseConfigPath(), sshConfigPath()), func() error {
+			return ensureClientConfigIncluded(sshConfigPath(), bitriseConfigPath())
+		})
+	}
+
+	// A missing session key can't be used to connect, the password is needed instead
+	connectEntry := *configEntry
+	keyMissing := false
+	if configEntry.IdentityFile != "" {
+		if _, err := os.Stat(configEntry.IdentityFile); os.IsNotExist(err) {
+			keyMissing = true
+			connectEntry.IdentityFile = ""
+		}
+	}
+	if keyMissing && password == nil {
+		return ConfigErr{err: fmt.Errorf("the session key is gone, the password is needed to repair the setup")}
+	}
+
+	address := knownHostsAddress(configEntry)
+	if !hasKnownHost(bitriseKnownHostsPath(), address) {
+		plan.local(fmt.Sprintf("Record the host key of %s in %s", address, bitriseKnownHostsPath()), func() error {
+			// Connecting records the host key
+			client, err := connectSSHClient(&connectEntry)
+			if err != nil {
+				return err
+			}
+			return client.Close()
+		})
+	}
+
+	// The remote is inspected without recording anything
+	inspectEntry := connectEntry
+	inspectEntry.readOnly = true
+
+	logger.Info("Inspecting remote host...")
+	client, err := connectSSHClient(&inspectEntry)
+	if err != nil {
+		return fmt.Errorf("connect to remote host: %w", err)
+	}
+	defer client.Close()
+
+	envMap, err := runWithPty(client, &[]string{sourceDirEnvVar, osTypeEnvVar, revisionEnvVar, revisionEnvVarUbuntu}, "echo $", true)
+	if err != nil {
+		return fmt.Errorf("detect remote environment: %w", err)
+	}
+	osType, sourceDir := envMap[osTypeEnvVar], envMap[sourceDirEnvVar]
+	revision := envMap[revisionEnvVar]
+	if revision == "" {
+		revision = envMap[revisionEnvVarUbuntu]
+	}
+
+	setup := remoteSetup{osType: osType, sourceDir: sourceDir, revision: revision, identityFile: configEntry.IdentityFile}
+	for _, resource := range remoteResources(client, setup) {
+		done, err := resource.check(client)
+		if err != nil {
+			logger.Warnf("check %s: %s", resource.description(), err)
+		}
+		if !done {
+			plan.remote(resource.description(), func() error { return resource.apply(client) })
+		}
+	}
+
+	if len(plan.Steps) == 0 {
+		logger.Success("Nothing to repair, the setup is complete")
+		return nil
+	}
+
+	logger.PrintFormattedOutput("Missing pieces of the setup", plan.String())
+	if dryRun {
+		return nil
+	}
+	return plan.execute(StageRepair)
+}
+
+// isKeyAuthorized reports whether the public key of the keypair is in the remote authorized_keys.
+func isKeyAuthorized(client *cryptoSSH.Client, keyPath string) (bool, error) {
+	pubKey, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return false, fmt.Errorf("read public key: %w", err)
+	}
+
+	content, err := readRemoteFile(client, authorizedKeysPath)
+	if err != nil {
+		return false, err
+	}
+	return hasAuthorizedKey(content, string(pubKey)), nil
+}
+
+// remoteCheck reports whether the shell condition holds on the remote.
+func remoteCheck(client *cryptoSSH.Client, condition string) bool {
+	cmd := fmt.Sprintf("if %s; then echo yes; else echo no; fi", condition)
+	result, err := runWithPty(client, &[]string{cmd}, "", true)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(result[cmd]) == "yes"
+}
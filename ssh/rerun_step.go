@@ -0,0 +1,190 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	rerunWorkflow   = "bitrise-remote-access-rerun"
+	rerunConfigPath = "/tmp/bitrise-remote-access-rerun.yml"
+)
+
+// RerunStep runs a step of the build's workflow again on the VM of the last session, with the inputs of the
+// bitrise.yml and the environment of the build. The step is the ID of the step, eg. xcode-test, with or without
+// its version, or its title. The output of the step is written to output.
+func RerunStep(step string, output io.Writer, password *string) error {
+	return withClient(password, func(client *cryptoSSH.Client) error {
+		build, err := readBuildContext(client)
+		if err != nil {
+			return err
+		}
+		configPath, err := findBitriseYML(client, build)
+		if err != nil {
+			return err
+		}
+		config, err := readBitriseYML(client, configPath)
+		if err != nil {
+			return err
+		}
+
+		rerunConfig, err := stepRerunConfig(config, build.Workflow, step)
+		if err != nil {
+			return err
+		}
+		content, err := yaml.Marshal(rerunConfig)
+		if err != nil {
+			return fmt.Errorf("encode step config: %w", err)
+		}
+		if err := updateRemoteFile(client, rerunConfigPath, func(string) string { return string(content) }); err != nil {
+			return fmt.Errorf("write step config: %w", err)
+		}
+		defer removeRerunConfig(client)
+
+		command := fmt.Sprintf("bitrise run %s --config %s", rerunWorkflow, rerunConfigPath)
+		if build.SourceDir != "" {
+			command = fmt.Sprintf("cd %s && %s", shellQuote(build.SourceDir), command)
+		}
+		return runInLoginShell(client, command, output)
+	})
+}
+
+// stepRerunConfig returns a copy of the config with a single workflow running the step. The app envs and the
+// step libraries are kept, the envs of the workflow the step was found in are added to the new workflow.
+func stepRerunConfig(config map[string]any, workflow, step string) (map[string]any, error) {
+	workflows, _ := config["workflows"].(map[string]any)
+	if len(workflows) == 0 {
+		return nil, fmt.Errorf("no workflows in bitrise.yml")
+	}
+
+	var order []string
+	if workflow != "" {
+		order = append(order, workflow)
+	}
+	order = append(order, slices.Sorted(maps.Keys(workflows))...)
+
+	for _, name := range order {
+		entry, envs, ok := findStep(workflows, name, step, map[string]bool{})
+		if !ok {
+			continue
+		}
+
+		rerun := map[string]any{"steps": []any{entry}}
+		if envs != nil {
+			rerun["envs"] = envs
+		}
+		copied := make(map[string]any, len(config))
+		for key, value := range config {
+			copied[key] = value
+		}
+		copied["workflows"] = map[string]any{rerunWorkflow: rerun}
+		delete(copied, "pipelines")
+		delete(copied, "stages")
+		delete(copied, "trigger_map")
+		return copied, nil
+	}
+	return nil, fmt.Errorf("step %q not found in the workflows of bitrise.yml", step)
+}
+
+// findStep looks for the step in the workflow and the workflows it runs before and after itself. The step list
+// entry is returned with the envs of the workflow it belongs to.
+func findStep(workflows map[string]any, workflow, step string, visited map[string]bool) (any, any, bool) {
+	if visited[workflow] {
+		return nil, nil, false
+	}
+	visited[workflow] = true
+
+	definition, _ := workflows[workflow].(map[string]any)
+	if definition == nil {
+		return nil, nil, false
+	}
+
+	chained := func(key string) []string {
+		var names []string
+		list, _ := definition[key].([]any)
+		for _, item := range list {
+			if name, ok := item.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+
+	for _, name := range chained("before_run") {
+		if entry, envs, ok := findStep(workflows, name, step, visited); ok {
+			return entry, envs, true
+		}
+	}
+
+	steps, _ := definition["steps"].([]any)
+	for _, entry := range steps {
+		item, _ := entry.(map[string]any)
+		for id, stepDefinition := range item {
+			if stepMatches(id, stepDefinition, step) {
+				return entry, definition["envs"], true
+			}
+		}
+	}
+
+	for _, name := range chained("after_run") {
+		if entry, envs, ok := findStep(workflows, name, step, visited); ok {
+			return entry, envs, true
+		}
+	}
+	return nil, nil, false
+}
+
+// stepMatches compares the step list key, eg. xcode-test@5 or git::https://github.com/org/step.git@main,
+// and the title of the step with the step the user asked for.
+func stepMatches(id string, definition any, step string) bool {
+	if id == step {
+		return true
+	}
+	name := id
+	if _, ref, ok := strings.Cut(name, "::"); ok {
+		name = ref
+	}
+	name, _, _ = strings.Cut(name, "@")
+	if name == step || strings.TrimSuffix(name[strings.LastIndex(name, "/")+1:], ".git") == step {
+		return true
+	}
+
+	fields, _ := definition.(map[string]any)
+	title, _ := fields["title"].(string)
+	return title != "" && strings.EqualFold(title, step)
+}
+
+// runInLoginShell runs the command in a login shell with a pseudo terminal, so the build's environment is set
+// and the output keeps its colors. The session is closed when the command finishes.
+func runInLoginShell(client *cryptoSSH.Client, command string, output io.Writer) error {
+	session, err := createSSHSession(client)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if err := session.RequestPty("xterm-256color", 40, 120, cryptoSSH.TerminalModes{}); err != nil {
+		return fmt.Errorf("request pty: %w", err)
+	}
+	session.Stdout = output
+	session.Stderr = output
+
+	if err := session.Run(posixCommand(client, `exec "$SHELL" -l -c `+shellQuote(command))); err != nil {
+		return fmt.Errorf("run %q: %w", command, err)
+	}
+	return nil
+}
+
+// removeRerunConfig deletes the config written by RerunStep.
+func removeRerunConfig(client *cryptoSSH.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+	_ = runCommand(ctx, client, "rm -f "+rerunConfigPath)
+}
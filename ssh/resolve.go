@@ -0,0 +1,42 @@
+package ssh
+
+import (
+	"net"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+)
+
+const (
+	resolveAttempts       = 5
+	resolveInitialBackoff = time.Second
+)
+
+var skipDNSCheck bool
+
+// SetSkipDNSCheck turns off resolving the hostname before connecting, the dial reports the problem instead.
+func SetSkipDNSCheck(skip bool) {
+	skipDNSCheck = skip
+}
+
+// resolveHost retries the lookup with exponential backoff, as the DNS names of some
+// builds only resolve after a delay.
+func resolveHost(host string) error {
+	backoff := resolveInitialBackoff
+
+	var err error
+	for attempt := 1; attempt <= resolveAttempts; attempt++ {
+		if _, err = net.LookupHost(host); err == nil {
+			return nil
+		}
+		if attempt == resolveAttempts {
+			break
+		}
+
+		logger.Infof("Waiting for %s to resolve, retrying in %s...", host, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	return err
+}
@@ -0,0 +1,150 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// remoteResource is a piece of the remote setup that is checked, applied and removed on its own, so the setup,
+// the dry run, repair and disconnect share a single definition of it. New provisioning items only need a
+// resource and a place in remoteResources.
+type remoteResource interface {
+	description() string
+	// check reports whether the resource is in place and up to date
+	check(client *cryptoSSH.Client) (bool, error)
+	// apply puts the resource in place, applying one that is in place changes nothing
+	apply(client *cryptoSSH.Client) error
+	remove(client *cryptoSSH.Client) error
+}
+
+// remoteSetup is what the resources of a VM depend on.
+type remoteSetup struct {
+	osType    string
+	sourceDir string
+	revision  string
+	stepLog   string
+	// identityFile is the session key authorized on the VM, empty if the password is used
+	identityFile string
+}
+
+// remoteResources returns the resources of the setup in the order they are applied. Disconnect removes the key
+// and the shell blocks, the README stays as part of the source directory.
+func remoteResources(client *cryptoSSH.Client, setup remoteSetup) []remoteResource {
+	var resources []remoteResource
+	switch {
+	case isMacOS(setup.osType):
+		if setup.identityFile != "" {
+			resources = append(resources, authorizedKeyResource{keyPath: setup.identityFile})
+		}
+		for _, shellConfig := range shellConfigsFor(remoteShell(client)) {
+			resources = append(resources, shellBlockResource{path: shellConfig})
+		}
+		resources = append(resources, readmeResource{item: readmeCopyItem(setup.sourceDir, setup.revision, setup.stepLog), sftp: true})
+	case isLinux(setup.osType):
+		// The key and the shell configs are left alone on Linux stacks, see setupRemoteConfig
+		sourceDir := setup.sourceDir
+		if sourceDir == "" {
+			sourceDir = "/bitrise/src"
+		}
+		resources = append(resources, readmeResource{item: readmeCopyItem(sourceDir, setup.revision, setup.stepLog)})
+	}
+	return resources
+}
+
+// authorizedKeyResource is the public key of the session key in the remote authorized_keys.
+type authorizedKeyResource struct {
+	keyPath string
+}
+
+func (r authorizedKeyResource) description() string {
+	if _, err := os.Stat(r.keyPath); os.IsNotExist(err) {
+		return fmt.Sprintf("Generate an SSH key at %s and append it to ~/%s", r.keyPath, authorizedKeysPath)
+	}
+	return fmt.Sprintf("Append the public key to ~/%s", authorizedKeysPath)
+}
+
+func (r authorizedKeyResource) check(client *cryptoSSH.Client) (bool, error) {
+	if _, err := os.Stat(r.keyPath + ".pub"); os.IsNotExist(err) {
+		return false, nil
+	}
+	return isKeyAuthorized(client, r.keyPath)
+}
+
+func (r authorizedKeyResource) apply(client *cryptoSSH.Client) error {
+	err := ensureClientKeyOnRemote(client, r.keyPath)
+	if errors.Is(err, ErrRemoteFileExists) {
+		return nil
+	}
+	return err
+}
+
+func (r authorizedKeyResource) remove(client *cryptoSSH.Client) error {
+	return removeClientKeyFromRemote(client, r.keyPath)
+}
+
+// shellBlockResource is the managed block of a shell config, printing the message of the day and exporting
+// the environment of the presets.
+type shellBlockResource struct {
+	path string
+}
+
+func (r shellBlockResource) description() string {
+	return fmt.Sprintf("Add `%s` to %s", motdCommand, r.path)
+}
+
+func (r shellBlockResource) check(client *cryptoSSH.Client) (bool, error) {
+	content, err := readRemoteFile(client, r.path)
+	if err != nil {
+		return false, err
+	}
+	return hasManagedBlock(content) && setManagedBlock(content, shellBlockLines(r.path)) == content, nil
+}
+
+func (r shellBlockResource) apply(client *cryptoSSH.Client) error {
+	return addMotdToShellConfig(client, r.path)
+}
+
+func (r shellBlockResource) remove(client *cryptoSSH.Client) error {
+	if err := updateRemoteFile(client, r.path, removeManagedBlock); err != nil {
+		return fmt.Errorf("edit remote shell config '%s': %w", r.path, err)
+	}
+	return nil
+}
+
+// readmeResource is the README of the remote access session in the source directory.
+type readmeResource struct {
+	item *copyItem
+	// sftp writes the file over SFTP, the Linux stacks only support writing it with a command
+	sftp bool
+}
+
+func (r readmeResource) description() string {
+	return fmt.Sprintf("Write %s", r.item.RemotePath)
+}
+
+func (r readmeResource) check(client *cryptoSSH.Client) (bool, error) {
+	return remoteCheck(client, fmt.Sprintf("[ -f %s ]", shellQuote(r.item.RemotePath))), nil
+}
+
+func (r readmeResource) apply(client *cryptoSSH.Client) error {
+	var err error
+	if r.sftp {
+		err = copyItemSFTP(client, r.item)
+	} else {
+		err = copyItemSSH(client, r.item)
+	}
+	if errors.Is(err, ErrRemoteFileExists) {
+		return nil
+	}
+	return err
+}
+
+func (r readmeResource) remove(client *cryptoSSH.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+	return runCommand(ctx, client, "rm -f "+shellQuote(r.item.RemotePath))
+}
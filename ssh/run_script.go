@@ -0,0 +1,56 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const remoteScriptDir = "/tmp/bitrise-remote-access-scripts"
+
+// RunScript uploads the script to the VM of the last session and runs it with the args in the source directory,
+// in a login shell with the build's environment. The output of the script is written to output.
+func RunScript(name string, content []byte, args []string, output io.Writer, password *string) error {
+	return withClient(password, func(client *cryptoSSH.Client) error {
+		build, err := readBuildContext(client)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+		defer cancel()
+		if err := runCommand(ctx, client, "mkdir -p "+remoteScriptDir); err != nil {
+			return fmt.Errorf("create script directory: %w", err)
+		}
+
+		remotePath := path.Join(remoteScriptDir, name)
+		if err := updateRemoteFile(client, remotePath, func(string) string { return string(content) }); err != nil {
+			return fmt.Errorf("upload script: %w", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+			defer cancel()
+			_ = runCommand(ctx, client, "rm -f "+shellQuote(remotePath))
+		}()
+		if err := runCommand(ctx, client, "chmod +x "+shellQuote(remotePath)); err != nil {
+			return fmt.Errorf("make script executable: %w", err)
+		}
+
+		quoted := []string{shellQuote(remotePath)}
+		for _, arg := range args {
+			quoted = append(quoted, shellQuote(arg))
+		}
+		command := strings.Join(quoted, " ")
+		if build.SourceDir != "" {
+			command = fmt.Sprintf("cd %s && %s", shellQuote(build.SourceDir), command)
+		}
+		if err := runInLoginShell(client, command, output); err != nil {
+			return fmt.Errorf("run script %s: %w", name, err)
+		}
+		return nil
+	})
+}
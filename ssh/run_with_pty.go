@@ -2,16 +2,38 @@ package ssh
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	cryptoSSH "golang.org/x/crypto/ssh"
 )
 
+const (
+	// defaultCommandTimeout is how long a single command may run, eg. a prompt waiting for input never finishes
+	defaultCommandTimeout = 30 * time.Second
+	// defaultSessionTimeout is how long all the commands of a session may run together
+	defaultSessionTimeout = 2 * time.Minute
+)
+
+// ErrRemoteTimeout is returned when a remote command doesn't finish in time.
+var ErrRemoteTimeout = errors.New("remote command timed out")
+
 // runWithPty runs the given commands on the remote server using a pseudo terminal.
 // It takes an SSH client, a slice of commands, a command prefix, and a result map to store the output.
 // The function returns an error if any step fails.
 func runWithPty(client *cryptoSSH.Client, commands *[]string, commandPrefix string, getResults bool) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSessionTimeout)
+	defer cancel()
+	return runWithPtyContext(ctx, client, commands, commandPrefix, getResults, defaultCommandTimeout)
+}
+
+// runWithPtyContext is runWithPty with cancellation. The session is closed when the context is done or a command
+// runs longer than commandTimeout, the results of the finished commands are returned with the error.
+func runWithPtyContext(ctx context.Context, client *cryptoSSH.Client, commands *[]string, commandPrefix string, getResults bool, commandTimeout time.Duration) (map[string]string, error) {
 	session, err := createSSHSession(client)
 	if err != nil {
 		return nil, err
@@ -29,17 +51,23 @@ func runWithPty(client *cryptoSSH.Client, commands *[]string, commandPrefix stri
 		return nil, fmt.Errorf("get stdin pipe: %w", err)
 	}
 
+	// The outputs are read by the session from the start, so they are set before starting the shell
+	stdout := newPtyOutput()
+	var stderrBuf bytes.Buffer
+	session.Stdout = stdout
+	session.Stderr = &stderrBuf
+
 	// Start remote shell
 	if err := session.Shell(); err != nil {
 		return nil, fmt.Errorf("start shell: %w", err)
 	}
 
-	var stdoutBuf, stderrBuf bytes.Buffer
-	session.Stdout = &stdoutBuf
-	session.Stderr = &stderrBuf
-
 	// Commands will be given in a single string, separated by carriage return
 	var jointCommands strings.Builder
+	if !isPOSIXShell(remoteShell(client)) {
+		// The rest of the input is read by sh instead of the login shell
+		jointCommands.WriteString("exec /bin/sh\r")
+	}
 	for i, command := range *commands {
 		// Format the command to be able to extract the output later
 		// Output will be in the format (prefix not included): [command=output]
@@ -51,6 +79,8 @@ func runWithPty(client *cryptoSSH.Client, commands *[]string, commandPrefix stri
 		}
 		jointCommands.WriteString(commandPrefix)
 		jointCommands.WriteString(formattedCommand)
+		// The quotes keep the echoed input from matching the marker
+		jointCommands.WriteString(fmt.Sprintf("echo \"[do\"\"ne%d]\"\r", i))
 	}
 
 	// Session woould wait for the last command to finish, so we need to exit the shell
@@ -58,9 +88,28 @@ func runWithPty(client *cryptoSSH.Client, commands *[]string, commandPrefix stri
 		return nil, fmt.Errorf("send command: %w", err)
 	}
 
+	finished := make(chan struct{})
+	var timeoutErr error
+	var watcher sync.WaitGroup
+	watcher.Add(1)
+	go func() {
+		defer watcher.Done()
+		timeoutErr = watchCommands(ctx, stdout, *commands, commandTimeout, finished)
+		if timeoutErr != nil {
+			session.Close()
+		}
+	}()
+
 	// Wait till exit
-	if err := session.Wait(); err != nil {
-		return nil, fmt.Errorf("wait for session: %w", err)
+	waitErr := session.Wait()
+	close(finished)
+	watcher.Wait()
+
+	if timeoutErr != nil {
+		return extractResults(stdout.String(), *commands), timeoutErr
+	}
+	if waitErr != nil {
+		return nil, fmt.Errorf("wait for session: %w", waitErr)
 	}
 
 	// Check for errors
@@ -72,11 +121,76 @@ func runWithPty(client *cryptoSSH.Client, commands *[]string, commandPrefix stri
 		return nil, nil
 	}
 
+	return extractResults(stdout.String(), *commands), nil
+}
+
+// runCommand runs a single command without a pseudo terminal, closing the session when the context is done.
+func runCommand(ctx context.Context, client *cryptoSSH.Client, cmd string) error {
+	_, err := runCommandOutput(ctx, client, cmd)
+	return err
+}
+
+// runCommandOutput is runCommand returning the standard output, stderr is added to the error if the command fails.
+func runCommandOutput(ctx context.Context, client *cryptoSSH.Client, cmd string) (string, error) {
+	session, err := createSSHSession(client)
+	if err != nil {
+		return "", fmt.Errorf("create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	if err := session.Start(posixCommand(client, cmd)); err != nil {
+		return "", fmt.Errorf("start command: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil && stderr.Len() > 0 {
+			return stdout.String(), fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return stdout.String(), err
+	case <-ctx.Done():
+		session.Close()
+		return stdout.String(), fmt.Errorf("%q: %w: %w", cmd, ErrRemoteTimeout, ctx.Err())
+	}
+}
+
+// watchCommands follows the completion markers of the commands and reports the one that didn't finish in time.
+func watchCommands(ctx context.Context, stdout *ptyOutput, commands []string, commandTimeout time.Duration, finished <-chan struct{}) error {
+	next := 0
+	timer := time.NewTimer(commandTimeout)
+	defer timer.Stop()
+
+	for next < len(commands) {
+		select {
+		case <-finished:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("%q: %w: %w", commands[next], ErrRemoteTimeout, ctx.Err())
+		case <-timer.C:
+			return fmt.Errorf("%q did not finish in %s: %w", commands[next], commandTimeout, ErrRemoteTimeout)
+		case <-stdout.written:
+			output := stdout.String()
+			for next < len(commands) && strings.Contains(output, fmt.Sprintf("[done%d]", next)) {
+				next++
+				timer.Reset(commandTimeout)
+			}
+		}
+	}
+	return nil
+}
+
+// extractResults parses the [resultN=output] lines of the commands.
+func extractResults(output string, commands []string) map[string]string {
 	resultMap := make(map[string]string)
 
-	// Extract the output
-	output := stdoutBuf.String()
-	for i, command := range *commands {
+	for i, command := range commands {
 		prefix := fmt.Sprintf("[result%d=", i)
 		startIndex := strings.LastIndex(output, prefix)
 		if startIndex != -1 {
@@ -89,5 +203,34 @@ func runWithPty(client *cryptoSSH.Client, commands *[]string, commandPrefix stri
 		}
 	}
 
-	return resultMap, nil
+	return resultMap
+}
+
+// ptyOutput collects the output of the shell while it is being watched.
+type ptyOutput struct {
+	mu      sync.Mutex
+	buffer  bytes.Buffer
+	written chan struct{}
+}
+
+func newPtyOutput() *ptyOutput {
+	return &ptyOutput{written: make(chan struct{}, 1)}
+}
+
+func (o *ptyOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	n, err := o.buffer.Write(p)
+	o.mu.Unlock()
+
+	select {
+	case o.written <- struct{}{}:
+	default:
+	}
+	return n, err
+}
+
+func (o *ptyOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buffer.String()
 }
@@ -0,0 +1,49 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const screenshotRemotePath = "/tmp/bitrise-remote-access-screenshot.png"
+
+// Screenshot captures the desktop of the VM of the last session and downloads it to localPath, eg. to see the
+// system dialog a UI test is stuck behind. Only macOS stacks have a desktop.
+func Screenshot(localPath string, password *string) error {
+	return withSFTP(password, DefaultTransferConcurrency, func(client *cryptoSSH.Client, sftpClient *sftp.Client) error {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+		defer cancel()
+
+		if osName, _ := runCommandOutput(ctx, client, "uname -s"); strings.TrimSpace(osName) != "Darwin" {
+			return fmt.Errorf("screenshots need a macOS stack, the VM runs %s", strings.TrimSpace(osName))
+		}
+
+		// -x keeps the shutter sound off
+		if _, err := runCommandOutput(ctx, client, "screencapture -x "+shellQuote(screenshotRemotePath)); err != nil {
+			return fmt.Errorf("capture the screen, the remote user might lack the Screen Recording permission: %w", err)
+		}
+		defer sftpClient.Remove(screenshotRemotePath)
+
+		remote, err := sftpClient.Open(screenshotRemotePath)
+		if err != nil {
+			return fmt.Errorf("open screenshot: %w", err)
+		}
+		defer remote.Close()
+
+		local, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("create %s: %w", localPath, err)
+		}
+		if _, err := io.Copy(local, remote); err != nil {
+			local.Close()
+			return fmt.Errorf("download screenshot: %w", err)
+		}
+		return local.Close()
+	})
+}
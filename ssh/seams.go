@@ -0,0 +1,67 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"os/exec"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
+)
+
+// CommandRunner runs the local programs the setup depends on, eg. ssh-keygen. It's replaced to run the setup
+// without the programs, eg. with canned outputs.
+type CommandRunner interface {
+	LookPath(file string) (string, error)
+	// Output returns the standard output, CombinedOutput the standard output and error of the program
+	Output(name string, args ...string) ([]byte, error)
+	CombinedOutput(name string, args ...string) ([]byte, error)
+}
+
+// Transport opens the connections the SSH clients run on. It's replaced to connect to an SSH server in the same
+// process or through a different route.
+type Transport interface {
+	Dial(ctx context.Context, address string) (net.Conn, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func (execRunner) Output(name string, args ...string) ([]byte, error) {
+	return interrupt.Command(name, args...).Output()
+}
+
+func (execRunner) CombinedOutput(name string, args ...string) ([]byte, error) {
+	return interrupt.Command(name, args...).CombinedOutput()
+}
+
+// tcpTransport dials the VM directly, from the local address if one is set.
+type tcpTransport struct {
+	bindAddress string
+}
+
+func (t tcpTransport) Dial(ctx context.Context, address string) (net.Conn, error) {
+	dialer := net.Dialer{LocalAddr: localAddr(t.bindAddress)}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+var (
+	localCommands CommandRunner = execRunner{}
+	// transportOverride replaces the transport of the config entries when set
+	transportOverride Transport
+)
+
+// SetCommandRunner replaces how local programs are run, nil restores running them with os/exec.
+func SetCommandRunner(runner CommandRunner) {
+	if runner == nil {
+		runner = execRunner{}
+	}
+	localCommands = runner
+}
+
+// SetTransport replaces how the VM is connected to, nil restores the transport of the config entries.
+func SetTransport(transport Transport) {
+	transportOverride = transport
+}
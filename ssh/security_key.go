@@ -0,0 +1,78 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	securityKeyType = "ed25519-sk"
+	// securityKeyInfix tells the session keys on a security key apart from the plain ones of the same build
+	securityKeyInfix = "sk"
+)
+
+var (
+	// useSecurityKey makes the session keys FIDO2 keys, so every connection of the editors needs a touch
+	useSecurityKey bool
+	// securityKeyProvider is the FIDO middleware library of ssh, empty for the one built into OpenSSH
+	securityKeyProvider string
+)
+
+// errSecurityKeyUnusable means the CLI's own client can't sign with the session key, only ssh can talk to the
+// authenticator, unless ssh-agent holds the key.
+var errSecurityKeyUnusable = errors.New("the session key is on a security key, which only ssh and ssh-agent can use")
+
+// SetSecurityKey creates the session keys on a FIDO2 security key, eg. a YubiKey, with ssh-keygen -t ed25519-sk.
+// provider is the SecurityKeyProvider of ssh, eg. the middleware of an ssh without built-in FIDO support.
+func SetSecurityKey(enabled bool, provider string) {
+	useSecurityKey = enabled
+	securityKeyProvider = provider
+}
+
+// isSecurityKey reports whether the keypair at keyPath lives on a security key, its public key type is sk-*.
+func isSecurityKey(keyPath string) bool {
+	content, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(string(content), "sk-")
+}
+
+// generateSecurityKey creates the keypair on the security key, the private key file only holds the handle of it.
+// ssh-keygen reads the PIN from the terminal itself, if the authenticator needs one.
+func generateSecurityKey(keyPath string) error {
+	if _, err := localCommands.LookPath("ssh-keygen"); err != nil {
+		return fmt.Errorf("ssh-keygen is needed to create a key on the security key: %w", err)
+	}
+	// ssh-keygen would ask whether to overwrite a leftover half
+	_ = removeLocalKey(keyPath)
+
+	args := []string{"-t", securityKeyType, "-f", keyPath, "-C", sessionKeyComment(), "-N", ""}
+	if securityKeyProvider != "" {
+		args = append(args, "-w", securityKeyProvider)
+	}
+	logger.Info("Touch your security key to create the session key...")
+	out, err := localCommands.CombinedOutput("ssh-keygen", args...)
+	if err != nil {
+		return fmt.Errorf("ssh-keygen -t %s: %s: %s", securityKeyType, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// securityKeySigner returns the signer of ssh-agent for the key on the security key, the agent asks for the touch.
+func securityKeySigner(keyPath string) (cryptoSSH.Signer, error) {
+	content, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return nil, fmt.Errorf("read public key: %w", err)
+	}
+	publicKey, _, _, _, err := cryptoSSH.ParseAuthorizedKey(content)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	return agentSigner(publicKey)
+}
@@ -0,0 +1,248 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	sshKeyPrefix       = "id_bitrise_remote_access"
+	authorizedKeysPath = ".ssh/authorized_keys"
+	sshKeyComment      = "Bitrise remote access key"
+)
+
+// sessionKeyComment labels the session keys of this machine's user, so the keys authorized for earlier sessions
+// can be told apart from the teammates' ones in authorized_keys.
+func sessionKeyComment() string {
+	user := os.Getenv("USER")
+	if user == "" {
+		user = os.Getenv("USERNAME")
+	}
+	host, err := os.Hostname()
+	if user == "" || err != nil {
+		return sshKeyComment
+	}
+	return fmt.Sprintf("%s (%s@%s)", sshKeyComment, user, host)
+}
+
+// sessionKeyPath returns the local path of the keypair generated for the given build.
+// Every build gets its own key, so a leaked key is only usable until the build's VM is gone.
+func sessionKeyPath(buildSlug string) string {
+	keyName := sshKeyPrefix
+	if useSecurityKey {
+		keyName = fmt.Sprintf("%s_%s", keyName, securityKeyInfix)
+	}
+	if buildSlug != "" {
+		keyName = fmt.Sprintf("%s_%s", keyName, buildSlug)
+	}
+	return filepath.Join(paths.SSHDir(), keyName)
+}
+
+func ensureClientKeyOnRemote(client *cryptoSSH.Client, keyPath string) error {
+	// Another session of the same build could overwrite the key between the check and the upload
+	err := withStateLock(func() error {
+		if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+			if err := generateKey(keyPath); err != nil {
+				return fmt.Errorf("generate SSH key: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	pubKey, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return fmt.Errorf("read public key: %w", err)
+	}
+
+	// The keys of earlier sessions from this machine are replaced, so reconnects don't pile them up
+	var updateErr error
+	err = updateRemoteFile(client, authorizedKeysPath, func(content string) string {
+		updated, err := withAuthorizedKey(content, string(pubKey), true)
+		if err != nil {
+			updateErr = err
+			return content
+		}
+		return updated
+	})
+	if err == nil {
+		err = updateErr
+	}
+	if err != nil {
+		return fmt.Errorf("add public key to remote authorized_keys: %w", err)
+	}
+
+	// The permissions are checked even if the key was already there, they may be why it's not accepted
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return fmt.Errorf("create SFTP client: %w", err)
+	}
+	defer sftpClient.Close()
+
+	if err := ensureStrictModes(sftpClient); err != nil {
+		return fmt.Errorf("fix remote SSH permissions: %w", err)
+	}
+	return nil
+}
+
+// generateKey creates an ed25519 keypair in OpenSSH format at keyPath and keyPath.pub.
+// ssh-keygen is only used if the key cannot be created natively, or if it goes on a security key.
+func generateKey(keyPath string) error {
+	if useSecurityKey {
+		return generateSecurityKey(keyPath)
+	}
+
+	err := generateKeyNative(keyPath)
+	if err == nil {
+		return nil
+	}
+
+	if _, lookErr := localCommands.LookPath("ssh-keygen"); lookErr != nil {
+		return err
+	}
+	// Don't let a partially written keypair make ssh-keygen prompt for overwriting
+	_ = removeLocalKey(keyPath)
+
+	out, cmdErr := localCommands.CombinedOutput("ssh-keygen", "-t", "ed25519", "-f", keyPath, "-C", sessionKeyComment(), "-N", "")
+	if cmdErr != nil {
+		return fmt.Errorf("%w (ssh-keygen fallback: %s: %s)", err, cmdErr, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func generateKeyNative(keyPath string) error {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("create key: %w", err)
+	}
+
+	privateBlock, err := cryptoSSH.MarshalPrivateKey(privateKey, sessionKeyComment())
+	if err != nil {
+		return fmt.Errorf("marshal private key: %w", err)
+	}
+
+	sshPublicKey, err := cryptoSSH.NewPublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("convert public key: %w", err)
+	}
+	authorizedKey := strings.TrimSpace(string(cryptoSSH.MarshalAuthorizedKey(sshPublicKey)))
+
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	// A keypair cut in half by an interrupt is removed
+	defer interrupt.Track(keyPath)()
+	defer interrupt.Track(keyPath + ".pub")()
+
+	// OpenSSH refuses to use private keys that are readable by others
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(privateBlock), 0600); err != nil {
+		return fmt.Errorf("write private key: %w", err)
+	}
+	if err := os.WriteFile(keyPath+".pub", []byte(authorizedKey+" "+sessionKeyComment()+"\n"), 0644); err != nil {
+		return fmt.Errorf("write public key: %w", err)
+	}
+
+	return nil
+}
+
+// removeClientKeyFromRemote deletes the public key of the given keypair from the remote authorized_keys.
+func removeClientKeyFromRemote(client *cryptoSSH.Client, keyPath string) error {
+	pubKey, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return fmt.Errorf("read public key: %w", err)
+	}
+
+	// Every entry of the key goes, whatever its comment and options are
+	var updateErr error
+	err = updateRemoteFile(client, authorizedKeysPath, func(content string) string {
+		updated, err := withoutAuthorizedKey(content, string(pubKey))
+		if err != nil {
+			updateErr = err
+			return content
+		}
+		return updated
+	})
+	if err == nil {
+		err = updateErr
+	}
+	if err != nil {
+		return fmt.Errorf("remove public key from remote authorized_keys: %w", err)
+	}
+	return nil
+}
+
+// removeLocalKey deletes both halves of the given keypair from the local disk.
+func removeLocalKey(keyPath string) error {
+	var errs []error
+	for _, path := range []string{keyPath, keyPath + ".pub"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// staleKeyAge is how long after its creation a session key is surely unused: builds are timed out well within it,
+// so the VM it was authorized on is gone by then.
+const staleKeyAge = 24 * time.Hour
+
+// removeStaleLocalKeys deletes keypairs left behind by earlier sessions, keeping the one at keepPath.
+func removeStaleLocalKeys(keepPath string) error {
+	return withStateLock(func() error {
+		stale, err := staleLocalKeys(keepPath, time.Now())
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, path := range stale {
+			if err := removeLocalKey(path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// staleLocalKeys returns the private key paths of earlier sessions that no session can be using anymore.
+// Other sessions may run at the same time, eg. in another terminal or the daemon, so a key is only stale if
+// no config entry refers to it and it's older than any build could be.
+func staleLocalKeys(keepPath string, now time.Time) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(paths.SSHDir(), sshKeyPrefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := map[string]bool{keepPath: true}
+	if entry, err := readSSHClientConfig(); err == nil && entry.IdentityFile != "" {
+		inUse[entry.IdentityFile] = true
+	}
+
+	var stale []string
+	for _, path := range matches {
+		if strings.HasSuffix(path, ".pub") || inUse[path] {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || now.Sub(info.ModTime()) < staleKeyAge {
+			continue
+		}
+		stale = append(stale, path)
+	}
+	return stale, nil
+}
@@ -0,0 +1,139 @@
+package ssh
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaleLocalKeys(t *testing.T) {
+	useTempDirs(t)
+
+	now := time.Now()
+	old := now.Add(-2 * staleKeyAge)
+	writeKey := func(buildSlug string, modTime time.Time) string {
+		t.Helper()
+		keyPath := sessionKeyPath(buildSlug)
+		for _, path := range []string{keyPath, keyPath + ".pub"} {
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("key"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return keyPath
+	}
+
+	current := writeKey("current", old)
+	recent := writeKey("recent", now.Add(-time.Hour))
+	configured := writeKey("configured", old)
+	abandoned := writeKey("abandoned", old)
+
+	if err := os.MkdirAll(filepath.Dir(bitriseConfigPath()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := "Host " + BitriseHostPattern + "\n  HostName 10.0.0.1\n  IdentityFile " + configured + "\n"
+	if err := os.WriteFile(bitriseConfigPath(), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := staleLocalKeys(current, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0] != abandoned {
+		t.Errorf("staleLocalKeys() = %v, want only %s (kept %s, %s, %s)", stale, abandoned, current, recent, configured)
+	}
+}
+
+func TestEnsureClientKeyOnRemote(t *testing.T) {
+	useTempDirs(t)
+	server := newTestServer(t, nil)
+	server.use(t)
+
+	client, err := connectSSHClient(server.entry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// A reconnect doesn't add the key again
+	keyPath := sessionKeyPath("build-slug")
+	for i := 0; i < 2; i++ {
+		if err := ensureClientKeyOnRemote(client, keyPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publicKey, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizedKeys, err := os.ReadFile(server.path(authorizedKeysPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(string(authorizedKeys), strings.TrimSpace(string(publicKey))); count != 1 {
+		t.Errorf("authorized_keys has the session key %d times, want once", count)
+	}
+	info, err := os.Stat(filepath.Dir(server.path(authorizedKeysPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0022 != 0 {
+		t.Errorf("~/.ssh is %s, sshd's StrictModes would refuse the key", perm)
+	}
+
+	keyOnly := server.entry()
+	keyOnly.Password = nil
+	keyOnly.IdentityFile = keyPath
+	keyOnly.sessionKeyOnly = true
+	keyClient, err := connectSSHClient(keyOnly)
+	if err != nil {
+		t.Fatalf("connect with the session key: %s", err)
+	}
+	keyClient.Close()
+
+	if err := removeClientKeyFromRemote(client, keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connectSSHClient(keyOnly); err == nil {
+		t.Error("the session key is accepted after it's removed")
+	}
+}
+
+func TestGenerateSecurityKey(t *testing.T) {
+	useTempDirs(t)
+	SetSecurityKey(true, "")
+	t.Cleanup(func() { SetSecurityKey(false, "") })
+
+	runner := &fakeRunner{
+		installed: map[string]bool{"ssh-keygen": true},
+		outputs: map[string]fakeOutput{
+			"ssh-keygen": {out: "Key enrollment failed: device not found", err: errors.New("exit status 1")},
+		},
+	}
+	useFakeRunner(t, runner)
+
+	keyPath := sessionKeyPath("build-slug")
+	err := generateKey(keyPath)
+	if err == nil || !strings.Contains(err.Error(), "device not found") {
+		t.Errorf("generateKey() = %v, want the output of ssh-keygen", err)
+	}
+	if len(runner.calls) != 1 || !slices.Contains(runner.calls[0], securityKeyType) {
+		t.Errorf("ran %v, want ssh-keygen -t %s", runner.calls, securityKeyType)
+	}
+
+	runner.installed = nil
+	if err := generateKey(keyPath); err == nil {
+		t.Error("generateKey() succeeded without ssh-keygen")
+	}
+}
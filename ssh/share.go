@@ -0,0 +1,94 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	tmateSocket = "/tmp/bitrise-remote-access.tmate.sock"
+	// shareTimeout covers installing tmate with the package manager, which can take a while on a fresh VM
+	shareTimeout = 5 * time.Minute
+
+	// Installs tmate if needed and starts a detached session, the join URLs are printed once it's connected
+	// to the tmate servers. Non-interactive sessions don't load the shell profile, so Homebrew's bin dirs are added manually.
+	tmateStartScript = `PATH="$PATH:/opt/homebrew/bin:/usr/local/bin"; ` +
+		`command -v tmate >/dev/null 2>&1 || ` +
+		`{ if command -v brew >/dev/null 2>&1; then brew install tmate; else sudo apt-get install -y tmate; fi; } >/dev/null 2>&1; ` +
+		`command -v tmate >/dev/null 2>&1 || { echo "tmate could not be installed" >&2; exit 1; }; ` +
+		`tmate -S ` + tmateSocket + ` has-session 2>/dev/null || tmate -S ` + tmateSocket + ` new-session -d; ` +
+		`tmate -S ` + tmateSocket + ` wait tmate-ready && ` +
+		`tmate -S ` + tmateSocket + ` display -p 'ssh_rw=#{tmate_ssh}' && ` +
+		`tmate -S ` + tmateSocket + ` display -p 'ssh_ro=#{tmate_ssh_ro}' && ` +
+		`tmate -S ` + tmateSocket + ` display -p 'web_rw=#{tmate_web}' && ` +
+		`tmate -S ` + tmateSocket + ` display -p 'web_ro=#{tmate_web_ro}'`
+	tmateStopScript = `PATH="$PATH:/opt/homebrew/bin:/usr/local/bin"; tmate -S ` + tmateSocket + ` kill-server`
+)
+
+// SharedTerminal holds the join URLs of a tmate session on the VM.
+type SharedTerminal struct {
+	SSH         string
+	SSHReadOnly string
+	Web         string
+	WebReadOnly string
+}
+
+// Share starts a tmate session on the VM of the last session, or returns the URLs of the running one.
+// Anyone with a URL can join without Bitrise access or the VM's credentials.
+func Share(password *string) (*SharedTerminal, error) {
+	var terminal *SharedTerminal
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		ctx, cancel := context.WithTimeout(context.Background(), shareTimeout)
+		defer cancel()
+
+		output, err := runCommandOutput(ctx, client, tmateStartScript)
+		if err != nil {
+			return fmt.Errorf("start tmate: %w", err)
+		}
+
+		terminal = parseTmateOutput(output)
+		if terminal.SSH == "" {
+			return fmt.Errorf("start tmate: no join URL in the output: %s", strings.TrimSpace(output))
+		}
+		return nil
+	})
+	return terminal, err
+}
+
+// StopSharing ends the tmate session, disconnecting everyone who joined.
+func StopSharing(password *string) error {
+	return withClient(password, func(client *cryptoSSH.Client) error {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+		defer cancel()
+
+		if err := runCommand(ctx, client, tmateStopScript); err != nil {
+			return fmt.Errorf("stop tmate: %w", err)
+		}
+		return nil
+	})
+}
+
+func parseTmateOutput(output string) *SharedTerminal {
+	terminal := &SharedTerminal{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "ssh_rw":
+			terminal.SSH = value
+		case "ssh_ro":
+			terminal.SSHReadOnly = value
+		case "web_rw":
+			terminal.Web = value
+		case "web_ro":
+			terminal.WebReadOnly = value
+		}
+	}
+	return terminal
+}
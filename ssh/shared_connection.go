@@ -0,0 +1,168 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const sharedConnectionSocketFileName = "connection.sock"
+
+// sharedConnectionSocketPath returns the socket the daemon shares its connection on. The socket speaks SSH, so
+// the subcommands get a regular client whose channels are relayed over the daemon's connection to the VM.
+func sharedConnectionSocketPath() string {
+	return filepath.Join(paths.StateDir(), sharedConnectionSocketFileName)
+}
+
+// connectSharedConnection connects to the connection of the running daemon, skipping the handshake with the VM
+// and the password. Only the user can open the socket, there is nothing else to authenticate.
+func connectSharedConnection() (*cryptoSSH.Client, error) {
+	conn, err := net.DialTimeout("unix", sharedConnectionSocketPath(), daemonControlTimeout)
+	if err != nil {
+		return nil, ErrDaemonNotRunning
+	}
+
+	config := &cryptoSSH.ClientConfig{
+		User:            "daemon",
+		HostKeyCallback: cryptoSSH.InsecureIgnoreHostKey(),
+		Timeout:         daemonControlTimeout,
+	}
+	sshConn, chans, reqs, err := cryptoSSH.NewClientConn(conn, sharedConnectionSocketPath(), config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect to daemon: %w", err)
+	}
+	return cryptoSSH.NewClient(sshConn, chans, reqs), nil
+}
+
+// shareConnection listens on the shared connection socket until the listener is closed.
+func (d *daemon) shareConnection() (net.Listener, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate host key: %w", err)
+	}
+	signer, err := cryptoSSH.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("create host key signer: %w", err)
+	}
+	config := &cryptoSSH.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	_ = os.Remove(sharedConnectionSocketPath())
+	listener, err := net.Listen("unix", sharedConnectionSocketPath())
+	if err != nil {
+		return nil, fmt.Errorf("listen on shared connection socket: %w", err)
+	}
+	if err := os.Chmod(sharedConnectionSocketPath(), 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("restrict shared connection socket: %w", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.relayConnection(conn, config)
+		}
+	}()
+	return listener, nil
+}
+
+func (d *daemon) relayConnection(conn net.Conn, config *cryptoSSH.ServerConfig) {
+	serverConn, chans, reqs, err := cryptoSSH.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+
+	go func() {
+		for req := range reqs {
+			// Remote forwards would be opened for the daemon, not for the subcommand asking for them
+			ok := false
+			if client := d.currentClient(); client != nil && req.Type != "tcpip-forward" && req.Type != "cancel-tcpip-forward" {
+				ok, _, _ = client.SendRequest(req.Type, req.WantReply, req.Payload)
+			}
+			if req.WantReply {
+				_ = req.Reply(ok, nil)
+			}
+		}
+	}()
+	for newChannel := range chans {
+		go d.relayChannel(newChannel)
+	}
+}
+
+// relayChannel opens the same channel on the VM and copies the data and the requests, eg. the exit status,
+// between the two.
+func (d *daemon) relayChannel(newChannel cryptoSSH.NewChannel) {
+	client := d.currentClient()
+	if client == nil {
+		_ = newChannel.Reject(cryptoSSH.ConnectionFailed, "the daemon is reconnecting")
+		return
+	}
+	upstream, upstreamReqs, err := client.OpenChannel(newChannel.ChannelType(), newChannel.ExtraData())
+	if err != nil {
+		var openErr *cryptoSSH.OpenChannelError
+		if errors.As(err, &openErr) {
+			_ = newChannel.Reject(openErr.Reason, openErr.Message)
+		} else {
+			_ = newChannel.Reject(cryptoSSH.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	downstream, downstreamReqs, err := newChannel.Accept()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	go relayRequests(downstreamReqs, upstream)
+	go func() {
+		if _, err := io.Copy(upstream, downstream); err != nil {
+			logger.Warnf("relay channel: %s", err)
+		}
+		_ = upstream.CloseWrite()
+	}()
+
+	// The downstream channel is closed once everything the VM sent is relayed
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(downstream, upstream)
+		_ = downstream.CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(downstream.Stderr(), upstream.Stderr())
+	}()
+	go func() {
+		defer wg.Done()
+		relayRequests(upstreamReqs, downstream)
+	}()
+	wg.Wait()
+	downstream.Close()
+	upstream.Close()
+}
+
+func relayRequests(reqs <-chan *cryptoSSH.Request, target cryptoSSH.Channel) {
+	for req := range reqs {
+		ok, err := target.SendRequest(req.Type, req.WantReply, req.Payload)
+		if req.WantReply {
+			_ = req.Reply(ok && err == nil, nil)
+		}
+	}
+}
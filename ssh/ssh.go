@@ -2,42 +2,102 @@ package ssh
 
 import (
 	"bufio"
-	"bytes"
 	_ "embed"
 	"errors"
 	"fmt"
 	"net"
+	"net/netip"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
 	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/metrics"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
 	"github.com/kevinburke/ssh_config"
 	cryptoSSH "golang.org/x/crypto/ssh"
 )
 
 const (
 	BitriseHostPattern   = "BitriseRunningVM"
-	sshKeyName           = "id_bitrise_remote_access"
 	remoteReadmeFileName = "README_REMOTE_ACCESS.md"
 	sourceDirEnvVar      = "BITRISE_SOURCE_DIR"
 	revisionEnvVar       = "BITRISE_OSX_STACK_REV_ID"
 	revisionEnvVarUbuntu = "BITRISE_STACK_REV_ID"
 	osTypeEnvVar         = "OSTYPE"
+	buildSlugEnvVar      = "BITRISE_BUILD_SLUG"
+	motdCommand          = "cat /etc/motd"
 )
 
+// Stages of the setup reported as progress events
+const (
+	StageHostKey      = "host_key"
+	StageConnect      = "connect"
+	StageDetect       = "detect"
+	StageSessionKey   = "session_key"
+	StageKeyAuth      = "key_auth"
+	StageMotd         = "motd"
+	StageReadme       = "readme"
+	StageStepLog      = "step_log"
+	StageStack        = "stack"
+	StageClientConfig = "client_config"
+	StageDisconnect   = "disconnect"
+	StageRepair       = "repair"
+	StageRefresh      = "refresh"
+)
+
+// motdShellConfigs are the shell configs on the remote that print the message of the day
+var motdShellConfigs = []string{"~/.zshrc", "~/.bashrc"}
+
 //go:embed README_REMOTE_ACCESS.md
 var readmeFile string
 
+// readmeTranslations are the READMEs of the languages with a translation, keyed by i18n locale
+var readmeTranslations = map[string]string{
+	i18n.Japanese: readmeFileJapanese,
+}
+
+//go:embed README_REMOTE_ACCESS.ja.md
+var readmeFileJapanese string
+
 type configEntry struct {
-	Host     string
-	HostName string
-	User     string
-	Port     string
-	Password *string
+	Host           string
+	HostName       string
+	User           string
+	Port           string
+	Password       *string
+	IdentityFile   string
+	KnownHostsFile string
+	Tuning         Tuning
+	// WebSocketURL is the endpoint the connection is tunneled through, empty for direct connections
+	WebSocketURL string
+	// BindAddress is the local address the connection is made from, empty to let the OS pick
+	BindAddress string
+	// CertificateFile is the user's SSH certificate, its private key isn't the session's and is never removed
+	CertificateFile string
+	// LookupName is the name the host was given with, if it was resolved to HostName for the connection
+	LookupName string
+	// LocalForwards and RemoteForwards are read back from the config entry, eg. by the daemon
+	LocalForwards  []string
+	RemoteForwards []string
+	// readOnly connections don't record the host key, used by dry runs
+	readOnly bool
+	// sessionKeyOnly connections only authenticate with the session key, used to verify it
+	sessionKeyOnly bool
+}
+
+// Tuning holds the transport preferences for slow links. Empty lists keep the defaults.
+type Tuning struct {
+	Compression bool
+	Ciphers     []string
+	MACs        []string
 }
 
 type ConfigErr struct {
@@ -48,20 +108,61 @@ func (c ConfigErr) Error() string {
 	return c.err.Error()
 }
 
-func SetupSSH(host, port, user string, password *string, onOpenIde func(bool, string) error) error {
+func (c ConfigErr) Unwrap() error {
+	return c.err
+}
+
+func (c ConfigErr) Category() failure.Category {
+	return failure.Config
+}
+
+// LaunchInfo is what the setup learned about the VM that the IDE launch can use.
+type LaunchInfo struct {
+	// ContextFiles are the remote files worth opening next to the source code, eg. the build's bitrise.yml
+	ContextFiles []string
+	// SlowLink is set if the link is too slow for the optional steps, eg. installing extensions on the remote
+	SlowLink bool
+}
+
+// SetupSSH prepares the local and remote side for the IDE and calls onOpenIde once the connection can be made.
+// allowKeyAuth is false for IDEs that cannot authenticate with the generated key, they get the password instead.
+func SetupSSH(host, port, user string, password *string, tuning Tuning, allowKeyAuth bool, onOpenIde func(bool, string, LaunchInfo) error) error {
 	config, err := createClientConfig(host, port, user, password)
 	if err != nil {
 		return ConfigErr{err: err}
 	}
+	config.Tuning = tuning
+
+	mirrorToWindows := false
+	if IsWSL() {
+		mirrorToWindows, _ = logger.Confirm(
+			"Running in WSL, but editors on Windows read the Windows SSH config.\nWould you like to write the SSH config entry there too?",
+			"Writing SSH config for Windows too",
+			"Writing SSH config for WSL only")
+		// The entry of an earlier session would point the Windows editors to a dead host
+		if !mirrorToWindows && hasWindowsMirror() {
+			if err := removeWindowsMirror(); err != nil {
+				logger.Warnf("remove the earlier Windows SSH config entry: %s", err)
+			}
+		}
+	}
+
+	if err := chooseClientConfigStrategy(); err != nil {
+		return err
+	}
 
 	// Channels to synchronize the methods
 	clientSetupDone := make(chan error)
 	ideLaunchDone := make(chan error)
 
+	// Set once the remote is detected, from that point on the IDE launch reports the outcome
+	detected := false
+
 	// Method to start client config creation after enviroment is detected
 	afterDetection := func(useIdentityKey bool) {
+		detected = true
 		go func() {
-			if err := setupClientConfig(config, useIdentityKey); err != nil {
+			if err := setupClientConfig(config, useIdentityKey, mirrorToWindows); err != nil {
 				clientSetupDone <- err
 			} else {
 				clientSetupDone <- nil
@@ -70,51 +171,104 @@ func SetupSSH(host, port, user string, password *string, onOpenIde func(bool, st
 	}
 
 	// Method to start IDE after essentials of remote setup are done
-	afterEssentials := func(useIdentityKey bool, folderPath string) {
+	afterEssentials := func(useIdentityKey bool, folderPath string, info LaunchInfo) {
 		go func() {
 			// Wait for afterDetection to finish
 			if err := <-clientSetupDone; err != nil {
-				ideLaunchDone <- err
+				ideLaunchDone <- failure.New(failure.Config, err)
 				return
 			}
-			ideLaunchDone <- onOpenIde(useIdentityKey, folderPath)
+			ideLaunchDone <- failure.New(failure.IDE, onOpenIde(useIdentityKey, folderPath, info))
 		}()
 	}
 
-	err = setupRemoteConfig(config, afterDetection, afterEssentials)
+	err = setupRemoteConfig(config, allowKeyAuth, afterDetection, afterEssentials)
 	if err != nil {
 		var opErr *net.OpError
 		if errors.As(err, &opErr) && opErr.Op == "dial" {
-			return fmt.Errorf("dial remote host: please check the SSH arguments and make sure the remote host is reachable and your build is running")
+			return failure.New(failure.Network, fmt.Errorf("dial remote host: please check the SSH arguments and make sure the remote host is reachable and your build is running: %w", err))
+		}
+		if !detected {
+			// The IDE would never be launched, so there is nothing to wait for
+			return failure.Default(failure.RemoteSetup, err)
 		}
 		logger.Warn(err)
 	}
+	if !detected {
+		return ConfigErr{err: fmt.Errorf("password cannot be empty")}
+	}
 
 	// Wait for IDE to finish and return its error if any
 	return <-ideLaunchDone
 }
 
-func setupClientConfig(configEntry *configEntry, useIdentityKey bool) error {
-	logger.Info("Ensuring Bitrise SSH config inclusion...")
-	if err := ensureBitriseClientConfigIncluded(); err != nil {
-		return fmt.Errorf("ensure Bitrise SSH config inclusion: %w", err)
-	} else {
-		logger.Success("Bitrise SSH config inclusion ensured")
+func setupClientConfig(configEntry *configEntry, useIdentityKey, mirrorToWindows bool) error {
+	return clientConfigPlan(configEntry, useIdentityKey, mirrorToWindows).execute(StageClientConfig)
+}
+
+// clientConfigPlan returns the changes of the local SSH config.
+func clientConfigPlan(configEntry *configEntry, useIdentityKey, mirrorToWindows bool) *Plan {
+	plan := &Plan{}
+
+	if !isClientConfigIncluded(sshConfigPath(), bitriseConfigPath()) && !configFileOverridden() {
+		plan.local(fmt.Sprintf("Include %s in %s", bitriseConfigPath(), sshConfigPath()), func() error {
+			if err := ensureClientConfigIncluded(sshConfigPath(), bitriseConfigPath()); err != nil {
+				return fmt.Errorf("ensure Bitrise SSH config inclusion: %w", err)
+			}
+			return nil
+		})
 	}
 
-	logger.Info("Updating SSH config entry...")
-	if err := writeSSHClientConfig(configEntry, useIdentityKey); err != nil {
-		return fmt.Errorf("update SSH config: %w", err)
-	} else {
-		logger.Success("SSH config entry updated")
+	plan.local(fmt.Sprintf("Write the %s host entry to %s", BitriseHostPattern, bitriseConfigPath()), func() error {
+		if err := writeSSHClientConfig(bitriseConfigPath(), configEntry, useIdentityKey); err != nil {
+			return fmt.Errorf("update SSH config: %w", err)
+		}
+		return nil
+	})
+
+	plan.local(fmt.Sprintf("Verify that ssh resolves %s to the written entry", BitriseHostPattern), func() error {
+		return verifyEffectiveConfig(configEntry, useIdentityKey)
+	})
+
+	plan.optional(fmt.Sprintf("Check the options other blocks of %s apply to %s", sshConfigPath(), BitriseHostPattern), func() error {
+		return warnConflictingOptions(configEntry, useIdentityKey)
+	})
+
+	if mirrorToWindows {
+		plan.optional(fmt.Sprintf("Write the %s host entry to the Windows SSH config", BitriseHostPattern), func() error {
+			if err := mirrorClientConfigToWindows(configEntry, useIdentityKey); err != nil {
+				return fmt.Errorf("update Windows SSH config: %w", err)
+			}
+			return nil
+		})
 	}
 
-	return nil
+	return plan
 }
 
-func ensureBitriseClientConfigIncluded() error {
-	sshConfigPath := sshConfigPath()
-	includeLine := fmt.Sprintf("Include %s", bitriseConfigPath())
+// isClientConfigIncluded reports whether the SSH config already includes the Bitrise config.
+func isClientConfigIncluded(sshConfigPath, includePath string) bool {
+	content, err := os.ReadFile(sshConfigPath)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(strings.Split(string(content), "\n"), fmt.Sprintf("Include %s", includePath)) ||
+		isDropInIncluded(sshConfigPath, includePath)
+}
+
+func ensureClientConfigIncluded(sshConfigPath, includePath string) error {
+	return withStateLock(func() error {
+		if reason := readOnlyReason(sshConfigPath); reason != "" {
+			return includeReadOnlyClientConfig(sshConfigPath, includePath, reason)
+		}
+		return includeClientConfig(sshConfigPath, includePath)
+	})
+}
+
+func includeClientConfig(sshConfigPath, includePath string) error {
+	defer interrupt.Track(sshConfigPath)()
+
+	includeLine := fmt.Sprintf("Include %s", includePath)
 
 	f, err := os.Open(sshConfigPath)
 	if err != nil {
@@ -150,12 +304,23 @@ func ensureBitriseClientConfigIncluded() error {
 	return os.WriteFile(sshConfigPath, []byte(newContent), 0644)
 }
 
-func writeSSHClientConfig(configEntry *configEntry, useIdentityKey bool) error {
+func writeSSHClientConfig(configDir string, configEntry *configEntry, useIdentityKey bool) error {
+	return withStateLock(func() error {
+		return writeClientConfigFile(configDir, configEntry, useIdentityKey)
+	})
+}
+
+func writeClientConfigFile(configDir string, configEntry *configEntry, useIdentityKey bool) error {
+	defer interrupt.Track(configDir)()
+
 	newHost := makeSSHConfigHost(configEntry, useIdentityKey)
 	trimmedHost := strings.TrimSpace(newHost.String())
 	content := "# --- Bitrise Generated ---\n" + trimmedHost + "\n# -------------------------\n"
 
-	configDir := bitriseConfigPath()
+	// An unchanged entry is not rewritten, the editor of an earlier session may be reading it on reconnect
+	if existing, err := os.ReadFile(configDir); err == nil && string(existing) == content {
+		return nil
+	}
 
 	parentDir := filepath.Dir(configDir)
 	if err := os.MkdirAll(parentDir, 0755); err != nil {
@@ -183,8 +348,18 @@ func createClientConfig(host, port, user string, password *string) (*configEntry
 		return nil, fmt.Errorf("user cannot be empty")
 	}
 
-	if net.ParseIP(host) == nil {
-		if _, err := net.LookupHost(host); err != nil {
+	// IPv6 literals may be given in the bracketed form of URLs, eg. [2001:db8::1]
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	// Tunneled connections only need the endpoint to resolve, the VM's name is resolved on the other side
+	lookupName := ""
+	if networkMode == NetworkVPN && webSocketURL == "" {
+		if resolved := resolveVPNHost(host); resolved != host {
+			lookupName, host = host, resolved
+		}
+	} else if _, err := netip.ParseAddr(host); err != nil && !skipDNSCheck && webSocketURL == "" {
+		// netip also accepts IPv6 literals with zone IDs, eg. fe80::1%en0
+		if err := resolveHost(host); err != nil {
 			return nil, fmt.Errorf("invalid host: %s", host)
 		}
 	}
@@ -194,16 +369,32 @@ func createClientConfig(host, port, user string, password *string) (*configEntry
 	}
 
 	configEntry := &configEntry{
-		Host:     BitriseHostPattern,
-		HostName: host,
-		User:     user,
-		Port:     port,
-		Password: password,
+		Host:           BitriseHostPattern,
+		HostName:       host,
+		User:           user,
+		Port:           port,
+		Password:       password,
+		KnownHostsFile: bitriseKnownHostsPath(),
+		WebSocketURL:   webSocketURL,
+		BindAddress:    bindAddress,
+		LookupName:     lookupName,
+	}
+
+	if certificateFile != "" {
+		if err := checkCertificate(certificateFile, user); err != nil {
+			return nil, err
+		}
+		configEntry.CertificateFile = certificateFile
 	}
 
 	return configEntry, nil
 }
 
+// escapeConfigTokens escapes the % of a value OpenSSH expands tokens in, eg. the zone ID of fe80::1%en0 in HostName.
+func escapeConfigTokens(value string) string {
+	return strings.ReplaceAll(value, "%", "%%")
+}
+
 func makeSSHConfigHost(config *configEntry, useIdentityOnly bool) ssh_config.Host {
 	// Space after hostname but before comment is important but there is no other way
 	// so we have to add it to the pattern. The built in methods will trim hostnames and
@@ -213,7 +404,7 @@ func makeSSHConfigHost(config *configEntry, useIdentityOnly bool) ssh_config.Hos
 	nodes := []ssh_config.Node{
 		&ssh_config.KV{
 			Key:   "  HostName",
-			Value: config.HostName,
+			Value: escapeConfigTokens(config.HostName),
 		},
 		&ssh_config.KV{
 			Key:   "  User",
@@ -227,12 +418,59 @@ func makeSSHConfigHost(config *configEntry, useIdentityOnly bool) ssh_config.Hos
 			Key:   "  StrictHostKeyChecking",
 			Value: "no", // Don't prompt for adding the host to known_hosts
 		},
+		&ssh_config.KV{
+			Key:   "  UserKnownHostsFile",
+			Value: configPathValue(config.KnownHostsFile), // Keep the keys of short-lived VMs out of ~/.ssh/known_hosts
+		},
 		&ssh_config.KV{
 			Key:   "  CheckHostIP",
 			Value: "no", // https://serverfault.com/questions/1040512/how-does-the-ssh-option-checkhostip-yes-really-help-me
 		},
 	}
 
+	if config.BindAddress != "" {
+		nodes = append(nodes, &ssh_config.KV{
+			Key:   "  BindAddress",
+			Value: config.BindAddress,
+		})
+	}
+	if config.WebSocketURL != "" {
+		nodes = append(nodes, &ssh_config.KV{
+			Key:   "  ProxyCommand",
+			Value: proxyCommand(config.WebSocketURL),
+		})
+	}
+	if config.Tuning.Compression {
+		nodes = append(nodes, &ssh_config.KV{
+			Key:   "  Compression",
+			Value: "yes",
+		})
+	}
+	if len(config.Tuning.Ciphers) > 0 {
+		nodes = append(nodes, &ssh_config.KV{
+			Key:   "  Ciphers",
+			Value: strings.Join(config.Tuning.Ciphers, ","),
+		})
+	}
+	if len(config.Tuning.MACs) > 0 {
+		nodes = append(nodes, &ssh_config.KV{
+			Key:   "  MACs",
+			Value: strings.Join(config.Tuning.MACs, ","),
+		})
+	}
+	for _, forward := range localForwards {
+		nodes = append(nodes, &ssh_config.KV{
+			Key:   "  LocalForward",
+			Value: forward,
+		})
+	}
+	for _, forward := range remoteForwards {
+		nodes = append(nodes, &ssh_config.KV{
+			Key:   "  RemoteForward",
+			Value: forward,
+		})
+	}
+
 	nodes = append(nodes, &ssh_config.KV{
 		Key:   "  IdentitiesOnly",
 		Value: "yes", // Only use the specified identity file
@@ -241,12 +479,38 @@ func makeSSHConfigHost(config *configEntry, useIdentityOnly bool) ssh_config.Hos
 	if useIdentityOnly {
 		nodes = append(nodes, &ssh_config.KV{
 			Key:   "  IdentityFile",
-			Value: "~/.ssh/" + sshKeyName, // Use the generated SSH key for authentication
+			Value: configPathValue(config.IdentityFile), // Use the generated SSH key for authentication
 		})
-	} else {
+		if securityKeyProvider != "" && isSecurityKey(config.IdentityFile) {
+			nodes = append(nodes, &ssh_config.KV{
+				Key:   "  SecurityKeyProvider",
+				Value: configPathValue(securityKeyProvider),
+			})
+		}
+	}
+	if config.CertificateFile != "" {
+		// Without the key file ssh takes the key of the certificate from ssh-agent
+		if keyPath := certificateKeyPath(config.CertificateFile); keyPath != config.CertificateFile {
+			if _, err := os.Stat(keyPath); err == nil {
+				nodes = append(nodes, &ssh_config.KV{
+					Key:   "  IdentityFile",
+					Value: configPathValue(keyPath),
+				})
+			}
+		}
+		nodes = append(nodes, &ssh_config.KV{
+			Key:   "  CertificateFile",
+			Value: configPathValue(config.CertificateFile),
+		})
+	}
+	if !useIdentityOnly {
+		preferred := "keyboard-interactive,password" // Prioritize password authentication, some stacks only offer it as keyboard-interactive
+		if config.CertificateFile != "" {
+			preferred = "publickey," + preferred
+		}
 		nodes = append(nodes, &ssh_config.KV{
 			Key:   "  PreferredAuthentications",
-			Value: "password", // Prioritize password authentication
+			Value: preferred,
 		})
 	}
 
@@ -259,76 +523,94 @@ func makeSSHConfigHost(config *configEntry, useIdentityOnly bool) ssh_config.Hos
 	}
 }
 
-func getHomeDir() string {
+// configPathValue formats a local path as an SSH config value. Windows OpenSSH treats
+// backslashes as escape characters in some versions, so forward slashes are used there.
+func configPathValue(path string) string {
 	if runtime.GOOS == "windows" {
-		return os.Getenv("USERPROFILE")
+		path = filepath.ToSlash(path)
 	}
-	return os.Getenv("HOME")
+	if strings.Contains(path, " ") {
+		return fmt.Sprintf("\"%s\"", path)
+	}
+	return path
 }
 
 func sshConfigPath() string {
-	return filepath.Join(getHomeDir(), ".ssh", "config")
+	return filepath.Join(paths.SSHDir(), "config")
 }
 
-func bitriseConfigPath() string {
-	return filepath.Join(getHomeDir(), ".bitrise", "remote-access", "ssh_config")
+// SSHCommand returns the ssh invocation that connects to the VM of the last session with the generated host entry.
+// The config file is passed explicitly, so it works even if the user's SSH config doesn't include it.
+func SSHCommand() []string {
+	return []string{"ssh", "-F", bitriseConfigPath(), BitriseHostPattern}
 }
 
-func ensureClientKeyOnRemote(client *cryptoSSH.Client) error {
-	keyPath := filepath.Join(getHomeDir(), ".ssh", sshKeyName)
-	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
-		cmd := exec.Command("ssh-keygen", "-t", "ed25519", "-f", keyPath, "-C", "Bitrise remote access key", "-N", "")
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("generate SSH key: %w", err)
-		}
-	}
-
-	pubKeyPath := keyPath + ".pub"
-	pubKey, err := os.ReadFile(pubKeyPath)
-	if err != nil {
-		return fmt.Errorf("read public key: %w", err)
-	}
-
-	remotePath := ".ssh/authorized_keys"
-
-	item := &copyItem{
-		Content:     string(pubKey),
-		RemotePath:  remotePath,
-		Append:      true,
-		NoDuplicate: true,
-	}
-
-	if err := copyItemSFTP(client, item); err != nil {
-		return fmt.Errorf("append public key to remote authorized_keys: %w", err)
-	}
-
-	return nil
+func bitriseConfigPath() string {
+	return filepath.Join(paths.StateDir(), "ssh_config")
 }
 
 func connectSSHClient(configEntry *configEntry) (*cryptoSSH.Client, error) {
-	password := configEntry.Password
-
-	if password == nil {
-		return nil, fmt.Errorf("trying to connect without password")
+	auth, err := authMethods(configEntry)
+	if err != nil {
+		return nil, err
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("trying to connect without password or key")
 	}
 
+	// Compression is only applied by the IDE's SSH client, Go's client doesn't support it
 	sshConfig := &cryptoSSH.ClientConfig{
+		Config: cryptoSSH.Config{
+			Ciphers: configEntry.Tuning.Ciphers,
+			MACs:    configEntry.Tuning.MACs,
+		},
 		User: configEntry.User,
-		Auth: []cryptoSSH.AuthMethod{
-			cryptoSSH.Password(*password),
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key cryptoSSH.PublicKey) error {
+			// The VM is freshly created for every build, there is no previous key to verify against.
+			// The key is recorded so the IDE's SSH client can verify it instead of trusting blindly.
+			if configEntry.readOnly {
+				return nil
+			}
+			if err := addHostKey(configEntry, key); err != nil {
+				logger.Warnf("record host key: %s", err)
+			}
+			return nil
 		},
-		HostKeyCallback: cryptoSSH.InsecureIgnoreHostKey(),
 	}
 
-	client, err := cryptoSSH.Dial("tcp", fmt.Sprintf("%s:%s", configEntry.HostName, configEntry.Port), sshConfig)
+	dialDone := metrics.Start(metrics.Dial)
+	conn, err := dialVM(configEntry, transportDialTimeout)
+	dialDone(err)
+	if err != nil {
+		return nil, failure.New(failure.Network, err)
+	}
+	authDone := metrics.Start(metrics.Auth)
+	sshConn, chans, reqs, err := cryptoSSH.NewClientConn(conn, net.JoinHostPort(configEntry.HostName, configEntry.Port), sshConfig)
+	authDone(err)
 	if err != nil {
-		if opErr, ok := err.(*net.OpError); ok {
-			return nil, opErr
+		conn.Close()
+		if strings.Contains(err.Error(), "unable to authenticate") {
+			return nil, failure.New(failure.Auth, fmt.Errorf("authenticate: the password or key was rejected: %w", err))
 		}
-		return nil, fmt.Errorf("start client connection: %w, %T", err, err)
+		return nil, failure.New(failure.Network, fmt.Errorf("start client connection: %w, %T", err, err))
 	}
 
-	return client, nil
+	return cryptoSSH.NewClient(sshConn, chans, reqs), nil
+}
+
+// passwordChallenge answers the keyboard-interactive prompts of sshd with the password.
+// Prompts that echo the answer aren't asking for a password, they are answered empty.
+func passwordChallenge(password string) cryptoSSH.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range questions {
+			if !echos[i] {
+				answers[i] = password
+			}
+		}
+		return answers, nil
+	}
 }
 
 func createSSHSession(client *cryptoSSH.Client) (*cryptoSSH.Session, error) {
@@ -340,31 +622,40 @@ func createSSHSession(client *cryptoSSH.Client) (*cryptoSSH.Session, error) {
 	return session, nil
 }
 
-func removeHostKey(configEntry *configEntry) error {
-	hostname := fmt.Sprintf("[%s]:%s", configEntry.HostName, configEntry.Port)
-	cmd := exec.Command("ssh-keygen", "-R", hostname)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-
-	if err := cmd.Run(); err != nil {
-		logger.PrintFormattedOutput("Remove Host Key", out.String())
-		return fmt.Errorf("remove host key for %s: %w", hostname, err)
+// readmeCopyItem returns the README written to the source directory of the remote, with the log of the failed
+// step if one was found.
+func readmeCopyItem(sourceDir, revision, stepLog string) *copyItem {
+	content := readmeFile
+	if translated, ok := readmeTranslations[i18n.Locale()]; ok {
+		content = translated
 	}
+	if stepLog != "" {
+		content += "\n📄 " + i18n.T("Log of the failed step: <file://%s>", stepLog) + "\n"
+	}
+	return &copyItem{
+		Content:     content,
+		NoDuplicate: true,
+		Mode:        readmeMode,
+		RemotePath:  filepath.Join(sourceDir, remoteReadmeFileName),
+		Replace: &map[string]string{
+			sourceDirEnvVar: sourceDir,
+			revisionEnvVar:  revision,
+		},
+	}
+}
 
-	return nil
-
+// shellBlockLines returns the content of the managed block of the shell config.
+func shellBlockLines(shellConfig string) []string {
+	return append([]string{motdCommand}, envExports(remoteEnv, shellConfig == fishConfigPath)...)
 }
 
+// addMotdToShellConfig prints the message of the day in new shells, in a managed block that disconnect removes.
 func addMotdToShellConfig(client *cryptoSSH.Client, shellConfig string) error {
-	cmd := fmt.Sprintf(`grep -qxF "cat /etc/motd" %s || echo -e "\ncat /etc/motd\n" >> %s`, shellConfig, shellConfig)
-	session, err := createSSHSession(client)
+	lines := shellBlockLines(shellConfig)
+	err := updateRemoteFile(client, shellConfig, func(content string) string {
+		return setManagedBlock(content, lines)
+	})
 	if err != nil {
-		return fmt.Errorf("create SSH session: %w", err)
-	}
-	defer session.Close()
-
-	if err = session.Run(cmd); err != nil {
 		return fmt.Errorf("edit remote shell config '%s': %w", shellConfig, err)
 	}
 	return nil
@@ -372,40 +663,49 @@ func addMotdToShellConfig(client *cryptoSSH.Client, shellConfig string) error {
 
 func setupShellConfigs(client *cryptoSSH.Client, shellConfigs []string) error {
 	for _, config := range shellConfigs {
-		if err := addMotdToShellConfig(client, config); err != nil {
+		if err := (shellBlockResource{path: config}).apply(client); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func setupRemoteConfig(configEntry *configEntry, onRemoteDetected func(bool), onEssentialsDone func(bool, string)) error {
-	logger.Info("Setting up SSH config of remote host...")
+func setupRemoteConfig(configEntry *configEntry, allowKeyAuth bool, onRemoteDetected func(bool), onEssentialsDone func(bool, string, LaunchInfo)) error {
+	logger.Info(i18n.T("Setting up SSH config of remote host..."))
 
-	logger.Info("Removing old host key...")
-	if err := removeHostKey(configEntry); err != nil {
+	progress.Start(StageHostKey, i18n.T("Removing old host key..."))
+	if err := removeUserHostKeys(configEntry); err != nil {
+		progress.Fail(StageHostKey, "remove old host key", err)
 		return err
 	} else {
-		logger.Success("No old host keys remaining")
+		progress.Succeed(StageHostKey, i18n.T("No old host keys remaining"))
 	}
 
-	if configEntry.Password == nil {
+	if !hasCredentials(configEntry) {
 		return nil
 	}
 
 	useIdentiyConfig := false
-	logger.Info("Connecting to remote host...")
+	progress.Start(StageConnect, i18n.T("Connecting to remote host..."))
 	client, err := connectSSHClient(configEntry)
 	if err != nil {
+		progress.Fail(StageConnect, "connect to remote host", err)
 		return err
 	}
 	defer client.Close()
 
-	logger.Info("Detecting remote environment...")
-	envMap, err := runWithPty(client, &[]string{sourceDirEnvVar, osTypeEnvVar, revisionEnvVar, revisionEnvVarUbuntu}, "echo $", true)
+	slowLink := adaptToLink(client, configEntry) == linkVerySlow
+
+	progress.Start(StageDetect, i18n.T("Detecting remote environment..."))
+	detectDone := metrics.Start(metrics.Detect)
+	envVars := append([]string{osTypeEnvVar, revisionEnvVar, revisionEnvVarUbuntu, buildSlugEnvVar}, buildContextEnvVars...)
+	envMap, err := runWithPty(client, &envVars, "echo $", true)
+	detectDone(err)
 	if err != nil {
+		progress.Fail(StageDetect, "detect remote environment", err)
 		return err
 	}
+	build := newBuildContext(envMap)
 
 	sourceDir := envMap[sourceDirEnvVar]
 	revision := envMap[revisionEnvVar]
@@ -413,51 +713,78 @@ func setupRemoteConfig(configEntry *configEntry, onRemoteDetected func(bool), on
 		// Ubuntu stack stores the revision in a different environment variable
 		revision = envMap[revisionEnvVarUbuntu]
 	}
-	readmeItem := &copyItem{
-		Content:     string(readmeFile),
-		NoDuplicate: true,
-		RemotePath:  filepath.Join(sourceDir, remoteReadmeFileName),
-		Replace: &map[string]string{
-			sourceDirEnvVar: sourceDir,
-			revisionEnvVar:  revision,
+	stepLog := showFailedStepLog(client, build)
+	progress.Emit(progress.Event{
+		Stage:   StageDetect,
+		Status:  progress.Succeeded,
+		Message: i18n.T("Remote environment detected"),
+		Metadata: map[string]string{
+			"os_type":    envMap[osTypeEnvVar],
+			"source_dir": sourceDir,
+			"revision":   revision,
 		},
-	}
+	})
 
 	if isMacOS(envMap[osTypeEnvVar]) {
-		useIdentiyConfig = true
-
-		onRemoteDetected(useIdentiyConfig)
+		useIdentiyConfig = allowKeyAuth
+		if useIdentiyConfig {
+			configEntry.IdentityFile = sessionKeyPath(envMap[buildSlugEnvVar])
 
-		logger.Info("Ensuring SSH key is available...")
-		if err := ensureClientKeyOnRemote(client); err != nil {
-			if errors.Unwrap(err) == ErrRemoteFileExists {
-				logger.Info("SSH key already ensured")
-			} else {
-				logger.Warnf("ensure SSH key available on remote: %s", err)
+			if err := removeStaleLocalKeys(configEntry.IdentityFile); err != nil {
+				progress.Fail(StageSessionKey, "remove SSH keys of earlier sessions", err)
 			}
-		} else {
-			logger.Success("SSH key ensured")
 		}
 
-		logger.Info("Adding message of the day to shell configs...")
-		if err := setupShellConfigs(client, []string{"~/.zshrc", "~/.bashrc"}); err != nil {
-			logger.Infof("modifying shell config: %s", err)
-		} else {
-			logger.Success("MOTD added to shell configs")
+		onRemoteDetected(useIdentiyConfig)
+
+		// A server left running by an earlier session connected with the same key and config
+		running := runningIDEServers(client)
+		if len(running) > 0 {
+			logger.Info(i18n.T("Reusing the %s already running on the VM", strings.Join(running, ", ")))
 		}
 
-		onEssentialsDone(useIdentiyConfig, sourceDir)
+		if useIdentiyConfig {
+			keyInstallDone := metrics.Start(metrics.KeyInstall)
+			progress.Start(StageSessionKey, i18n.T("Ensuring SSH key is available..."))
+			keyResource := authorizedKeyResource{keyPath: configEntry.IdentityFile}
+			authorized, _ := keyResource.check(client)
+			if authorized {
+				progress.Skip(StageSessionKey, i18n.T("SSH key already ensured"))
+			} else if err := keyResource.apply(client); err != nil {
+				progress.Fail(StageSessionKey, "ensure SSH key available on remote", err)
+			} else {
+				progress.Succeed(StageSessionKey, i18n.T("SSH key ensured"))
+			}
 
-		logger.Info("Copying README file to remote...")
-		if err := copyItemSFTP(client, readmeItem); err != nil {
-			if err == ErrRemoteFileExists {
-				logger.Info("README file already copied")
+			progress.Start(StageKeyAuth, i18n.T("Verifying the SSH key is accepted..."))
+			if authorized && len(running) > 0 {
+				progress.Skip(StageKeyAuth, i18n.T("SSH key already accepted by the running server's session"))
+			} else if err := verifyKeyAuth(client, configEntry); err != nil {
+				// The editor is given the password instead of a key that would not work
+				useIdentiyConfig = false
+				progress.Fail(StageKeyAuth, "verify SSH key, falling back to password", err)
 			} else {
-				logger.Warnf("copy README file to remote: %s", err)
+				progress.Succeed(StageKeyAuth, i18n.T("SSH key accepted"))
 			}
+			if useIdentiyConfig {
+				keyInstallDone(nil)
+			} else {
+				keyInstallDone(fmt.Errorf("the SSH key can't be used"))
+			}
+		}
+
+		progress.Start(StageMotd, i18n.T("Adding message of the day to shell configs..."))
+		if err := setupShellConfigs(client, shellConfigsFor(remoteShell(client))); err != nil {
+			progress.Fail(StageMotd, "modifying shell config", err)
 		} else {
-			logger.Success("README file copied")
+			progress.Succeed(StageMotd, i18n.T("MOTD added to shell configs"))
 		}
+
+		onEssentialsDone(useIdentiyConfig, sourceDir, LaunchInfo{ContextFiles: contextFiles(client, build, stepLog), SlowLink: slowLink})
+
+		copyReadme(client, slowLink, readmeResource{item: readmeCopyItem(sourceDir, revision, stepLog), sftp: true})
+
+		adviseStack(client, build, revision)
 	} else if isLinux(envMap[osTypeEnvVar]) {
 		// Skipping SSH key and MOTD setup for Linux stack because we encountered issues with ssh-copy-id
 		// it's probably caused by our Linux stack setup where the VM runs a Docker container and remote access connects the two with `docker exec`.
@@ -472,28 +799,34 @@ func setupRemoteConfig(configEntry *configEntry, onRemoteDetected func(bool), on
 			sourceDir = "/bitrise/src"
 		}
 
-		onEssentialsDone(useIdentiyConfig, sourceDir)
+		onEssentialsDone(useIdentiyConfig, sourceDir, LaunchInfo{ContextFiles: contextFiles(client, build, stepLog), SlowLink: slowLink})
 
-		logger.Info("Copying README file to remote...")
-		if err := copyItemSSH(client, readmeItem); err != nil {
-			if err == ErrRemoteFileExists {
-				logger.Info("README file already copied")
-			} else {
-				logger.Warnf("copy README file to remote: %s", err)
-			}
-		} else {
-			logger.Success("README file copied")
-		}
+		copyReadme(client, slowLink, readmeResource{item: readmeCopyItem(sourceDir, revision, stepLog)})
 	} else {
-		logger.Warnf("Unrecognized OS type: %s", envMap[osTypeEnvVar])
+		logger.Warn(i18n.T("Unrecognized OS type: %s", envMap[osTypeEnvVar]))
 
 		onRemoteDetected(useIdentiyConfig)
-		onEssentialsDone(useIdentiyConfig, sourceDir)
+		onEssentialsDone(useIdentiyConfig, sourceDir, LaunchInfo{SlowLink: slowLink})
 	}
 
 	return nil
 }
 
+func copyReadme(client *cryptoSSH.Client, slowLink bool, readme readmeResource) {
+	if slowLink {
+		progress.Skip(StageReadme, i18n.T("README copy skipped on the slow link"))
+		return
+	}
+	progress.Start(StageReadme, i18n.T("Copying README file to remote..."))
+	if copied, _ := readme.check(client); copied {
+		progress.Skip(StageReadme, i18n.T("README file already copied"))
+	} else if err := readme.apply(client); err != nil {
+		progress.Fail(StageReadme, "copy README file to remote", err)
+	} else {
+		progress.Succeed(StageReadme, i18n.T("README file copied"))
+	}
+}
+
 func isMacOS(osType string) bool {
 	return strings.Contains(osType, "darwin")
 }
@@ -0,0 +1,108 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClientConfigHostName(t *testing.T) {
+	useTempDirs(t)
+
+	tests := []struct {
+		name     string
+		hostName string
+		written  string
+	}{
+		{name: "IPv4", hostName: "10.0.0.1", written: "HostName 10.0.0.1"},
+		{name: "IPv6", hostName: "2001:db8::1", written: "HostName 2001:db8::1"},
+		{name: "IPv6 with zone ID", hostName: "fe80::1%en0", written: "HostName fe80::1%%en0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &configEntry{Host: BitriseHostPattern, HostName: tt.hostName, User: "vagrant", Port: "22"}
+
+			host := makeSSHConfigHost(entry, false)
+			if !strings.Contains(host.String(), tt.written) {
+				t.Errorf("makeSSHConfigHost() = %q, want it to contain %q", host.String(), tt.written)
+			}
+
+			if err := writeSSHClientConfig(bitriseConfigPath(), entry, false); err != nil {
+				t.Fatal(err)
+			}
+			read, err := readSSHClientConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read.HostName != tt.hostName {
+				t.Errorf("readSSHClientConfig().HostName = %q, want %q", read.HostName, tt.hostName)
+			}
+		})
+	}
+}
+
+func TestSetupRemoteConfig(t *testing.T) {
+	useTempDirs(t)
+	server := newTestServer(t, macOSStack())
+	server.use(t)
+
+	var detected, launched bool
+	var launchedWithKey bool
+	var launchedFolder string
+	err := setupRemoteConfig(server.entry(), true, func(useIdentityKey bool) {
+		detected = true
+	}, func(useIdentityKey bool, folderPath string, info LaunchInfo) {
+		launched = true
+		launchedWithKey = useIdentityKey
+		launchedFolder = folderPath
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !detected || !launched {
+		t.Fatalf("detected = %t, launched = %t, want both", detected, launched)
+	}
+	if !launchedWithKey {
+		t.Error("the IDE is launched with the password, want the session key")
+	}
+	if launchedFolder != server.path("git") {
+		t.Errorf("folder = %q, want the source dir", launchedFolder)
+	}
+
+	keyPath := sessionKeyPath("build-slug")
+	publicKey, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		t.Fatalf("session key not generated: %s", err)
+	}
+	authorizedKeys, err := os.ReadFile(server.path(authorizedKeysPath))
+	if err != nil {
+		t.Fatalf("authorized_keys not written: %s", err)
+	}
+	if !strings.Contains(string(authorizedKeys), strings.TrimSpace(string(publicKey))) {
+		t.Errorf("authorized_keys = %q, want it to contain the session key", authorizedKeys)
+	}
+	if _, err := os.Stat(filepath.Join(server.path("git"), remoteReadmeFileName)); err != nil {
+		t.Errorf("README not copied: %s", err)
+	}
+	if !knownHostsContain(t, server.hostKey) {
+		t.Error("the host key is not recorded in known_hosts")
+	}
+}
+
+func TestSetupRemoteConfigWrongPassword(t *testing.T) {
+	useTempDirs(t)
+	server := newTestServer(t, macOSStack())
+	server.use(t)
+
+	entry := server.entry()
+	wrong := "wrong"
+	entry.Password = &wrong
+	err := setupRemoteConfig(entry, true, func(bool) {
+		t.Error("the remote is detected without logging in")
+	}, func(bool, string, LaunchInfo) {})
+	if err == nil {
+		t.Fatal("setupRemoteConfig() succeeded with a wrong password")
+	}
+}
@@ -0,0 +1,146 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+var (
+	// xcodeStackPattern matches the Xcode version in a stack ID, eg. osx-xcode-16.0.x
+	xcodeStackPattern = regexp.MustCompile(`xcode-(\d+(?:\.\d+)*)`)
+	// xcodeVersionPattern matches the version in the output of xcodebuild -version, eg. Xcode 16.0
+	xcodeVersionPattern = regexp.MustCompile(`Xcode (\d+(?:\.\d+)*)`)
+)
+
+// StackInfo is the stack the build ran on, compared with the one its bitrise.yml declares and the local Xcode.
+type StackInfo struct {
+	// Revision is the stack revision of the VM, BITRISE_OSX_STACK_REV_ID
+	Revision string `json:"revision,omitempty"`
+	// Declared is the stack of the workflow in bitrise.yml, empty if the app's default stack is used
+	Declared    string `json:"declared,omitempty"`
+	RemoteXcode string `json:"remote_xcode,omitempty"`
+	LocalXcode  string `json:"local_xcode,omitempty"`
+}
+
+// DetectStack returns the stack of the VM of the last session.
+func DetectStack(password *string) (*StackInfo, error) {
+	var stack *StackInfo
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		envVars := append([]string{revisionEnvVar, revisionEnvVarUbuntu}, buildContextEnvVars...)
+		envMap, err := runWithPty(client, &envVars, "echo $", true)
+		if err != nil {
+			return fmt.Errorf("detect remote environment: %w", err)
+		}
+		revision := envMap[revisionEnvVar]
+		if revision == "" {
+			revision = envMap[revisionEnvVarUbuntu]
+		}
+		stack = detectStack(client, newBuildContext(envMap), revision)
+		return nil
+	})
+	return stack, err
+}
+
+// detectStack collects what's known about the stack, the parts that can't be read are left empty.
+func detectStack(client *cryptoSSH.Client, build *buildContext, revision string) *StackInfo {
+	stack := &StackInfo{Revision: strings.TrimSpace(revision)}
+
+	if configPath, err := findBitriseYML(client, build); err == nil {
+		if config, err := readBitriseYML(client, configPath); err == nil {
+			stack.Declared = declaredStack(config, build.Workflow)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+	if output, err := runCommandOutput(ctx, client, "xcodebuild -version 2>/dev/null"); err == nil {
+		stack.RemoteXcode = xcodeVersion(output)
+	}
+
+	if runtime.GOOS == "darwin" {
+		if output, err := localCommands.Output("xcodebuild", "-version"); err == nil {
+			stack.LocalXcode = xcodeVersion(string(output))
+		}
+	}
+	return stack
+}
+
+// declaredStack returns the stack the workflow's meta sets, or the one of the whole bitrise.yml.
+func declaredStack(config map[string]any, workflow string) string {
+	workflows, _ := config["workflows"].(map[string]any)
+	definition, _ := workflows[workflow].(map[string]any)
+	if stack := metaStack(definition); stack != "" {
+		return stack
+	}
+	return metaStack(config)
+}
+
+func metaStack(definition map[string]any) string {
+	meta, _ := definition["meta"].(map[string]any)
+	bitriseMeta, _ := meta["bitrise.io"].(map[string]any)
+	stack, _ := bitriseMeta["stack"].(string)
+	return strings.TrimSpace(stack)
+}
+
+func xcodeVersion(output string) string {
+	if match := xcodeVersionPattern.FindStringSubmatch(output); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// sameVersion compares the components both versions have, so 16.0 matches 16.0.1 and the x of 16.0.x anything.
+func sameVersion(a, b string) bool {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		if aParts[i] != bParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// majorMinor cuts the version to its first two components, patch releases rarely explain a difference.
+func majorMinor(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return strings.Join(parts, ".")
+}
+
+// Advice returns the differences that make a build behave differently than expected, eg. on the local machine.
+func (s *StackInfo) Advice() []string {
+	var advice []string
+	if match := xcodeStackPattern.FindStringSubmatch(s.Declared); match != nil && s.RemoteXcode != "" && !sameVersion(match[1], s.RemoteXcode) {
+		advice = append(advice, fmt.Sprintf("bitrise.yml declares the %s stack, but the VM has Xcode %s: the stack of the build might have been set in the app's settings or by the trigger",
+			s.Declared, s.RemoteXcode))
+	}
+	if s.RemoteXcode != "" && s.LocalXcode != "" && majorMinor(s.RemoteXcode) != majorMinor(s.LocalXcode) {
+		advice = append(advice, fmt.Sprintf("The VM has Xcode %s, this machine has Xcode %s: compiler and SDK differences can make the build pass on one and fail on the other",
+			s.RemoteXcode, s.LocalXcode))
+	}
+	return advice
+}
+
+// adviseStack prints the stack and Xcode version differences, a frequent cause of builds that only fail on the VM.
+func adviseStack(client *cryptoSSH.Client, build *buildContext, revision string) {
+	progress.Start(StageStack, i18n.T("Comparing the stack with bitrise.yml and the local Xcode..."))
+	advice := detectStack(client, build, revision).Advice()
+	if len(advice) == 0 {
+		progress.Succeed(StageStack, i18n.T("The stack matches"))
+		return
+	}
+	progress.Succeed(StageStack, i18n.T("The stack differs"))
+	for _, line := range advice {
+		logger.Warn(line)
+	}
+}
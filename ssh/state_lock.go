@@ -0,0 +1,132 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+)
+
+const (
+	stateLockName    = "state.lock"
+	stateLockPIDFile = "pid"
+	// stateLockWait is how long to wait for another session, its writes take milliseconds, only a stuck one takes longer
+	stateLockWait = 30 * time.Second
+	// stateLockStale is the age a lock is taken over at even if its PID runs, the PID may belong to another program by then
+	stateLockStale = 5 * time.Minute
+	stateLockPoll  = 100 * time.Millisecond
+)
+
+// stateMu serializes the writes of this process, the lock directory only keeps other processes out
+var stateMu sync.Mutex
+
+// StateLockedErr means another invocation, eg. auto in another terminal, is writing the SSH config or the keys.
+type StateLockedErr struct {
+	PID  int
+	Path string
+}
+
+func (e StateLockedErr) Error() string {
+	return fmt.Sprintf("another session (pid %d) is configuring the SSH config, try again once it's done, or remove %s if it's stuck", e.PID, e.Path)
+}
+
+func (e StateLockedErr) Category() failure.Category {
+	return failure.Config
+}
+
+// withStateLock runs the change of the shared local state, eg. ~/.ssh/config, the Bitrise SSH config or a session
+// key, while no other invocation of the CLI changes it. The lock is a directory, creating one is atomic everywhere.
+func withStateLock(change func() error) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	lockPath := filepath.Join(paths.StateDir(), stateLockName)
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	deadline := time.Now().Add(stateLockWait)
+	waiting := false
+	for {
+		err := os.Mkdir(lockPath, 0700)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("lock %s: %w", lockPath, err)
+		}
+
+		pid, held := stateLockOwner(lockPath)
+		if !held {
+			// The owner was killed before it could remove the lock
+			_ = os.RemoveAll(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return StateLockedErr{PID: pid, Path: lockPath}
+		}
+		if !waiting {
+			waiting = true
+			logger.Info(i18n.T("Another session (pid %d) is configuring the SSH config, waiting for it...", pid))
+		}
+		time.Sleep(stateLockPoll)
+	}
+	defer os.RemoveAll(lockPath)
+
+	// The PID is renamed into place, so the others never read it half written
+	pidPath := filepath.Join(lockPath, stateLockPIDFile)
+	if err := os.WriteFile(pidPath+".tmp", []byte(strconv.Itoa(os.Getpid())), 0600); err != nil {
+		return fmt.Errorf("lock %s: %w", lockPath, err)
+	}
+	if err := os.Rename(pidPath+".tmp", pidPath); err != nil {
+		return fmt.Errorf("lock %s: %w", lockPath, err)
+	}
+	return change()
+}
+
+// stateLockOwner returns the PID of the lock's owner and whether it still holds the lock.
+func stateLockOwner(lockPath string) (int, bool) {
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		// Removed meanwhile
+		return 0, false
+	}
+	if time.Since(info.ModTime()) > stateLockStale {
+		return 0, false
+	}
+
+	// Without a PID the owner has just created the directory, a lock it abandoned there is taken over once stale
+	content, err := os.ReadFile(filepath.Join(lockPath, stateLockPIDFile))
+	if err != nil {
+		return 0, true
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, true
+	}
+	return pid, processRunning(pid)
+}
+
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// Finding the process on Windows already opens it, which fails if it's gone
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
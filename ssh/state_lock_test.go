@@ -0,0 +1,52 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStateLockOwner(t *testing.T) {
+	tests := []struct {
+		name     string
+		pid      *string
+		stale    bool
+		wantHeld bool
+	}{
+		{name: "no PID yet", wantHeld: true},
+		{name: "empty PID", pid: ptrTo(""), wantHeld: true},
+		{name: "unparsable PID", pid: ptrTo("12a"), wantHeld: true},
+		{name: "running owner", pid: ptrTo(strconv.Itoa(os.Getpid())), wantHeld: true},
+		{name: "stale without PID", stale: true, wantHeld: false},
+		{name: "stale with running owner", pid: ptrTo(strconv.Itoa(os.Getpid())), stale: true, wantHeld: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lockPath := filepath.Join(t.TempDir(), stateLockName)
+			if err := os.Mkdir(lockPath, 0700); err != nil {
+				t.Fatal(err)
+			}
+			if tt.pid != nil {
+				if err := os.WriteFile(filepath.Join(lockPath, stateLockPIDFile), []byte(*tt.pid), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.stale {
+				modTime := time.Now().Add(-2 * stateLockStale)
+				if err := os.Chtimes(lockPath, modTime, modTime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, held := stateLockOwner(lockPath); held != tt.wantHeld {
+				t.Errorf("stateLockOwner() held = %t, want %t", held, tt.wantHeld)
+			}
+		})
+	}
+}
+
+func ptrTo(value string) *string {
+	return &value
+}
@@ -0,0 +1,96 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// failedStepLogTailLines is how much of the failed step's log is shown during the setup
+const failedStepLogTailLines = 30
+
+// xcodeRawLogEnvVars point to the raw xcodebuild output, the Xcode steps export them when they fail
+var xcodeRawLogEnvVars = []string{"BITRISE_XCODE_RAW_TEST_RESULT_TEXT_PATH", "BITRISE_XCODE_RAW_RESULT_TEXT_PATH"}
+
+// FailedStepLog returns the path of the failed step's log on the VM of the last session.
+func FailedStepLog(password *string) (string, error) {
+	var stepLog string
+	err := withClient(password, func(client *cryptoSSH.Client) error {
+		build, err := readBuildContext(client)
+		if err != nil {
+			return err
+		}
+		if stepLog = failedStepLog(client, build); stepLog == "" {
+			return fmt.Errorf("no failed step log found on the VM")
+		}
+		return nil
+	})
+	return stepLog, err
+}
+
+// failedStepLog returns the path of the log of the last failed step, empty if there is none. The raw logs the
+// Xcode steps exported are preferred, otherwise the newest log in the deploy dir is taken.
+func failedStepLog(client *cryptoSSH.Client, build *buildContext) string {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+
+	var candidates []string
+	for _, rawLog := range build.RawLogs {
+		candidates = append(candidates, fmt.Sprintf("[ -f %[1]s ] && echo %[1]s", shellQuote(rawLog)))
+	}
+	if build.DeployDir != "" {
+		candidates = append(candidates, fmt.Sprintf("find %s -maxdepth 2 -name '*.log' -type f 2>/dev/null | xargs ls -t 2>/dev/null | head -n 1", shellQuote(build.DeployDir)))
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	output, _ := runCommandOutput(ctx, client, "{ "+strings.Join(candidates, "; ")+"; } | head -n 1")
+	return strings.TrimSpace(output)
+}
+
+// showFailedStepLog prints the end of the failed step's log, so the failure is in view before the editor opens.
+// The path of the log is returned, empty if none was found.
+func showFailedStepLog(client *cryptoSSH.Client, build *buildContext) string {
+	progress.Start(StageStepLog, i18n.T("Looking for the log of the failed step..."))
+	stepLog := failedStepLog(client, build)
+	if stepLog == "" {
+		progress.Skip(StageStepLog, i18n.T("No failed step log found"))
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout)
+	defer cancel()
+	tail, err := runCommandOutput(ctx, client, fmt.Sprintf("tail -n %d %s", failedStepLogTailLines, shellQuote(stepLog)))
+	if err != nil {
+		progress.Fail(StageStepLog, "read "+stepLog, err)
+		return stepLog
+	}
+	progress.Emit(progress.Event{
+		Stage:    StageStepLog,
+		Status:   progress.Succeeded,
+		Message:  "Found the log of the failed step",
+		Metadata: map[string]string{"path": stepLog},
+	})
+
+	logger.PrintFormattedOutput(fmt.Sprintf("Last lines of %s", stepLog), strings.TrimRight(tail, "\n"))
+	return stepLog
+}
+
+// contextFiles returns the files that give context to the debugging session, opened next to the source code:
+// the build's bitrise.yml and the log of the failed step.
+func contextFiles(client *cryptoSSH.Client, build *buildContext, stepLog string) []string {
+	var files []string
+	if configPath, err := findBitriseYML(client, build); err == nil {
+		files = append(files, configPath)
+	}
+	if stepLog != "" {
+		files = append(files, stepLog)
+	}
+	return files
+}
@@ -0,0 +1,69 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+)
+
+const (
+	transferChunkSize = 256 * 1024
+	// progressInterval limits the progress events of a single file
+	progressInterval = 2 * time.Second
+)
+
+// streamCopy copies in chunks without holding the content in memory, reporting the progress of large files.
+// offset is the size already transferred by an earlier, interrupted transfer.
+func streamCopy(dst io.Writer, src io.Reader, name string, offset, total int64) (int64, error) {
+	reader := &progressReader{
+		reader:      src,
+		name:        name,
+		transferred: offset,
+		total:       total,
+		lastReport:  time.Now(),
+	}
+	return io.CopyBuffer(dst, reader, make([]byte, transferChunkSize))
+}
+
+type progressReader struct {
+	reader      io.Reader
+	name        string
+	transferred int64
+	total       int64
+	lastReport  time.Time
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.transferred += int64(n)
+
+	if time.Since(r.lastReport) >= progressInterval {
+		r.lastReport = time.Now()
+		progress.Emit(progress.Event{
+			Stage:   StageTransfer,
+			Status:  progress.Progressed,
+			Message: fmt.Sprintf("Copying %s: %s / %s", r.name, formatBytes(r.transferred), formatBytes(r.total)),
+			Metadata: map[string]string{
+				"file":        r.name,
+				"transferred": fmt.Sprint(r.transferred),
+				"total":       fmt.Sprint(r.total),
+			},
+		})
+	}
+	return n, err
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
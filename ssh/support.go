@@ -0,0 +1,35 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// redactedConfigKeys are the options of the generated host entry that tell who and where the VM is
+var redactedConfigKeys = []string{"hostname", "user", "identityfile", "proxycommand", "bindaddress"}
+
+// RedactedClientConfig returns the generated host entry with the address of the VM, the user and the local paths
+// left out, eg. to attach it to a bug report.
+func RedactedClientConfig() (string, error) {
+	content, err := os.ReadFile(bitriseConfigPath())
+	if err != nil {
+		return "", fmt.Errorf("read SSH config: %w", err)
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSuffix(fields[0], "="))
+		for _, redacted := range redactedConfigKeys {
+			if key == redacted {
+				indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+				lines[i] = indent + fields[0] + " <redacted>"
+			}
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
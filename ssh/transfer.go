@@ -0,0 +1,420 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+	"github.com/pkg/sftp"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+const (
+	// StageTransfer is the progress stage of push, pull and sync
+	StageTransfer = "transfer"
+
+	// DefaultTransferConcurrency is the number of files copied at the same time,
+	// many small files (eg. node_modules) are limited by the round trips, not the bandwidth
+	DefaultTransferConcurrency = 8
+	// DefaultTransferRetries is how many times a failed file is tried again, continuing where it stopped
+	DefaultTransferRetries = 2
+
+	transferRetryDelay = time.Second
+	// maxConcurrentRequests is the default per-file limit of pkg/sftp
+	maxConcurrentRequests = 64
+)
+
+// TransferOptions configure Push and Pull.
+type TransferOptions struct {
+	// OnlyChanged skips the files with the same size and modification time on both sides
+	OnlyChanged bool
+	// Resume continues the files that are smaller at the destination, eg. after a dropped connection
+	Resume bool
+	// Verify compares the SHA-256 of both sides after the transfer
+	Verify bool
+	// Concurrency defaults to DefaultTransferConcurrency
+	Concurrency int
+	// Retries defaults to DefaultTransferRetries, negative values disable retrying
+	Retries int
+}
+
+func (o TransferOptions) concurrency() int {
+	if o.Concurrency <= 0 {
+		return DefaultTransferConcurrency
+	}
+	return o.Concurrency
+}
+
+func (o TransferOptions) retries() int {
+	if o.Retries == 0 {
+		return DefaultTransferRetries
+	}
+	return max(o.Retries, 0)
+}
+
+// fileJob is a regular file to copy, directories and symlinks are created while walking the tree.
+type fileJob struct {
+	src, dst string
+	info     fs.FileInfo
+}
+
+// Push copies a local file or directory to the VM of the last session, keeping permissions and symlinks.
+func Push(localPath, remotePath string, password *string, options TransferOptions) error {
+	return withSFTP(password, options.concurrency(), func(client *cryptoSSH.Client, sftpClient *sftp.Client) error {
+		jobs, err := pushTree(sftpClient, localPath, remotePath)
+		if err != nil {
+			return err
+		}
+		err = runJobs(jobs, options, func(job fileJob, retry bool) error {
+			if options.OnlyChanged && !retry {
+				if remote, err := sftpClient.Stat(job.dst); err == nil && sameFile(job.info, remote) {
+					return nil
+				}
+			}
+			return pushFile(sftpClient, job, options.Resume || retry)
+		})
+		if err != nil || !options.Verify {
+			return err
+		}
+		return verifyTransfers(client, jobs, true)
+	})
+}
+
+// Pull copies a file or directory from the VM of the last session to the local machine.
+func Pull(remotePath, localPath string, password *string, options TransferOptions) error {
+	return withSFTP(password, options.concurrency(), func(client *cryptoSSH.Client, sftpClient *sftp.Client) error {
+		jobs, err := pullTree(sftpClient, remotePath, localPath)
+		if err != nil {
+			return err
+		}
+		err = runJobs(jobs, options, func(job fileJob, retry bool) error {
+			if options.OnlyChanged && !retry {
+				if local, err := os.Stat(job.dst); err == nil && sameFile(job.info, local) {
+					return nil
+				}
+			}
+			return pullFile(sftpClient, job, options.Resume || retry)
+		})
+		if err != nil || !options.Verify {
+			return err
+		}
+		return verifyTransfers(client, jobs, false)
+	})
+}
+
+// withSFTP connects to the VM of the last session, the password is only needed without a session key.
+func withSFTP(password *string, concurrency int, transfer func(*cryptoSSH.Client, *sftp.Client) error) error {
+	return withClient(password, func(client *cryptoSSH.Client) error {
+		sftpClient, err := newTransferClient(client, concurrency)
+		if err != nil {
+			return err
+		}
+		defer sftpClient.Close()
+
+		return transfer(client, sftpClient)
+	})
+}
+
+// withClient connects to the VM of the last session like withSFTP, for commands that don't copy files.
+func withClient(password *string, run func(*cryptoSSH.Client) error) error {
+	client, err := connectLastSession(password)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return run(client)
+}
+
+// LastSession returns the address of the last session's VM as user@host:port.
+func LastSession() (string, error) {
+	configEntry, err := readSSHClientConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ConfigErr{err: fmt.Errorf("no session found, connect to the build first")}
+		}
+		return "", fmt.Errorf("read SSH config entry: %w", err)
+	}
+	return fmt.Sprintf("%s@%s", configEntry.User, net.JoinHostPort(configEntry.HostName, configEntry.Port)), nil
+}
+
+// connectLastSession connects to the VM of the last session, the password is only needed without a session key.
+// The connection of the daemon is used when it's running and connected to the same VM.
+func connectLastSession(password *string) (*cryptoSSH.Client, error) {
+	configEntry, err := readSSHClientConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ConfigErr{err: fmt.Errorf("no session found, connect to the build first")}
+		}
+		return nil, fmt.Errorf("read SSH config entry: %w", err)
+	}
+
+	if client, err := connectDaemonOf(configEntry); err == nil {
+		return client, nil
+	} else if !errors.Is(err, ErrDaemonNotRunning) {
+		logger.Warnf("use the connection of the daemon: %s", err)
+	}
+
+	configEntry.Password = password
+	if _, err := os.Stat(configEntry.IdentityFile); err != nil {
+		configEntry.IdentityFile = ""
+	}
+
+	client, err := connectSSHClient(configEntry)
+	if err != nil && password != nil && failure.CategoryOf(err) == failure.Auth {
+		return nil, failure.New(failure.Auth, fmt.Errorf("%w: %w", ErrPasswordRejected, err))
+	}
+	return client, err
+}
+
+// connectDaemonOf returns the shared connection of the daemon if it's connected to the VM of the config entry.
+// A daemon left running from an earlier session would reach another build.
+func connectDaemonOf(configEntry *configEntry) (*cryptoSSH.Client, error) {
+	status, err := QueryDaemon()
+	if err != nil {
+		return nil, err
+	}
+	if status.Host != configEntry.HostName {
+		return nil, fmt.Errorf("it's connected to %s instead of %s, stop it with the daemon stop command", status.Host, configEntry.HostName)
+	}
+	return connectSharedConnection()
+}
+
+func newTransferClient(client *cryptoSSH.Client, concurrency int) (*sftp.Client, error) {
+	// Every worker keeps requests in flight for its file, so the per-file limit is shared among them
+	sftpClient, err := sftp.NewClient(client, sftp.UseConcurrentWrites(true), sftp.MaxConcurrentRequestsPerFile(max(maxConcurrentRequests/concurrency, 1)))
+	if err != nil {
+		return nil, fmt.Errorf("create SFTP client: %w", err)
+	}
+	return sftpClient, nil
+}
+
+// pushTree creates the directories and symlinks on the remote and returns the files to copy.
+func pushTree(sftpClient *sftp.Client, localRoot, remoteRoot string) ([]fileJob, error) {
+	var jobs []fileJob
+	err := filepath.WalkDir(localRoot, func(localPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(localRoot, localPath)
+		if err != nil {
+			return err
+		}
+		remotePath := path.Join(remoteRoot, filepath.ToSlash(relative))
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			if err := sftpClient.MkdirAll(remotePath); err != nil {
+				return fmt.Errorf("create remote directory %s: %w", remotePath, err)
+			}
+			return sftpClient.Chmod(remotePath, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			// Links are recreated as they are, relative links keep working inside the copied tree
+			target, err := os.Readlink(localPath)
+			if err != nil {
+				return err
+			}
+			_ = sftpClient.Remove(remotePath)
+			if err := sftpClient.Symlink(target, remotePath); err != nil {
+				return fmt.Errorf("create remote symlink %s: %w", remotePath, err)
+			}
+		case info.Mode().IsRegular():
+			jobs = append(jobs, fileJob{src: localPath, dst: remotePath, info: info})
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// pullTree creates the directories and symlinks locally and returns the files to copy.
+func pullTree(sftpClient *sftp.Client, remoteRoot, localRoot string) ([]fileJob, error) {
+	var jobs []fileJob
+	walker := sftpClient.Walk(remoteRoot)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+		remotePath, info := walker.Path(), walker.Stat()
+
+		relative, err := filepath.Rel(filepath.FromSlash(remoteRoot), filepath.FromSlash(remotePath))
+		if err != nil {
+			return nil, err
+		}
+		localPath := filepath.Join(localRoot, relative)
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(localPath, 0755); err != nil {
+				return nil, fmt.Errorf("create directory %s: %w", localPath, err)
+			}
+			if err := os.Chmod(localPath, info.Mode().Perm()); err != nil {
+				return nil, err
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := sftpClient.ReadLink(remotePath)
+			if err != nil {
+				return nil, fmt.Errorf("read remote symlink %s: %w", remotePath, err)
+			}
+			_ = os.Remove(localPath)
+			if err := os.Symlink(target, localPath); err != nil {
+				return nil, fmt.Errorf("create symlink %s: %w", localPath, err)
+			}
+		case info.Mode().IsRegular():
+			jobs = append(jobs, fileJob{src: remotePath, dst: localPath, info: info})
+		}
+	}
+	return jobs, nil
+}
+
+func pushFile(sftpClient *sftp.Client, job fileJob, resume bool) error {
+	src, err := os.Open(job.src)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var offset int64
+	if resume {
+		if remote, err := sftpClient.Stat(job.dst); err == nil && remote.Size() < job.info.Size() {
+			offset = remote.Size()
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	dst, err := sftpClient.OpenFile(job.dst, flags)
+	if err != nil {
+		return fmt.Errorf("open remote file %s: %w", job.dst, err)
+	}
+	defer dst.Close()
+
+	if err := seekBoth(src, dst, offset); err != nil {
+		return fmt.Errorf("resume %s: %w", job.src, err)
+	}
+	if _, err := streamCopy(dst, src, job.src, offset, job.info.Size()); err != nil {
+		return fmt.Errorf("copy %s: %w", job.src, err)
+	}
+	if err := sftpClient.Chmod(job.dst, job.info.Mode().Perm()); err != nil {
+		return err
+	}
+	// Keeping the modification time lets later syncs skip the file
+	return sftpClient.Chtimes(job.dst, job.info.ModTime(), job.info.ModTime())
+}
+
+func pullFile(sftpClient *sftp.Client, job fileJob, resume bool) error {
+	src, err := sftpClient.Open(job.src)
+	if err != nil {
+		return fmt.Errorf("open remote file %s: %w", job.src, err)
+	}
+	defer src.Close()
+
+	var offset int64
+	if resume {
+		if local, err := os.Stat(job.dst); err == nil && local.Size() < job.info.Size() {
+			offset = local.Size()
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	dst, err := os.OpenFile(job.dst, flags, job.info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if err := seekBoth(src, dst, offset); err != nil {
+		return fmt.Errorf("resume %s: %w", job.src, err)
+	}
+	if _, err := streamCopy(dst, src, job.src, offset, job.info.Size()); err != nil {
+		return fmt.Errorf("copy %s: %w", job.src, err)
+	}
+	if err := dst.Chmod(job.info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(job.dst, job.info.ModTime(), job.info.ModTime())
+}
+
+// seekBoth moves both files to the offset of a resumed transfer.
+func seekBoth(src, dst io.Seeker, offset int64) error {
+	if offset == 0 {
+		return nil
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := dst.Seek(offset, io.SeekStart)
+	return err
+}
+
+// runJobs copies the files with a pool of workers, reporting every file as a progress event.
+// Failed files are retried, copy is told to continue the partial file then.
+func runJobs(jobs []fileJob, options TransferOptions, copy func(job fileJob, retry bool) error) error {
+	queue := make(chan fileJob)
+	var mu sync.Mutex
+	var errs []error
+
+	var wg sync.WaitGroup
+	for range min(options.concurrency(), len(jobs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if err := copyWithRetry(job, options.retries(), copy); err != nil {
+					progress.Fail(StageTransfer, fmt.Sprintf("copy %s", job.src), err)
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+					continue
+				}
+				progress.Succeed(StageTransfer, fmt.Sprintf("Copied %s", job.src))
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// sameFile compares the size and the modification time, SFTP only keeps the time in seconds.
+func copyWithRetry(job fileJob, retries int, copy func(job fileJob, retry bool) error) error {
+	err := copy(job, false)
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		progress.Emit(progress.Event{
+			Stage:   StageTransfer,
+			Status:  progress.Progressed,
+			Message: fmt.Sprintf("Copying %s failed, retrying (%d/%d): %s", job.src, attempt, retries, err),
+		})
+		time.Sleep(transferRetryDelay * time.Duration(attempt))
+		err = copy(job, true)
+	}
+	return err
+}
+
+func sameFile(a, b fs.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Truncate(time.Second).Equal(b.ModTime().Truncate(time.Second))
+}
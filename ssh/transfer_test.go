@@ -0,0 +1,65 @@
+package ssh
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConnectLastSessionSkipsDaemonOfOtherVM(t *testing.T) {
+	useTempDirs(t)
+	server := newTestServer(t, nil)
+	server.use(t)
+	entry := server.entry()
+	if err := writeSSHClientConfig(bitriseConfigPath(), entry, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// A daemon left running from the session of another build
+	if err := os.MkdirAll(filepath.Dir(DaemonSocketPath()), 0700); err != nil {
+		t.Fatal(err)
+	}
+	control, err := net.Listen("unix", DaemonSocketPath())
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %s", err)
+	}
+	defer control.Close()
+	go func() {
+		for {
+			conn, err := control.Accept()
+			if err != nil {
+				return
+			}
+			_ = json.NewEncoder(conn).Encode(DaemonStatus{Host: "10.0.0.2", Connected: true})
+			conn.Close()
+		}
+	}()
+	shared, err := net.Listen("unix", sharedConnectionSocketPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Close()
+	var sharedUsed atomic.Bool
+	go func() {
+		for {
+			conn, err := shared.Accept()
+			if err != nil {
+				return
+			}
+			sharedUsed.Store(true)
+			conn.Close()
+		}
+	}()
+
+	client, err := connectLastSession(entry.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if sharedUsed.Load() {
+		t.Error("the connection of the daemon is used, it's connected to another VM")
+	}
+}
@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/websocket"
+)
+
+const transportDialTimeout = 30 * time.Second
+
+// webSocketURL is the endpoint the SSH connection is tunneled through, empty for direct connections
+var webSocketURL string
+
+// proxyCommandURLPattern reads the endpoint back from the ProxyCommand of the host entry
+var proxyCommandURLPattern = regexp.MustCompile(`--websocket-url "([^"]+)"`)
+
+// SetWebSocketURL tunnels the SSH connections through the WebSocket endpoint instead of dialing the VM directly,
+// for networks that block outbound SSH ports. The IDEs use the same endpoint through ProxyCommand.
+func SetWebSocketURL(endpoint string) {
+	webSocketURL = endpoint
+}
+
+// dialVM opens the connection the SSH client runs on, directly or through the WebSocket endpoint of the entry.
+func dialVM(configEntry *configEntry, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	address := net.JoinHostPort(configEntry.HostName, configEntry.Port)
+	if transportOverride != nil {
+		return transportOverride.Dial(ctx, address)
+	}
+	if configEntry.WebSocketURL == "" {
+		return tcpTransport{bindAddress: configEntry.BindAddress}.Dial(ctx, address)
+	}
+
+	target, err := webSocketTarget(configEntry.WebSocketURL, configEntry.HostName, configEntry.Port)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := websocket.Dial(ctx, target)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "websocket", Err: err}
+	}
+	return conn, nil
+}
+
+// webSocketTarget adds the VM's address to the endpoint in the host and port query parameters.
+func webSocketTarget(endpoint, host, port string) (string, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("parse WebSocket URL: %w", err)
+	}
+	query := target.Query()
+	query.Set("host", host)
+	query.Set("port", port)
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// proxyCommand returns the ProxyCommand value running this executable's proxy command for the endpoint.
+// % starts a token in ssh_config, so the percent-encoded characters of the URL are escaped.
+func proxyCommand(endpoint string) string {
+	executable, err := os.Executable()
+	if err != nil {
+		executable = os.Args[0]
+	}
+	return fmt.Sprintf(`"%s" proxy --websocket-url "%s" %%h %%p`,
+		strings.Trim(configPathValue(executable), `"`), strings.ReplaceAll(endpoint, "%", "%%"))
+}
+
+// proxyCommandEndpoint returns the endpoint of a ProxyCommand written by proxyCommand, empty for other values.
+func proxyCommandEndpoint(value string) string {
+	match := proxyCommandURLPattern.FindStringSubmatch(value)
+	if match == nil {
+		return ""
+	}
+	return strings.ReplaceAll(match[1], "%%", "%")
+}
+
+// Proxy copies between stdin/stdout and the VM's SSH port through the WebSocket endpoint, it's the ProxyCommand
+// of the host entry so the IDEs' SSH clients take the same route as the CLI.
+func Proxy(endpoint, host, port string, stdin io.Reader, stdout io.Writer) error {
+	conn, err := dialVM(&configEntry{HostName: host, Port: port, WebSocketURL: endpoint}, transportDialTimeout)
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", endpoint, err)
+	}
+	defer conn.Close()
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(conn, stdin)
+		done <- err
+	}()
+	go func() {
+		_, err := io.Copy(stdout, conn)
+		done <- err
+	}()
+	return <-done
+}
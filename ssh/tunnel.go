@@ -0,0 +1,98 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// tunnel forwards the connections of a local port to an address on the VM over the SSH client,
+// for the helpers that need a forward without an editor holding the connection open.
+type tunnel struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// openTunnel listens on localhost:localPort and forwards every connection to remoteAddress, eg. 127.0.0.1:1234.
+func openTunnel(client *cryptoSSH.Client, localPort int, remoteAddress string) (*tunnel, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+	if err != nil {
+		return nil, fmt.Errorf("listen on local port %d: %w", localPort, err)
+	}
+
+	t := &tunnel{listener: listener}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		for {
+			local, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go t.forward(client, local, remoteAddress)
+		}
+	}()
+	return t, nil
+}
+
+func (t *tunnel) forward(client *cryptoSSH.Client, local net.Conn, remoteAddress string) {
+	t.pipe(local, func() (net.Conn, error) { return client.Dial("tcp", remoteAddress) }, remoteAddress)
+}
+
+// pipe copies between the accepted connection and the one dialed to the target until either side closes.
+func (t *tunnel) pipe(local net.Conn, dial func() (net.Conn, error), remoteAddress string) {
+	defer local.Close()
+
+	remote, err := dial()
+	if err != nil {
+		logger.Warnf("forward to %s: %s", remoteAddress, err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst io.Writer, src io.Reader) {
+		if _, err := io.Copy(dst, src); err != nil && !errors.Is(err, net.ErrClosed) {
+			logger.Warnf("forward to %s: %s", remoteAddress, err)
+		}
+		done <- struct{}{}
+	}
+	go pipe(remote, local)
+	go pipe(local, remote)
+	// Either side closing ends the forwarded connection
+	<-done
+}
+
+// openReverseTunnel listens on localhost:remotePort of the VM and forwards every connection to localAddress.
+func openReverseTunnel(client *cryptoSSH.Client, remotePort int, localAddress string) (*tunnel, error) {
+	listener, err := client.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", remotePort))
+	if err != nil {
+		return nil, fmt.Errorf("listen on remote port %d: %w", remotePort, err)
+	}
+
+	t := &tunnel{listener: listener}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		for {
+			remote, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go t.pipe(remote, func() (net.Conn, error) { return net.Dial("tcp", localAddress) }, localAddress)
+		}
+	}()
+	return t, nil
+}
+
+// Close stops accepting connections, the forwarded ones end when the SSH client is closed.
+func (t *tunnel) Close() error {
+	err := t.listener.Close()
+	t.wg.Wait()
+	return err
+}
@@ -0,0 +1,81 @@
+package ssh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+	cryptoSSH "golang.org/x/crypto/ssh"
+)
+
+// verifyBatchSize limits the commands sent to the remote shell at once
+const verifyBatchSize = 200
+
+// verifyTransfers compares the SHA-256 of both sides of the copied files. The remote side is hashed on the VM,
+// so the files are not transferred again.
+func verifyTransfers(client *cryptoSSH.Client, jobs []fileJob, pushed bool) error {
+	progress.Start(StageTransfer, fmt.Sprintf("Verifying the checksums of %d files...", len(jobs)))
+
+	var mismatches []string
+	for start := 0; start < len(jobs); start += verifyBatchSize {
+		batch := jobs[start:min(start+verifyBatchSize, len(jobs))]
+
+		commands := make([]string, len(batch))
+		for i, job := range batch {
+			commands[i] = remoteHashCommand(remoteSide(job, pushed))
+		}
+		results, err := runWithPty(client, &commands, "", true)
+		if err != nil {
+			return fmt.Errorf("hash remote files: %w", err)
+		}
+
+		for i, job := range batch {
+			localHash, err := localFileHash(localSide(job, pushed))
+			if err != nil {
+				return fmt.Errorf("hash local file: %w", err)
+			}
+			if remoteHash := strings.TrimSpace(results[commands[i]]); remoteHash != localHash {
+				progress.Fail(StageTransfer, fmt.Sprintf("checksum mismatch: %s", job.src), fmt.Errorf("local %s, remote %s", localHash, remoteHash))
+				mismatches = append(mismatches, job.src)
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("checksum mismatch of %d files, copy them again: %s", len(mismatches), strings.Join(mismatches, ", "))
+	}
+	progress.Succeed(StageTransfer, "Checksums match")
+	return nil
+}
+
+func remoteSide(job fileJob, pushed bool) string {
+	if pushed {
+		return job.dst
+	}
+	return job.src
+}
+
+func localSide(job fileJob, pushed bool) string {
+	if pushed {
+		return job.src
+	}
+	return job.dst
+}
+
+func localFileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,61 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	waitPollInterval = 5 * time.Second
+	waitDialTimeout  = 5 * time.Second
+)
+
+// WaitForSSH polls the host until an SSH server answers on the port.
+// onPoll is called before every attempt with the time spent waiting so far, returning an error stops the wait.
+func WaitForSSH(host, port string, timeout time.Duration, onPoll func(elapsed time.Duration) error) error {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	address := net.JoinHostPort(host, port)
+
+	start := time.Now()
+	for {
+		if err := onPoll(time.Since(start)); err != nil {
+			return err
+		}
+
+		err := probeSSH(&configEntry{HostName: host, Port: port, WebSocketURL: webSocketURL, BindAddress: bindAddress})
+		if err == nil {
+			return nil
+		}
+
+		if time.Since(start) > timeout {
+			return fmt.Errorf("%s did not accept SSH connections in %s: %w", address, timeout, err)
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// probeSSH connects to the VM and checks for the SSH protocol banner, a listening port alone
+// is not enough as the VM's port forwarding accepts connections before sshd is up.
+func probeSSH(configEntry *configEntry) error {
+	conn, err := dialVM(configEntry, waitDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(waitDialTimeout)); err != nil {
+		return err
+	}
+
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read SSH banner: %w", err)
+	}
+	if !strings.HasPrefix(banner, "SSH-") {
+		return fmt.Errorf("unexpected banner: %q", strings.TrimSpace(banner))
+	}
+	return nil
+}
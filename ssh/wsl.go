@@ -0,0 +1,156 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
+)
+
+const wslMountRoot = "/mnt/"
+
+// IsWSL reports whether the CLI runs inside Windows Subsystem for Linux.
+// Editors launched from WSL are Windows applications, so they read the Windows side SSH config.
+func IsWSL() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	version, err := os.ReadFile("/proc/version")
+	return err == nil && strings.Contains(strings.ToLower(string(version)), "microsoft")
+}
+
+// windowsHomeDir returns the Windows user's home directory as seen from WSL, eg. /mnt/c/Users/bitrise.
+func windowsHomeDir() (string, error) {
+	out, err := localCommands.Output("cmd.exe", "/c", "echo %USERPROFILE%")
+	if err != nil {
+		return "", fmt.Errorf("query Windows home directory: %w", err)
+	}
+
+	profile := strings.TrimSpace(string(out))
+	if profile == "" || profile == "%USERPROFILE%" {
+		return "", fmt.Errorf("windows home directory is unknown")
+	}
+
+	return windowsToWSLPath(profile)
+}
+
+// windowsToWSLPath translates C:\Users\bitrise to /mnt/c/Users/bitrise.
+func windowsToWSLPath(path string) (string, error) {
+	if len(path) < 2 || path[1] != ':' {
+		return "", fmt.Errorf("not an absolute Windows path: %s", path)
+	}
+	drive := strings.ToLower(path[:1])
+	rest := strings.ReplaceAll(path[2:], `\`, "/")
+	return wslMountRoot + drive + rest, nil
+}
+
+// wslToWindowsPath translates /mnt/c/Users/bitrise to C:/Users/bitrise.
+// Forward slashes are kept, Windows OpenSSH handles them in config values.
+func wslToWindowsPath(path string) (string, error) {
+	if !strings.HasPrefix(path, wslMountRoot) || len(path) < len(wslMountRoot)+1 {
+		return "", fmt.Errorf("path is not on a Windows drive: %s", path)
+	}
+	rest := path[len(wslMountRoot):]
+	drive := strings.ToUpper(rest[:1])
+	return drive + ":" + rest[1:], nil
+}
+
+// mirrorClientConfigToWindows writes the host entry to the Windows side SSH config too,
+// copying the session key and known host over, as the Windows ssh client cannot use the WSL files.
+func mirrorClientConfigToWindows(configEntry *configEntry, useIdentityKey bool) error {
+	windowsHome, err := windowsHomeDir()
+	if err != nil {
+		return err
+	}
+
+	windowsEntry := *configEntry
+	windowsEntry.Password = nil
+
+	if useIdentityKey {
+		keyPath := filepath.Join(windowsHome, ".ssh", filepath.Base(configEntry.IdentityFile))
+		for _, suffix := range []string{"", ".pub"} {
+			if err := copyLocalFile(configEntry.IdentityFile+suffix, keyPath+suffix, 0600); err != nil {
+				return fmt.Errorf("copy SSH key: %w", err)
+			}
+		}
+		if windowsEntry.IdentityFile, err = wslToWindowsPath(keyPath); err != nil {
+			return err
+		}
+	}
+
+	knownHostsPath := filepath.Join(windowsHome, ".bitrise", "remote-access", "known_hosts")
+	if err := copyLocalFile(configEntry.KnownHostsFile, knownHostsPath, 0644); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("copy known hosts: %w", err)
+	}
+	if windowsEntry.KnownHostsFile, err = wslToWindowsPath(knownHostsPath); err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(windowsHome, ".bitrise", "remote-access", "ssh_config")
+	if err := writeSSHClientConfig(configPath, &windowsEntry, useIdentityKey); err != nil {
+		return err
+	}
+
+	includePath, err := wslToWindowsPath(configPath)
+	if err != nil {
+		return err
+	}
+	return ensureClientConfigIncluded(filepath.Join(windowsHome, ".ssh", "config"), includePath)
+}
+
+// HasWindowsMirror reports whether the host entry was written to the Windows SSH config too, so the editors on
+// Windows can connect to the VM.
+func HasWindowsMirror() bool {
+	return IsWSL() && hasWindowsMirror()
+}
+
+// hasWindowsMirror reports whether the host entry was written to the Windows SSH config too.
+func hasWindowsMirror() bool {
+	windowsHome, err := windowsHomeDir()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(windowsHome, ".bitrise", "remote-access", "ssh_config"))
+	return err == nil
+}
+
+// removeWindowsMirror deletes the files written by mirrorClientConfigToWindows.
+func removeWindowsMirror() error {
+	windowsHome, err := windowsHomeDir()
+	if err != nil {
+		return err
+	}
+
+	keys, err := filepath.Glob(filepath.Join(windowsHome, ".ssh", sshKeyPrefix+"*"))
+	if err != nil {
+		return err
+	}
+
+	paths := append(keys,
+		filepath.Join(windowsHome, ".bitrise", "remote-access", "ssh_config"),
+		filepath.Join(windowsHome, ".bitrise", "remote-access", "known_hosts"))
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyLocalFile(src, dst string, perm os.FileMode) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	defer interrupt.Track(dst)()
+	return os.WriteFile(dst, content, perm)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	pluginCommandName = ":remote"
+	standaloneName    = "bitrise-remote"
+	// pluginModeEnvVar is set by the Bitrise CLI when it runs a plugin
+	pluginModeEnvVar = "BITRISE_PLUGIN_INPUT_PLUGIN_MODE"
+)
+
+//go:embed bitrise-plugin.yml
+var pluginDefinition []byte
+
+// cliName is how the CLI was invoked, used in the usage texts and the suggested commands
+var cliName = invocationName()
+
+// invocationName returns `bitrise :remote` when running as a Bitrise CLI plugin, the name of the binary otherwise,
+// eg. bitrise-remote when started through the symlink of standalone-install.
+func invocationName() string {
+	if os.Getenv(pluginModeEnvVar) != "" {
+		return "bitrise " + pluginCommandName
+	}
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	if name == "" || name == "." {
+		return standaloneName
+	}
+	return name
+}
+
+// pluginManifest is the part of bitrise-plugin.yml the Bitrise CLI validates on install.
+type pluginManifest struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Executable  map[string]string `yaml:"executable"`
+}
+
+// pluginPlatform returns the executable key of the Bitrise CLI for this machine.
+func pluginPlatform() string {
+	platform := runtime.GOOS
+	if platform == "darwin" {
+		platform = "osx"
+	}
+	if runtime.GOARCH == "arm64" {
+		platform += "-arm64"
+	}
+	return platform
+}
+
+// checkPluginDefinition validates the plugin definition like the Bitrise CLI does on install, and looks for
+// the usual reasons of "plugin validation failed" on this machine. It returns the problems found.
+func checkPluginDefinition(content []byte) []string {
+	var problems []string
+
+	var manifest pluginManifest
+	if err := yaml.Unmarshal(content, &manifest); err != nil {
+		return append(problems, fmt.Sprintf("bitrise-plugin.yml is invalid: %s", err))
+	}
+	if manifest.Name == "" {
+		problems = append(problems, "bitrise-plugin.yml has no name")
+	}
+	if len(manifest.Executable) == 0 {
+		problems = append(problems, "bitrise-plugin.yml has no executables")
+	} else if manifest.Executable[pluginPlatform()] == "" {
+		problems = append(problems, fmt.Sprintf("no executable is released for %s, use the standalone binary instead", pluginPlatform()))
+	}
+
+	bitrisePath, err := exec.LookPath("bitrise")
+	if err != nil {
+		problems = append(problems, "the Bitrise CLI is not in $PATH, install it or use the standalone binary")
+		return problems
+	}
+	out, err := exec.Command(bitrisePath, "--version").Output()
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("the Bitrise CLI at %s doesn't run: %s", bitrisePath, err))
+	} else {
+		logger.Infof("Bitrise CLI %s at %s", strings.TrimSpace(string(out)), bitrisePath)
+	}
+	return problems
+}
+
+// installStandalone links the running binary as bitrise-remote into dir, and tells if dir is not on $PATH.
+func installStandalone(dir string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("find executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create directory: %w", err)
+	}
+	name := standaloneName
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	link := filepath.Join(dir, name)
+	if existing, err := os.Readlink(link); err == nil && existing == executable {
+		return link, nil
+	}
+	if _, err := os.Lstat(link); err == nil {
+		if err := os.Remove(link); err != nil {
+			return "", fmt.Errorf("replace %s: %w", link, err)
+		}
+	}
+	if err := os.Symlink(executable, link); err != nil {
+		return "", fmt.Errorf("link %s: %w", link, err)
+	}
+	return link, nil
+}
+
+// defaultStandaloneDir is the directory of user installed binaries, usually on $PATH.
+func defaultStandaloneDir() string {
+	return filepath.Join(paths.HomeDir(), ".local", "bin")
+}
+
+// onPath reports whether dir is one of the $PATH entries.
+func onPath(dir string) bool {
+	for _, entry := range filepath.SplitList(os.Getenv("PATH")) {
+		if filepath.Clean(entry) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func pluginCheck(ctx context.Context, cliCmd *cli.Command) error {
+	content := pluginDefinition
+	if file := cliCmd.String(fileFlag); file != "" {
+		var err error
+		if content, err = os.ReadFile(file); err != nil {
+			return failure.New(failure.Config, fmt.Errorf("read plugin definition: %w", err))
+		}
+	}
+
+	problems := checkPluginDefinition(content)
+	if len(problems) == 0 {
+		logger.Success("The plugin can be installed on this machine")
+		return nil
+	}
+	logger.PrintFormattedOutput("Plugin problems", "- "+strings.Join(problems, "\n- "))
+	logger.Infof("The binary works without the Bitrise CLI too, link it with `%s %s`", cliName, standaloneCmd)
+	return failure.New(failure.Config, fmt.Errorf("%d problem(s) found", len(problems)))
+}
+
+func standaloneInstall(ctx context.Context, cliCmd *cli.Command) error {
+	dir := cliCmd.String(dirFlag)
+	if dir == "" {
+		dir = defaultStandaloneDir()
+	}
+
+	link, err := installStandalone(dir)
+	if err != nil {
+		return failure.New(failure.Config, err)
+	}
+	logger.Successf("Linked %s", link)
+	if !onPath(dir) {
+		logger.Warnf("%s is not on $PATH, add it to your shell's config, eg. export PATH=\"%s:$PATH\"", dir, dir)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Package support collects what is needed to look into a bug report into a zip: the local logs, the generated
+// SSH config and the versions of the tools taking part in the connection. The address of the VM, the user and
+// the password are redacted.
+package support
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/auth"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/bitrise-io/bitrise-remote-access-cli/vscode"
+)
+
+const (
+	// TranscriptFileName is the progress log of the last connect, rewritten by every connect
+	TranscriptFileName = "last-session.log"
+
+	redacted = "<redacted>"
+	// maxLogSize is how much of the end of a log is kept, the start of a long daemon log is rarely relevant
+	maxLogSize = 1 << 20
+)
+
+// Create writes the bundle to zipPath with the logs that exist, and returns the names of the files in it.
+func Create(zipPath string, logPaths []string) ([]string, error) {
+	file, err := os.OpenFile(zipPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %w", zipPath, err)
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	redactor := newRedactor()
+	var names []string
+	add := func(name, content string) error {
+		writer, err := archive.Create(name)
+		if err != nil {
+			return fmt.Errorf("add %s: %w", name, err)
+		}
+		if _, err := io.WriteString(writer, redactor.Replace(content)); err != nil {
+			return fmt.Errorf("add %s: %w", name, err)
+		}
+		names = append(names, name)
+		return nil
+	}
+
+	if err := add("environment.txt", environment()); err != nil {
+		return nil, err
+	}
+	if config, err := ssh.RedactedClientConfig(); err == nil {
+		if err := add("ssh_config", config); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range logPaths {
+		content, err := tail(path)
+		if err != nil {
+			continue
+		}
+		if err := add(filepath.Base(path), content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("write %s: %w", zipPath, err)
+	}
+	return names, file.Close()
+}
+
+// newRedactor replaces the address and the credentials of the last session wherever they show up, eg. in the
+// error messages of the logs.
+func newRedactor() *strings.Replacer {
+	var pairs []string
+	if address, err := ssh.LastSession(); err == nil {
+		user, hostPort, _ := strings.Cut(address, "@")
+		host, _, _ := net.SplitHostPort(hostPort)
+		for _, value := range []string{host, user} {
+			if value != "" {
+				pairs = append(pairs, value, redacted)
+			}
+		}
+	}
+	if password, ok := auth.SessionPassword(); ok {
+		pairs = append(pairs, password, redacted)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// environment describes the local machine and the versions of the tools the connection goes through.
+func environment() string {
+	lines := []string{
+		"Created: " + time.Now().Format(time.RFC3339),
+		fmt.Sprintf("OS: %s/%s", runtime.GOOS, runtime.GOARCH),
+		"Go: " + runtime.Version(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		lines = append(lines, "CLI: "+info.Main.Version)
+	}
+	if ssh.IsWSL() {
+		lines = append(lines, "WSL: yes")
+	}
+
+	// ssh prints its version to stderr
+	if out, err := exec.Command("ssh", "-V").CombinedOutput(); err == nil {
+		lines = append(lines, "ssh: "+strings.TrimSpace(string(out)))
+	} else {
+		lines = append(lines, fmt.Sprintf("ssh: %s", err))
+	}
+
+	versions := vscode.Versions()
+	for _, name := range slices.Sorted(maps.Keys(versions)) {
+		lines = append(lines, fmt.Sprintf("%s: %s", name, versions[name]))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// tail returns the end of the file, at most maxLogSize bytes of it.
+func tail(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxLogSize {
+		if _, err := file.Seek(-maxLogSize, io.SeekEnd); err != nil {
+			return "", err
+		}
+	}
+	content, err := io.ReadAll(file)
+	return string(content), err
+}
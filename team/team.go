@@ -0,0 +1,115 @@
+package team
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the config committed to the project repo, shared by everyone debugging its builds.
+const FileName = ".bitrise-remote.yml"
+
+// Config is the team-shared remote debugging setup of a project.
+type Config struct {
+	// IDE is used by the auto command instead of detecting the installed editors
+	IDE string `yaml:"ide"`
+	// OpenPath is opened instead of the source directory, relative to it, eg. packages/app in a monorepo
+	OpenPath   string   `yaml:"open_path"`
+	Extensions []string `yaml:"extensions"`
+	// IncompatibleRemoteSSH lists the Remote - SSH versions found to break the connection, they are offered to be
+	// replaced with the pinned release. It's the only source of the versions, the CLI has no built-in list
+	IncompatibleRemoteSSH []string `yaml:"incompatible_remote_ssh"`
+	// Forwards are local port forwards, eg. 8080 or 8080:localhost:3000
+	Forwards []string `yaml:"forwards"`
+	Hooks    Hooks    `yaml:"hooks"`
+	Adaptive Adaptive `yaml:"adaptive"`
+	Metrics  Metrics  `yaml:"metrics"`
+
+	// Path is where the config was read from
+	Path string `yaml:"-"`
+}
+
+// Hooks are shell commands run on the local machine, from the directory of the config file.
+type Hooks struct {
+	BeforeConnect []string `yaml:"before_connect"`
+	AfterOpen     []string `yaml:"after_open"`
+}
+
+// Adaptive sets the round-trip times the setup adapts to a slow link at, eg. 250ms.
+type Adaptive struct {
+	Disabled bool `yaml:"disabled"`
+	// SlowRTT turns on compression
+	SlowRTT time.Duration `yaml:"slow_rtt"`
+	// VerySlowRTT also skips the optional steps, like installing extensions on the remote
+	VerySlowRTT time.Duration `yaml:"very_slow_rtt"`
+}
+
+// Metrics sets where the timings of the setup phases are exported, the flags of the same name take precedence.
+type Metrics struct {
+	// File gets a JSON line per connect, or the Prometheus text format if it ends with .prom
+	File string `yaml:"file"`
+	// OTLPEndpoint is the OTLP/HTTP endpoint of an OpenTelemetry collector, eg. http://localhost:4318
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+}
+
+// Load looks for the config in the working directory and its parents up to the repo root.
+// It returns nil without an error if the project has no config.
+func Load() (*Config, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("get working directory: %w", err)
+	}
+
+	for {
+		path := filepath.Join(dir, FileName)
+		content, err := os.ReadFile(path)
+		if err == nil {
+			var config Config
+			if err := yaml.Unmarshal(content, &config); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", path, err)
+			}
+			config.Path = path
+			return &config, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return nil, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// RunHooks runs the commands one by one, stopping at the first failure.
+// env is added to the environment of the commands, eg. the SSH host.
+func (c *Config) RunHooks(commands []string, env []string) error {
+	for _, command := range commands {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/c", command)
+		} else {
+			cmd = exec.Command("sh", "-c", command)
+		}
+		cmd.Dir = filepath.Dir(c.Path)
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("run hook %q: %w", command, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/desktop"
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/progress"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
+	"github.com/urfave/cli/v3"
+)
+
+func transferCommand(name, usage, arguments string) *cli.Command {
+	return &cli.Command{
+		Name:      name,
+		Usage:     usage,
+		UsageText: fmt.Sprintf("%s %s %s", cliName, name, arguments),
+		Action:    transfer,
+		Flags: []cli.Flag{
+			sessionPasswordCLIFlag,
+			&cli.BoolFlag{
+				Name:  resumeFlag,
+				Usage: "Continue the files that were partially copied by an interrupted transfer",
+			},
+			&cli.BoolFlag{
+				Name:  verifyFlag,
+				Usage: "Compare the SHA-256 checksums of the copied files on both sides",
+			},
+			&cli.IntFlag{
+				Name:  concurrencyFlag,
+				Usage: "Number of files copied at the same time",
+				Value: ssh.DefaultTransferConcurrency,
+			},
+			&cli.IntFlag{
+				Name:  retriesFlag,
+				Usage: "Number of times a failed file is tried again, 0 disables retrying",
+				Value: ssh.DefaultTransferRetries,
+			},
+			configDirCLIFlag,
+			jsonCLIFlag,
+		},
+	}
+}
+
+func grabCommandFor(kind, usage string) *cli.Command {
+	return &cli.Command{
+		Name:      kind,
+		Usage:     usage,
+		UsageText: fmt.Sprintf("%s %s %s [<LOCAL_DIR>] [--%s]", cliName, grabCommand, kind, openFlag),
+		Action:    grab,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  openFlag,
+				Usage: "Open the download when it's ready, eg. the test results in Xcode",
+			},
+			sessionPasswordCLIFlag,
+			configDirCLIFlag,
+			jsonCLIFlag,
+		},
+	}
+}
+
+// grab downloads the artifact named by the subcommand into the given directory, the working directory by default.
+func grab(ctx context.Context, cliCmd *cli.Command) error {
+	jsonOutput = cliCmd.Bool(jsonFlag)
+	if jsonOutput {
+		progress.SetSinks(progress.NewJSONSink(os.Stdout))
+	}
+
+	localDir := cliCmd.Args().First()
+	if localDir == "" {
+		localDir = "."
+	}
+
+	localPath, err := ssh.Grab(cliCmd.Name, localDir, passwordFlag(cliCmd))
+	if err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+	logger.Successf("Downloaded to %s", localPath)
+
+	if cliCmd.Name == ssh.GrabXCResult {
+		logger.Infof("Inspect it with `xcrun xcresulttool get test-results summary --path %s`", localPath)
+	}
+	if cliCmd.Bool(openFlag) {
+		if runtime.GOOS != "darwin" {
+			logger.Warnf("--%s needs macOS, open %s manually", openFlag, localPath)
+			return nil
+		}
+		if err := exec.Command("open", localPath).Run(); err != nil {
+			logger.Warnf("open %s: %s", localPath, err)
+		}
+	}
+	return nil
+}
+
+// screenshot downloads a capture of the VM's screen, to a timestamped file in the working directory by default.
+func screenshot(ctx context.Context, cliCmd *cli.Command) error {
+	localPath := cliCmd.Args().First()
+	if localPath == "" {
+		localPath = fmt.Sprintf("bitrise-vm-%s.png", time.Now().Format("20060102-150405"))
+	}
+
+	logger.Info("Capturing the screen of the VM...")
+	if err := ssh.Screenshot(localPath, passwordFlag(cliCmd)); err != nil {
+		return failure.Default(failure.RemoteSetup, err)
+	}
+	logger.Successf("Screenshot saved to %s", localPath)
+
+	if cliCmd.Bool(openFlag) {
+		if err := desktop.Open(localPath); err != nil {
+			logger.Warnf("open %s: %s", localPath, err)
+		}
+	}
+	return nil
+}
+
+// transfer runs push, pull and sync, the remote paths are relative to the home directory of the VM's user.
+func transfer(ctx context.Context, cliCmd *cli.Command) error {
+	jsonOutput = cliCmd.Bool(jsonFlag)
+	if jsonOutput {
+		progress.SetSinks(progress.NewJSONSink(os.Stdout))
+	}
+
+	if cliCmd.Args().Len() != 2 {
+		_ = cli.ShowSubcommandHelp(cliCmd)
+		return failure.New(failure.Config, fmt.Errorf("%s needs a source and a destination path", cliCmd.Name))
+	}
+	src, dst := cliCmd.Args().Get(0), cliCmd.Args().Get(1)
+
+	password := passwordFlag(cliCmd)
+
+	options := ssh.TransferOptions{
+		Resume:      cliCmd.Bool(resumeFlag),
+		Verify:      cliCmd.Bool(verifyFlag),
+		Concurrency: int(cliCmd.Int(concurrencyFlag)),
+		Retries:     int(cliCmd.Int(retriesFlag)),
+	}
+	if options.Retries == 0 {
+		// TransferOptions treats zero as the default
+		options.Retries = -1
+	}
+
+	var err error
+	switch cliCmd.Name {
+	case pushCommand:
+		err = ssh.Push(src, dst, password, options)
+	case pullCommand:
+		err = ssh.Pull(src, dst, password, options)
+	case syncCommand:
+		options.OnlyChanged = true
+		err = ssh.Push(src, dst, password, options)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Successf("%s finished", cliCmd.Name)
+	return nil
+}
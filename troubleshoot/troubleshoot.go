@@ -0,0 +1,97 @@
+package troubleshoot
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/desktop"
+	"github.com/bitrise-io/bitrise-remote-access-cli/failure"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+)
+
+const buildsURL = "https://app.bitrise.io/dashboard/builds"
+
+// diagnosis is a known cause of a failure with the checks that help the user to resolve it.
+type diagnosis struct {
+	matches func(err error) bool
+	title   string
+	checks  []string
+}
+
+var diagnoses = []diagnosis{
+	{
+		matches: func(err error) bool {
+			var dnsErr *net.DNSError
+			return errors.As(err, &dnsErr) || strings.Contains(err.Error(), "invalid host")
+		},
+		title: "The hostname could not be resolved",
+		checks: []string{
+			"Is the --host argument copied correctly from the build page?",
+			"Does your network block DNS lookups (eg. a VPN or captive portal)?",
+		},
+	},
+	{
+		matches: func(err error) bool {
+			return failure.CategoryOf(err) == failure.Network && strings.Contains(err.Error(), "connection refused")
+		},
+		title: "The VM refused the connection",
+		checks: []string{
+			"Is the build still running? Remote access is available until 10 minutes after the build finishes.",
+			"Is the --port argument right? Every build gets a different port.",
+			"Was the build started with \"Rebuild with Remote Access\"?",
+		},
+	},
+	{
+		matches: func(err error) bool {
+			return failure.CategoryOf(err) == failure.Network
+		},
+		title: "The VM is not reachable",
+		checks: []string{
+			"Is the build still running? Remote access is available until 10 minutes after the build finishes.",
+			"Are the --host and --port arguments from the same build?",
+			"Does your network or firewall allow outgoing SSH connections to non-standard ports?",
+		},
+	},
+	{
+		matches: func(err error) bool {
+			return failure.CategoryOf(err) == failure.Auth
+		},
+		title: "The VM rejected the credentials",
+		checks: []string{
+			"Is the --password argument from the same build as the host and port? Every rebuild gets a new password.",
+			"Did the build restart the remote access step? It sets a new password, switch the session to it with the refresh command.",
+			"Is the --user argument right?",
+		},
+	},
+}
+
+// Run prints the checks for the known causes of the error and offers to open the builds page,
+// where the build's status and connection parameters can be verified.
+func Run(err error) {
+	for _, diagnosis := range diagnoses {
+		if !diagnosis.matches(err) {
+			continue
+		}
+
+		var body strings.Builder
+		for _, check := range diagnosis.checks {
+			fmt.Fprintf(&body, "• %s\n", check)
+		}
+		logger.PrintFormattedOutput(diagnosis.title, strings.TrimSuffix(body.String(), "\n"))
+
+		confirm, confirmErr := logger.Confirm("Would you like to open your Bitrise builds in the browser?", "", "")
+		if confirmErr == nil && confirm {
+			if err := OpenBrowser(buildsURL); err != nil {
+				logger.Warnf("open browser: %s", err)
+			}
+		}
+		return
+	}
+}
+
+// OpenBrowser opens the URL with the default browser of the OS.
+func OpenBrowser(url string) error {
+	return desktop.Open(url)
+}
@@ -1,13 +1,22 @@
 package vscode
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bitrise-io/bitrise-remote-access-cli/ide"
+	"github.com/bitrise-io/bitrise-remote-access-cli/interrupt"
 	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+	"github.com/bitrise-io/bitrise-remote-access-cli/ssh"
 )
 
 const (
@@ -15,19 +24,50 @@ const (
 	ideName                = "Visual Studio Code"
 	sshExtensionIdentifier = "ms-vscode-remote.remote-ssh"
 	sshExtensionName       = "Remote - SSH"
-	codePathMac            = "/Applications/Visual Studio Code.app/Contents/Resources/app/bin/code"
-	urlInstallVSCode       = "https://code.visualstudio.com/docs/setup/setup-overview"
-	urlAddVSCodeToPath     = "https://code.visualstudio.com/docs/setup/mac#_launch-vs-code-from-the-command-line"
+	// sshExtensionPinnedVersion is a release known to work with the generated SSH config
+	sshExtensionPinnedVersion = "0.113.1"
+	codePathMac               = "/Applications/Visual Studio Code.app/Contents/Resources/app/bin/code"
+	urlInstallVSCode          = "https://code.visualstudio.com/docs/setup/setup-overview"
+	urlAddVSCodeToPath        = "https://code.visualstudio.com/docs/setup/mac#_launch-vs-code-from-the-command-line"
+
+	// serverStartTimeout is how long the window gets to connect, including the server download on the VM
+	serverStartTimeout = 3 * time.Minute
 )
 
+// Server is the VS Code server Remote - SSH starts on the VM, its older releases log to
+// ~/.vscode-server/.<commit>.log and the newer ones to the server dir
+var Server = ssh.IDEServer{
+	Name:           "VS Code server",
+	ProcessPattern: ".vscode-server",
+	InstallDir:     ".vscode-server",
+	LogGlobs:       []string{".vscode-server/.*.log", ".vscode-server/cli/servers/*/log.txt"},
+}
+
+// incompatibleSSHExtensionVersions lists the Remote - SSH releases that break with the generated SSH config. They
+// only come from the team config, the CLI ships no list of its own.
+var incompatibleSSHExtensionVersions []string
+
+// AddIncompatibleSSHExtensionVersions marks more Remote - SSH releases as breaking the connection, eg. the ones of
+// the team config.
+func AddIncompatibleSSHExtensionVersions(versions ...string) {
+	incompatibleSSHExtensionVersions = append(incompatibleSSHExtensionVersions, versions...)
+}
+
 var IdeData = ide.IDE{
 	Identifier: ideIdentifier,
 	Name:       ideName,
 	Aliases:    []string{"code"},
+	Capabilities: ide.Capabilities{
+		KeyAuth:          true,
+		PasswordPaste:    true,
+		FolderURI:        true,
+		ExtensionInstall: true,
+		Goto:             true,
+	},
 	OnOpen:     openInVSCode,
 	OnTestPath: isVSCodeInstalled}
 
-func openInVSCode(hostPattern, folderPath, additionalInfo string) error {
+func openInVSCode(hostPattern, folderPath, additionalInfo string, options ide.OpenOptions) error {
 	codePath, installed := isVSCodeInstalled()
 	if !installed {
 		logger.Infof(`
@@ -41,7 +81,11 @@ Please visit the following sites for more info:
 		return fmt.Errorf("%s CLI not found in $PATH", ideIdentifier)
 	}
 
-	if !prepareSSHExtension() {
+	if runtime.GOOS == "windows" {
+		checkWindowsSSHClient()
+	}
+
+	if !prepareSSHExtension(codePath, options.Offline) {
 		logger.Info("Ending session...")
 		return fmt.Errorf("%s does not have the necessary extensions installed", ideName)
 	}
@@ -55,17 +99,135 @@ Please visit the following sites for more info:
 
 	openPath := fmt.Sprintf("--folder-uri=vscode-remote://ssh-remote+%s%s/", hostPattern, folderPath)
 
-	cmd := exec.Command(codePath, openPath)
+	args := []string{openPath}
+	if options.ReuseWindow {
+		args = append(args, "--reuse-window")
+	} else if options.NewWindow {
+		args = append(args, "--new-window")
+	}
+	// Both only take effect when code starts a new instance, a running one keeps its own
+	if options.DisableWorkspaceTrust {
+		args = append(args, "--disable-workspace-trust")
+	}
+	if options.DisableTelemetry {
+		args = append(args, "--disable-telemetry")
+	}
+
+	cmd := interrupt.Command(codePath, args...)
 
 	err := cmd.Run()
 	if err != nil {
 		return fmt.Errorf("open %s window: %w", ideName, err)
 	}
 
+	if !options.SkipVerify {
+		if err := waitForServer(hostPattern, options.Password); err != nil {
+			return err
+		}
+	}
+
+	// The location is opened last so its tab is the active one
+	files := slices.Clone(options.ContextFiles)
+	if options.Goto != nil {
+		files = append(files, options.Goto.String())
+	}
+	if len(files) > 0 {
+		openContextFiles(codePath, hostPattern, files)
+	}
+
+	if len(options.RemoteExtensions) > 0 {
+		if options.Offline {
+			logger.Warnf("Offline mode: not installing extensions on remote: %s", strings.Join(options.RemoteExtensions, ", "))
+		} else {
+			installRemoteExtensions(codePath, hostPattern, options.RemoteExtensions)
+		}
+	}
+
 	return nil
 }
 
+// waitForServer waits for the window to connect, code returns as soon as the window opens and Remote - SSH only
+// reports its failures in the window.
+func waitForServer(hostPattern string, password *string) error {
+	logger.Infof("Waiting for %s to connect to the VM...", ideName)
+
+	err := ssh.WaitForIDEServer(Server, password, serverStartTimeout)
+	var serverErr ssh.IDEServerErr
+	switch {
+	case err == nil:
+		logger.Successf("%s connected", ideName)
+		return nil
+	case errors.As(err, &serverErr) && serverErr.Connected:
+		if serverErr.Log != "" {
+			logger.PrintFormattedOutput(fmt.Sprintf("Last lines of the %s log", Server.Name), strings.TrimRight(serverErr.Log, "\n"))
+		}
+		return fmt.Errorf("%w: the VM might not reach the VS Code download servers, reload the window to retry", err)
+	case errors.As(err, &serverErr):
+		return fmt.Errorf("%w: see the %s output of the window (View > Output > %s), eg. whether the key was rejected; `ssh %s` uses the same config", err, sshExtensionName, sshExtensionName, hostPattern)
+	default:
+		// The window might still connect, only the check failed
+		logger.Warnf("check the %s connection: %s", ideName, err)
+		return nil
+	}
+}
+
+// installRemoteExtensions installs the extensions into the VS Code server of the remote host.
+// Failures are only reported, the extensions can still be installed from the opened window.
+func installRemoteExtensions(codePath, hostPattern string, extensions []string) {
+	remote := fmt.Sprintf("ssh-remote+%s", hostPattern)
+	for _, extension := range extensions {
+		extension = strings.TrimSpace(extension)
+		if extension == "" {
+			continue
+		}
+
+		logger.Infof("Installing %s extension on remote...", extension)
+		cmd := interrupt.Command(codePath, "--remote", remote, "--install-extension", extension)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			logger.Warnf("install %s extension on remote: %s\n%s", extension, err, out)
+		} else {
+			logger.Successf("%s extension installed on remote", extension)
+		}
+	}
+}
+
+// openContextFiles opens the remote files as tabs of the window just opened, a file can be given as path:line:col.
+// Failures are only reported, the files can still be opened from the window.
+func openContextFiles(codePath, hostPattern string, files []string) {
+	args := append([]string{"--reuse-window", "--remote", fmt.Sprintf("ssh-remote+%s", hostPattern), "--goto"}, files...)
+
+	if out, err := interrupt.Command(codePath, args...).CombinedOutput(); err != nil {
+		logger.Warnf("open %s: %s\n%s", strings.Join(files, ", "), err, out)
+	}
+}
+
+// Versions returns the versions of VS Code and Remote - SSH, the ones that aren't installed are left out.
+func Versions() map[string]string {
+	versions := map[string]string{}
+	codePath, installed := isVSCodeInstalled()
+	if !installed {
+		return versions
+	}
+	// The first line is the version, the next ones the commit and the architecture
+	if out, err := interrupt.Command(codePath, "--version").Output(); err == nil {
+		version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		versions[ideName] = version
+	}
+	if version, installed := sshExtensionVersion(codePath); installed {
+		versions[sshExtensionName] = version
+	}
+	return versions
+}
+
 func isVSCodeInstalled() (string, bool) {
+	if ssh.HasWindowsMirror() {
+		// The `code` shell script would open the folder in a WSL remote window,
+		// the Windows binary is needed to connect with the mirrored entry from Windows directly.
+		// Without the mirror only the WSL side has the entry, so the WSL `code` is used.
+		codePath, err := exec.LookPath("code.exe")
+		return codePath, err == nil
+	}
+
 	codePath, err := exec.LookPath("code")
 	if err == nil {
 		return codePath, true
@@ -75,23 +237,70 @@ func isVSCodeInstalled() (string, bool) {
 	return codePathMac, err == nil
 }
 
-func isSSHExtensionInstalled() bool {
-	cmd := exec.Command("code", "--list-extensions")
+func isSSHExtensionInstalled(codePath string) bool {
+	_, installed := sshExtensionVersion(codePath)
+	return installed
+}
+
+// sshExtensionVersion returns the installed version of the Remote - SSH extension.
+func sshExtensionVersion(codePath string) (string, bool) {
+	cmd := interrupt.Command(codePath, "--list-extensions", "--show-versions")
 	out, err := cmd.Output()
 	if err != nil {
-		return false
+		return "", false
 	}
 
-	if strings.Contains(string(out), sshExtensionIdentifier) {
-		return true
+	// Lines are in the format of publisher.extension@version
+	for _, line := range strings.Split(string(out), "\n") {
+		identifier, version, _ := strings.Cut(strings.TrimSpace(line), "@")
+		if strings.EqualFold(identifier, sshExtensionIdentifier) {
+			return version, true
+		}
+	}
+
+	return "", false
+}
+
+// ensureCompatibleSSHExtension offers to replace a Remote - SSH release known to break with the pinned one.
+// Declining only results in a warning, the connection might still work.
+func ensureCompatibleSSHExtension(codePath string, offline bool) {
+	version, _ := sshExtensionVersion(codePath)
+	if !slices.Contains(incompatibleSSHExtensionVersions, version) {
+		return
+	}
+
+	if offline {
+		logger.Warnf("%s %s is known to break the connection, but it can't be replaced in offline mode", sshExtensionName, version)
+		return
+	}
+
+	confirm, err := logger.Confirm(
+		fmt.Sprintf("The installed \"%s\" extension version %s is known to break the connection\nWould you like to install version %s instead?", sshExtensionName, version, sshExtensionPinnedVersion),
+		"Installing extensions...",
+		"")
+	if err != nil || !confirm {
+		logger.Warnf("Continuing with %s %s, the connection might fail", sshExtensionName, version)
+		return
 	}
 
-	return false
+	pinned := fmt.Sprintf("%s@%s", sshExtensionIdentifier, sshExtensionPinnedVersion)
+	cmd := interrupt.Command(codePath, "--install-extension", pinned, "--force")
+	if out, err := cmd.Output(); err != nil {
+		logger.PrintFormattedOutput("Install extensions", fmt.Sprintf("install %s extension\nreason: %s\n\noutput:\n%s\n", pinned, err, out))
+		return
+	}
+	logger.Successf("%s %s installed", sshExtensionName, sshExtensionPinnedVersion)
+	// VS Code would update the extension back to the latest release on its next check
+	logger.Warnf("Turn off Auto Update for %s (right-click it in the Extensions view), or VS Code replaces %s with the latest release again", sshExtensionName, sshExtensionPinnedVersion)
 }
 
-func prepareSSHExtension() bool {
-	if isSSHExtensionInstalled() {
+func prepareSSHExtension(codePath string, offline bool) bool {
+	if isSSHExtensionInstalled(codePath) {
+		ensureCompatibleSSHExtension(codePath, offline)
 		return true
+	} else if offline {
+		logger.Warnf("%s does not have the necessary \"%s\" extension installed and it can't be installed in offline mode", ideName, sshExtensionName)
+		return false
 	} else {
 		confirm, err := logger.Confirm(
 			fmt.Sprintf("%s does not have the necessary \"%s\" extension installed\nWould you like to install it?", ideName, sshExtensionName),
@@ -101,12 +310,52 @@ func prepareSSHExtension() bool {
 			return false
 		}
 
-		cmd := exec.Command("code", "--install-extension", sshExtensionIdentifier)
+		cmd := interrupt.Command(codePath, "--install-extension", sshExtensionIdentifier)
 
 		if out, err := cmd.Output(); err != nil {
 			logger.PrintFormattedOutput("Install extensions", fmt.Sprintf("install %s extension\nreason: %s\n\noutput:\n%s\n", sshExtensionIdentifier, err, out))
 			return false
 		}
-		return isSSHExtensionInstalled()
+		return isSSHExtensionInstalled(codePath)
+	}
+}
+
+// sshPathSettingPattern matches the remote.SSH.path user setting, settings.json may have comments so it's not decoded
+var sshPathSettingPattern = regexp.MustCompile(`"remote\.SSH\.path"\s*:\s*("(?:[^"\\]|\\.)*")`)
+
+// checkWindowsSSHClient warns if Remote - SSH will run an ssh client that may not understand the generated config,
+// or none at all. It doesn't stop the connection, the client may still work.
+func checkWindowsSSHClient() {
+	if path := sshPathSetting(); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			logger.Warnf("%s is set to use %s in remote.SSH.path, but it's not found: %s", sshExtensionName, path, err)
+		}
+		return
+	}
+
+	path, err := ssh.FindOpenSSH()
+	if err != nil {
+		logger.Warnf("%s may fail to connect: %s", sshExtensionName, err)
+		return
+	}
+	if !ssh.IsWindowsOpenSSH(path) {
+		logger.Warnf("The Windows OpenSSH client is not installed, %s uses %s, which may not understand the generated config\nIf the connection fails, install the \"OpenSSH Client\" optional feature", sshExtensionName, path)
+	}
+}
+
+// sshPathSetting returns the ssh client set in the user's VS Code settings.
+func sshPathSetting() string {
+	content, err := os.ReadFile(filepath.Join(os.Getenv("APPDATA"), "Code", "User", "settings.json"))
+	if err != nil {
+		return ""
+	}
+	match := sshPathSettingPattern.FindSubmatch(content)
+	if match == nil {
+		return ""
+	}
+	path, err := strconv.Unquote(string(match[1]))
+	if err != nil {
+		return ""
 	}
+	return path
 }
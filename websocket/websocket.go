@@ -0,0 +1,279 @@
+// Package websocket is a minimal WebSocket client, enough to carry a byte stream such as an SSH connection
+// in binary messages through networks that only let HTTPS out.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// acceptGUID is appended to the key of the handshake to compute the accept value, see RFC 6455 section 1.3
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+
+	finBit  = 0x80
+	maskBit = 0x80
+)
+
+// Conn is a WebSocket connection read and written as a byte stream, every write is sent as a binary message.
+type Conn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	readMu    sync.Mutex
+	remaining uint64
+	mask      []byte
+	maskPos   int
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// Dial opens a WebSocket connection to the ws, wss, http or https URL.
+func Dial(ctx context.Context, rawURL string) (*Conn, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse URL: %w", err)
+	}
+
+	secure := false
+	defaultPort := "80"
+	switch target.Scheme {
+	case "ws", "http":
+	case "wss", "https":
+		secure, defaultPort = true, "443"
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q, expected wss or https", target.Scheme)
+	}
+	address := target.Host
+	if target.Port() == "" {
+		address = net.JoinHostPort(target.Hostname(), defaultPort)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if secure {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: target.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	reader, err := handshake(conn, target)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	return &Conn{Conn: conn, reader: reader}, nil
+}
+
+// handshake upgrades the HTTP connection, the returned reader holds what the server sent after the response.
+func handshake(conn net.Conn, target *url.URL) (*bufio.Reader, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	request := &http.Request{
+		Method:     http.MethodGet,
+		URL:        target,
+		Host:       target.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if err := request.Write(conn); err != nil {
+		return nil, fmt.Errorf("send handshake: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return nil, fmt.Errorf("read handshake response: %w", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("handshake rejected: %s", response.Status)
+	}
+
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	if response.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return nil, fmt.Errorf("handshake rejected: invalid accept key")
+	}
+	return reader, nil
+}
+
+// Read returns the payload of the data messages, control messages are answered in between.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.reader.Read(p)
+	c.unmask(p[:n])
+	c.remaining -= uint64(n)
+	return n, err
+}
+
+// nextFrame reads the header of the next frame, control frames are handled here and leave remaining at zero.
+func (c *Conn) nextFrame() error {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return err
+	}
+	opcode := header[0] & 0x0F
+
+	length := uint64(header[1] &^ maskBit)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	// Servers don't mask their frames, but it costs nothing to accept them
+	c.mask, c.maskPos = nil, 0
+	if header[1]&maskBit != 0 {
+		c.mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.reader, c.mask); err != nil {
+			return err
+		}
+	}
+
+	switch opcode {
+	case opContinuation, opText, opBinary:
+		c.remaining = length
+		return nil
+	case opClose:
+		_ = c.writeFrame(opClose, nil)
+		return io.EOF
+	case opPing, opPong:
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, payload); err != nil {
+			return err
+		}
+		c.unmask(payload)
+		if opcode == opPing {
+			return c.writeFrame(opPong, payload)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected WebSocket opcode %d", opcode)
+	}
+}
+
+func (c *Conn) unmask(p []byte) {
+	if c.mask == nil {
+		return
+	}
+	for i := range p {
+		p[i] ^= c.mask[c.maskPos%4]
+		c.maskPos++
+	}
+}
+
+// Write sends p as a single binary message.
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame sends a masked frame, clients have to mask every frame they send.
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	frame := []byte{finBit | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := c.Conn.Write(frame)
+	if opcode == opClose {
+		c.closed = true
+	}
+	return err
+}
+
+// Close sends a close message and closes the connection without waiting for the answer.
+func (c *Conn) Close() error {
+	err := c.writeFrame(opClose, nil)
+	if closeErr := c.Conn.Close(); err == nil || errors.Is(err, net.ErrClosed) {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/i18n"
+	"github.com/bitrise-io/bitrise-remote-access-cli/logger"
+)
+
+// runWizard asks for the connection parameters that were not passed, so the command copied without them
+// still works. It returns the identifier of the IDE picked for the auto command, empty for other commands.
+func runWizard(parsedArgs map[string]string, command string) (string, error) {
+	logger.Info(i18n.T("Some connection parameters are missing, you can find them on the build's page under Remote Access"))
+
+	prompts := []struct {
+		flag, title, placeholder string
+		validate                 func(string) error
+	}{
+		{sshHostFlag, "Host", "eg. 1.2.3.4", validateHost},
+		{sshPortFlag, "Port", "eg. 22", validatePort},
+		{sshUserFlag, "User", "eg. vagrant", validateNotEmpty},
+	}
+	for _, prompt := range prompts {
+		if parsedArgs[prompt.flag] != "" {
+			continue
+		}
+		value, err := logger.Input(i18n.T(prompt.title), prompt.placeholder, prompt.validate)
+		if err != nil {
+			return "", fmt.Errorf("ask for %s: %w", prompt.flag, err)
+		}
+		parsedArgs[prompt.flag] = strings.TrimSpace(value)
+	}
+
+	if _, set := parsedArgs[sshPasswordFlag]; !set {
+		password, err := logger.Password(i18n.T("Password"))
+		if err != nil {
+			return "", fmt.Errorf("ask for password: %w", err)
+		}
+		if password != "" {
+			parsedArgs[sshPasswordFlag] = password
+		}
+	}
+
+	if command != autoCommand {
+		return "", nil
+	}
+
+	var identifiers, names []string
+	for _, ide := range supportedIDEs {
+		if ide.SupportsCurrentPlatform() {
+			identifiers = append(identifiers, ide.Identifier)
+			names = append(names, ide.Name)
+		}
+	}
+	if len(identifiers) == 0 {
+		return "", nil
+	}
+	choice, err := logger.Choose(i18n.T("Editor"), names)
+	if err != nil {
+		return "", fmt.Errorf("ask for editor: %w", err)
+	}
+	return identifiers[choice], nil
+}
+
+// needsWizard reports whether a connection parameter is missing and can be asked for.
+func needsWizard(parsedArgs map[string]string) bool {
+	if jsonOutput || !logger.IsInteractive() {
+		return false
+	}
+	return parsedArgs[sshHostFlag] == "" || parsedArgs[sshPortFlag] == "" || parsedArgs[sshUserFlag] == ""
+}
+
+func validateHost(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("host cannot be empty")
+	}
+	if strings.ContainsAny(value, " @/") {
+		return fmt.Errorf("expected a hostname or an IP address")
+	}
+	return nil
+}
+
+func validatePort(value string) error {
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("expected a number between 1 and 65535")
+	}
+	return nil
+}
+
+func validateNotEmpty(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("cannot be empty")
+	}
+	return nil
+}
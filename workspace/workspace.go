@@ -0,0 +1,111 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/bitrise-io/bitrise-remote-access-cli/paths"
+)
+
+const (
+	stateFileName = "workspaces.json"
+	// Remote access is only available while the build runs and a few minutes after,
+	// older entries belong to VMs that are gone.
+	maxAge = 24 * time.Hour
+)
+
+// Entry is the workspace that was opened for a build's VM.
+type Entry struct {
+	Host     string    `json:"host"`
+	Port     string    `json:"port"`
+	Folder   string    `json:"folder"`
+	IDEs     []string  `json:"ides"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+// Load returns the workspace opened for the host earlier, if any.
+func Load(host, port string) (Entry, bool) {
+	entries, err := read()
+	if err != nil {
+		return Entry{}, false
+	}
+
+	for _, entry := range entries {
+		if entry.Host == host && entry.Port == port {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Save records the workspace of the host, replacing the earlier one and dropping expired entries.
+func Save(entry Entry) error {
+	entries, err := read()
+	if err != nil {
+		entries = nil
+	}
+
+	entry.OpenedAt = time.Now()
+	kept := []Entry{entry}
+	for _, existing := range entries {
+		if existing.Host == entry.Host && existing.Port == entry.Port {
+			continue
+		}
+		if time.Since(existing.OpenedAt) > maxAge {
+			continue
+		}
+		kept = append(kept, existing)
+	}
+
+	content, err := json.MarshalIndent(kept, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode workspaces: %w", err)
+	}
+
+	path := statePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// Recent returns the workspaces of the VMs that might still be around, the most recently opened first.
+func Recent() ([]Entry, error) {
+	entries, err := read()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(entries, func(a, b Entry) int { return b.OpenedAt.Compare(a.OpenedAt) })
+	return entries, nil
+}
+
+func read() ([]Entry, error) {
+	content, err := os.ReadFile(statePath())
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, err
+	}
+
+	var valid []Entry
+	for _, entry := range entries {
+		if time.Since(entry.OpenedAt) <= maxAge {
+			valid = append(valid, entry)
+		}
+	}
+	return valid, nil
+}
+
+func statePath() string {
+	return filepath.Join(paths.StateDir(), stateFileName)
+}